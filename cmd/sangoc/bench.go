@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/driver"
+	"github.com/rxxuzi/sango/pkg/sangotest"
+)
+
+// benchCommand implements sangoc bench, which runs the bench declarations
+// of the given files, of the .sango files in the given directories, or of
+// the modules of the project in the current directory, and compares them
+// with a baseline
+func benchCommand(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	run := flags.String("run", "", "Run only the benchmarks whose names match the regular expression")
+	benchtime := flags.Duration("benchtime", sangotest.DefaultBenchTime, "Run each round of a benchmark for at least this long")
+	count := flags.Int("count", sangotest.DefaultRounds, "Rounds to run each benchmark for")
+	baseline := flags.String("baseline", "", "Compare the results with the baseline in this file")
+	save := flags.String("save", "", "Save the results as the baseline in this file")
+	threshold := flags.Float64("threshold", 10, "Report a regression when a benchmark is this many percent slower in its median and fastest rounds, or allocates more")
+	timeout := flags.Duration("timeout", sangotest.DefaultTimeout, "Fail a benchmark whose round runs this much longer than -benchtime")
+	cc := flags.String("cc", "cc", "C compiler to compile the benchmarks with")
+	runtime := flags.String("runtime", "", "Directory holding sango.c and sango.h (default $SANGO_RUNTIME, runtime/ next to the sangoc bin/ directory, or runtime/ in a parent directory)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc bench [-run regexp] [-benchtime d] [-count n] [-baseline file] [-save file] [-threshold pct] [-timeout d] [-cc cc] [-runtime dir] [file.sango|dir]...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	opts := sangotest.BenchOptions{Time: *benchtime, Rounds: *count, Timeout: *timeout, CC: *cc, Runtime: *runtime}
+	if opts.Runtime == "" {
+		var err error
+		if opts.Runtime, err = runtimeDir("."); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *run != "" {
+		var err error
+		if opts.Run, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -run: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	base := sangotest.Baseline{}
+	if *baseline != "" {
+		var err error
+		if base, err = sangotest.LoadBaseline(*baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	saved := sangotest.Baseline{}
+	if *save != "" {
+		var err error
+		if saved, err = sangotest.LoadBaseline(*save); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	files, err := testFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range files {
+		results, ok := benchFile(file, opts, base, *threshold)
+		if !ok {
+			failed = true
+		}
+		saved.Add(file, results)
+	}
+	if *save != "" {
+		if err := saved.Save(*save); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// benchFile runs the benchmarks of a file and reports whether they all ran
+// without regressing from the baseline
+func benchFile(file string, opts sangotest.BenchOptions, base sangotest.Baseline, threshold float64) ([]sangotest.BenchResult, bool) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+		return nil, false
+	}
+	unit, errors := driver.AnalyzeTests(string(source))
+	var benches []*ast.BenchStatement
+	if len(errors) == 0 {
+		benches, errors = sangotest.Benchmarks(unit.Program)
+	}
+	if len(errors) > 0 {
+		fmt.Fprintf(os.Stderr, "Errors in %s:\n", file)
+		for _, err := range errors {
+			fmt.Fprintf(os.Stderr, "  %s\n", err)
+		}
+		fmt.Printf("FAIL\t%s\n", file)
+		return nil, false
+	}
+
+	results, err := sangotest.Bench(unit.Program, benches, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Printf("FAIL\t%s\n", file)
+		return nil, false
+	}
+	if len(results) == 0 {
+		fmt.Printf("?   \t%s\t[no benchmarks to run]\n", file)
+		return results, true
+	}
+
+	width := 0
+	for _, r := range results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+	failures, regressions := 0, 0
+	for _, r := range results {
+		if r.Err != nil {
+			failures++
+			fmt.Printf("--- FAIL: %s\n", r.Name)
+			printFailure(file, r.Err, "    ")
+			continue
+		}
+		line := fmt.Sprintf("%-*s\t%10d\t%12.1f ns/op\t%12.1f min ns/op\t%8.2f allocs/op", width, r.Name, r.N, r.NsPerOp(), r.MinNsPerOp(), r.AllocsPerOp())
+		if change, ok := base.Compare(file, r); ok {
+			line += fmt.Sprintf("\t%s ns/op\t%s min ns/op\t%s allocs/op", signed(change.Time), signed(change.MinTime), signed(change.Allocs))
+			if change.Regressed(threshold) {
+				regressions++
+				line += "\tREGRESSION"
+			}
+		}
+		fmt.Println(line)
+	}
+
+	var problems []string
+	if failures > 0 {
+		problems = append(problems, fmt.Sprintf("%d of %d benchmarks failed", failures, len(results)))
+	}
+	if regressions > 0 {
+		problems = append(problems, fmt.Sprintf("%d regressed by more than %g%%", regressions, threshold))
+	}
+	if len(problems) > 0 {
+		fmt.Printf("FAIL\t%s\t%s\n", file, strings.Join(problems, ", "))
+		return results, false
+	}
+	fmt.Printf("ok  \t%s\t%d benchmarks run\n", file, len(results))
+	return results, true
+}
+
+// signed formats a change in percent with its sign
+func signed(pct float64) string {
+	return fmt.Sprintf("%+.1f%%", pct)
+}
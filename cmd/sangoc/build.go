@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/driver"
+	"github.com/rxxuzi/sango/pkg/project"
+)
+
+// buildCommand implements sangoc build, which builds the project whose
+// sango.toml is in the given directory or one of its parents
+func buildCommand(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "Print the C compiler commands and what was reused from the build cache")
+	jobs := flags.Int("j", 0, "Number of modules to compile at once (default the number of CPUs)")
+	runtime := flags.String("runtime", "", "Directory holding sango.c and sango.h (default $SANGO_RUNTIME, runtime/ next to the sangoc bin/ directory, or runtime/ in a parent directory)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc build [-v] [-j n] [-runtime dir] [dir]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	root, err := project.Find(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	m, err := project.Load(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *runtime == "" {
+		if *runtime, err = runtimeDir(m.Dir, "."); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	exe, err := driver.Build(m, driver.Options{Runtime: *runtime, Version: VERSION, Jobs: *jobs, Verbose: *verbose, Log: os.Stdout})
+	if err != nil {
+		if failed, ok := err.(driver.BuildError); ok {
+			fmt.Fprintf(os.Stderr, "Build errors:\n")
+			for _, m := range failed {
+				fmt.Fprintf(os.Stderr, "%s\n", m)
+			}
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Built %s\n", exe)
+}
+
+// runtimeDir returns $SANGO_RUNTIME, or the first directory holding
+// sango.c of: runtime/ next to the sangoc bin/ directory, where make build
+// puts it, and runtime/ in each of dirs or one of its parents, such as a
+// project or the source tree of sangoc
+func runtimeDir(dirs ...string) (string, error) {
+	if env := os.Getenv("SANGO_RUNTIME"); env != "" {
+		return env, nil
+	}
+	candidates := []string{}
+	if exe, err := os.Executable(); err == nil {
+		candidates = append(candidates, filepath.Join(filepath.Dir(exe), "..", "runtime"))
+	}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		for d := abs; ; d = filepath.Dir(d) {
+			candidates = append(candidates, filepath.Join(d, "runtime"))
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(filepath.Join(candidate, "sango.c")); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("runtime not found next to sangoc or in %s and their parents; set SANGO_RUNTIME or pass -runtime", strings.Join(dirs, ", "))
+}
+
+// newCommand implements sangoc new, which lays out a new project
+func newCommand(args []string) {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc new <name>\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	dir := flags.Arg(0)
+	m, err := project.New(dir, filepath.Base(dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created project %s in %s\n", m.Name, dir)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/doc"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+// docCommand implements sangoc doc, which renders the documentation of the
+// given files, or of the .sango files in the given directories
+func docCommand(args []string) {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	htmlFlag := flags.Bool("html", false, "Render a static HTML page instead of Markdown")
+	output := flags.String("o", "", "Write the documentation to a file instead of standard output")
+	name := flags.String("name", "", "Module name used as the title")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc doc [-html] [-o file] [-name name] <file.sango|dir>...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No input file specified\n")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	files := []string{}
+	for _, arg := range flags.Args() {
+		found, err := sourceFiles(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, found...)
+	}
+
+	if *name == "" {
+		*name = moduleName(flags.Arg(0))
+	}
+
+	programs := []*ast.Program{}
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		if errors := p.Errors(); len(errors) > 0 {
+			fmt.Fprintf(os.Stderr, "Parser errors in %s:\n", file)
+			for _, err := range errors {
+				fmt.Fprintf(os.Stderr, "  %s\n", err)
+			}
+			os.Exit(1)
+		}
+		programs = append(programs, program)
+	}
+
+	module := doc.New(*name, programs...)
+	text := module.Markdown()
+	if *htmlFlag {
+		text = module.HTML()
+	}
+
+	if *output == "" {
+		fmt.Print(text)
+		return
+	}
+	if err := ioutil.WriteFile(*output, []byte(text), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *output, err)
+		os.Exit(1)
+	}
+}
+
+// sourceFiles returns path if it is a .sango file, or the .sango files
+// directly inside it, sorted by name, if it is a directory
+func sourceFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("input '%s' does not exist", path)
+	}
+	if !info.IsDir() {
+		if filepath.Ext(path) != ".sango" {
+			return nil, fmt.Errorf("input file '%s' must have .sango extension", path)
+		}
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.sango"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .sango files in '%s'", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// moduleName names a module after its directory, or after its file
+func moduleName(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".sango")
+}
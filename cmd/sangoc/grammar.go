@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rxxuzi/sango/pkg/editor"
+)
+
+// genGrammarCommand implements sangoc gen-grammar, which writes the editor
+// grammars and the semantic tokens legend generated from the token tables
+func genGrammarCommand(args []string) {
+	flags := flag.NewFlagSet("gen-grammar", flag.ExitOnError)
+	output := flags.String("o", ".", "Directory to write the files to")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc gen-grammar [-o dir]\n")
+		fmt.Fprintf(os.Stderr, "Writes sango.tmLanguage.json, grammar.js and semantic-tokens-legend.json.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: Unexpected argument '%s'\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(*output, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"sango.tmLanguage.json", editor.TextMate()},
+		{"grammar.js", editor.TreeSitter()},
+		{"semantic-tokens-legend.json", editor.LegendJSON()},
+	}
+	for _, file := range files {
+		path := filepath.Join(*output, file.name)
+		if err := ioutil.WriteFile(path, file.data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+}
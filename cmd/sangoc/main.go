@@ -1,14 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/driver"
 	"github.com/rxxuzi/sango/pkg/lexer"
-	"github.com/rxxuzi/sango/pkg/parser"
 )
 
 const VERSION = "v0.1.8"
@@ -18,16 +21,44 @@ type CompileMode int
 const (
 	ModeLexOnly CompileMode = iota
 	ModeParseOnly
+	ModeEmitC
 )
 
 type Config struct {
 	mode        CompileMode
+	format      string // output format of -l and -p: text, json or tsv (-l only)
 	inputFile   string
 	showHelp    bool
 	showVersion bool
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "doc":
+			docCommand(os.Args[2:])
+			return
+		case "gen-grammar":
+			genGrammarCommand(os.Args[2:])
+			return
+		case "vet":
+			vetCommand(os.Args[2:])
+			return
+		case "test":
+			testCommand(os.Args[2:])
+			return
+		case "bench":
+			benchCommand(os.Args[2:])
+			return
+		case "build":
+			buildCommand(os.Args[2:])
+			return
+		case "new":
+			newCommand(os.Args[2:])
+			return
+		}
+	}
+
 	config := parseArgs()
 
 	if config.showVersion {
@@ -68,9 +99,11 @@ func main() {
 	// Execute compilation based on mode
 	switch config.mode {
 	case ModeLexOnly:
-		lexOnly(string(source), config.inputFile)
+		lexOnly(string(source), config.inputFile, config.format)
 	case ModeParseOnly:
-		parseOnly(string(source), config.inputFile)
+		parseOnly(string(source), config.inputFile, config.format)
+	case ModeEmitC:
+		emitC(string(source), config.inputFile)
 	}
 }
 
@@ -80,6 +113,8 @@ func parseArgs() Config {
 	// Define flags
 	lexFlag := flag.Bool("l", false, "Lexical analysis only - show tokens")
 	parseFlag := flag.Bool("p", false, "Parse only - show AST")
+	emitFlag := flag.Bool("c", false, "Emit C")
+	formatFlag := flag.String("format", "text", "Output format of -l and -p: text, json or tsv (-l only)")
 	versionFlag := flag.Bool("v", false, "Show version")
 	helpFlag := flag.Bool("h", false, "Show help")
 
@@ -87,6 +122,7 @@ func parseArgs() Config {
 
 	config.showHelp = *helpFlag
 	config.showVersion = *versionFlag
+	config.format = *formatFlag
 
 	// Determine mode
 	modeCount := 0
@@ -98,18 +134,31 @@ func parseArgs() Config {
 		config.mode = ModeParseOnly
 		modeCount++
 	}
+	if *emitFlag {
+		config.mode = ModeEmitC
+		modeCount++
+	}
 
 	if modeCount > 1 {
-		fmt.Fprintf(os.Stderr, "Error: Multiple modes specified. Use only one of -l or -p\n")
+		fmt.Fprintf(os.Stderr, "Error: Multiple modes specified. Use only one of -l, -p or -c\n")
 		os.Exit(1)
 	}
 
 	if modeCount == 0 && !config.showHelp && !config.showVersion {
-		fmt.Fprintf(os.Stderr, "Error: No mode specified. Use -l for lexing or -p for parsing\n")
+		fmt.Fprintf(os.Stderr, "Error: No mode specified. Use -l for lexing, -p for parsing or -c for C output\n")
 		showUsage()
 		os.Exit(1)
 	}
 
+	switch {
+	case config.format == "text":
+	case config.format == "json" && (*lexFlag || *parseFlag):
+	case config.format == "tsv" && *lexFlag:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown format '%s'. Use text, json or tsv with -l, and text or json with -p\n", config.format)
+		os.Exit(1)
+	}
+
 	// Get input file
 	args := flag.Args()
 	if len(args) > 0 {
@@ -129,59 +178,143 @@ func showHelp() {
 
 Usage:
   sangoc -l <file.sango>                 Lexical analysis only - show tokens
+  sangoc -l --format=json|tsv <file>     Lexical analysis only - write tokens as JSON or TSV
   sangoc -p <file.sango>                 Parse only - show AST
+  sangoc -p --format=json <file.sango>   Parse only - write the AST as JSON
+  sangoc -c <file.sango>                 Emit the C translation of a file
+  sangoc doc [-html] [-o file] <path>... Render documentation as Markdown or HTML
+  sangoc gen-grammar [-o dir]            Write editor grammars generated from the token tables
+  sangoc vet [-check[=false]] <path>...  Report suspicious code; -list shows the checks
+  sangoc test [-run re] [-v] [path]...   Run the test declarations
+  sangoc bench [-run re] [path]...       Run the bench declarations; -baseline compares
+  sangoc build [-v] [-j n] [dir]         Build the project described by sango.toml
+  sangoc new <name>                      Create a project with a sango.toml
   sangoc -v                              Show version
   sangoc -h                              Show this help
 
 Options:
   -l    Perform lexical analysis only and display tokens
   -p    Perform parsing only and display AST
+  -c    Emit the C translation: structs with layout assertions, functions,
+        globals, and a C main if the file has a def main
+  --format=json
+        With -l, write the tokens as a JSON array; with -p, write the AST
+        as JSON (see pkg/ast/schema.json)
+  --format=tsv
+        With -l, write the tokens as tab-separated values with a header
   -v    Display version information
   -h    Display this help message
 
 Examples:
   sangoc -l hello.sango                  # Show tokens
   sangoc -p hello.sango                  # Show AST
-
-Note: This is a development version focused on lexer and parser implementation.
-Type checking, code generation, and compilation are not yet implemented.
+  sangoc -c hello.sango > hello.c        # Generate C
+  sangoc doc -html -o lib.html lib/      # Document the files in lib/
+  sangoc gen-grammar -o editors/         # TextMate, tree-sitter and LSP legend
+  sangoc vet -shadow=false src/          # Run every check but shadow
+  sangoc new hello && sangoc build hello # Create and build a project
+  sangoc test -run '^sum' lib/           # Run the tests whose names start with sum
+  sangoc test -seed 42 lib/              # Check properties with the arguments of seed 42
+  sangoc bench -baseline b.json src/     # Flag regressions from a saved baseline
+
+Note: This is a development version. Code generation does not cover every
+construct yet and reports the ones it cannot translate.
 
 `, VERSION)
 }
 
 // Lexical analysis only
-func lexOnly(source, filename string) {
-	fmt.Printf("=== Lexical Analysis of %s ===\n", filename)
-
+func lexOnly(source, filename, format string) {
 	l := lexer.New(source)
-
+	tokens := []lexer.Token{}
 	for {
 		tok := l.NextToken()
+		tokens = append(tokens, tok)
 		if tok.Type == lexer.EOF {
 			break
 		}
-		fmt.Printf("%s\n", tok)
 	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(tokens, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\n", data)
+	case "tsv":
+		// Tabs, line breaks and backslashes in literals are escaped
+		escape := strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+		fmt.Printf("type\tliteral\tline\tcolumn\tutf16Column\toffset\tend\n")
+		for _, tok := range tokens {
+			fmt.Printf("%s\t%s\t%d\t%d\t%d\t%d\t%d\n", escape.Replace(tok.Type.String()), escape.Replace(tok.Literal),
+				tok.Line, tok.Column, tok.UTF16Column, tok.Offset, tok.End)
+		}
+	default:
+		fmt.Printf("=== Lexical Analysis of %s ===\n", filename)
+		for _, tok := range tokens[:len(tokens)-1] {
+			fmt.Printf("%s\n", tok)
+		}
+	}
+
+	if errors := l.Errors(); len(errors) > 0 {
+		fmt.Fprintf(os.Stderr, "Lexer errors:\n")
+		for _, err := range errors {
+			fmt.Fprintf(os.Stderr, "  %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// analyze runs the stages of the compiler before code generation on the
+// source, exiting on the first stage that reports errors
+func analyze(source string) *driver.Unit {
+	unit, errors := driver.Analyze(source)
+	if len(errors) > 0 {
+		fmt.Fprintf(os.Stderr, "Parser errors:\n")
+		for _, err := range errors {
+			fmt.Fprintf(os.Stderr, "  %s\n", err)
+		}
+		os.Exit(1)
+	}
+	return unit
 }
 
 // Parse only
-func parseOnly(source, filename string) {
+func parseOnly(source, filename, format string) {
+	if format == "json" {
+		data, err := ast.Marshal(analyze(source).Program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+
 	fmt.Printf("=== Parsing %s ===\n", filename)
 
-	l := lexer.New(source)
-	p := parser.New(l)
+	unit := analyze(source)
 
-	program := p.ParseProgram()
+	fmt.Printf("AST:\n%s\n", unit.Program.String())
 
-	// Check for parser errors
-	errors := p.Errors()
+	if flags := unit.Parser.CRegistry().LinkFlags(); len(flags) > 0 {
+		fmt.Printf("Link flags: %s\n", strings.Join(flags, " "))
+	}
+}
+
+// Emit the C translation of the program, with a C main if it has a def main
+func emitC(source, filename string) {
+	unit := analyze(source)
+	c, errors := unit.C(filename, unit.DefinesMain())
 	if len(errors) > 0 {
-		fmt.Fprintf(os.Stderr, "Parser errors:\n")
+		fmt.Fprintf(os.Stderr, "Code generation errors:\n")
 		for _, err := range errors {
 			fmt.Fprintf(os.Stderr, "  %s\n", err)
 		}
 		os.Exit(1)
 	}
 
-	fmt.Printf("AST:\n%s\n", program.String())
+	fmt.Print(c)
 }
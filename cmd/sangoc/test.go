@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/driver"
+	"github.com/rxxuzi/sango/pkg/project"
+	"github.com/rxxuzi/sango/pkg/sangotest"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// testCommand implements sangoc test, which runs the test declarations of
+// the given files, of the .sango files in the given directories, or of the
+// modules of the project in the current directory
+func testCommand(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	run := flags.String("run", "", "Run only the tests whose names match the regular expression")
+	verbose := flags.Bool("v", false, "Report every test, not only those that fail")
+	seed := flags.Int64("seed", 0, "Seed of the arguments check generates; a new one each run if 0")
+	checks := flags.Int("checks", sangotest.DefaultChecks, "Arguments check tries each property with")
+	timeout := flags.Duration("timeout", sangotest.DefaultTimeout, "Fail a test, or a call of a property, that runs longer than this")
+	cc := flags.String("cc", "cc", "C compiler to compile the tests with")
+	runtime := flags.String("runtime", "", "Directory holding sango.c and sango.h (default $SANGO_RUNTIME, runtime/ next to the sangoc bin/ directory, or runtime/ in a parent directory)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc test [-run regexp] [-seed n] [-checks n] [-timeout d] [-cc cc] [-runtime dir] [-v] [file.sango|dir]...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	opts := sangotest.Options{Seed: *seed, Checks: *checks, Timeout: *timeout, CC: *cc, Runtime: *runtime}
+	if opts.Runtime == "" {
+		var err error
+		if opts.Runtime, err = runtimeDir("."); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *run != "" {
+		var err error
+		if opts.Run, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -run: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	files, err := testFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range files {
+		if !testFile(file, opts, *verbose) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// testFiles returns the files named by the arguments of sangoc test
+func testFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		root, err := project.Find(".")
+		if err != nil {
+			return nil, err
+		}
+		m, err := project.Load(root)
+		if err != nil {
+			return nil, err
+		}
+		return m.Modules()
+	}
+
+	files := []string{}
+	for _, arg := range args {
+		found, err := sourceFiles(arg)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// testFile runs the tests of a file and reports whether they all passed
+func testFile(file string, opts sangotest.Options, verbose bool) bool {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+		return false
+	}
+	unit, errors := driver.AnalyzeTests(string(source))
+	var tests []*ast.TestStatement
+	if len(errors) == 0 {
+		tests, errors = sangotest.Tests(unit.Program)
+	}
+	if len(errors) > 0 {
+		fmt.Fprintf(os.Stderr, "Errors in %s:\n", file)
+		for _, err := range errors {
+			fmt.Fprintf(os.Stderr, "  %s\n", err)
+		}
+		fmt.Printf("FAIL\t%s\n", file)
+		return false
+	}
+
+	results, err := sangotest.Run(unit.Program, tests, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Printf("FAIL\t%s\n", file)
+		return false
+	}
+	if len(results) == 0 {
+		fmt.Printf("?   \t%s\t[no tests to run]\n", file)
+		return true
+	}
+
+	passed := 0
+	for _, r := range results {
+		seconds := r.Elapsed.Seconds()
+		if r.Passed() {
+			passed++
+			if verbose {
+				fmt.Printf("--- PASS: %s (%.2fs)\n", r.Name, seconds)
+				printOutput(r.Output, "    ")
+			}
+			continue
+		}
+		fmt.Printf("--- FAIL: %s (%.2fs)\n", r.Name, seconds)
+		printOutput(r.Output, "    ")
+		printFailure(file, r.Err, "    ")
+	}
+
+	if passed < len(results) {
+		fmt.Printf("FAIL\t%s\t%d of %d tests failed\n", file, len(results)-passed, len(results))
+		return false
+	}
+	fmt.Printf("ok  \t%s\t%d tests passed\n", file, passed)
+	return true
+}
+
+// printOutput prints what a test printed, indented
+func printOutput(output, indent string) {
+	if output = strings.TrimRight(output, "\n"); output != "" {
+		for _, line := range strings.Split(output, "\n") {
+			fmt.Printf("%s%s\n", indent, line)
+		}
+	}
+}
+
+// printFailure prints why a test failed: the values of the operands of a
+// failed assert, and the seed and shrunk arguments of a failed check
+func printFailure(file string, err error, indent string) {
+	switch failed := err.(type) {
+	case *semantic.AssertionError:
+		fmt.Printf("%s%s:%d:%d: assertion failed: %s\n", indent, file, failed.Line, failed.Column, failed.Expression)
+		for _, op := range failed.Operands {
+			fmt.Printf("%s    %s = %s\n", indent, op.Expression, op.Value)
+		}
+	case *sangotest.CheckError:
+		fmt.Printf("%s%s:%d:%d: check failed after %d tries and %d shrinks (-seed %d)\n", indent, file, failed.Line, failed.Column, failed.Tries, failed.Shrinks, failed.Seed)
+		args := make([]string, len(failed.Args))
+		for i, arg := range failed.Args {
+			args[i] = fmt.Sprintf("%s = %s", failed.Names[i], arg)
+		}
+		fmt.Printf("%s    counterexample: %s\n", indent, strings.Join(args, ", "))
+		if _, ok := failed.Err.(*semantic.AssertionError); ok {
+			printFailure(file, failed.Err, indent+"    ")
+		} else {
+			fmt.Printf("%s    %v\n", indent, failed.Err)
+		}
+	default:
+		fmt.Printf("%s%s: %v\n", indent, file, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/lint"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+// vetCommand implements sangoc vet, which runs the lint checks on the given
+// files, or on the .sango files in the given directories. Each check has a
+// flag of its own name: -shadow runs only the checks enabled that way, and
+// -shadow=false runs all but the checks disabled that way.
+func vetCommand(args []string) {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	list := flags.Bool("list", false, "List the checks and exit")
+	enabled := map[string]*bool{}
+	for _, c := range lint.Checks() {
+		enabled[c.Name] = flags.Bool(c.Name, false, "Report "+c.Doc)
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sangoc vet [-list] [-check[=false]...] <file.sango|dir>...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *list {
+		for _, c := range lint.Checks() {
+			fmt.Printf("%-18s %s\n", c.Name, c.Doc)
+		}
+		return
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No input file specified\n")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	settings := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		if on, ok := enabled[f.Name]; ok {
+			settings[f.Name] = *on
+		}
+	})
+	checks, err := lint.Select(settings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	files := []string{}
+	for _, arg := range flags.Args() {
+		found, err := sourceFiles(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, found...)
+	}
+
+	failed := false
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		if errors := p.Errors(); len(errors) > 0 {
+			fmt.Fprintf(os.Stderr, "Parser errors in %s:\n", file)
+			for _, err := range errors {
+				fmt.Fprintf(os.Stderr, "  %s\n", err)
+			}
+			failed = true
+			continue
+		}
+		for _, d := range lint.Run(program, string(source), p.CRegistry(), checks) {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s (%s)\n", file, d.Line, d.Column, d.Message, d.Check)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
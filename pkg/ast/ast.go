@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 
 	"github.com/rxxuzi/sango/pkg/lexer"
@@ -161,6 +162,17 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+// BadStatement stands in for a statement that failed to parse. It covers
+// the tokens from Token to End, which the parser skipped.
+type BadStatement struct {
+	Token lexer.Token // the first token of the statement
+	End   lexer.Token // the last token skipped
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) String() string       { return "<bad statement>" }
+
 // FunctionStatement represents top-level function definitions
 type FunctionStatement struct {
 	Token      lexer.Token // the 'def' token
@@ -168,12 +180,17 @@ type FunctionStatement struct {
 	Parameters []*Parameter
 	ReturnType *TypeExpression
 	Body       Expression // can be BlockStatement or expression
+	Const      bool       // true for const def, evaluated at compile time
+	Doc        string     // text of the doc comment before it, if any
 }
 
 func (fs *FunctionStatement) statementNode()       {}
 func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
 func (fs *FunctionStatement) String() string {
 	var out bytes.Buffer
+	if fs.Const {
+		out.WriteString("const ")
+	}
 	out.WriteString(fs.TokenLiteral() + " ")
 	out.WriteString(fs.Name.String())
 	out.WriteString("(")
@@ -206,11 +223,73 @@ func (is *IncludeStatement) String() string {
 	return is.TokenLiteral() + " \"" + is.Path + "\""
 }
 
+// ExternStatement represents extern "C" { def name(params): type; ... }
+// or a bare link hint such as extern "libm"
+type ExternStatement struct {
+	Token     lexer.Token // the 'extern' token
+	ABI       string      // "C" or the library the declarations are linked from
+	Functions []*ExternFunction
+}
+
+func (es *ExternStatement) statementNode()       {}
+func (es *ExternStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExternStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(es.TokenLiteral() + " \"" + es.ABI + "\"")
+	if len(es.Functions) > 0 {
+		out.WriteString(" { ")
+		functions := []string{}
+		for _, fn := range es.Functions {
+			functions = append(functions, fn.String())
+		}
+		out.WriteString(strings.Join(functions, "; "))
+		out.WriteString(" }")
+	}
+	return out.String()
+}
+
+// ExternFunction represents a C function declaration inside an extern block:
+// def name(params, ...): type = "c_name"
+type ExternFunction struct {
+	Token      lexer.Token // the 'def' token
+	Name       *Identifier
+	Parameters []*Parameter
+	ReturnType *TypeExpression
+	Variadic   bool   // true if the parameter list ends with ...
+	CName      string // optional C symbol name, defaults to Name
+}
+
+func (ef *ExternFunction) TokenLiteral() string { return ef.Token.Literal }
+func (ef *ExternFunction) String() string {
+	var out bytes.Buffer
+	out.WriteString("def ")
+	out.WriteString(ef.Name.String())
+	out.WriteString("(")
+	params := []string{}
+	for _, p := range ef.Parameters {
+		params = append(params, p.String())
+	}
+	if ef.Variadic {
+		params = append(params, "...")
+	}
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if ef.ReturnType != nil {
+		out.WriteString(": ")
+		out.WriteString(ef.ReturnType.String())
+	}
+	if ef.CName != "" {
+		out.WriteString(" = \"" + ef.CName + "\"")
+	}
+	return out.String()
+}
+
 // TypeStatement represents type aliases: type Name = Type
 type TypeStatement struct {
 	Token lexer.Token // the 'type' token
 	Name  *Identifier
 	Type  *TypeExpression
+	Doc   string // text of the doc comment before it, if any
 }
 
 func (ts *TypeStatement) statementNode()       {}
@@ -226,15 +305,20 @@ func (ts *TypeStatement) String() string {
 
 // StructStatement represents struct definitions
 type StructStatement struct {
-	Token  lexer.Token // the 'struct' token
-	Name   *Identifier
-	Fields []*StructField
+	Token      lexer.Token // the 'struct' token
+	Attributes []*Attribute
+	Name       *Identifier
+	Fields     []*StructFieldDecl // in declaration order
+	Doc        string             // text of the doc comment before it, if any
 }
 
 func (ss *StructStatement) statementNode()       {}
 func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
 func (ss *StructStatement) String() string {
 	var out bytes.Buffer
+	for _, attr := range ss.Attributes {
+		out.WriteString(attr.String() + " ")
+	}
 	out.WriteString(ss.TokenLiteral() + " ")
 	out.WriteString(ss.Name.String())
 	out.WriteString(" { ")
@@ -247,12 +331,70 @@ func (ss *StructStatement) String() string {
 	return out.String()
 }
 
+// Field returns the declaration of the named field
+func (ss *StructStatement) Field(name string) *StructFieldDecl {
+	for _, f := range ss.Fields {
+		if f.Name.Value == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Attribute returns the attribute with the given name, if present
+func (ss *StructStatement) Attribute(name string) *Attribute {
+	for _, attr := range ss.Attributes {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// StructFieldDecl represents a field declaration name: Type = default in a
+// struct or record type
+type StructFieldDecl struct {
+	Token   lexer.Token // the field name token
+	Name    *Identifier
+	Type    *TypeExpression
+	Default Expression // optional
+}
+
+func (fd *StructFieldDecl) TokenLiteral() string { return fd.Token.Literal }
+func (fd *StructFieldDecl) String() string {
+	s := fd.Name.String() + ": " + fd.Type.String()
+	if fd.Default != nil {
+		s += " = " + fd.Default.String()
+	}
+	return s
+}
+
+// Attribute represents an annotation such as @packed or @align(16)
+type Attribute struct {
+	Token     lexer.Token // the '@' token
+	Name      string
+	Arguments []Expression
+}
+
+func (a *Attribute) TokenLiteral() string { return a.Token.Literal }
+func (a *Attribute) String() string {
+	if a.Arguments == nil {
+		return "@" + a.Name
+	}
+	args := []string{}
+	for _, arg := range a.Arguments {
+		args = append(args, arg.String())
+	}
+	return "@" + a.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
 // ImplStatement represents implementation blocks
 type ImplStatement struct {
 	Token        lexer.Token // the 'impl' token
 	Type         *Identifier
 	ReceiverInfo *ReceiverInfo // Parsed receiver type information
 	Methods      []*FunctionStatement
+	Doc          string // text of the doc comment before it, if any
 }
 
 func (is *ImplStatement) statementNode()       {}
@@ -271,17 +413,54 @@ func (is *ImplStatement) String() string {
 	return out.String()
 }
 
-// DefineStatement represents C-style macro definitions
+// DefineStatement represents macro definitions:
+//
+//	define NAME = expr           compile-time constant
+//	define max(a, b) = expr      function-like macro expanded at the AST level
+//	define @c NAME tokens...     raw C macro passed through to the output
 type DefineStatement struct {
-	Token lexer.Token // the 'define' token
-	Name  *Identifier
-	Value string // Simple string for now
+	Token      lexer.Token // the 'define' token
+	Name       *Identifier
+	Parameters []*Identifier   // parameters of a function-like macro
+	Type       *TypeExpression // optional type of a constant: define N: u32 = 4
+	Value      Expression      // parsed body; nil for flag macros and raw C macros
+	Raw        string          // body of a raw C macro
+	IsC        bool            // true for define @c
 }
 
 func (ds *DefineStatement) statementNode()       {}
 func (ds *DefineStatement) TokenLiteral() string { return ds.Token.Literal }
 func (ds *DefineStatement) String() string {
-	return ds.TokenLiteral() + " " + ds.Name.String() + " " + ds.Value
+	var out bytes.Buffer
+	out.WriteString(ds.TokenLiteral() + " ")
+	if ds.IsC {
+		out.WriteString("@c " + ds.Name.String())
+		if ds.Raw != "" {
+			out.WriteString(" " + ds.Raw)
+		}
+		return out.String()
+	}
+	out.WriteString(ds.Name.String())
+	if ds.IsFunctionLike() {
+		params := []string{}
+		for _, param := range ds.Parameters {
+			params = append(params, param.String())
+		}
+		out.WriteString("(" + strings.Join(params, ", ") + ")")
+	}
+	if ds.Type != nil {
+		out.WriteString(": " + ds.Type.String())
+	}
+	if ds.Value != nil {
+		out.WriteString(" = ")
+		out.WriteString(ds.Value.String())
+	}
+	return out.String()
+}
+
+// IsFunctionLike reports whether the macro takes parameters
+func (ds *DefineStatement) IsFunctionLike() bool {
+	return ds.Parameters != nil
 }
 
 // ForStatement represents for loops: for x <- iterable { ... } or for i in range { ... }
@@ -362,10 +541,49 @@ func (as *AssertStatement) String() string {
 	return out.String()
 }
 
+// TestStatement represents a test declaration: test "name" { ... }. Tests
+// are only compiled by sangoc test.
+type TestStatement struct {
+	Token lexer.Token // the 'test' token
+	Name  string
+	Body  *BlockStatement
+}
+
+func (ts *TestStatement) statementNode()       {}
+func (ts *TestStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TestStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.TokenLiteral() + " " + strconv.Quote(ts.Name) + " ")
+	if ts.Body != nil {
+		out.WriteString(ts.Body.String())
+	}
+	return out.String()
+}
+
+// BenchStatement represents a benchmark declaration: bench "name" { ... }.
+// Benchmarks are only compiled by sangoc bench.
+type BenchStatement struct {
+	Token lexer.Token // the 'bench' token
+	Name  string
+	Body  *BlockStatement
+}
+
+func (bs *BenchStatement) statementNode()       {}
+func (bs *BenchStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BenchStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(bs.TokenLiteral() + " " + strconv.Quote(bs.Name) + " ")
+	if bs.Body != nil {
+		out.WriteString(bs.Body.String())
+	}
+	return out.String()
+}
+
 // IntegerLiteral represents an integer literal
 type IntegerLiteral struct {
 	Token lexer.Token
-	Value int64
+	Value int64  // u64 values above MaxInt64 wrap around
+	Type  string // type suffix such as "u8", empty if untyped
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
@@ -376,6 +594,7 @@ func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 type FloatLiteral struct {
 	Token lexer.Token
 	Value float64
+	Type  string // type suffix "f32" or "f64", empty if untyped
 }
 
 func (fl *FloatLiteral) expressionNode()      {}
@@ -392,6 +611,68 @@ func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return "\"" + sl.Value + "\"" }
 
+// InterpolatedString represents a string with embedded expressions such as
+// "Hello ${name}!". Parts holds the text as *StringLiteral and the embedded
+// expressions as *Interpolation, in order.
+type InterpolatedString struct {
+	Token lexer.Token // the INTERP_START token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(text.Value)
+		} else {
+			out.WriteString(part.String())
+		}
+	}
+	out.WriteString("\"")
+	return out.String()
+}
+
+// Interpolation is one ${value} or ${value:format} in an interpolated string
+type Interpolation struct {
+	Token  lexer.Token // the string token the interpolation follows
+	Value  Expression
+	Format string // format spec such as ".2f", empty if none
+
+	// Set by semantic.CheckInterpolations
+	Type      *TypeExpression // type of Value
+	Converter string          // function converting Value to a string; see below
+	CFormat   string          // printf conversion for Format, such as "%.2f"
+}
+
+// Converter values other than runtime functions
+const (
+	ConvertNone   = ""                    // Value is already a string
+	ConvertShow   = "show"                // Value's type has a show method
+	ConvertFormat = "sango_string_format" // Value is formatted with CFormat
+)
+
+func (in *Interpolation) expressionNode()      {}
+func (in *Interpolation) TokenLiteral() string { return in.Token.Literal }
+func (in *Interpolation) String() string {
+	if in.Format != "" {
+		return "${" + in.Value.String() + ":" + in.Format + "}"
+	}
+	return "${" + in.Value.String() + "}"
+}
+
+// CharLiteral represents a character literal such as 'a' or '\u{3042}'
+type CharLiteral struct {
+	Token lexer.Token
+	Value rune
+}
+
+func (cl *CharLiteral) expressionNode()      {}
+func (cl *CharLiteral) TokenLiteral() string { return cl.Token.Literal }
+func (cl *CharLiteral) String() string       { return strconv.QuoteRune(cl.Value) }
+
 // BooleanLiteral represents true or false
 type BooleanLiteral struct {
 	Token lexer.Token
@@ -420,6 +701,15 @@ func (w *WildcardExpression) expressionNode()      {}
 func (w *WildcardExpression) TokenLiteral() string { return w.Token.Literal }
 func (w *WildcardExpression) String() string       { return "_" }
 
+// BadExpression stands in for an expression that failed to parse
+type BadExpression struct {
+	Token lexer.Token // the token the expression should have started at
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) String() string       { return "<bad expression>" }
+
 // PrefixExpression represents !expression or -expression
 type PrefixExpression struct {
 	Token    lexer.Token // The prefix token, e.g. !
@@ -540,6 +830,7 @@ type Parameter struct {
 	Type *TypeExpression
 }
 
+func (p *Parameter) TokenLiteral() string { return p.Name.TokenLiteral() }
 func (p *Parameter) String() string {
 	if p.Type != nil {
 		return p.Name.String() + ": " + p.Type.String()
@@ -551,21 +842,30 @@ func (p *Parameter) String() string {
 type TypeExpression struct {
 	Token       lexer.Token
 	Name        string
-	Array       bool               // true if []Type
-	ElementType *TypeExpression    // for array element type
-	Tuple       []TypeExpression   // for tuple types (A, B, C)
-	Function    *FunctionType      // for function types (A, B) -> C
-	Record      *RecordType        // for record types { field: type }
+	Array       bool             // true if []Type or [N]Type
+	Length      Expression       // array length for [N]Type, nil for []Type
+	Pointer     bool             // true if *Type
+	ElementType *TypeExpression  // for array element type
+	Tuple       []TypeExpression // for tuple types (A, B, C)
+	Function    *FunctionType    // for function types (A, B) -> C
+	Record      *RecordType      // for record types { field: type }
 }
 
 func (te *TypeExpression) expressionNode()      {}
 func (te *TypeExpression) TokenLiteral() string { return te.Token.Literal }
 func (te *TypeExpression) String() string {
+	if te.Pointer && te.ElementType != nil {
+		return "*" + te.ElementType.String()
+	}
 	if te.Array {
+		prefix := "[]"
+		if te.Length != nil {
+			prefix = "[" + te.Length.String() + "]"
+		}
 		if te.ElementType != nil {
-			return "[]" + te.ElementType.String()
+			return prefix + te.ElementType.String()
 		}
-		return "[]" + te.Name
+		return prefix + te.Name
 	}
 	if len(te.Tuple) > 0 {
 		types := []string{}
@@ -583,6 +883,43 @@ func (te *TypeExpression) String() string {
 	return te.Name
 }
 
+// SizeofExpression represents sizeof(operand) and alignof(operand). The
+// operand is either a type or an expression; exactly one of Type and Value
+// is set.
+type SizeofExpression struct {
+	Token    lexer.Token // the 'sizeof' or 'alignof' token
+	Operator string      // "sizeof" or "alignof"
+	Type     *TypeExpression
+	Value    Expression
+}
+
+func (se *SizeofExpression) expressionNode()      {}
+func (se *SizeofExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SizeofExpression) String() string {
+	if se.Type != nil {
+		return se.Operator + "(" + se.Type.String() + ")"
+	}
+	return se.Operator + "(" + se.Value.String() + ")"
+}
+
+// OffsetofExpression represents offsetof(Type, field) where field may be a
+// path through nested structs such as header.flags
+type OffsetofExpression struct {
+	Token lexer.Token // the 'offsetof' token
+	Type  *TypeExpression
+	Field []*Identifier
+}
+
+func (oe *OffsetofExpression) expressionNode()      {}
+func (oe *OffsetofExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *OffsetofExpression) String() string {
+	path := []string{}
+	for _, f := range oe.Field {
+		path = append(path, f.Value)
+	}
+	return "offsetof(" + oe.Type.String() + ", " + strings.Join(path, ".") + ")"
+}
+
 // FunctionType represents (A, B) -> C
 type FunctionType struct {
 	Parameters []TypeExpression
@@ -591,21 +928,23 @@ type FunctionType struct {
 
 // RecordType represents { field: type, ... }
 type RecordType struct {
-	Fields map[string]*TypeExpression
+	Fields []*StructFieldDecl // in declaration order
 }
 
+func (rt *RecordType) TokenLiteral() string { return "{" }
 func (rt *RecordType) String() string {
 	var out bytes.Buffer
 	out.WriteString("{ ")
 	fields := []string{}
-	for name, fieldType := range rt.Fields {
-		fields = append(fields, name + ": " + fieldType.String())
+	for _, field := range rt.Fields {
+		fields = append(fields, field.String())
 	}
 	out.WriteString(strings.Join(fields, ", "))
 	out.WriteString(" }")
 	return out.String()
 }
 
+func (ft *FunctionType) TokenLiteral() string { return "(" }
 func (ft *FunctionType) String() string {
 	params := []string{}
 	for _, p := range ft.Parameters {
@@ -749,6 +1088,7 @@ type StructField struct {
 	Value Expression
 }
 
+func (sf *StructField) TokenLiteral() string { return sf.Name.TokenLiteral() }
 func (sf *StructField) String() string {
 	return sf.Name.String() + ": " + sf.Value.String()
 }
@@ -808,6 +1148,7 @@ type MatchCase struct {
 	Value   Expression
 }
 
+func (mc *MatchCase) TokenLiteral() string { return mc.Pattern.TokenLiteral() }
 func (mc *MatchCase) String() string {
 	if mc.Guard != nil {
 		return mc.Pattern.String() + " if " + mc.Guard.String() + " => " + mc.Value.String()
@@ -0,0 +1,475 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// SchemaVersion is the version of the JSON form of the AST written by
+// Marshal. It changes whenever a node kind or field is renamed or removed.
+const SchemaVersion = 1
+
+// The JSON form of a program is
+//
+//	{"version": 1, "program": {"kind": "Program", "statements": [...]}}
+//
+// Every node is an object whose "kind" is the name of its Go type. Its
+// fields follow with lowerCamelCase names: child nodes as objects, lists as
+// arrays and other values as strings, numbers and booleans. Absent nodes and
+// lists are left out. The "token" of a node holds its position:
+//
+//	{"type": "IDENT", "literal": "x", "line": 1, "column": 5,
+//	 "utf16Column": 5, "offset": 4, "end": 5}
+//
+// where type is the token type as the lexer prints it. Schema returns the
+// JSON Schema of this form.
+
+// nodeKinds lists every node type by kind
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &Identifier{},
+		&ValStatement{}, &VarStatement{}, &ReturnStatement{}, &AssignmentStatement{},
+		&ExpressionStatement{}, &BadStatement{}, &FunctionStatement{}, &IncludeStatement{},
+		&ExternStatement{}, &ExternFunction{}, &TypeStatement{}, &StructStatement{},
+		&StructFieldDecl{}, &Attribute{}, &ImplStatement{}, &DefineStatement{},
+		&ForStatement{}, &WhileStatement{}, &DeferStatement{}, &AssertStatement{},
+		&TestStatement{}, &BenchStatement{}, &BlockStatement{},
+		&IntegerLiteral{}, &FloatLiteral{}, &StringLiteral{}, &InterpolatedString{},
+		&Interpolation{}, &CharLiteral{}, &BooleanLiteral{}, &NullLiteral{},
+		&WildcardExpression{}, &BadExpression{}, &PrefixExpression{}, &InfixExpression{},
+		&IfExpression{}, &FunctionLiteral{}, &Parameter{}, &SizeofExpression{},
+		&OffsetofExpression{}, &CallExpression{}, &BuiltinFunctionCall{}, &ArrayLiteral{},
+		&IndexExpression{}, &RangeExpression{}, &TupleLiteral{}, &StructField{},
+		&StructLiteral{}, &MatchExpression{}, &MatchCase{},
+		&TypeExpression{}, &FunctionType{}, &RecordType{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+var (
+	nodeType         = reflect.TypeOf((*Node)(nil)).Elem()
+	statementType    = reflect.TypeOf((*Statement)(nil)).Elem()
+	expressionType   = reflect.TypeOf((*Expression)(nil)).Elem()
+	tokenType        = reflect.TypeOf(lexer.Token{})
+	receiverType     = reflect.TypeOf(ReceiverType(0))
+	receiverInfoType = reflect.TypeOf(&ReceiverInfo{})
+	typeValueType    = reflect.TypeOf(TypeExpression{})
+)
+
+var receiverTypes = []ReceiverType{ValueReceiver, PointerReceiver, ReferenceReceiver}
+
+// Marshal returns the JSON form of program
+func Marshal(program *Program) ([]byte, error) {
+	doc := object{{"version", SchemaVersion}, {"program", encode(reflect.ValueOf(program))}}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Unmarshal rebuilds a program from its JSON form
+func Unmarshal(data []byte) (*Program, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc struct {
+		Version json.Number
+		Program interface{}
+	}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Version.String() != fmt.Sprint(SchemaVersion) {
+		return nil, fmt.Errorf("unsupported AST version %q, expected %d", doc.Version, SchemaVersion)
+	}
+
+	program := reflect.New(reflect.TypeOf(&Program{})).Elem()
+	if err := decode(program, doc.Program, "program"); err != nil {
+		return nil, err
+	}
+	if program.IsNil() {
+		return nil, fmt.Errorf("missing program")
+	}
+	return program.Interface().(*Program), nil
+}
+
+// object is a JSON object that keeps the order of its members
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.key)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// jsonName returns the name of a field in JSON: ReturnValue is returnValue,
+// CName is cName and UTF16Column is utf16Column
+func jsonName(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) && unicode.IsLower(runes[upper]) {
+		upper--
+	}
+	if upper == 0 {
+		upper = 1
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// encode returns the JSON value of v
+func encode(v reflect.Value) interface{} {
+	switch {
+	case v.Type() == tokenType:
+		return encodeStruct(v, "")
+	case v.Type() == receiverType:
+		return v.Interface().(ReceiverType).String()
+	case v.Type() == typeValueType:
+		return encode(v.Addr())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encode(v.Elem())
+		}
+		if v.Type() == receiverInfoType {
+			return encodeStruct(v.Elem(), "")
+		}
+		return encodeStruct(v.Elem(), v.Elem().Type().Name())
+	case reflect.Slice:
+		items := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, encode(v.Index(i)))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+// encodeStruct returns the JSON object of a struct, starting with its kind
+// if it is a node
+func encodeStruct(v reflect.Value, kind string) object {
+	obj := object{}
+	if kind != "" {
+		obj = append(obj, member{"kind", kind})
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice:
+			if f.IsNil() {
+				continue
+			}
+		}
+		if f.Type() == reflect.TypeOf(lexer.TokenType(0)) {
+			obj = append(obj, member{jsonName(v.Type().Field(i).Name), f.Interface().(lexer.TokenType).String()})
+			continue
+		}
+		obj = append(obj, member{jsonName(v.Type().Field(i).Name), encode(f)})
+	}
+	return obj
+}
+
+// decode sets v from the JSON value raw, decoded with UseNumber. path
+// locates raw in the document for errors.
+func decode(v reflect.Value, raw interface{}, path string) error {
+	if raw == nil {
+		return nil
+	}
+
+	switch {
+	case v.Type() == tokenType:
+		return decodeStruct(v, raw, path)
+	case v.Type() == receiverType:
+		for _, rt := range receiverTypes {
+			if rt.String() == raw {
+				v.Set(reflect.ValueOf(rt))
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: unknown receiver type %v", path, raw)
+	case v.Type() == reflect.TypeOf(lexer.TokenType(0)):
+		name, _ := raw.(string)
+		t, ok := lexer.LookupTokenType(name)
+		if !ok {
+			return fmt.Errorf("%s: unknown token type %v", path, raw)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.Type() == receiverInfoType:
+		info := reflect.New(receiverInfoType.Elem())
+		if err := decodeStruct(info.Elem(), raw, path); err != nil {
+			return err
+		}
+		v.Set(info)
+		return nil
+	case v.Type() == typeValueType:
+		node, err := decodeNode(raw, path)
+		if err != nil {
+			return err
+		}
+		if node.Type() != reflect.PtrTo(typeValueType) {
+			return fmt.Errorf("%s: expected a TypeExpression, got %s", path, node.Elem().Type().Name())
+		}
+		v.Set(node.Elem())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		node, err := decodeNode(raw, path)
+		if err != nil {
+			return err
+		}
+		if !node.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("%s: %s is not a %s", path, node.Elem().Type().Name(), typeName(v.Type()))
+		}
+		v.Set(node)
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decode(list.Index(i), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(list)
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("%s: expected a boolean", path)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected an integer", path)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return fmt.Errorf("%s: expected an integer, got %s", path, n)
+		}
+		v.SetInt(i)
+	case reflect.Float64:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected a number", path)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: expected a number, got %s", path, n)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("%s: cannot decode a %s", path, v.Type())
+	}
+	return nil
+}
+
+// decodeNode returns a pointer to the node of the JSON object raw
+func decodeNode(raw interface{}, path string) (reflect.Value, error) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%s: expected a node", path)
+	}
+	kind, _ := obj["kind"].(string)
+	typ, ok := nodeKinds[kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%s: unknown node kind %q", path, obj["kind"])
+	}
+	node := reflect.New(typ)
+	if err := decodeStruct(node.Elem(), obj, path); err != nil {
+		return reflect.Value{}, err
+	}
+	return node, nil
+}
+
+// decodeStruct sets the fields of the struct v from the JSON object raw
+func decodeStruct(v reflect.Value, raw interface{}, path string) error {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: expected an object", path)
+	}
+	for i := 0; i < v.NumField(); i++ {
+		name := jsonName(v.Type().Field(i).Name)
+		if err := decode(v.Field(i), obj[name], path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeName returns the name of a node type for errors
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem().Name()
+	}
+	return t.Name()
+}
+
+// Schema returns the JSON Schema of the JSON form of the AST
+func Schema() []byte {
+	defs := object{
+		{"Token", object{
+			{"type", "object"},
+			{"required", []string{"type", "literal", "line", "column"}},
+			{"properties", fieldSchemas(tokenType)},
+			{"additionalProperties", false},
+		}},
+		{"ReceiverInfo", object{
+			{"type", "object"},
+			{"properties", fieldSchemas(receiverInfoType.Elem())},
+			{"additionalProperties", false},
+		}},
+		{"Node", anyOf(nodeType)},
+		{"Statement", anyOf(statementType)},
+		{"Expression", anyOf(expressionType)},
+	}
+	for _, kind := range sortedKinds() {
+		typ := nodeKinds[kind]
+		defs = append(defs, member{kind, object{
+			{"type", "object"},
+			{"required", []string{"kind"}},
+			{"properties", append(object{{"kind", object{{"const", kind}}}}, fieldSchemas(typ)...)},
+			{"additionalProperties", false},
+		}})
+	}
+
+	schema := object{
+		{"$schema", "https://json-schema.org/draft/2020-12/schema"},
+		{"$id", fmt.Sprintf("urn:sango:ast:v%d", SchemaVersion)},
+		{"title", "Sango AST"},
+		{"type", "object"},
+		{"required", []string{"version", "program"}},
+		{"properties", object{
+			{"version", object{{"const", SchemaVersion}}},
+			{"program", ref("Program")},
+		}},
+		{"additionalProperties", false},
+		{"$defs", defs},
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}
+
+func sortedKinds() []string {
+	kinds := []string{}
+	for kind := range nodeKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func ref(name string) object {
+	return object{{"$ref", "#/$defs/" + name}}
+}
+
+// anyOf returns the schema of a value of an interface type
+func anyOf(iface reflect.Type) object {
+	refs := []interface{}{}
+	for _, kind := range sortedKinds() {
+		if reflect.PtrTo(nodeKinds[kind]).Implements(iface) {
+			refs = append(refs, ref(kind))
+		}
+	}
+	return object{{"anyOf", refs}}
+}
+
+// fieldSchemas returns the schemas of the fields of a struct
+func fieldSchemas(typ reflect.Type) object {
+	fields := object{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		fields = append(fields, member{jsonName(f.Name), valueSchema(f.Type)})
+	}
+	return fields
+}
+
+// valueSchema returns the schema of a value of type t
+func valueSchema(t reflect.Type) object {
+	switch {
+	case t == tokenType:
+		return ref("Token")
+	case t == reflect.TypeOf(lexer.TokenType(0)):
+		return object{{"type", "string"}}
+	case t == receiverType:
+		names := []string{}
+		for _, rt := range receiverTypes {
+			names = append(names, rt.String())
+		}
+		return object{{"enum", names}}
+	case t == receiverInfoType:
+		return ref("ReceiverInfo")
+	case t == typeValueType:
+		return ref("TypeExpression")
+	case t == nodeType:
+		return ref("Node")
+	case t == statementType:
+		return ref("Statement")
+	case t == expressionType:
+		return ref("Expression")
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return ref(t.Elem().Name())
+	case reflect.Slice:
+		return object{{"type", "array"}, {"items", valueSchema(t.Elem())}}
+	case reflect.String:
+		return object{{"type", "string"}}
+	case reflect.Bool:
+		return object{{"type", "boolean"}}
+	case reflect.Float64:
+		return object{{"type", "number"}}
+	default:
+		return object{{"type", "integer"}}
+	}
+}
@@ -0,0 +1,193 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+var update = flag.Bool("update", false, "rewrite schema.json")
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{walkInput}
+	files, err := filepath.Glob(filepath.Join("..", "parser", "testdata", "*.sango"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(file, "errors") {
+			inputs = append(inputs, string(source))
+		}
+	}
+
+	for i, input := range inputs {
+		program := parse(t, input)
+		data, err := ast.Marshal(program)
+		if err != nil {
+			t.Fatalf("inputs[%d] - %v", i, err)
+		}
+
+		back, err := ast.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("inputs[%d] - %v", i, err)
+		}
+		if back.String() != program.String() {
+			t.Errorf("inputs[%d] - program differs after a round trip\ngot:\n%s\nwant:\n%s", i, back, program)
+		}
+		again, err := ast.Marshal(back)
+		if err != nil {
+			t.Fatalf("inputs[%d] - %v", i, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("inputs[%d] - JSON differs after a round trip", i)
+		}
+	}
+}
+
+func TestJSONForm(t *testing.T) {
+	data, err := ast.Marshal(parse(t, "val x = -1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Version int
+		Program struct {
+			Kind       string
+			Statements []map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != ast.SchemaVersion || doc.Program.Kind != "Program" || len(doc.Program.Statements) != 1 {
+		t.Fatalf("unexpected document %s", data)
+	}
+
+	val := doc.Program.Statements[0]
+	if val["kind"] != "ValStatement" {
+		t.Errorf("expected a ValStatement, got %v", val["kind"])
+	}
+	token := val["token"].(map[string]interface{})
+	if token["type"] != "val" || token["line"] != 1.0 || token["column"] != 1.0 || token["end"] != 3.0 {
+		t.Errorf("unexpected token %v", token)
+	}
+	if _, ok := val["type"]; ok {
+		t.Errorf("expected no type, got %v", val["type"])
+	}
+	value := val["value"].(map[string]interface{})
+	if value["kind"] != "PrefixExpression" || value["operator"] != "-" {
+		t.Errorf("unexpected value %v", value)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"version": 2, "program": {"kind": "Program"}}`, `unsupported AST version "2", expected 1`},
+		{`{"version": 1}`, "missing program"},
+		{`{"version": 1, "program": {"kind": "Program", "statements": [{"kind": "Nope"}]}}`,
+			`program.statements[0]: unknown node kind "Nope"`},
+		{`{"version": 1, "program": {"kind": "Program", "statements": [{"kind": "Identifier"}]}}`,
+			"program.statements[0]: Identifier is not a Statement"},
+		{`{"version": 1, "program": {"kind": "Program", "statements": [{"kind": "ReturnStatement",
+			"token": {"type": "bogus"}}]}}`, "program.statements[0].token.type: unknown token type bogus"},
+		{`{"version": 1, "program": {"kind": "Program", "statements": [{"kind": "ExpressionStatement",
+			"expression": {"kind": "IntegerLiteral", "value": "1"}}]}}`,
+			"program.statements[0].expression.value: expected an integer"},
+	}
+
+	for i, tt := range tests {
+		_, err := ast.Unmarshal([]byte(tt.input))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("tests[%d] - expected error %q, got %v", i, tt.err, err)
+		}
+	}
+}
+
+// TestSchema checks schema.json against Schema and the output of Marshal
+// against the schema. Run go test -update to rewrite schema.json.
+func TestSchema(t *testing.T) {
+	schema := ast.Schema()
+	if *update {
+		if err := ioutil.WriteFile("schema.json", schema, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(schema, want) {
+		t.Fatalf("schema.json is out of date; bump ast.SchemaVersion if a field was renamed or removed, and run go test -update")
+	}
+
+	var s struct {
+		Defs map[string]struct {
+			Properties map[string]interface{}
+			Required   []string
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ast.Marshal(parse(t, walkInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every node must be a kind of the schema with only its properties
+	var check func(v interface{}, def string)
+	check = func(v interface{}, def string) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				check(item, def)
+			}
+		case map[string]interface{}:
+			if kind, ok := v["kind"].(string); ok {
+				def = kind
+			}
+			d, ok := s.Defs[def]
+			if !ok {
+				t.Errorf("no schema for %s", def)
+				return
+			}
+			for _, req := range d.Required {
+				if _, ok := v[req]; !ok {
+					t.Errorf("%s is missing %s", def, req)
+				}
+			}
+			for key, value := range v {
+				if _, ok := d.Properties[key]; !ok {
+					t.Errorf("%s has no property %s in the schema", def, key)
+				}
+				if key == "token" || key == "end" && def == "BadStatement" {
+					check(value, "Token")
+				} else if key == "receiverInfo" {
+					check(value, "ReceiverInfo")
+				} else {
+					check(value, def)
+				}
+			}
+		}
+	}
+	check(doc["program"], "Program")
+}
@@ -0,0 +1,288 @@
+package ast
+
+import "reflect"
+
+// A Visitor's Visit method is called by Walk for each node. If it returns a
+// non-nil visitor w, Walk visits the children of node with w and then calls
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth first, in source order
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	eachChild(node, func(child Node) Node {
+		Walk(v, child)
+		return child
+	})
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node depth first, calling f for each
+// node and then f(nil) after its children. The children of a node are
+// skipped if f returns false for it.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Children returns the child nodes of node in source order. Every field of
+// node that holds nodes is included, field names such as the x of
+// Point { x: 1 } as well; operators and receiver kinds are not nodes.
+func Children(node Node) []Node {
+	children := []Node{}
+	eachChild(node, func(child Node) Node {
+		children = append(children, child)
+		return child
+	})
+	return children
+}
+
+// Rewrite transforms the tree rooted at node and returns its new root. pre
+// is called on each node before its children and post after them, and each
+// returns the node to put in its place, which must have a type the field
+// holding the node accepts. Returning nil removes the node from a list, or
+// clears the field holding it, and skips the rest of its rewrite. Either of
+// pre and post may be nil.
+func Rewrite(node Node, pre, post func(Node) Node) Node {
+	if pre != nil {
+		if node = pre(node); node == nil {
+			return nil
+		}
+	}
+	eachChild(node, func(child Node) Node {
+		return Rewrite(child, pre, post)
+	})
+	if post != nil {
+		node = post(node)
+	}
+	return node
+}
+
+// eachChild calls fn for each child of node in source order and puts the
+// node it returns in place of the child. Identifiers, literals, wildcards,
+// BadStatement and BadExpression have no children.
+func eachChild(node Node, fn func(Node) Node) {
+	switch n := node.(type) {
+	case *Program:
+		list(&n.Statements, fn)
+
+	// Statements
+	case *ValStatement:
+		list(&n.Names, fn)
+		field(&n.Type, fn)
+		field(&n.Value, fn)
+	case *VarStatement:
+		list(&n.Names, fn)
+		field(&n.Type, fn)
+		field(&n.Value, fn)
+	case *ReturnStatement:
+		field(&n.ReturnValue, fn)
+	case *AssignmentStatement:
+		field(&n.Name, fn)
+		field(&n.Value, fn)
+	case *ExpressionStatement:
+		field(&n.Expression, fn)
+	case *FunctionStatement:
+		field(&n.Name, fn)
+		list(&n.Parameters, fn)
+		field(&n.ReturnType, fn)
+		field(&n.Body, fn)
+	case *ExternStatement:
+		list(&n.Functions, fn)
+	case *ExternFunction:
+		field(&n.Name, fn)
+		list(&n.Parameters, fn)
+		field(&n.ReturnType, fn)
+	case *TypeStatement:
+		field(&n.Name, fn)
+		field(&n.Type, fn)
+	case *StructStatement:
+		list(&n.Attributes, fn)
+		field(&n.Name, fn)
+		list(&n.Fields, fn)
+	case *StructFieldDecl:
+		field(&n.Name, fn)
+		field(&n.Type, fn)
+		field(&n.Default, fn)
+	case *Attribute:
+		list(&n.Arguments, fn)
+	case *ImplStatement:
+		field(&n.Type, fn)
+		list(&n.Methods, fn)
+	case *DefineStatement:
+		field(&n.Name, fn)
+		list(&n.Parameters, fn)
+		field(&n.Type, fn)
+		field(&n.Value, fn)
+	case *ForStatement:
+		field(&n.Variable, fn)
+		field(&n.Iterable, fn)
+		field(&n.Body, fn)
+	case *WhileStatement:
+		field(&n.Condition, fn)
+		field(&n.Body, fn)
+	case *DeferStatement:
+		field(&n.Expression, fn)
+	case *AssertStatement:
+		field(&n.Expression, fn)
+	case *TestStatement:
+		field(&n.Body, fn)
+	case *BenchStatement:
+		field(&n.Body, fn)
+	case *BlockStatement:
+		list(&n.Statements, fn)
+
+	// Expressions
+	case *InterpolatedString:
+		list(&n.Parts, fn)
+	case *Interpolation:
+		field(&n.Value, fn)
+	case *PrefixExpression:
+		field(&n.Right, fn)
+	case *InfixExpression:
+		field(&n.Left, fn)
+		field(&n.Right, fn)
+	case *IfExpression:
+		field(&n.Condition, fn)
+		field(&n.Consequence, fn)
+		field(&n.Alternative, fn)
+	case *FunctionLiteral:
+		field(&n.Name, fn)
+		list(&n.Parameters, fn)
+		field(&n.ReturnType, fn)
+		field(&n.Body, fn)
+	case *Parameter:
+		field(&n.Name, fn)
+		field(&n.Type, fn)
+	case *SizeofExpression:
+		field(&n.Type, fn)
+		field(&n.Value, fn)
+	case *OffsetofExpression:
+		field(&n.Type, fn)
+		list(&n.Field, fn)
+	case *CallExpression:
+		field(&n.Function, fn)
+		list(&n.Arguments, fn)
+	case *BuiltinFunctionCall:
+		list(&n.Arguments, fn)
+	case *ArrayLiteral:
+		list(&n.Elements, fn)
+	case *IndexExpression:
+		field(&n.Left, fn)
+		field(&n.Index, fn)
+	case *RangeExpression:
+		field(&n.Start, fn)
+		field(&n.End, fn)
+	case *TupleLiteral:
+		list(&n.Elements, fn)
+	case *StructLiteral:
+		field(&n.Name, fn)
+		list(&n.Fields, fn)
+	case *StructField:
+		field(&n.Name, fn)
+		field(&n.Value, fn)
+	case *MatchExpression:
+		field(&n.Value, fn)
+		list(&n.Cases, fn)
+	case *MatchCase:
+		field(&n.Pattern, fn)
+		field(&n.Guard, fn)
+		field(&n.Value, fn)
+
+	// Types. The element type of an array or pointer comes after its length.
+	case *TypeExpression:
+		field(&n.Length, fn)
+		field(&n.ElementType, fn)
+		values(&n.Tuple, fn)
+		field(&n.Function, fn)
+		field(&n.Record, fn)
+	case *FunctionType:
+		values(&n.Parameters, fn)
+		field(&n.ReturnType, fn)
+	case *RecordType:
+		list(&n.Fields, fn)
+	}
+}
+
+// field passes the node in *f, if any, to fn and stores the result
+func field[T Node](f *T, fn func(Node) Node) {
+	if isNil(*f) {
+		return
+	}
+	r := fn(*f)
+	if r == Node(*f) {
+		return
+	}
+	if r == nil {
+		var zero T
+		*f = zero
+		return
+	}
+	*f = r.(T)
+}
+
+// list passes each node of *l to fn and stores the results, leaving out nil
+// ones. The slice is only replaced if a node changes.
+func list[T Node](l *[]T, fn func(Node) Node) {
+	var changed []T
+	for i, item := range *l {
+		var r Node = item
+		if !isNil(item) {
+			r = fn(item)
+		}
+		if changed == nil {
+			if r == Node(item) {
+				continue
+			}
+			changed = append(make([]T, 0, len(*l)), (*l)[:i]...)
+		}
+		if r != nil {
+			changed = append(changed, r.(T))
+		}
+	}
+	if changed != nil {
+		*l = changed
+	}
+}
+
+// values is list for the types of tuple and function types, which are held
+// as values rather than pointers
+func values(l *[]TypeExpression, fn func(Node) Node) {
+	var changed []TypeExpression
+	for i := range *l {
+		item := &(*l)[i]
+		r := fn(item)
+		if changed == nil {
+			if r == Node(item) {
+				continue
+			}
+			changed = append(make([]TypeExpression, 0, len(*l)), (*l)[:i]...)
+		}
+		if r != nil {
+			changed = append(changed, *r.(*TypeExpression))
+		}
+	}
+	if changed != nil {
+		*l = changed
+	}
+}
+
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,223 @@
+package ast_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+const walkInput = `
+include "stdio.h"
+extern "C" { def puts(s: string): int; def printf(f: string, ...): int }
+define N: u32 = 4
+define SQ(x) = x * x
+type Pair (int, string)
+type Op (int, int) -> int
+type Rec { a: int, b: []int }
+@packed
+struct Point { x: int = 0, y: int }
+impl *Point { def len(self) = self.x + self.y }
+val a, b: int = 1
+var arr: [N]int = [1, 2, 3, 4]
+def f(p: *Point, xs: []int): int = {
+  defer puts("done")
+  assert(p != null)
+  var s = 0
+  for x <- xs { s += x }
+  while (s > 10) { s -= 1 }
+  val q = Point { x: 1, y: -2 }
+  val r = { .x = 1, .y = 2 }
+  val t = (1, "two")
+  val m = match s {
+    0 => "zero"
+    n if n > 0 => "pos"
+    _ => "neg"
+  }
+  val g = def(y: int) = y ** 2
+  val z = sizeof(Point) + alignof(int) + offsetof(Point, y)
+  val str = "s = ${s:>4} and ${m}"
+  val w = if (s == 0) { xs[1..2] } else { xs[..s] }
+  println(3.5, 'c', true, w)
+  return s
+}
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// fieldNodes counts the non-nil nodes held in the fields of node
+func fieldNodes(node ast.Node) int {
+	count := 0
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.Slice && (f.Type().Elem().Implements(nodeType) ||
+			reflect.PtrTo(f.Type().Elem()).Implements(nodeType)):
+			count += f.Len()
+		case f.Kind() == reflect.Interface || f.Kind() == reflect.Ptr:
+			if f.Type().Implements(nodeType) && !f.IsNil() {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestChildrenExhaustive(t *testing.T) {
+	program := parse(t, walkInput)
+
+	seen := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		seen[reflect.TypeOf(node).Elem().Name()] = true
+		if got, want := len(ast.Children(node)), fieldNodes(node); got != want {
+			t.Errorf("%T %s - expected %d children, got %d", node, node.String(), want, got)
+		}
+		return true
+	})
+
+	for _, name := range []string{
+		"IncludeStatement", "ExternStatement", "ExternFunction", "DefineStatement",
+		"TypeStatement", "StructStatement", "StructFieldDecl", "Attribute", "ImplStatement",
+		"ValStatement", "VarStatement", "FunctionStatement", "Parameter", "DeferStatement",
+		"AssertStatement", "ForStatement", "WhileStatement", "AssignmentStatement",
+		"ReturnStatement", "ExpressionStatement", "BlockStatement", "StructLiteral",
+		"StructField", "TupleLiteral", "MatchExpression", "MatchCase", "FunctionLiteral",
+		"SizeofExpression", "OffsetofExpression", "InterpolatedString", "Interpolation",
+		"IfExpression", "IndexExpression", "RangeExpression", "CallExpression",
+		"InfixExpression", "PrefixExpression", "ArrayLiteral", "TypeExpression",
+		"FunctionType", "RecordType", "FloatLiteral", "CharLiteral", "BooleanLiteral",
+		"NullLiteral", "WildcardExpression", "StringLiteral", "IntegerLiteral",
+	} {
+		if !seen[name] {
+			t.Errorf("%s was not visited", name)
+		}
+	}
+}
+
+type depthVisitor struct {
+	depth, max *int
+	out        *strings.Builder
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	if _, ok := node.(*ast.Identifier); ok {
+		v.out.WriteString(node.String() + " ")
+	}
+	*v.depth++
+	if *v.depth > *v.max {
+		*v.max = *v.depth
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, "val x = a + b * f(c)\nvar y = (x, [d])")
+
+	depth, max := 0, 0
+	var out strings.Builder
+	ast.Walk(depthVisitor{&depth, &max, &out}, program)
+
+	if depth != 0 {
+		t.Errorf("expected Visit(nil) after each node, depth ends at %d", depth)
+	}
+	if max != 6 {
+		t.Errorf("expected depth 6, got %d", max)
+	}
+	if got, want := out.String(), "x a b f c y x d "; got != want {
+		t.Errorf("expected identifiers in source order %q, got %q", want, got)
+	}
+}
+
+func TestInspectSkip(t *testing.T) {
+	program := parse(t, "def f() = { g(1) }\nval v = h(2)")
+
+	calls := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionStatement); ok {
+			return false
+		}
+		if call, ok := node.(*ast.CallExpression); ok {
+			calls = append(calls, call.String())
+		}
+		return true
+	})
+	if len(calls) != 1 || calls[0] != "h(2)" {
+		t.Errorf("expected only h(2), got %v", calls)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, "val x: (int, old) = (1, 2)\ndebug(x)\nval y = x + x * 2\nold(y)")
+
+	result := ast.Rewrite(program, func(node ast.Node) ast.Node {
+		// Drop debug calls
+		if stmt, ok := node.(*ast.ExpressionStatement); ok {
+			if call, ok := stmt.Expression.(*ast.CallExpression); ok && call.Function.String() == "debug" {
+				return nil
+			}
+		}
+		return node
+	}, func(node ast.Node) ast.Node {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			if n.Value == "x" {
+				return &ast.Identifier{Token: n.Token, Value: "count"}
+			}
+		case *ast.TypeExpression:
+			if n.Name == "old" {
+				return &ast.TypeExpression{Token: n.Token, Name: "new"}
+			}
+		case *ast.InfixExpression:
+			// Fold x * 2 into x + x
+			if n.Operator == "*" && n.Right.String() == "2" {
+				return &ast.InfixExpression{Token: n.Token, Left: n.Left, Operator: "+", Right: n.Left}
+			}
+		}
+		return node
+	})
+
+	if result != ast.Node(program) {
+		t.Fatalf("expected the program to stay the root")
+	}
+	if typ := program.Statements[0].(*ast.ValStatement).Type.String(); typ != "(int, new)" {
+		t.Errorf("expected type (int, new), got %s", typ)
+	}
+	got := []string{}
+	for _, stmt := range program.Statements {
+		got = append(got, stmt.String())
+	}
+	want := []string{"val count = (1, 2);", "val y = (count + (count + count));", "old(y)"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestWalkReadOnly(t *testing.T) {
+	program := parse(t, walkInput)
+	before := program.String()
+	ast.Rewrite(program, nil, nil)
+	ast.Inspect(program, func(ast.Node) bool { return true })
+	if after := program.String(); after != before {
+		t.Errorf("walking changed the program\nbefore:\n%s\nafter:\n%s", before, after)
+	}
+}
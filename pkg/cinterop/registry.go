@@ -1,6 +1,7 @@
 package cinterop
 
 import (
+	"strings"
 	"sync"
 )
 
@@ -9,6 +10,8 @@ type FunctionRegistry struct {
 	mu        sync.RWMutex
 	functions map[string]FunctionSignature // function name -> signature
 	headers   map[string]bool              // track which headers have been included
+	origins   map[string]string            // function name -> header that declared it
+	libraries []string                     // libraries to link, in declaration order
 }
 
 // NewFunctionRegistry creates a new function registry
@@ -16,6 +19,8 @@ func NewFunctionRegistry() *FunctionRegistry {
 	return &FunctionRegistry{
 		functions: make(map[string]FunctionSignature),
 		headers:   make(map[string]bool),
+		origins:   make(map[string]string),
+		libraries: []string{},
 	}
 }
 
@@ -35,6 +40,7 @@ func (r *FunctionRegistry) IncludeHeader(header string) {
 	if funcs := GetFunctionsForHeader(header); funcs != nil {
 		for _, fn := range funcs {
 			r.functions[fn.Name] = fn
+			r.origins[fn.Name] = header
 		}
 	}
 }
@@ -44,6 +50,7 @@ func (r *FunctionRegistry) RegisterFunction(fn FunctionSignature) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.functions[fn.Name] = fn
+	delete(r.origins, fn.Name)
 }
 
 // LookupFunction checks if a function is available
@@ -54,6 +61,15 @@ func (r *FunctionRegistry) LookupFunction(name string) (FunctionSignature, bool)
 	return fn, ok
 }
 
+// Header returns the header whose include declared the named function. It
+// reports false for functions registered by hand, such as extern ones.
+func (r *FunctionRegistry) Header(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	header, ok := r.origins[name]
+	return header, ok
+}
+
 // IsFunction checks if a name is a registered C function
 func (r *FunctionRegistry) IsFunction(name string) bool {
 	r.mu.RLock()
@@ -74,3 +90,57 @@ func (r *FunctionRegistry) GetAllFunctions() map[string]FunctionSignature {
 	}
 	return result
 }
+
+// AddLibrary records a library that must be linked into the final executable.
+// Both "libm" and "m" name the same library.
+func (r *FunctionRegistry) AddLibrary(name string) {
+	lib := NormalizeLibrary(name)
+	if lib == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.libraries {
+		if existing == lib {
+			return
+		}
+	}
+	r.libraries = append(r.libraries, lib)
+}
+
+// Libraries returns the libraries to link, in the order they were declared
+func (r *FunctionRegistry) Libraries() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]string, len(r.libraries))
+	copy(result, r.libraries)
+	return result
+}
+
+// LinkFlags returns the -l flags for every library recorded in the registry
+func (r *FunctionRegistry) LinkFlags() []string {
+	libs := r.Libraries()
+	flags := make([]string, 0, len(libs))
+	for _, lib := range libs {
+		flags = append(flags, "-l"+lib)
+	}
+	return flags
+}
+
+// NormalizeLibrary converts a link hint such as "libm" or "libm.so" into the
+// name passed to -l. The C ABI marker "C" names no library.
+func NormalizeLibrary(name string) string {
+	if name == "" || name == "C" {
+		return ""
+	}
+	name = strings.TrimPrefix(name, "-l")
+	name = strings.TrimPrefix(name, "lib")
+	if i := strings.Index(name, ".so"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSuffix(name, ".a")
+	return name
+}
@@ -57,7 +57,17 @@ type FunctionSignature struct {
 	Name       string
 	ReturnType string
 	Args       []Argument
-	Variadic   bool // for functions like printf that accept variable arguments
+	Variadic   bool   // for functions like printf that accept variable arguments
+	CName      string // optional C symbol name when it differs from Name
+	Library    string // optional library the symbol is linked from (e.g. "m")
+}
+
+// Symbol returns the C symbol the function is emitted as
+func (fs FunctionSignature) Symbol() string {
+	if fs.CName != "" {
+		return fs.CName
+	}
+	return fs.Name
 }
 
 // Argument represents a function argument
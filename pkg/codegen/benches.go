@@ -0,0 +1,65 @@
+package codegen
+
+import "github.com/rxxuzi/sango/pkg/ast"
+
+// Bench translates a benchmark and the code it uses into an executable. It
+// returns errors for code it cannot compile yet.
+//
+// The executable reads numbers of iterations from its input, one per line.
+// For each it runs the benchmark that many times and writes the
+// nanoseconds they took and the blocks they allocated to file descriptor 3,
+// as "<ns> <allocs>". A failed assert is written as it is by a test.
+//
+// Each iteration runs in an arena of the runtime, which frees the blocks
+// it allocated when it returns, so a long run does not grow without bound.
+// A block an iteration leaves in a global is freed with the rest.
+func (g *Generator) Bench(program *ast.Program, bench *ast.BenchStatement) (*Executable, []string) {
+	g.errors = []string{}
+	t := newTranslator(g, program)
+	t.asserts = []*Assert{}
+	// The body must not be inlined into the loop that times it, or be
+	// dropped for having no effect
+	t.prototypes.WriteString("static void sango_bench(void) __attribute__((noinline, noipa));\n")
+
+	saved := t.enter(nil, bench.Token)
+	t.line("static void sango_bench(void) {")
+	t.block(bench.Body)
+	t.line("}")
+	t.functions.WriteString("\n")
+	t.functions.Write(t.out.Bytes())
+	t.leave(saved)
+	t.finish()
+
+	exe := &Executable{
+		Source:    "// Generated by sangoc\n#include <time.h>\n" + t.assemble(harness, benchEntry),
+		Libraries: libraries(program),
+		Asserts:   t.asserts,
+	}
+	return exe, append(g.Errors(), t.errors...)
+}
+
+const benchEntry = `
+int main(void) {
+    sango_report = fdopen(3, "w");
+    if (sango_report == NULL) {
+        sango_report = stderr;
+    }
+    sango_init();
+    while (sango_more(stdin)) {
+        long long n = sango_read_integer(stdin);
+        uint64_t allocs = sango_allocs;
+        struct timespec start, end;
+        clock_gettime(CLOCK_MONOTONIC, &start);
+        for (long long i = 0; i < n; i++) {
+            sango_arena_begin();
+            sango_bench();
+            sango_arena_end();
+        }
+        clock_gettime(CLOCK_MONOTONIC, &end);
+        long long ns = (long long)(end.tv_sec - start.tv_sec) * 1000000000LL + (end.tv_nsec - start.tv_nsec);
+        fprintf(sango_report, "%lld %llu\n", ns, (unsigned long long)(sango_allocs - allocs));
+        fflush(sango_report);
+    }
+    return 0;
+}
+`
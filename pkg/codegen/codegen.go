@@ -0,0 +1,158 @@
+// Package codegen translates checked Sango declarations into C.
+//
+// Structs are emitted with their fields in declaration order and followed
+// by static assertions on their size and field offsets. The C compiler then
+// rejects any build where its layout differs from the one computed by the
+// semantic package, so structs can be copied to and from binary buffers.
+package codegen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// Generator emits C for a program whose types are described by layouts
+type Generator struct {
+	layouts *semantic.Layouts
+	errors  []string
+}
+
+// New creates a generator that uses layouts for sizes and array lengths
+func New(layouts *semantic.Layouts) *Generator {
+	return &Generator{layouts: layouts, errors: []string{}}
+}
+
+// Errors returns the errors reported while generating
+func (g *Generator) Errors() []string {
+	return g.errors
+}
+
+// Structs emits forward typedefs for every struct in the program followed
+// by their definitions. A struct is defined after the structs it contains by
+// value, and otherwise in declaration order.
+func (g *Generator) Structs(program *ast.Program) string {
+	structs := []*ast.StructStatement{}
+	byName := map[string]*ast.StructStatement{}
+	for _, stmt := range program.Statements {
+		if s, ok := stmt.(*ast.StructStatement); ok && s != nil && s.Name != nil {
+			structs = append(structs, s)
+			byName[s.Name.Value] = s
+		}
+	}
+
+	var out bytes.Buffer
+	for _, s := range structs {
+		fmt.Fprintf(&out, "typedef struct %s %s;\n", s.Name.Value, s.Name.Value)
+	}
+
+	emitted := map[string]bool{}
+	var emit func(s *ast.StructStatement)
+	emit = func(s *ast.StructStatement) {
+		if emitted[s.Name.Value] {
+			return
+		}
+		emitted[s.Name.Value] = true
+		for _, f := range s.Fields {
+			for _, dep := range valueDependencies(f.Type) {
+				if d, ok := byName[dep]; ok {
+					emit(d)
+				}
+			}
+		}
+		out.WriteString("\n")
+		out.WriteString(g.Struct(s))
+	}
+	for _, s := range structs {
+		emit(s)
+	}
+	return out.String()
+}
+
+// Struct emits the C definition of one struct and the assertions that pin
+// its layout
+func (g *Generator) Struct(s *ast.StructStatement) string {
+	name := s.Name.Value
+	layout, err := g.layouts.Named(name)
+	var unknown *semantic.UnknownTypeError
+	checked := err == nil
+	if err != nil && (!errors.As(err, &unknown) || isPrimitive(unknown.Name)) {
+		g.errors = append(g.errors, fmt.Sprintf("struct %s: %v at line %d:%d",
+			name, err, s.Token.Line, s.Token.Column))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("struct ")
+	if attrs := g.structAttributes(s, layout); attrs != "" {
+		out.WriteString(attrs + " ")
+	}
+	out.WriteString(name + " {\n")
+	for _, f := range s.Fields {
+		decl, err := g.declare(f.Type, f.Name.Value)
+		if err != nil {
+			g.errors = append(g.errors, fmt.Sprintf("field %s.%s: %v at line %d:%d",
+				name, f.Name.Value, err, f.Token.Line, f.Token.Column))
+			continue
+		}
+		out.WriteString("    " + decl + ";\n")
+	}
+	out.WriteString("};\n")
+
+	// Types from C headers have no known layout; leave them to the compiler
+	if !checked {
+		return out.String()
+	}
+	fmt.Fprintf(&out, "_Static_assert(sizeof(%s) == %d, \"size of %s\");\n", name, layout.Size, name)
+	fmt.Fprintf(&out, "_Static_assert(_Alignof(%s) == %d, \"alignment of %s\");\n", name, layout.Align, name)
+	for _, f := range layout.Fields {
+		fmt.Fprintf(&out, "_Static_assert(offsetof(%s, %s) == %d, \"offset of %s.%s\");\n",
+			name, f.Name, f.Offset, name, f.Name)
+	}
+	return out.String()
+}
+
+// structAttributes translates @packed and @align into GCC attributes
+func (g *Generator) structAttributes(s *ast.StructStatement, layout semantic.Layout) string {
+	attrs := []string{}
+	if s.Attribute("packed") != nil {
+		attrs = append(attrs, "packed")
+	}
+	if s.Attribute("align") != nil && layout.Align > 0 {
+		attrs = append(attrs, fmt.Sprintf("aligned(%d)", layout.Align))
+	}
+	if len(attrs) == 0 {
+		return ""
+	}
+	return "__attribute__((" + strings.Join(attrs, ", ") + "))"
+}
+
+// valueDependencies returns the named types that te contains by value and
+// that must therefore be complete before it
+func valueDependencies(te *ast.TypeExpression) []string {
+	switch {
+	case te == nil, te.Pointer, te.Function != nil:
+		return nil
+	case te.Array:
+		if te.Length == nil {
+			return nil
+		}
+		return valueDependencies(te.ElementType)
+	case len(te.Tuple) > 0:
+		deps := []string{}
+		for i := range te.Tuple {
+			deps = append(deps, valueDependencies(&te.Tuple[i])...)
+		}
+		return deps
+	case te.Record != nil:
+		deps := []string{}
+		for _, f := range te.Record.Fields {
+			deps = append(deps, valueDependencies(f.Type)...)
+		}
+		return deps
+	}
+	return []string{te.Name}
+}
@@ -0,0 +1,347 @@
+package codegen
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+func generate(t *testing.T, input string) (*ast.Program, *Generator) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	ev := semantic.NewEvaluator()
+	ev.EvaluateProgram(program)
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	return program, New(ev.Layouts())
+}
+
+func TestStructsInDeclarationOrder(t *testing.T) {
+	program, g := generate(t, `struct Packet {
+  id: u64
+  header: Header
+  body: [4]u8
+  next: *Packet
+}
+@packed struct Header { tag: u8, length: u32 }`)
+
+	out := g.Structs(program)
+	if errs := g.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	expected := `typedef struct Packet Packet;
+typedef struct Header Header;
+
+struct __attribute__((packed)) Header {
+    uint8_t tag;
+    uint32_t length;
+};
+_Static_assert(sizeof(Header) == 5, "size of Header");
+_Static_assert(_Alignof(Header) == 1, "alignment of Header");
+_Static_assert(offsetof(Header, tag) == 0, "offset of Header.tag");
+_Static_assert(offsetof(Header, length) == 1, "offset of Header.length");
+
+struct Packet {
+    uint64_t id;
+    Header header;
+    uint8_t body[4];
+    Packet *next;
+};
+_Static_assert(sizeof(Packet) == 32, "size of Packet");
+_Static_assert(_Alignof(Packet) == 8, "alignment of Packet");
+_Static_assert(offsetof(Packet, id) == 0, "offset of Packet.id");
+_Static_assert(offsetof(Packet, header) == 8, "offset of Packet.header");
+_Static_assert(offsetof(Packet, body) == 13, "offset of Packet.body");
+_Static_assert(offsetof(Packet, next) == 24, "offset of Packet.next");
+`
+	if out != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestDeclarations(t *testing.T) {
+	_, g := generate(t, "")
+
+	tests := []struct {
+		typ      string
+		expected string
+	}{
+		{"int", "sango_int x"},
+		{"[]string", "sango_array* x"},
+		{"*u8", "uint8_t *x"},
+		{"[3][2]i16", "int16_t x[3][2]"},
+		{"*[4]u8", "uint8_t (*x)[4]"},
+		{"[4]*u8", "uint8_t *x[4]"},
+		{"int -> bool", "sango_bool (*x)(sango_int)"},
+		{"(u8, f64)", "struct { uint8_t _0; double _1; } x"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.typ))
+		te := p.ParseTypeExpression()
+		decl, err := g.Declaration(te, "x")
+		if err != nil {
+			t.Errorf("%s: %v", tt.typ, err)
+			continue
+		}
+		if decl != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.typ, tt.expected, decl)
+		}
+	}
+}
+
+func TestUnknownCTypesAreNotAsserted(t *testing.T) {
+	program, g := generate(t, "struct Handle { file: FILE, fd: int }")
+	out := g.Structs(program)
+	if errs := g.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if !strings.Contains(out, "    FILE file;\n") || strings.Contains(out, "_Static_assert") {
+		t.Errorf("wrong output for C type field:\n%s", out)
+	}
+}
+
+func TestCharFieldsAreAsserted(t *testing.T) {
+	program, g := generate(t, `struct Glyph { c: char, width: u8 }
+struct Line { first: Glyph, count: int }`)
+	out := g.Structs(program)
+	if errs := g.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, want := range []string{
+		"    sango_char c;\n",
+		`_Static_assert(sizeof(Glyph) == 8, "size of Glyph");`,
+		`_Static_assert(offsetof(Line, count) == 8, "offset of Line.count");`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+// run compiles C with the runtime and runs it, returning its output and
+// exit status
+func run(t *testing.T, source string) (string, int) {
+	t.Helper()
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	runtime := filepath.Join("..", "..", "runtime")
+	file := filepath.Join(dir, "main.c")
+	if err := ioutil.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "main")
+	cmd := exec.Command("cc", "-std=gnu11", "-fwrapv", "-w", "-I", runtime, file, filepath.Join(runtime, "sango.c"), "-o", exe, "-lm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("compiling failed: %v\n%s\n%s", err, out, source)
+	}
+	out, err := exec.Command(exe).CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return string(out), exit.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func TestProgram(t *testing.T) {
+	program, g := generate(t, `include "stdio.h"
+struct Point { x: i32, y: i32 }
+type Pair (i32, string)
+
+val origin = Point { x: 0, y: 0 }
+var calls: i32 = 0
+
+def norm2(p: Point): i32 = {
+  calls += 1
+  p.x * p.x + p.y * p.y
+}
+
+def classify(n: i32): string = match n {
+  0 => "zero"
+  x if x < 0 => "negative"
+  _ => "positive"
+}
+
+def first(p: Pair): i32 = p.0
+
+def sum(xs: []i32): i32 = {
+  var total = 0
+  for x <- xs { total += x }
+  total
+}
+
+def main(): i32 = {
+  val p = Point { x: 3, y: 4 }
+  assert(norm2(origin) == 0)
+  printf("%s %s %d\n", classify(-2), classify(norm2(p)), first((7, "seven")))
+  assert(p != origin && (1, "a") == (1, "a"))
+  sum([1, 2, 3]) + calls
+}`)
+
+	source, errs := g.Program(program, true)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, want := range []string{
+		"static int32_t sg_norm2(Point sg_p) {",
+		"static sango_string sg_classify(int32_t sg_n) {",
+		"static void sango_init(void) {",
+		"int main(void) {",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("expected %q in:\n%s", want, source)
+		}
+	}
+
+	out, status := run(t, source)
+	if out != "negative positive 7\n" || status != 8 {
+		t.Errorf("expected the output of main and status 8, got %q and %d", out, status)
+	}
+}
+
+func TestProgramAssert(t *testing.T) {
+	program, g := generate(t, `def main() = {
+  val n = 2
+  assert(n + n == 5)
+}`)
+	source, errs := g.Program(program, true)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	out, status := run(t, source)
+	if out != "Assertion failed: (n + n) == 5 at line 3:3\n" || status == 0 {
+		t.Errorf("expected the assert to fail, got %q and %d", out, status)
+	}
+}
+
+func TestProgramErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		main     bool
+		expected string
+	}{
+		{`def f(x): i32 = 1`, false, "parameter x of def f has no type at line 1:1"},
+		{`def f(): i32 = y`, false, "undefined: y at line 1:1"},
+		{`struct P { x: i32 }
+def f(p: P): i32 = p.get()`, false, "cannot compile method calls yet at line 2:1"},
+		{`def f() = { defer f() }`, false, "cannot compile defer statements yet at line 1:13"},
+		{`def f(): i32 = 1`, true, "the entry module has no def main at line 0:0"},
+		{`def main(n: i32) = { }`, true, "def main takes no parameters at line 1:1"},
+	}
+
+	for _, tt := range tests {
+		program, g := generate(t, tt.input)
+		_, errs := g.Program(program, tt.main)
+		if len(errs) != 1 || errs[0] != tt.expected {
+			t.Errorf("%s: expected %q, got %v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+// test translates the only test of input
+func test(t *testing.T, input string) (*Executable, []string) {
+	t.Helper()
+	program, g := generate(t, input)
+	for _, stmt := range program.Statements {
+		if ts, ok := stmt.(*ast.TestStatement); ok {
+			return g.Test(program, ts)
+		}
+	}
+	t.Fatalf("no test in input")
+	return nil, nil
+}
+
+func TestTestReportsAssertOperands(t *testing.T) {
+	exe, errs := test(t, `struct Vec { x: f64, y: f64 }
+def add(a: i32, b: i32): i32 = a + b
+test "math" {
+  val v = Vec { x: 1.0, y: 2.0 }
+  assert(add(1, 2) == 3)
+  assert(v == Vec { x: 1.0, y: 2.0 })
+  check(def(a: i32, b: i32) = add(a, b) == add(b, a), 50)
+}`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if len(exe.Asserts) != 2 || len(exe.Asserts[0].Operands) != 1 || len(exe.Asserts[1].Operands) != 2 {
+		t.Fatalf("wrong asserts: %+v", exe.Asserts)
+	}
+	if len(exe.Checks) != 1 || exe.Checks[0].Count != 50 || len(exe.Checks[0].Property.Parameters) != 2 {
+		t.Fatalf("wrong checks: %+v", exe.Checks)
+	}
+	for _, want := range []string{
+		"static int32_t sg_add(int32_t sg_a, int32_t sg_b) {",
+		"static void sango_test(void) {",
+		"sango_report_assert(1);",
+		"static bool sango_property0(",
+		`fputs(sango_property0(sango_v6, sango_v7) ? "pass\n" : "fail\n", sango_report);`,
+	} {
+		if !strings.Contains(exe.Source, want) {
+			t.Errorf("expected %q in:\n%s", want, exe.Source)
+		}
+	}
+}
+
+func TestTestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`test "t" { check(def(x) = true) }`, "check cannot generate x, which has no type at line 1:12"},
+		{`test "t" { check(def(x: i32) = x) }`, "check expects a property that returns bool, got i32 at line 1:12"},
+		{`test "t" { val x = y }`, "undefined: y at line 1:12"},
+		{`struct P { x: i32 }
+test "t" { val p = P { x: 1 }
+  assert(p.get() == 1) }`, "cannot compile method calls yet at line 3:3"},
+	}
+
+	for _, tt := range tests {
+		_, errs := test(t, tt.input)
+		if len(errs) != 1 || errs[0] != tt.expected {
+			t.Errorf("%s: expected %q, got %v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestBench(t *testing.T) {
+	program, g := generate(t, `def add(a: i32, b: i32): i32 = a + b
+bench "add" {
+  assert(add(1, 2) == 3)
+}`)
+	exe, errs := g.Bench(program, program.Statements[1].(*ast.BenchStatement))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(exe.Asserts) != 1 {
+		t.Errorf("expected 1 assert, got %d", len(exe.Asserts))
+	}
+	for _, want := range []string{
+		"static void sango_bench(void) __attribute__((noinline, noipa));",
+		"static void sango_bench(void) {",
+		"sango_allocs - allocs",
+	} {
+		if !strings.Contains(exe.Source, want) {
+			t.Errorf("expected %q in:\n%s", want, exe.Source)
+		}
+	}
+}
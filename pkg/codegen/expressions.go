@@ -0,0 +1,1239 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/cinterop"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+func named(name string) *ast.TypeExpression { return &ast.TypeExpression{Name: name} }
+
+// resolve follows the type aliases that te names
+func (t *translator) resolve(te *ast.TypeExpression) *ast.TypeExpression {
+	for i := 0; te != nil && i < maxAliasDepth; i++ {
+		if te.Array || te.Pointer || len(te.Tuple) > 0 || te.Function != nil || te.Record != nil {
+			return te
+		}
+		alias, ok := t.aliases[te.Name]
+		if !ok {
+			return te
+		}
+		te = alias
+	}
+	return te
+}
+
+func isNamed(te *ast.TypeExpression, name string) bool {
+	return te != nil && !te.Array && !te.Pointer && len(te.Tuple) == 0 && te.Function == nil && te.Record == nil && te.Name == name
+}
+
+// isInteger reports whether a resolved type is an integer type or char
+func isInteger(te *ast.TypeExpression) bool {
+	if te == nil || te.Array || te.Pointer {
+		return false
+	}
+	_, ok := semantic.LookupIntType(te.Name)
+	return ok || te.Name == "char"
+}
+
+func isFloat(te *ast.TypeExpression) bool {
+	return te != nil && !te.Array && !te.Pointer && semantic.IsFloatType(te.Name)
+}
+
+// isUnsigned reports whether a resolved type is an unsigned integer type
+func isUnsigned(te *ast.TypeExpression) bool {
+	if !isInteger(te) {
+		return false
+	}
+	it, ok := semantic.LookupIntType(te.Name)
+	return !ok || !it.Signed
+}
+
+// isComposite reports whether a resolved type is compared field by field
+// or element by element
+func (t *translator) isComposite(te *ast.TypeExpression) bool {
+	if te == nil || te.Pointer || te.Function != nil {
+		return false
+	}
+	_, isStruct := t.structs[te.Name]
+	return te.Array || len(te.Tuple) > 0 || te.Record != nil || isStruct
+}
+
+// byCopy reports whether a struct field of type te is declared as a C array
+// or an anonymous struct, and so is read and written with memcpy
+func (t *translator) byCopy(te *ast.TypeExpression) bool {
+	te = t.resolve(te)
+	return te != nil && !te.Pointer && ((te.Array && te.Length != nil) || len(te.Tuple) > 0 || te.Record != nil)
+}
+
+// ctype returns the C spelling of a type. Tuples, records, fixed arrays and
+// function types get typedefs, so values of them can be passed, returned and
+// assigned.
+func (t *translator) ctype(te *ast.TypeExpression) string {
+	te = t.resolve(te)
+	switch {
+	case te == nil:
+		t.errorf("missing type")
+		return "void"
+	case te.Pointer:
+		return t.ctype(te.ElementType) + "*"
+	case te.Array && te.Length == nil:
+		return "sango_array*"
+	case te.Array, len(te.Tuple) > 0, te.Record != nil, te.Function != nil:
+		return t.typedef(te)
+	}
+	return CTypeName(te.Name)
+}
+
+func (t *translator) typedef(te *ast.TypeExpression) string {
+	key := te.String()
+	if name, ok := t.typeNames[key]; ok {
+		return name
+	}
+	var decl string
+	switch {
+	case te.Array:
+		decl = fmt.Sprintf("struct { %s data[%d]; }", t.ctype(te.ElementType), t.arrayLength(te))
+	case len(te.Tuple) > 0:
+		members := []string{}
+		for i := range te.Tuple {
+			members = append(members, fmt.Sprintf("%s _%d;", t.ctype(&te.Tuple[i]), i))
+		}
+		decl = "struct { " + strings.Join(members, " ") + " }"
+	case te.Record != nil:
+		members := []string{}
+		for _, f := range te.Record.Fields {
+			members = append(members, fmt.Sprintf("%s %s;", t.ctype(f.Type), f.Name.Value))
+		}
+		decl = "struct { " + strings.Join(members, " ") + " }"
+	case te.Function != nil:
+		params := []string{}
+		for i := range te.Function.Parameters {
+			params = append(params, t.ctype(&te.Function.Parameters[i]))
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		ret := te.Function.ReturnType
+		if ret == nil {
+			ret = named("void")
+		}
+		name := fmt.Sprintf("sango_t%d", len(t.typeNames))
+		t.typeNames[key] = name
+		fmt.Fprintf(&t.typedefs, "typedef %s (*%s)(%s);\n", t.ctype(ret), name, strings.Join(params, ", "))
+		return name
+	}
+	name := fmt.Sprintf("sango_t%d", len(t.typeNames))
+	t.typeNames[key] = name
+	fmt.Fprintf(&t.typedefs, "typedef %s %s;\n", decl, name)
+	return name
+}
+
+// arrayLength returns the length of a fixed array type
+func (t *translator) arrayLength(te *ast.TypeExpression) int64 {
+	n, err := t.g.layouts.ArrayLength(te)
+	if err != nil {
+		t.errorf("%v", err)
+	}
+	return n
+}
+
+// zero returns the value of a var declared without one
+func (t *translator) zero(te *ast.TypeExpression) string {
+	rt := t.resolve(te)
+	switch {
+	case isNamed(rt, "string"):
+		return `""`
+	case rt.Array && rt.Length == nil:
+		return fmt.Sprintf("sango_array_of(sizeof(%s), 0, NULL)", t.ctype(rt.ElementType))
+	case rt.Pointer:
+		return "NULL"
+	case t.isComposite(rt):
+		return fmt.Sprintf("((%s){0})", t.ctype(te))
+	}
+	return "0"
+}
+
+// expr translates an expression into a C expression
+func (t *translator) expr(e ast.Expression) string {
+	switch n := e.(type) {
+	case nil:
+		t.errorf("missing expression")
+		return "0"
+	case *ast.IntegerLiteral:
+		return integer(n)
+	case *ast.FloatLiteral:
+		return float(n)
+	case *ast.StringLiteral:
+		return cString(n.Value)
+	case *ast.InterpolatedString:
+		return t.interpolation(n)
+	case *ast.CharLiteral:
+		return fmt.Sprintf("((sango_char)%d)", n.Value)
+	case *ast.BooleanLiteral:
+		return strconv.FormatBool(n.Value)
+	case *ast.NullLiteral:
+		return "NULL"
+	case *ast.Identifier:
+		if b, ok := t.lookup(n.Value); ok {
+			return b.name
+		}
+		if fn := t.defs[n.Value]; fn != nil {
+			t.use(fn)
+			return "sg_" + n.Value
+		}
+		t.errorf("undefined: %s", n.Value)
+		return "0"
+	case *ast.PrefixExpression:
+		return t.prefix(n)
+	case *ast.InfixExpression:
+		if n.Operator == "." {
+			return t.field(n)
+		}
+		lt, rt := t.operandType(n.Left, n.Right), t.operandType(n.Right, n.Left)
+		return t.binary(n.Operator, t.value(n.Left, lt), lt, t.value(n.Right, rt), rt, t.typeOf(n))
+	case *ast.IndexExpression:
+		return t.index(n)
+	case *ast.CallExpression:
+		return t.call(n)
+	case *ast.ArrayLiteral:
+		return t.arrayLiteral(n, nil)
+	case *ast.TupleLiteral:
+		return t.tupleLiteral(n, nil)
+	case *ast.StructLiteral:
+		return t.structLiteral(n)
+	case *ast.IfExpression:
+		if n.Alternative == nil {
+			t.errorf("if without else has no value")
+			return "0"
+		}
+		return fmt.Sprintf("(%s ? %s : %s)", t.expr(n.Condition), t.blockValue(n.Consequence, nil), t.blockValue(n.Alternative, nil))
+	case *ast.BlockStatement:
+		return t.blockValue(n, nil)
+	case *ast.MatchExpression:
+		return t.match(n, true)
+	case *ast.SizeofExpression:
+		op := "sizeof"
+		if n.Operator == "alignof" {
+			op = "_Alignof"
+		}
+		if n.Type != nil {
+			return fmt.Sprintf("((uint64_t)%s(%s))", op, t.ctype(n.Type))
+		}
+		// Identifiers name a type when one is declared, as in C
+		if id, ok := n.Value.(*ast.Identifier); ok && t.g.layouts.IsType(id.Value) {
+			return fmt.Sprintf("((uint64_t)%s(%s))", op, t.ctype(named(id.Value)))
+		}
+		if n.Operator == "alignof" {
+			op = "__alignof__"
+		}
+		return fmt.Sprintf("((uint64_t)%s(%s))", op, t.expr(n.Value))
+	case *ast.OffsetofExpression:
+		path := []string{}
+		for _, f := range n.Field {
+			path = append(path, f.Value)
+		}
+		return fmt.Sprintf("((uint64_t)offsetof(%s, %s))", t.ctype(n.Type), strings.Join(path, "."))
+	}
+	t.errorf("cannot compile %s yet", e)
+	return "0"
+}
+
+// value translates an expression whose value has type want, which gives the
+// element types of literals that do not spell them out
+func (t *translator) value(e ast.Expression, want *ast.TypeExpression) string {
+	if want == nil {
+		return t.expr(e)
+	}
+	switch n := e.(type) {
+	case *ast.ArrayLiteral:
+		return t.arrayLiteral(n, want)
+	case *ast.TupleLiteral:
+		return t.tupleLiteral(n, want)
+	case *ast.BlockStatement:
+		return t.blockValue(n, want)
+	case *ast.IfExpression:
+		if n.Alternative != nil {
+			return fmt.Sprintf("(%s ? %s : %s)", t.expr(n.Condition), t.blockValue(n.Consequence, want), t.blockValue(n.Alternative, want))
+		}
+	}
+	return t.expr(e)
+}
+
+// integer translates an integer literal, giving large untyped literals the
+// type they are inferred to have
+func integer(n *ast.IntegerLiteral) string {
+	var digits string
+	switch {
+	case n.Value < 0:
+		digits = strconv.FormatUint(uint64(n.Value), 10) + "ULL"
+	case n.Value > math.MaxInt32:
+		digits = strconv.FormatInt(n.Value, 10) + "LL"
+	default:
+		digits = strconv.FormatInt(n.Value, 10)
+	}
+	if n.Type != "" {
+		return fmt.Sprintf("((%s)%s)", CTypeName(n.Type), digits)
+	}
+	return digits
+}
+
+func float(n *ast.FloatLiteral) string {
+	var digits string
+	switch {
+	case math.IsInf(n.Value, 1):
+		digits = "INFINITY"
+	case math.IsInf(n.Value, -1):
+		digits = "(-INFINITY)"
+	case math.IsNaN(n.Value):
+		digits = "NAN"
+	default:
+		digits = strconv.FormatFloat(n.Value, 'g', -1, 64)
+		if !strings.ContainsAny(digits, ".e") {
+			digits += ".0"
+		}
+	}
+	if n.Type == "f32" || n.Type == "float" {
+		return fmt.Sprintf("((float)%s)", digits)
+	}
+	return digits
+}
+
+// cString quotes s as a C string literal
+func cString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20 || c >= 0x7f || c == '?':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (t *translator) prefix(n *ast.PrefixExpression) string {
+	right := t.expr(n.Right)
+	switch n.Operator {
+	case "-", "~":
+		if typ := t.typeOf(n); isInteger(t.resolve(typ)) {
+			return fmt.Sprintf("((%s)(%s%s))", t.ctype(typ), n.Operator, right)
+		}
+	}
+	return fmt.Sprintf("(%s%s)", n.Operator, right)
+}
+
+// binary translates a binary operator whose operands have the given C
+// spellings and types. Arithmetic on integers is converted back to the type
+// of the result, so it wraps like Sango's fixed-width integers do.
+func (t *translator) binary(op, left string, lt *ast.TypeExpression, right string, rt *ast.TypeExpression, result *ast.TypeExpression) string {
+	rl, rr := t.resolve(lt), t.resolve(rt)
+	switch op {
+	case "&&", "||":
+		return fmt.Sprintf("(%s %s %s)", left, op, right)
+	case "==", "!=", "<", ">", "<=", ">=":
+		if isNamed(rl, "string") || isNamed(rr, "string") {
+			return fmt.Sprintf("(strcmp(%s, %s) %s 0)", left, right, op)
+		}
+		if (op == "==" || op == "!=") && (t.isComposite(rl) || t.isComposite(rr)) {
+			typ := lt
+			if !t.isComposite(rl) {
+				typ = rt
+			}
+			not := ""
+			if op == "!=" {
+				not = "!"
+			}
+			return fmt.Sprintf("%s%s(%s, %s)", not, t.equal(typ), left, right)
+		}
+		return fmt.Sprintf("(%s %s %s)", left, op, right)
+	case "+":
+		if isNamed(rl, "string") && isNamed(rr, "string") {
+			return fmt.Sprintf("sango_string_concat(%s, %s)", left, right)
+		}
+	case "%":
+		if isFloat(rl) || isFloat(rr) {
+			return fmt.Sprintf("fmod(%s, %s)", left, right)
+		}
+	}
+	code := fmt.Sprintf("(%s %s %s)", left, op, right)
+	if isInteger(t.resolve(result)) {
+		return fmt.Sprintf("((%s)%s)", t.ctype(result), code)
+	}
+	return code
+}
+
+// field translates field access and tuple element access
+func (t *translator) field(n *ast.InfixExpression) string {
+	lt := t.resolve(t.typeOf(n.Left))
+	base := t.expr(n.Left)
+	sel := "."
+	if lt != nil && lt.Pointer {
+		sel = "->"
+		lt = t.resolve(lt.ElementType)
+	}
+	switch right := n.Right.(type) {
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("(%s)%s_%d", base, sel, right.Value)
+	case *ast.Identifier:
+		if lt != nil {
+			if s, ok := t.structs[lt.Name]; ok && !lt.Array && !lt.Pointer {
+				f := structField(s, right.Value)
+				if f == nil {
+					t.errorf("%s has no field %s", lt.Name, right.Value)
+					return "0"
+				}
+				if t.byCopy(f.Type) {
+					return t.copied(base, sel, f)
+				}
+			}
+		}
+		return fmt.Sprintf("(%s)%s%s", base, sel, right.Value)
+	}
+	t.errorf("cannot compile %s yet", n)
+	return "0"
+}
+
+// copied reads a struct field declared as a C array or anonymous struct
+// into a value of the typedef'd type the translated code uses for it
+func (t *translator) copied(base, sel string, f *ast.StructFieldDecl) string {
+	v := t.temp()
+	if sel == "->" {
+		return fmt.Sprintf("({ %s %s; memcpy(&%s, &(%s)->%s, sizeof %s); %s; })", t.ctype(f.Type), v, v, base, f.Name.Value, v, v)
+	}
+	o := t.temp()
+	return fmt.Sprintf("({ __typeof__(%s) %s = %s; %s %s; memcpy(&%s, &%s.%s, sizeof %s); %s; })",
+		base, o, base, t.ctype(f.Type), v, v, o, f.Name.Value, v, v)
+}
+
+func (t *translator) index(n *ast.IndexExpression) string {
+	lt := t.resolve(t.typeOf(n.Left))
+	if r, ok := n.Index.(*ast.RangeExpression); ok {
+		return t.slice(n, r, lt)
+	}
+	base, i := t.expr(n.Left), t.expr(n.Index)
+	switch {
+	case lt == nil:
+		t.errorf("cannot infer the type of %s", n.Left)
+		return "0"
+	case lt.Array && lt.Length == nil:
+		return fmt.Sprintf("(*(%s*)sango_array_get(%s, sango_index(%s, (%s)->length)))", t.ctype(lt.ElementType), base, i, base)
+	case lt.Array:
+		return fmt.Sprintf("(%s).data[sango_index(%s, %d)]", base, i, t.arrayLength(lt))
+	case lt.Pointer:
+		return fmt.Sprintf("(%s)[%s]", base, i)
+	case isNamed(lt, "string"):
+		return fmt.Sprintf("sango_string_at(%s, %s)", base, i)
+	}
+	t.errorf("cannot index %s", n.Left)
+	return "0"
+}
+
+func (t *translator) slice(n *ast.IndexExpression, r *ast.RangeExpression, lt *ast.TypeExpression) string {
+	o := t.temp()
+	start := "0"
+	if r.Start != nil {
+		start = t.expr(r.Start)
+	}
+	switch {
+	case lt != nil && lt.Array && lt.Length == nil:
+		end := o + "->length"
+		if r.End != nil {
+			end = t.expr(r.End)
+			if r.Inclusive {
+				end += " + 1"
+			}
+		}
+		return fmt.Sprintf("({ sango_array* %s = %s; sango_array_slice(%s, %s, %s); })", o, t.expr(n.Left), o, start, end)
+	case isNamed(lt, "string"):
+		end := fmt.Sprintf("(int64_t)strlen(%s)", o)
+		if r.End != nil {
+			end = t.expr(r.End)
+			if r.Inclusive {
+				end += " + 1"
+			}
+		}
+		return fmt.Sprintf("({ sango_string %s = %s; sango_string_slice(%s, %s, %s); })", o, t.expr(n.Left), o, start, end)
+	}
+	t.errorf("cannot slice %s", n.Left)
+	return "0"
+}
+
+func (t *translator) call(n *ast.CallExpression) string {
+	id, ok := n.Function.(*ast.Identifier)
+	if !ok {
+		if infix, ok := n.Function.(*ast.InfixExpression); ok && infix.Operator == "." {
+			t.errorf("cannot compile method calls yet")
+		} else {
+			t.errorf("cannot compile calls of %s yet", n.Function)
+		}
+		return "0"
+	}
+	name := id.Value
+	if t.local(name) {
+		t.errorf("cannot compile calls of function values yet")
+		return "0"
+	}
+	switch name {
+	case "len":
+		return t.length(n)
+	case "check":
+		if t.checks != nil {
+			return t.check(n)
+		}
+	}
+
+	args := []string{}
+	if fn := t.defs[name]; fn != nil {
+		if len(n.Arguments) != len(fn.Parameters) {
+			t.errorf("def %s expects %d arguments, got %d", name, len(fn.Parameters), len(n.Arguments))
+			return "0"
+		}
+		t.use(fn)
+		for i, arg := range n.Arguments {
+			args = append(args, t.value(arg, fn.Parameters[i].Type))
+		}
+		return fmt.Sprintf("sg_%s(%s)", name, strings.Join(args, ", "))
+	}
+	if fn := t.externs[name]; fn != nil {
+		for i, arg := range n.Arguments {
+			var want *ast.TypeExpression
+			if i < len(fn.Parameters) {
+				want = fn.Parameters[i].Type
+			}
+			args = append(args, t.value(arg, want))
+		}
+		return fmt.Sprintf("%s(%s)", t.extern(fn), strings.Join(args, ", "))
+	}
+	for _, arg := range n.Arguments {
+		args = append(args, t.expr(arg))
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+// extern returns the C symbol of an extern function, declaring it unless a
+// header sango.h or the program includes already does
+func (t *translator) extern(fn *ast.ExternFunction) string {
+	cname := fn.CName
+	if cname == "" {
+		cname = fn.Name.Value
+	}
+	if t.externSet[cname] {
+		return cname
+	}
+	t.externSet[cname] = true
+	if _, declared := t.cfuncs[cname]; declared {
+		return cname
+	}
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, t.ctype(p.Type))
+	}
+	if fn.Variadic {
+		params = append(params, "...")
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	ret := fn.ReturnType
+	if ret == nil {
+		ret = named("void")
+	}
+	fmt.Fprintf(&t.prototypes, "%s %s(%s);\n", t.ctype(ret), cname, strings.Join(params, ", "))
+	return cname
+}
+
+func (t *translator) length(n *ast.CallExpression) string {
+	if len(n.Arguments) != 1 {
+		t.errorf("len expects 1 argument, got %d", len(n.Arguments))
+		return "0"
+	}
+	arg := n.Arguments[0]
+	at := t.resolve(t.typeOf(arg))
+	switch {
+	case isNamed(at, "string"):
+		return fmt.Sprintf("((sango_int)strlen(%s))", t.expr(arg))
+	case at != nil && at.Array && at.Length == nil:
+		return fmt.Sprintf("((sango_int)(%s)->length)", t.expr(arg))
+	case at != nil && at.Array:
+		return fmt.Sprintf("((sango_int)%d)", t.arrayLength(at))
+	}
+	t.errorf("cannot infer the type of %s", arg)
+	return "0"
+}
+
+func (t *translator) interpolation(n *ast.InterpolatedString) string {
+	parts := []string{}
+	for _, part := range n.Parts {
+		switch p := part.(type) {
+		case *ast.StringLiteral:
+			if p.Value != "" {
+				parts = append(parts, cString(p.Value))
+			}
+		case *ast.Interpolation:
+			v := t.expr(p.Value)
+			switch p.Converter {
+			case ast.ConvertNone:
+				parts = append(parts, v)
+			case ast.ConvertShow:
+				t.errorf("cannot compile show methods yet")
+			case ast.ConvertFormat:
+				if isNamed(t.resolve(p.Type), "bool") {
+					v = fmt.Sprintf("sango_string_from_bool(%s)", v)
+				}
+				parts = append(parts, fmt.Sprintf("sango_string_format(%s, %s)", cString(p.CFormat), v))
+			default:
+				parts = append(parts, fmt.Sprintf("%s(%s)", p.Converter, v))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return `""`
+	}
+	s := parts[0]
+	for _, p := range parts[1:] {
+		s = fmt.Sprintf("sango_string_concat(%s, %s)", s, p)
+	}
+	return s
+}
+
+// arrayLiteral builds a dynamic array from its elements, or a fixed array
+// when want is one
+func (t *translator) arrayLiteral(n *ast.ArrayLiteral, want *ast.TypeExpression) string {
+	rw := t.resolve(want)
+	if rw != nil && len(rw.Tuple) > 0 {
+		return t.tupleLiteral(&ast.TupleLiteral{Token: n.Token, Elements: n.Elements}, want)
+	}
+	var elem *ast.TypeExpression
+	if rw != nil && rw.Array {
+		elem = rw.ElementType
+	} else if len(n.Elements) > 0 {
+		elem = t.typeOf(n.Elements[0])
+	}
+	if elem == nil {
+		t.errorf("cannot infer the element type of %s", n)
+		return "NULL"
+	}
+	elems := []string{}
+	for _, e := range n.Elements {
+		elems = append(elems, t.value(e, elem))
+	}
+	if rw != nil && rw.Array && rw.Length != nil {
+		if length := t.arrayLength(rw); int64(len(elems)) != length {
+			t.errorf("cannot use %d elements as %s", len(elems), want)
+		}
+		return fmt.Sprintf("((%s){{%s}})", t.ctype(want), strings.Join(elems, ", "))
+	}
+	ce := t.ctype(elem)
+	if len(elems) == 0 {
+		return fmt.Sprintf("sango_array_of(sizeof(%s), 0, NULL)", ce)
+	}
+	return fmt.Sprintf("sango_array_of(sizeof(%s), %d, (%s[]){%s})", ce, len(elems), ce, strings.Join(elems, ", "))
+}
+
+func (t *translator) tupleLiteral(n *ast.TupleLiteral, want *ast.TypeExpression) string {
+	rw := t.resolve(want)
+	typ := want
+	if rw == nil || len(rw.Tuple) != len(n.Elements) {
+		typ = t.typeOf(n)
+		rw = typ
+	}
+	if typ == nil {
+		t.errorf("cannot infer the type of %s", n)
+		return "0"
+	}
+	elems := []string{}
+	for i, e := range n.Elements {
+		elems = append(elems, t.value(e, &rw.Tuple[i]))
+	}
+	return fmt.Sprintf("((%s){%s})", t.ctype(typ), strings.Join(elems, ", "))
+}
+
+func (t *translator) structLiteral(n *ast.StructLiteral) string {
+	if n.Name == nil {
+		t.errorf("cannot compile record literals yet")
+		return "0"
+	}
+	rt := t.resolve(named(n.Name.Value))
+	s, ok := t.structs[rt.Name]
+	if !ok {
+		t.errorf("unknown struct %s", n.Name.Value)
+		return "0"
+	}
+	given := map[string]ast.Expression{}
+	for _, f := range n.Fields {
+		if structField(s, f.Name.Value) == nil {
+			t.errorf("%s has no field %s", s.Name.Value, f.Name.Value)
+		}
+		given[f.Name.Value] = f.Value
+	}
+	v := t.temp()
+	code := []string{fmt.Sprintf("%s %s = {0};", s.Name.Value, v)}
+	for _, f := range s.Fields {
+		value, ok := given[f.Name.Value]
+		if !ok {
+			value = f.Default
+		}
+		var c string
+		switch {
+		case value != nil:
+			c = t.value(value, f.Type)
+		case t.zero(f.Type) != "0" && !t.isComposite(t.resolve(f.Type)):
+			c = t.zero(f.Type)
+		default:
+			continue
+		}
+		if t.byCopy(f.Type) {
+			w := t.temp()
+			code = append(code, fmt.Sprintf("{ %s %s = %s; memcpy(&%s.%s, &%s, sizeof %s); }", t.ctype(f.Type), w, c, v, f.Name.Value, w, w))
+		} else {
+			code = append(code, fmt.Sprintf("%s.%s = %s;", v, f.Name.Value, c))
+		}
+	}
+	return fmt.Sprintf("({ %s %s; })", strings.Join(code, " "), v)
+}
+
+// blockValue translates a block used as an expression into a statement
+// expression
+func (t *translator) blockValue(b *ast.BlockStatement, want *ast.TypeExpression) string {
+	if b == nil || len(b.Statements) == 0 {
+		t.errorf("empty block has no value")
+		return "0"
+	}
+	if es, ok := b.Statements[0].(*ast.ExpressionStatement); ok && len(b.Statements) == 1 {
+		return t.value(es.Expression, want)
+	}
+	var v string
+	t.push()
+	code := t.capture(func() {
+		last := len(b.Statements) - 1
+		for _, stmt := range b.Statements[:last] {
+			t.statement(stmt)
+		}
+		es, ok := b.Statements[last].(*ast.ExpressionStatement)
+		if !ok || !yields(es) {
+			t.pos = position(b.Statements[last])
+			t.errorf("block has no value")
+			v = "0"
+			return
+		}
+		v = t.value(es.Expression, want)
+	})
+	t.pop()
+	return fmt.Sprintf("({ %s %s; })", code, v)
+}
+
+// match translates a match into a chain of ifs inside a statement
+// expression, which panics when no case matches
+func (t *translator) match(n *ast.MatchExpression, value bool) string {
+	st := t.typeOf(n.Value)
+	var rt *ast.TypeExpression
+	if value {
+		if rt = t.typeOf(n); rt == nil {
+			t.errorf("cannot infer the type of match")
+			return "0"
+		}
+	}
+	subject, result := t.temp(), t.temp()
+	code := t.capture(func() {
+		t.line("%s %s = %s;", t.declType(st), subject, t.expr(n.Value))
+		if value {
+			t.line("%s %s;", t.ctype(rt), result)
+		}
+		t.cases(n.Cases, subject, st, result, rt)
+	})
+	if value {
+		return fmt.Sprintf("({ %s %s; })", code, result)
+	}
+	return fmt.Sprintf("({ %s })", code)
+}
+
+func (t *translator) cases(cases []*ast.MatchCase, subject string, st *ast.TypeExpression, result string, rt *ast.TypeExpression) {
+	if len(cases) == 0 {
+		t.line("sango_panic(\"no match case\");")
+		return
+	}
+	mc := cases[0]
+	t.push()
+	defer t.pop()
+	cond := ""
+	switch pat := mc.Pattern.(type) {
+	case *ast.WildcardExpression:
+	case *ast.Identifier:
+		if _, bound := t.lookup(pat.Value); bound {
+			cond = t.binary("==", subject, st, t.expr(pat), t.typeOf(pat), nil)
+		} else {
+			t.line("%s %s = %s;", t.declType(st), t.bind(pat.Value, st), subject)
+		}
+	default:
+		cond = t.binary("==", subject, st, t.expr(pat), t.typeOf(pat), nil)
+	}
+	if mc.Guard != nil {
+		guard := t.expr(mc.Guard)
+		if cond == "" {
+			cond = guard
+		} else {
+			cond = fmt.Sprintf("%s && %s", cond, guard)
+		}
+	}
+	var body string
+	if rt != nil {
+		body = fmt.Sprintf("%s = %s;", result, t.value(mc.Value, rt))
+	} else {
+		body = t.expr(mc.Value) + ";"
+	}
+	if cond == "" {
+		t.line("%s", body)
+		return
+	}
+	t.line("if (%s) { %s } else {", cond, body)
+	t.cases(cases[1:], subject, st, result, rt)
+	t.line("}")
+}
+
+// typeOf infers the type of an expression like the semantic checks do. It
+// returns nil when the type cannot be inferred.
+func (t *translator) typeOf(e ast.Expression) *ast.TypeExpression {
+	switch n := e.(type) {
+	case *ast.IntegerLiteral:
+		if n.Type != "" {
+			return named(n.Type)
+		}
+		switch {
+		case n.Value < 0:
+			return named("u64")
+		case n.Value > math.MaxInt32:
+			return named("long")
+		}
+		return named("int")
+	case *ast.FloatLiteral:
+		if n.Type != "" {
+			return named(n.Type)
+		}
+		return named("double")
+	case *ast.StringLiteral, *ast.InterpolatedString:
+		return named("string")
+	case *ast.CharLiteral:
+		return named("char")
+	case *ast.BooleanLiteral:
+		return named("bool")
+	case *ast.NullLiteral:
+		return &ast.TypeExpression{Pointer: true, ElementType: named("void")}
+	case *ast.SizeofExpression, *ast.OffsetofExpression:
+		return named("u64")
+	case *ast.StructLiteral:
+		if n.Name != nil {
+			return named(n.Name.Value)
+		}
+	case *ast.ArrayLiteral:
+		if len(n.Elements) > 0 {
+			if elem := t.typeOf(n.Elements[0]); elem != nil {
+				return &ast.TypeExpression{Array: true, ElementType: elem}
+			}
+		}
+	case *ast.TupleLiteral:
+		tuple := &ast.TypeExpression{}
+		for _, elem := range n.Elements {
+			et := t.typeOf(elem)
+			if et == nil {
+				return nil
+			}
+			tuple.Tuple = append(tuple.Tuple, *et)
+		}
+		return tuple
+	case *ast.Identifier:
+		if b, ok := t.lookup(n.Value); ok {
+			return b.typ
+		}
+	case *ast.PrefixExpression:
+		switch n.Operator {
+		case "!":
+			return named("bool")
+		case "&":
+			if rt := t.typeOf(n.Right); rt != nil {
+				return &ast.TypeExpression{Pointer: true, ElementType: rt}
+			}
+		case "*":
+			if rt := t.resolve(t.typeOf(n.Right)); rt != nil && rt.Pointer {
+				return rt.ElementType
+			}
+		default:
+			return t.typeOf(n.Right)
+		}
+	case *ast.InfixExpression:
+		return t.infixType(n)
+	case *ast.IndexExpression:
+		lt := t.resolve(t.typeOf(n.Left))
+		switch {
+		case lt == nil:
+		case isRange(n.Index):
+			if isNamed(lt, "string") || (lt.Array && lt.Length == nil) {
+				return lt
+			}
+		case lt.Array, lt.Pointer:
+			return lt.ElementType
+		case isNamed(lt, "string"):
+			return named("u8")
+		}
+	case *ast.CallExpression:
+		return t.callType(n)
+	case *ast.IfExpression:
+		if n.Alternative != nil {
+			if ct := t.blockType(n.Consequence); ct != nil {
+				return ct
+			}
+			return t.blockType(n.Alternative)
+		}
+	case *ast.BlockStatement:
+		return t.blockType(n)
+	case *ast.MatchExpression:
+		for _, mc := range n.Cases {
+			t.push()
+			if id, ok := mc.Pattern.(*ast.Identifier); ok && !t.local(id.Value) {
+				if _, global := t.globals[id.Value]; !global {
+					t.scope.names[id.Value] = binding{typ: t.typeOf(n.Value)}
+				}
+			}
+			rt := t.typeOf(mc.Value)
+			t.pop()
+			if rt != nil {
+				return rt
+			}
+		}
+	}
+	return nil
+}
+
+func isRange(e ast.Expression) bool {
+	_, ok := e.(*ast.RangeExpression)
+	return ok
+}
+
+// untyped reports whether e is an integer literal without a suffix, which
+// takes the type of the other operand
+func untyped(e ast.Expression) bool {
+	if p, ok := e.(*ast.PrefixExpression); ok && p.Operator == "-" {
+		e = p.Right
+	}
+	lit, ok := e.(*ast.IntegerLiteral)
+	return ok && lit.Type == ""
+}
+
+// literal reports whether e is an array or tuple literal, which takes the
+// type of the other operand
+func literal(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.ArrayLiteral, *ast.TupleLiteral:
+		return true
+	}
+	return false
+}
+
+// operandType returns the type of an operand of a binary operator, which is
+// the type of the other operand for untyped literals
+func (t *translator) operandType(e, other ast.Expression) *ast.TypeExpression {
+	if untyped(e) && !untyped(other) {
+		if ot := t.resolve(t.typeOf(other)); isInteger(ot) || isFloat(ot) {
+			return ot
+		}
+	}
+	if literal(e) && !literal(other) {
+		if ot := t.typeOf(other); ot != nil {
+			return ot
+		}
+	}
+	return t.typeOf(e)
+}
+
+func (t *translator) infixType(n *ast.InfixExpression) *ast.TypeExpression {
+	switch n.Operator {
+	case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+		return named("bool")
+	case ".":
+		return t.fieldType(t.typeOf(n.Left), n.Right)
+	case "<<", ">>":
+		return t.operandType(n.Left, n.Right)
+	}
+	return t.arithmeticType(n.Left, n.Right)
+}
+
+// arithmeticType returns the type of arithmetic on two operands: the wider
+// of their types, char for a char and an integer, and string for strings
+func (t *translator) arithmeticType(left, right ast.Expression) *ast.TypeExpression {
+	lt, rt := t.operandType(left, right), t.operandType(right, left)
+	rl, rr := t.resolve(lt), t.resolve(rt)
+	if rl == nil || rr == nil {
+		return nil
+	}
+	if isNamed(rl, "string") && isNamed(rr, "string") {
+		return lt
+	}
+	if isNamed(rl, "char") && isInteger(rr) {
+		return lt
+	}
+	if isNamed(rr, "char") && isInteger(rl) {
+		return rt
+	}
+	lrank, lok := semantic.NumericRank(rl.Name)
+	rrank, rok := semantic.NumericRank(rr.Name)
+	if !lok || !rok || rl.Array || rr.Array || rl.Pointer || rr.Pointer {
+		if rl.Pointer {
+			return lt
+		}
+		return nil
+	}
+	if rrank > lrank {
+		return rt
+	}
+	return lt
+}
+
+func (t *translator) fieldType(typ *ast.TypeExpression, field ast.Expression) *ast.TypeExpression {
+	rt := t.resolve(typ)
+	if rt != nil && rt.Pointer {
+		rt = t.resolve(rt.ElementType)
+	}
+	if rt == nil {
+		return nil
+	}
+	switch f := field.(type) {
+	case *ast.IntegerLiteral:
+		if f.Value >= 0 && f.Value < int64(len(rt.Tuple)) {
+			return &rt.Tuple[f.Value]
+		}
+	case *ast.Identifier:
+		if rt.Record != nil {
+			for _, decl := range rt.Record.Fields {
+				if decl.Name.Value == f.Value {
+					return decl.Type
+				}
+			}
+		}
+		if s, ok := t.structs[rt.Name]; ok {
+			if decl := structField(s, f.Value); decl != nil {
+				return decl.Type
+			}
+		}
+	}
+	return nil
+}
+
+func (t *translator) callType(n *ast.CallExpression) *ast.TypeExpression {
+	id, ok := n.Function.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	if t.local(id.Value) {
+		b, _ := t.lookup(id.Value)
+		if ft := t.resolve(b.typ); ft != nil && ft.Function != nil {
+			if ft.Function.ReturnType == nil {
+				return named("void")
+			}
+			return ft.Function.ReturnType
+		}
+		return nil
+	}
+	switch id.Value {
+	case "len":
+		return named("int")
+	case "check":
+		if t.checks != nil {
+			return named("bool")
+		}
+	}
+	if fn := t.defs[id.Value]; fn != nil {
+		return t.returnType(fn)
+	}
+	if fn := t.externs[id.Value]; fn != nil {
+		if fn.ReturnType == nil {
+			return named("void")
+		}
+		return fn.ReturnType
+	}
+	if fn, ok := t.cfuncs[id.Value]; ok {
+		return cReturnType(fn.ReturnType)
+	}
+	return nil
+}
+
+// cReturnType translates the return type of a C library function
+func cReturnType(ret string) *ast.TypeExpression {
+	if ret == "*char" {
+		return named("string")
+	}
+	if strings.HasPrefix(ret, "*") {
+		elem := cinterop.ConvertCTypeToSango(strings.TrimPrefix(ret, "*"))
+		return &ast.TypeExpression{Pointer: true, ElementType: named(elem)}
+	}
+	name := cinterop.ConvertCTypeToSango(ret)
+	if _, ok := cTypeNames[name]; !ok {
+		return nil
+	}
+	return named(name)
+}
+
+// bodyType returns the type of the value of a function body
+func (t *translator) bodyType(body ast.Expression) *ast.TypeExpression {
+	if b, ok := body.(*ast.BlockStatement); ok {
+		return t.blockType(b)
+	}
+	return t.typeOf(body)
+}
+
+// blockType returns the type of the value of a block, which is void when it
+// does not end with an expression
+func (t *translator) blockType(b *ast.BlockStatement) *ast.TypeExpression {
+	if b == nil || len(b.Statements) == 0 {
+		return named("void")
+	}
+	t.push()
+	defer t.pop()
+	last := len(b.Statements) - 1
+	for _, stmt := range b.Statements[:last] {
+		t.declareTypes(stmt)
+	}
+	es, ok := b.Statements[last].(*ast.ExpressionStatement)
+	if !ok || !yields(es) {
+		return named("void")
+	}
+	return t.typeOf(es.Expression)
+}
+
+// declareTypes binds the names a statement declares to their types, so the
+// expressions after it can be typed without translating it
+func (t *translator) declareTypes(stmt ast.Statement) {
+	var names []*ast.Identifier
+	var typ *ast.TypeExpression
+	var value ast.Expression
+	switch s := stmt.(type) {
+	case *ast.ValStatement:
+		names, typ, value = s.Names, s.Type, s.Value
+	case *ast.VarStatement:
+		names, typ, value = s.Names, s.Type, s.Value
+	default:
+		return
+	}
+	if typ == nil && value != nil {
+		typ = t.typeOf(value)
+	}
+	if len(names) == 1 {
+		t.scope.names[names[0].Value] = binding{typ: typ}
+		return
+	}
+	rt := t.resolve(typ)
+	for i, name := range names {
+		b := binding{}
+		if rt != nil && i < len(rt.Tuple) {
+			b.typ = &rt.Tuple[i]
+		}
+		t.scope.names[name.Value] = b
+	}
+}
+
+// structField returns the declaration of a field of a struct, or nil
+func structField(s *ast.StructStatement, name string) *ast.StructFieldDecl {
+	for _, f := range s.Fields {
+		if f.Name != nil && f.Name.Value == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// helper returns the name of the helper function of kind for type te,
+// defining it with define the first time. It returns "" when define does.
+func (t *translator) helper(kind string, te *ast.TypeExpression, define func(name, ctype string) string) string {
+	key := kind + " " + t.resolve(te).String()
+	if name, ok := t.helperSet[key]; ok {
+		return name
+	}
+	name := fmt.Sprintf("sango_%s%d", kind, len(t.helperSet))
+	t.helperSet[key] = name
+	code := define(name, t.ctype(te))
+	if code == "" {
+		t.helperSet[key] = ""
+		return ""
+	}
+	t.helpers.WriteString("\n" + code)
+	return name
+}
+
+// elements returns the C expressions and types of the fields of a value v of
+// a tuple, record or struct type, or nil for other types
+func (t *translator) elements(te *ast.TypeExpression, v string) ([]string, []*ast.TypeExpression) {
+	rt := t.resolve(te)
+	values, types := []string{}, []*ast.TypeExpression{}
+	switch {
+	case len(rt.Tuple) > 0:
+		for i := range rt.Tuple {
+			values = append(values, fmt.Sprintf("%s._%d", v, i))
+			types = append(types, &rt.Tuple[i])
+		}
+	case rt.Record != nil:
+		for _, f := range rt.Record.Fields {
+			values = append(values, v+"."+f.Name.Value)
+			types = append(types, f.Type)
+		}
+	default:
+		s, ok := t.structs[rt.Name]
+		if !ok || rt.Array || rt.Pointer {
+			return nil, nil
+		}
+		for _, f := range s.Fields {
+			if t.byCopy(f.Type) {
+				values = append(values, t.copied(v, ".", f))
+			} else {
+				values = append(values, v+"."+f.Name.Value)
+			}
+			types = append(types, f.Type)
+		}
+	}
+	return values, types
+}
+
+// equal returns the function comparing two values of a tuple, record,
+// struct or array type
+func (t *translator) equal(te *ast.TypeExpression) string {
+	return t.helper("equal", te, func(name, ctype string) string {
+		fmt.Fprintf(&t.prototypes, "static bool %s(%s a, %s b);\n", name, ctype, ctype)
+		var body []string
+		rt := t.resolve(te)
+		switch {
+		case rt.Array && rt.Length == nil:
+			elem := t.ctype(rt.ElementType)
+			body = append(body,
+				"if (a->length != b->length) return false;",
+				"for (size_t i = 0; i < a->length; i++) {",
+				fmt.Sprintf("    if (!%s) return false;", t.binary("==", fmt.Sprintf("((%s*)a->data)[i]", elem), rt.ElementType, fmt.Sprintf("((%s*)b->data)[i]", elem), rt.ElementType, nil)),
+				"}")
+		case rt.Array:
+			body = append(body,
+				fmt.Sprintf("for (size_t i = 0; i < %d; i++) {", t.arrayLength(rt)),
+				fmt.Sprintf("    if (!%s) return false;", t.binary("==", "a.data[i]", rt.ElementType, "b.data[i]", rt.ElementType, nil)),
+				"}")
+		default:
+			as, types := t.elements(te, "a")
+			bs, _ := t.elements(te, "b")
+			for i := range as {
+				body = append(body, fmt.Sprintf("if (!%s) return false;", t.binary("==", as[i], types[i], bs[i], types[i], nil)))
+			}
+		}
+		body = append(body, "return true;")
+		return fmt.Sprintf("static bool %s(%s a, %s b) {\n    %s\n}\n", name, ctype, ctype, strings.Join(body, "\n    "))
+	})
+}
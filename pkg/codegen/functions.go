@@ -0,0 +1,730 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/cinterop"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// maxAliasDepth bounds the type aliases followed to resolve a type
+const maxAliasDepth = 64
+
+// translator translates the defs of a program into C. It starts from an
+// entry point, such as the body of a test, and translates the defs and
+// globals it uses as it meets them, so only the code that runs has to be
+// translatable.
+type translator struct {
+	g       *Generator
+	program *ast.Program
+	structs map[string]*ast.StructStatement
+	aliases map[string]*ast.TypeExpression
+	defs    map[string]*ast.FunctionStatement
+	externs map[string]*ast.ExternFunction
+	cfuncs  map[string]cinterop.FunctionSignature // of the headers sango.h and the program include
+	globals map[string]*global
+
+	typedefs   bytes.Buffer
+	prototypes bytes.Buffer // of helpers and defs
+	variables  bytes.Buffer
+	helpers    bytes.Buffer
+	functions  bytes.Buffer
+	typeNames  map[string]string // C names of tuple, record, fixed array and function types
+	helperSet  map[string]string // names of equality, read and write functions, by kind and type
+	externSet  map[string]bool
+	inits      map[int]string // initializations of globals, by position in the program
+
+	pending   []*ast.FunctionStatement
+	translate map[string]bool // defs translated or pending
+	returns   map[string]*ast.TypeExpression
+	inferring map[string]bool
+	queued    []*global
+
+	frame
+	temps int
+
+	asserts  []*Assert // nil unless asserts report their operands
+	checks   []*Check  // nil unless check can be called
+	dispatch bytes.Buffer
+	errors   []string
+}
+
+// frame is the state of the function being translated
+type frame struct {
+	out    *bytes.Buffer
+	indent int
+	scope  *scope
+	used   map[string]bool     // C names of its locals
+	result *ast.TypeExpression // its return type; nil outside of defs
+	pos    lexer.Token         // of the statement being translated, for errors
+}
+
+// global is a val or var declared at the top level
+type global struct {
+	index  int // of the declaration in the program
+	names  []*ast.Identifier
+	typ    *ast.TypeExpression
+	value  ast.Expression
+	pos    lexer.Token
+	types  []*ast.TypeExpression // of each name
+	typing bool
+	typed  bool
+	queued bool
+}
+
+// binding is a name visible to the code being translated
+type binding struct {
+	name string // in C
+	typ  *ast.TypeExpression
+}
+
+type scope struct {
+	names  map[string]binding
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{names: make(map[string]binding), parent: parent}
+}
+
+func newTranslator(g *Generator, program *ast.Program) *translator {
+	t := &translator{
+		g:         g,
+		program:   program,
+		structs:   make(map[string]*ast.StructStatement),
+		aliases:   make(map[string]*ast.TypeExpression),
+		defs:      make(map[string]*ast.FunctionStatement),
+		externs:   make(map[string]*ast.ExternFunction),
+		cfuncs:    make(map[string]cinterop.FunctionSignature),
+		globals:   make(map[string]*global),
+		typeNames: make(map[string]string),
+		helperSet: make(map[string]string),
+		externSet: make(map[string]bool),
+		inits:     make(map[int]string),
+		translate: make(map[string]bool),
+		returns:   make(map[string]*ast.TypeExpression),
+		inferring: make(map[string]bool),
+		errors:    []string{},
+	}
+	headers := []string{"stdio.h", "stdlib.h", "string.h"}
+	for i, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.StructStatement:
+			if s != nil && s.Name != nil {
+				t.structs[s.Name.Value] = s
+			}
+		case *ast.TypeStatement:
+			if s != nil && s.Name != nil && s.Type != nil {
+				t.aliases[s.Name.Value] = s.Type
+			}
+		case *ast.FunctionStatement:
+			if s != nil && s.Name != nil {
+				t.defs[s.Name.Value] = s
+			}
+		case *ast.ExternStatement:
+			for _, fn := range s.Functions {
+				t.externs[fn.Name.Value] = fn
+			}
+		case *ast.IncludeStatement:
+			headers = append(headers, s.Path)
+		case *ast.ValStatement:
+			t.declareGlobal(i, s.Names, s.Type, s.Value, s.Token)
+		case *ast.VarStatement:
+			t.declareGlobal(i, s.Names, s.Type, s.Value, s.Token)
+		}
+	}
+	for _, header := range headers {
+		for _, fn := range cinterop.GetFunctionsForHeader(header) {
+			t.cfuncs[fn.Name] = fn
+		}
+	}
+	return t
+}
+
+func (t *translator) declareGlobal(index int, names []*ast.Identifier, typ *ast.TypeExpression, value ast.Expression, pos lexer.Token) {
+	gl := &global{index: index, names: names, typ: typ, value: value, pos: pos}
+	for _, name := range names {
+		t.globals[name.Value] = gl
+	}
+}
+
+// errorf records an error at the statement being translated
+func (t *translator) errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf("%s at line %d:%d", fmt.Sprintf(format, args...), t.pos.Line, t.pos.Column))
+}
+
+// line writes a line of the function being translated
+func (t *translator) line(format string, args ...interface{}) {
+	t.out.WriteString(strings.Repeat("    ", t.indent))
+	fmt.Fprintf(t.out, format, args...)
+	t.out.WriteString("\n")
+}
+
+// capture returns the lines that write writes, joined into one
+func (t *translator) capture(write func()) string {
+	out, indent := t.out, t.indent
+	t.out, t.indent = &bytes.Buffer{}, 0
+	write()
+	code := strings.Join(strings.Fields(strings.ReplaceAll(t.out.String(), "\n", " ")), " ")
+	t.out, t.indent = out, indent
+	return code
+}
+
+// enter starts translating a function that returns result, returning the
+// state to restore when it is done
+func (t *translator) enter(result *ast.TypeExpression, pos lexer.Token) frame {
+	saved := t.frame
+	t.frame = frame{out: &bytes.Buffer{}, scope: newScope(nil), used: map[string]bool{}, result: result, pos: pos}
+	return saved
+}
+
+func (t *translator) leave(saved frame) {
+	t.frame = saved
+}
+
+func (t *translator) push() { t.scope = newScope(t.scope) }
+func (t *translator) pop()  { t.scope = t.scope.parent }
+
+// temp returns the name of a new temporary
+func (t *translator) temp() string {
+	t.temps++
+	return fmt.Sprintf("sango_v%d", t.temps)
+}
+
+// bind declares a local and returns its C name, which is renamed when it
+// would hide a local of the same function or a global it may refer to
+func (t *translator) bind(name string, typ *ast.TypeExpression) string {
+	cname := "sg_" + name
+	_, global := t.globals[name]
+	if global || t.defs[name] != nil || t.used[cname] {
+		for n := 2; ; n++ {
+			if candidate := fmt.Sprintf("sg_%s_%d", name, n); !t.used[candidate] {
+				cname = candidate
+				break
+			}
+		}
+	}
+	t.used[cname] = true
+	t.scope.names[name] = binding{name: cname, typ: typ}
+	return cname
+}
+
+// lookup finds a local or global
+func (t *translator) lookup(name string) (binding, bool) {
+	for s := t.scope; s != nil; s = s.parent {
+		if b, ok := s.names[name]; ok {
+			return b, true
+		}
+	}
+	return t.global(name)
+}
+
+// local reports whether name is a local of the function being translated
+func (t *translator) local(name string) bool {
+	for s := t.scope; s != nil; s = s.parent {
+		if _, ok := s.names[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// global returns a global, inferring its type and queueing its
+// initialization the first time it is used
+func (t *translator) global(name string) (binding, bool) {
+	gl, ok := t.globals[name]
+	if !ok {
+		return binding{}, false
+	}
+	if !gl.typed && !gl.typing {
+		gl.typing = true
+		scope := t.scope
+		t.scope = nil
+		gl.types = t.globalTypes(gl)
+		t.scope = scope
+		gl.typing, gl.typed = false, true
+	}
+	if !gl.queued {
+		gl.queued = true
+		t.queued = append(t.queued, gl)
+	}
+	b := binding{name: "sg_" + name}
+	for i, n := range gl.names {
+		if n.Value == name && i < len(gl.types) {
+			b.typ = gl.types[i]
+		}
+	}
+	return b, true
+}
+
+func (t *translator) globalTypes(gl *global) []*ast.TypeExpression {
+	if len(gl.names) == 1 {
+		typ := gl.typ
+		if typ == nil && gl.value != nil {
+			typ = t.typeOf(gl.value)
+		}
+		return []*ast.TypeExpression{typ}
+	}
+	types := make([]*ast.TypeExpression, len(gl.names))
+	typ := t.resolve(gl.typ)
+	if arr, ok := gl.value.(*ast.ArrayLiteral); ok && typ == nil && len(arr.Elements) == len(gl.names) {
+		for i, elem := range arr.Elements {
+			types[i] = t.typeOf(elem)
+		}
+		return types
+	}
+	if typ == nil && gl.value != nil {
+		typ = t.resolve(t.typeOf(gl.value))
+	}
+	if typ != nil && len(typ.Tuple) == len(gl.names) {
+		for i := range typ.Tuple {
+			types[i] = &typ.Tuple[i]
+		}
+	}
+	return types
+}
+
+// use queues a def for translation
+func (t *translator) use(fn *ast.FunctionStatement) {
+	if !t.translate[fn.Name.Value] {
+		t.translate[fn.Name.Value] = true
+		t.pending = append(t.pending, fn)
+	}
+}
+
+// finish translates the defs and globals used so far, and those they use
+func (t *translator) finish() {
+	for len(t.pending) > 0 || len(t.queued) > 0 {
+		if len(t.pending) > 0 {
+			fn := t.pending[0]
+			t.pending = t.pending[1:]
+			t.function(fn)
+			continue
+		}
+		gl := t.queued[0]
+		t.queued = t.queued[1:]
+		t.initialize(gl)
+	}
+}
+
+// initialize declares a global and translates its initialization, which
+// runs before the entry point
+func (t *translator) initialize(gl *global) {
+	saved := t.enter(nil, gl.pos)
+	defer t.leave(saved)
+
+	for i, name := range gl.names {
+		if gl.types[i] == nil {
+			t.errorf("cannot infer the type of %s", name.Value)
+			return
+		}
+		fmt.Fprintf(&t.variables, "static %s sg_%s;\n", t.ctype(gl.types[i]), name.Value)
+	}
+	if gl.value == nil {
+		for i, name := range gl.names {
+			t.line("sg_%s = %s;", name.Value, t.zero(gl.types[i]))
+		}
+	} else if len(gl.names) == 1 {
+		t.line("sg_%s = %s;", gl.names[0].Value, t.value(gl.value, gl.types[0]))
+	} else if arr, ok := gl.value.(*ast.ArrayLiteral); ok && len(arr.Elements) == len(gl.names) {
+		for i, name := range gl.names {
+			t.line("sg_%s = %s;", name.Value, t.value(arr.Elements[i], gl.types[i]))
+		}
+	} else {
+		typ := gl.typ
+		if typ == nil {
+			typ = t.typeOf(gl.value)
+		}
+		tmp := t.temp()
+		t.line("{")
+		t.line("    %s %s = %s;", t.ctype(typ), tmp, t.value(gl.value, typ))
+		for i, name := range gl.names {
+			t.line("    sg_%s = %s._%d;", name.Value, tmp, i)
+		}
+		t.line("}")
+	}
+	t.inits[gl.index] += t.out.String()
+}
+
+// assemble joins the translation into a C file: the headers, the types
+// and declarations it needs, prelude, the functions, the initializer of the
+// globals and main
+func (t *translator) assemble(prelude, main string) string {
+	var out bytes.Buffer
+	out.WriteString("#include <ctype.h>\n#include <math.h>\n#include \"sango.h\"\n")
+	for _, stmt := range t.program.Statements {
+		if inc, ok := stmt.(*ast.IncludeStatement); ok {
+			fmt.Fprintf(&out, "#include <%s>\n", inc.Path)
+		}
+	}
+	out.WriteString("\n")
+	out.WriteString(t.g.Structs(t.program))
+	for _, part := range []*bytes.Buffer{&t.typedefs, &t.prototypes, &t.variables} {
+		if part.Len() > 0 {
+			out.WriteString("\n")
+			out.Write(part.Bytes())
+		}
+	}
+	out.WriteString(prelude)
+	out.Write(t.helpers.Bytes())
+	out.Write(t.functions.Bytes())
+	out.WriteString("\n")
+	out.WriteString(t.initializer())
+	out.WriteString(main)
+	return out.String()
+}
+
+// initializer returns the function that initializes the globals in the
+// order they are declared
+func (t *translator) initializer() string {
+	indexes := []int{}
+	for i := range t.inits {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	var out bytes.Buffer
+	out.WriteString("static void sango_init(void) {\n")
+	for _, i := range indexes {
+		for _, line := range strings.SplitAfter(t.inits[i], "\n") {
+			if line != "" {
+				out.WriteString("    " + line)
+			}
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// returnType returns the return type of a def, inferring it from its body
+// when it is not declared. It returns nil when it cannot be inferred.
+func (t *translator) returnType(fn *ast.FunctionStatement) *ast.TypeExpression {
+	if fn.ReturnType != nil {
+		return fn.ReturnType
+	}
+	name := fn.Name.Value
+	if rt, ok := t.returns[name]; ok {
+		return rt
+	}
+	if t.inferring[name] {
+		return nil
+	}
+	t.inferring[name] = true
+	scope := t.scope
+	t.scope = newScope(nil)
+	for _, param := range fn.Parameters {
+		if param.Name != nil {
+			t.scope.names[param.Name.Value] = binding{typ: param.Type}
+		}
+	}
+	rt := t.bodyType(fn.Body)
+	t.scope = scope
+	delete(t.inferring, name)
+	if rt != nil {
+		t.returns[name] = rt
+	}
+	return rt
+}
+
+// function translates a def into a static C function
+func (t *translator) function(fn *ast.FunctionStatement) {
+	ret := t.returnType(fn)
+	saved := t.enter(ret, fn.Token)
+	defer t.leave(saved)
+
+	if ret == nil {
+		t.errorf("cannot infer the return type of def %s", fn.Name.Value)
+		return
+	}
+	params := []string{}
+	for _, param := range fn.Parameters {
+		if param.Type == nil {
+			t.errorf("parameter %s of def %s has no type", param.Name.Value, fn.Name.Value)
+			return
+		}
+		params = append(params, t.ctype(param.Type)+" "+t.bind(param.Name.Value, param.Type))
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	signature := fmt.Sprintf("static %s sg_%s(%s)", t.ctype(ret), fn.Name.Value, strings.Join(params, ", "))
+	fmt.Fprintf(&t.prototypes, "%s;\n", signature)
+	t.line("%s {", signature)
+	t.indent++
+	t.body(fn.Body, ret)
+	t.indent--
+	t.line("}")
+	t.functions.WriteString("\n")
+	t.functions.Write(t.out.Bytes())
+}
+
+// body translates the body of a function, returning the value of its last
+// expression unless it returns void
+func (t *translator) body(body ast.Expression, ret *ast.TypeExpression) {
+	void := isNamed(t.resolve(ret), "void")
+	block, ok := body.(*ast.BlockStatement)
+	if !ok {
+		if void {
+			t.line("%s;", t.expr(body))
+		} else {
+			t.line("return %s;", t.value(body, ret))
+		}
+		return
+	}
+	t.push()
+	defer t.pop()
+	for i, stmt := range block.Statements {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i == len(block.Statements)-1 && !void && yields(es) {
+			t.pos = es.Token
+			t.line("return %s;", t.value(es.Expression, ret))
+			continue
+		}
+		t.statement(stmt)
+	}
+}
+
+// yields reports whether a statement ending a block gives it its value: an
+// if without else is a statement
+func yields(es *ast.ExpressionStatement) bool {
+	ifx, ok := es.Expression.(*ast.IfExpression)
+	return !ok || ifx.Alternative != nil
+}
+
+func (t *translator) block(b *ast.BlockStatement) {
+	t.indent++
+	t.push()
+	if b != nil {
+		for _, stmt := range b.Statements {
+			t.statement(stmt)
+		}
+	}
+	t.pop()
+	t.indent--
+}
+
+func (t *translator) statement(stmt ast.Statement) {
+	t.pos = position(stmt)
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		t.expressionStatement(s.Expression)
+	case *ast.ValStatement:
+		t.binding(s.Names, s.Type, s.Value)
+	case *ast.VarStatement:
+		t.binding(s.Names, s.Type, s.Value)
+	case *ast.AssignmentStatement:
+		t.assign(s)
+	case *ast.ReturnStatement:
+		switch {
+		case t.result == nil:
+			t.errorf("return outside of a function")
+		case s.ReturnValue == nil:
+			t.line("return;")
+		default:
+			t.line("return %s;", t.value(s.ReturnValue, t.result))
+		}
+	case *ast.WhileStatement:
+		t.line("while (%s) {", t.expr(s.Condition))
+		t.block(s.Body)
+		t.line("}")
+	case *ast.ForStatement:
+		t.forStatement(s)
+	case *ast.AssertStatement:
+		if t.asserts != nil {
+			t.assert(s)
+		} else {
+			t.assertion(s)
+		}
+	case *ast.BlockStatement:
+		t.line("{")
+		t.block(s)
+		t.line("}")
+	default:
+		t.errorf("cannot compile %s statements yet", stmt.TokenLiteral())
+	}
+}
+
+// assertion translates an assert, which panics with the source of its
+// condition when it is false
+func (t *translator) assertion(s *ast.AssertStatement) {
+	message := fmt.Sprintf("%s at line %d:%d", semantic.Source(s.Expression), s.Token.Line, s.Token.Column)
+	t.line("sango_assert(%s, %s);", t.expr(s.Expression), cString(message))
+}
+
+// position returns the first token of a statement
+func position(stmt ast.Statement) lexer.Token {
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.ValStatement:
+		return s.Token
+	case *ast.VarStatement:
+		return s.Token
+	case *ast.AssignmentStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.WhileStatement:
+		return s.Token
+	case *ast.ForStatement:
+		return s.Token
+	case *ast.AssertStatement:
+		return s.Token
+	case *ast.BlockStatement:
+		return s.Token
+	case *ast.DeferStatement:
+		return s.Token
+	}
+	return lexer.Token{Literal: stmt.TokenLiteral()}
+}
+
+func (t *translator) expressionStatement(e ast.Expression) {
+	switch n := e.(type) {
+	case *ast.IfExpression:
+		t.ifStatement(n)
+	case *ast.BlockStatement:
+		t.line("{")
+		t.block(n)
+		t.line("}")
+	case *ast.MatchExpression:
+		t.line("%s;", t.match(n, false))
+	default:
+		t.line("%s;", t.expr(e))
+	}
+}
+
+func (t *translator) ifStatement(n *ast.IfExpression) {
+	t.line("if (%s) {", t.expr(n.Condition))
+	t.block(n.Consequence)
+	if n.Alternative != nil {
+		t.line("} else {")
+		t.block(n.Alternative)
+	}
+	t.line("}")
+}
+
+// binding translates val and var, destructuring tuples into several names
+func (t *translator) binding(names []*ast.Identifier, typ *ast.TypeExpression, value ast.Expression) {
+	if value == nil {
+		if typ == nil {
+			t.errorf("%s has neither a type nor a value", names[0].Value)
+			return
+		}
+		for _, name := range names {
+			t.line("%s %s = %s;", t.ctype(typ), t.bind(name.Value, typ), t.zero(typ))
+		}
+		return
+	}
+
+	if len(names) == 1 {
+		vt := typ
+		if vt == nil {
+			vt = t.typeOf(value)
+		}
+		c := t.value(value, typ)
+		t.line("%s %s = %s;", t.declType(vt), t.bind(names[0].Value, vt), c)
+		return
+	}
+
+	vt := typ
+	if vt == nil {
+		vt = t.typeOf(value)
+	}
+	rt := t.resolve(vt)
+	if rt == nil || len(rt.Tuple) != len(names) {
+		t.errorf("cannot destructure %s into %d names", value, len(names))
+		return
+	}
+	tmp := t.temp()
+	t.line("%s %s = %s;", t.ctype(vt), tmp, t.value(value, vt))
+	for i, name := range names {
+		elem := &rt.Tuple[i]
+		t.line("%s %s = %s._%d;", t.ctype(elem), t.bind(name.Value, elem), tmp, i)
+	}
+}
+
+// declType returns the C type to declare a variable of type te with, which
+// the C compiler infers when te is not known
+func (t *translator) declType(te *ast.TypeExpression) string {
+	if te == nil {
+		return "__auto_type"
+	}
+	return t.ctype(te)
+}
+
+func (t *translator) assign(s *ast.AssignmentStatement) {
+	b, ok := t.lookup(s.Name.Value)
+	if !ok {
+		t.errorf("undefined: %s", s.Name.Value)
+		return
+	}
+	if s.Operator == "=" {
+		t.line("%s = %s;", b.name, t.value(s.Value, b.typ))
+		return
+	}
+	op := s.Operator[:len(s.Operator)-1]
+	t.line("%s = %s;", b.name, t.binary(op, b.name, b.typ, t.expr(s.Value), t.typeOf(s.Value), b.typ))
+}
+
+// forStatement translates loops over ranges into counting loops, and loops
+// over arrays into loops over their elements
+func (t *translator) forStatement(s *ast.ForStatement) {
+	if r, ok := s.Iterable.(*ast.RangeExpression); ok {
+		if r.Start == nil || r.End == nil {
+			t.errorf("cannot iterate over a range without bounds")
+			return
+		}
+		typ := t.arithmeticType(r.Start, r.End)
+		if typ == nil {
+			typ = named("int")
+		}
+		start, end := t.expr(r.Start), t.expr(r.End)
+		cmp := "<"
+		if r.Inclusive {
+			cmp = "<="
+		}
+		t.push()
+		limit := t.temp()
+		v := t.bind(s.Variable.Value, typ)
+		t.line("for (%s %s = %s, %s = %s; %s %s %s; %s++) {", t.ctype(typ), v, start, limit, end, v, cmp, limit, v)
+		t.block(s.Body)
+		t.line("}")
+		t.pop()
+		return
+	}
+
+	it := t.typeOf(s.Iterable)
+	rt := t.resolve(it)
+	if rt == nil || !rt.Array {
+		t.errorf("cannot iterate over %s", s.Iterable)
+		return
+	}
+	arr, i := t.temp(), t.temp()
+	elem := rt.ElementType
+	t.line("{")
+	t.indent++
+	t.line("%s %s = %s;", t.ctype(it), arr, t.expr(s.Iterable))
+	value := fmt.Sprintf("%s.data[%s]", arr, i)
+	if rt.Length == nil {
+		t.line("for (size_t %s = 0; %s < %s->length; %s++) {", i, i, arr, i)
+		value = fmt.Sprintf("((%s*)%s->data)[%s]", t.ctype(elem), arr, i)
+	} else {
+		t.line("for (size_t %s = 0; %s < %d; %s++) {", i, i, t.arrayLength(rt), i)
+	}
+	t.indent++
+	t.push()
+	t.line("%s %s = %s;", t.ctype(elem), t.bind(s.Variable.Value, elem), value)
+	if s.Body != nil {
+		for _, stmt := range s.Body.Statements {
+			t.statement(stmt)
+		}
+	}
+	t.pop()
+	t.indent--
+	t.line("}")
+	t.indent--
+	t.line("}")
+}
@@ -0,0 +1,70 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// Program translates a module into C: its structs, every def that is not a
+// const def, and its globals, which a function sango_init initializes in
+// the order they are declared. It returns errors for code it cannot
+// compile yet.
+//
+// With main set, the module is the entry point of a program, and its def
+// main becomes the C main function. main initializes the globals, calls
+// the def, and exits with what it returns if it declares an integer return
+// type.
+func (g *Generator) Program(program *ast.Program, main bool) (string, []string) {
+	g.errors = []string{}
+	t := newTranslator(g, program)
+	var entry *ast.FunctionStatement
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionStatement:
+			if s == nil || s.Name == nil || s.Const {
+				continue
+			}
+			t.use(s)
+			if s.Name.Value == "main" {
+				entry = s
+			}
+		case *ast.ValStatement:
+			t.globalNames(s.Names)
+		case *ast.VarStatement:
+			t.globalNames(s.Names)
+		}
+	}
+	t.finish()
+
+	code := ""
+	if main {
+		if entry == nil {
+			t.errorf("the entry module has no def main")
+		} else {
+			code = t.entry(entry)
+		}
+	}
+	source := t.assemble("", code)
+	return source, append(g.Errors(), t.errors...)
+}
+
+// globalNames queues the globals of a declaration for initialization
+func (t *translator) globalNames(names []*ast.Identifier) {
+	for _, name := range names {
+		t.global(name.Value)
+	}
+}
+
+// entry returns the C main function that runs def main
+func (t *translator) entry(fn *ast.FunctionStatement) string {
+	t.pos = fn.Token
+	if len(fn.Parameters) > 0 {
+		t.errorf("def main takes no parameters")
+	}
+	call := "    sg_main();\n    return 0;\n"
+	if fn.ReturnType != nil && isInteger(t.resolve(fn.ReturnType)) {
+		call = "    return (int)sg_main();\n"
+	}
+	return fmt.Sprintf("\nint main(void) {\n    sango_init();\n%s}\n", call)
+}
@@ -0,0 +1,489 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// Executable is a C program that runs a test. A failed assert writes
+// "assert <id>" to file descriptor 3, followed by the values of its
+// operands, and exits with status 1.
+//
+// Run with the ids of checks as arguments, the program fails the calls of
+// check with those ids instead of running them: the runner has found them a
+// counterexample already. A failed check writes "check <id>" to file
+// descriptor 3 and exits with status 1.
+//
+// Run as "check <id>", the program reads arguments for the property of
+// check id from its input, one set after another, and writes "pass" or
+// "fail" to file descriptor 3 for each.
+//
+// Values are written and read as space separated fields: integers in
+// decimal, floats as C hexadecimal floats, bools as 0 or 1, strings as
+// their length, a colon and their bytes, dynamic arrays as their length and
+// elements, and fixed arrays, tuples and structs as their elements.
+type Executable struct {
+	Source    string
+	Libraries []string // to link, from the ABIs of extern declarations
+	Asserts   []*Assert
+	Checks    []*Check
+}
+
+// Assert is an assert statement reachable from a test and the operands
+// whose values it writes when it fails
+type Assert struct {
+	Statement *ast.AssertStatement
+	Operands  []Operand
+}
+
+// Operand is an operand of a failed comparison
+type Operand struct {
+	Expression ast.Expression
+	Type       *ast.TypeExpression
+}
+
+// Check is a call of check in a test
+type Check struct {
+	Call     *ast.CallExpression
+	Property *ast.FunctionLiteral
+	Count    int64 // of arguments to try; 0 leaves it to the runner
+}
+
+// Test translates a test and the code it uses into an executable. It
+// returns errors for code it cannot compile yet.
+func (g *Generator) Test(program *ast.Program, test *ast.TestStatement) (*Executable, []string) {
+	g.errors = []string{}
+	t := newTranslator(g, program)
+	t.asserts = []*Assert{}
+	t.checks = []*Check{}
+	t.prototypes.WriteString("static bool sango_checked(int id);\n")
+
+	saved := t.enter(nil, test.Token)
+	t.line("static void sango_test(void) {")
+	t.block(test.Body)
+	t.line("}")
+	t.functions.WriteString("\n")
+	t.functions.Write(t.out.Bytes())
+	t.leave(saved)
+	t.finish()
+
+	var main bytes.Buffer
+	fmt.Fprintf(&main, "\nstatic bool sango_failed[%d];\n", len(t.checks)+1)
+	main.WriteString(testMain)
+	main.WriteString("\nstatic int sango_check(int id) {\n    switch (id) {\n")
+	main.Write(t.dispatch.Bytes())
+	main.WriteString("    }\n    return 2;\n}\n")
+	main.WriteString(testEntry)
+
+	exe := &Executable{
+		Source:    "// Generated by sangoc\n" + t.assemble(harness, main.String()),
+		Libraries: libraries(program),
+		Asserts:   t.asserts,
+		Checks:    t.checks,
+	}
+	return exe, append(g.Errors(), t.errors...)
+}
+
+// libraries returns the libraries to link for the extern declarations of a
+// program, and libm
+func libraries(program *ast.Program) []string {
+	libs := []string{"m"}
+	seen := map[string]bool{"m": true, "c": true}
+	for _, stmt := range program.Statements {
+		if ext, ok := stmt.(*ast.ExternStatement); ok && !seen[ext.ABI] && ext.ABI != "C" {
+			seen[ext.ABI] = true
+			libs = append(libs, ext.ABI)
+		}
+	}
+	return libs
+}
+
+// assert translates an assert statement. When it compares values, their
+// operands are evaluated once and written on failure, so the runner can
+// report them.
+func (t *translator) assert(s *ast.AssertStatement) {
+	a := &Assert{Statement: s}
+	id := len(t.asserts)
+	t.asserts = append(t.asserts, a)
+
+	infix, ok := s.Expression.(*ast.InfixExpression)
+	if !ok || len(semantic.AssertOperands(s.Expression)) == 0 {
+		t.line("if (!(%s)) {", t.expr(s.Expression))
+		t.line("    sango_report_assert(%d);", id)
+		t.line("    sango_exit_report();")
+		t.line("}")
+		return
+	}
+
+	reported := map[ast.Expression]bool{}
+	for _, op := range semantic.AssertOperands(s.Expression) {
+		reported[op] = true
+	}
+	t.line("{")
+	t.indent++
+	writes := []string{}
+	side := func(e, other ast.Expression) (string, *ast.TypeExpression) {
+		typ := t.operandType(e, other)
+		if !reported[e] {
+			return t.value(e, typ), typ
+		}
+		v := t.temp()
+		t.line("%s %s = %s;", t.declType(typ), v, t.value(e, typ))
+		if writer := t.writer(typ); writer != "" {
+			a.Operands = append(a.Operands, Operand{Expression: e, Type: typ})
+			writes = append(writes, fmt.Sprintf("%s(sango_report, %s);", writer, v))
+		}
+		return v, typ
+	}
+	left, lt := side(infix.Left, infix.Right)
+	right, rt := side(infix.Right, infix.Left)
+	t.line("if (!%s) {", t.binary(infix.Operator, left, lt, right, rt, named("bool")))
+	t.line("    sango_report_assert(%d);", id)
+	for _, w := range writes {
+		t.line("    %s", w)
+	}
+	t.line("    sango_exit_report();")
+	t.line("}")
+	t.indent--
+	t.line("}")
+}
+
+// check translates a call of check in a test. Its property becomes a C
+// function that the executable runs on arguments it reads when run as
+// "check <id>"; in the test itself the call only reports whether the runner
+// has failed it.
+func (t *translator) check(n *ast.CallExpression) string {
+	if len(n.Arguments) < 1 || len(n.Arguments) > 2 {
+		t.errorf("check expects 1 or 2 arguments, got %d", len(n.Arguments))
+		return "false"
+	}
+	property, ok := n.Arguments[0].(*ast.FunctionLiteral)
+	if !ok {
+		t.errorf("check expects a function literal, got %s", n.Arguments[0])
+		return "false"
+	}
+	c := &Check{Call: n, Property: property}
+	if len(n.Arguments) == 2 {
+		count, ok := n.Arguments[1].(*ast.IntegerLiteral)
+		if !ok || count.Value <= 0 {
+			t.errorf("check expects a constant positive number of checks, got %s", n.Arguments[1])
+			return "false"
+		}
+		c.Count = count.Value
+	}
+	for _, p := range property.Parameters {
+		if p.Type == nil {
+			t.errorf("check cannot generate %s, which has no type", p.Name.Value)
+			return "false"
+		}
+	}
+	id := len(t.checks)
+	t.checks = append(t.checks, c)
+	t.property(id, property)
+	return fmt.Sprintf("sango_checked(%d)", id)
+}
+
+// property translates the property of a check into a function returning
+// whether it holds, and the case of sango_check that runs it
+func (t *translator) property(id int, fn *ast.FunctionLiteral) {
+	saved := t.enter(named("bool"), t.pos)
+	defer t.leave(saved)
+
+	params, args, reads := []string{}, []string{}, []string{}
+	for _, p := range fn.Parameters {
+		reader := t.reader(p.Type)
+		if reader == "" {
+			t.errorf("check cannot generate values of type %s", p.Type)
+			return
+		}
+		v := t.temp()
+		reads = append(reads, fmt.Sprintf("%s %s = %s(stdin);", t.ctype(p.Type), v, reader))
+		args = append(args, v)
+		params = append(params, t.ctype(p.Type)+" "+t.bind(p.Name.Value, p.Type))
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+
+	ret := t.bodyType(fn.Body)
+	switch rt := t.resolve(ret); {
+	case rt == nil:
+		t.errorf("cannot infer what the property of check returns")
+		return
+	case !isNamed(rt, "bool") && !isNamed(rt, "void"):
+		t.errorf("check expects a property that returns bool, got %s", ret)
+		return
+	}
+	signature := fmt.Sprintf("static bool sango_property%d(%s)", id, strings.Join(params, ", "))
+	fmt.Fprintf(&t.prototypes, "%s;\n", signature)
+	t.line("%s {", signature)
+	t.indent++
+	t.body(fn.Body, t.resolve(ret))
+	if isNamed(t.resolve(ret), "void") {
+		t.line("return true;")
+	}
+	t.indent--
+	t.line("}")
+	t.functions.WriteString("\n")
+	t.functions.Write(t.out.Bytes())
+
+	fmt.Fprintf(&t.dispatch, "    case %d:\n        while (sango_more(stdin)) {\n", id)
+	for _, read := range reads {
+		fmt.Fprintf(&t.dispatch, "            %s\n", read)
+	}
+	fmt.Fprintf(&t.dispatch, "            fputs(sango_property%d(%s) ? \"pass\\n\" : \"fail\\n\", sango_report);\n", id, strings.Join(args, ", "))
+	t.dispatch.WriteString("            fflush(sango_report);\n        }\n        return 0;\n")
+}
+
+// writer returns the function writing values of type te in the format the
+// runner reads, or "" for types it cannot write, such as pointers
+func (t *translator) writer(te *ast.TypeExpression) string {
+	rt := t.resolve(te)
+	if rt == nil || rt.Pointer || rt.Function != nil {
+		return ""
+	}
+	return t.helper("write", te, func(name, ctype string) string {
+		var body []string
+		switch {
+		case isNamed(rt, "string"):
+			body = append(body, "sango_write_string(f, v);")
+		case isNamed(rt, "bool"):
+			body = append(body, "fprintf(f, \"%d \", v ? 1 : 0);")
+		case isFloat(rt):
+			body = append(body, "fprintf(f, \"%a \", (double)v);")
+		case isUnsigned(rt):
+			body = append(body, "fprintf(f, \"%llu \", (unsigned long long)v);")
+		case isInteger(rt):
+			body = append(body, "fprintf(f, \"%lld \", (long long)v);")
+		case rt.Array:
+			elem := t.writer(rt.ElementType)
+			if elem == "" {
+				return ""
+			}
+			if rt.Length == nil {
+				body = append(body,
+					"fprintf(f, \"%zu \", v->length);",
+					"for (size_t i = 0; i < v->length; i++) {",
+					fmt.Sprintf("    %s(f, ((%s*)v->data)[i]);", elem, t.ctype(rt.ElementType)),
+					"}")
+			} else {
+				body = append(body,
+					fmt.Sprintf("for (size_t i = 0; i < %d; i++) {", t.arrayLength(rt)),
+					fmt.Sprintf("    %s(f, v.data[i]);", elem),
+					"}")
+			}
+		default:
+			values, types := t.elements(te, "v")
+			if values == nil {
+				return ""
+			}
+			for i, v := range values {
+				elem := t.writer(types[i])
+				if elem == "" {
+					return ""
+				}
+				body = append(body, fmt.Sprintf("%s(f, %s);", elem, v))
+			}
+		}
+		fmt.Fprintf(&t.prototypes, "static void %s(FILE* f, %s v);\n", name, ctype)
+		return fmt.Sprintf("static void %s(FILE* f, %s v) {\n    %s\n}\n", name, ctype, strings.Join(body, "\n    "))
+	})
+}
+
+// reader returns the function reading values of type te in the format the
+// runner writes, or "" for types it cannot read
+func (t *translator) reader(te *ast.TypeExpression) string {
+	rt := t.resolve(te)
+	if rt == nil || rt.Pointer || rt.Function != nil {
+		return ""
+	}
+	return t.helper("read", te, func(name, ctype string) string {
+		var body []string
+		switch {
+		case isNamed(rt, "string"):
+			body = append(body, "return sango_read_string(f);")
+		case isNamed(rt, "bool"):
+			body = append(body, "return sango_read_integer(f) != 0;")
+		case isFloat(rt):
+			body = append(body, fmt.Sprintf("return (%s)sango_read_float(f);", ctype))
+		case isUnsigned(rt):
+			body = append(body, fmt.Sprintf("return (%s)sango_read_unsigned(f);", ctype))
+		case isInteger(rt):
+			body = append(body, fmt.Sprintf("return (%s)sango_read_integer(f);", ctype))
+		case rt.Array:
+			elem := t.reader(rt.ElementType)
+			if elem == "" {
+				return ""
+			}
+			et := t.ctype(rt.ElementType)
+			if rt.Length == nil {
+				body = append(body,
+					"size_t n = (size_t)sango_read_unsigned(f);",
+					fmt.Sprintf("sango_array* v = sango_array_new(sizeof(%s), n);", et),
+					"for (size_t i = 0; i < n; i++) {",
+					fmt.Sprintf("    %s e = %s(f);", et, elem),
+					"    sango_array_push(v, &e);",
+					"}",
+					"return v;")
+			} else {
+				body = append(body,
+					fmt.Sprintf("%s v;", ctype),
+					fmt.Sprintf("for (size_t i = 0; i < %d; i++) {", t.arrayLength(rt)),
+					fmt.Sprintf("    v.data[i] = %s(f);", elem),
+					"}",
+					"return v;")
+			}
+		default:
+			body = append(body, fmt.Sprintf("%s v = {0};", ctype))
+			fields := []string{}
+			types := []*ast.TypeExpression{}
+			byCopy := []bool{}
+			switch {
+			case len(rt.Tuple) > 0:
+				for i := range rt.Tuple {
+					fields = append(fields, fmt.Sprintf("_%d", i))
+					types = append(types, &rt.Tuple[i])
+					byCopy = append(byCopy, false)
+				}
+			case rt.Record != nil:
+				for _, f := range rt.Record.Fields {
+					fields = append(fields, f.Name.Value)
+					types = append(types, f.Type)
+					byCopy = append(byCopy, false)
+				}
+			default:
+				s, ok := t.structs[rt.Name]
+				if !ok || rt.Array {
+					return ""
+				}
+				for _, f := range s.Fields {
+					fields = append(fields, f.Name.Value)
+					types = append(types, f.Type)
+					byCopy = append(byCopy, t.byCopy(f.Type))
+				}
+			}
+			for i, field := range fields {
+				elem := t.reader(types[i])
+				if elem == "" {
+					return ""
+				}
+				if byCopy[i] {
+					body = append(body, fmt.Sprintf("{ %s e = %s(f); memcpy(&v.%s, &e, sizeof e); }", t.ctype(types[i]), elem, field))
+				} else {
+					body = append(body, fmt.Sprintf("v.%s = %s(f);", field, elem))
+				}
+			}
+			body = append(body, "return v;")
+		}
+		fmt.Fprintf(&t.prototypes, "static %s %s(FILE* f);\n", ctype, name)
+		return fmt.Sprintf("static %s %s(FILE* f) {\n    %s\n}\n", ctype, name, strings.Join(body, "\n    "))
+	})
+}
+
+// harness is the part of every executable that reports to the runner
+const harness = `
+static FILE* sango_report;
+
+static void sango_report_assert(int id) {
+    fprintf(sango_report, "assert %d\n", id);
+}
+
+static void sango_exit_report(void) __attribute__((noreturn));
+static void sango_exit_report(void) {
+    fputc('\n', sango_report);
+    fflush(sango_report);
+    exit(1);
+}
+
+static void sango_write_string(FILE* f, sango_string s) {
+    size_t n = strlen(s);
+    fprintf(f, "%zu:", n);
+    fwrite(s, 1, n, f);
+    fputc(' ', f);
+}
+
+// sango_more skips spaces and reports whether there is more input
+static bool sango_more(FILE* f) {
+    int c;
+    while ((c = fgetc(f)) != EOF && isspace(c)) {
+    }
+    if (c == EOF) {
+        return false;
+    }
+    ungetc(c, f);
+    return true;
+}
+
+static long long sango_read_integer(FILE* f) {
+    long long n = 0;
+    if (fscanf(f, "%lld", &n) != 1) {
+        sango_panic("malformed input");
+    }
+    return n;
+}
+
+static unsigned long long sango_read_unsigned(FILE* f) {
+    unsigned long long n = 0;
+    if (fscanf(f, "%llu", &n) != 1) {
+        sango_panic("malformed input");
+    }
+    return n;
+}
+
+static double sango_read_float(FILE* f) {
+    char buf[64];
+    if (fscanf(f, "%63s", buf) != 1) {
+        sango_panic("malformed input");
+    }
+    return strtod(buf, NULL);
+}
+
+static sango_string sango_read_string(FILE* f) {
+    size_t n = (size_t)sango_read_unsigned(f);
+    if (fgetc(f) != ':') {
+        sango_panic("malformed input");
+    }
+    char* s = sango_alloc(n + 1);
+    if (fread(s, 1, n, f) != n) {
+        sango_panic("malformed input");
+    }
+    s[n] = '\0';
+    return s;
+}
+`
+
+// testMain is the part of a test executable that fails checks the runner
+// has found a counterexample for
+const testMain = `
+static bool sango_checked(int id) {
+    if (sango_failed[id]) {
+        fprintf(sango_report, "check %d\n", id);
+        sango_exit_report();
+    }
+    return true;
+}
+`
+
+const testEntry = `
+int main(int argc, char** argv) {
+    sango_report = fdopen(3, "w");
+    if (sango_report == NULL) {
+        sango_report = stderr;
+    }
+    sango_init();
+    if (argc == 3 && strcmp(argv[1], "check") == 0) {
+        return sango_check(atoi(argv[2]));
+    }
+    for (int i = 1; i < argc; i++) {
+        sango_failed[atoi(argv[i])] = true;
+    }
+    setvbuf(stdout, NULL, _IONBF, 0);
+    sango_test();
+    fflush(sango_report);
+    return 0;
+}
+`
@@ -0,0 +1,138 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// cTypeNames maps Sango type names to the C types declared in sango.h and
+// stdint.h
+var cTypeNames = map[string]string{
+	"int":    "sango_int",
+	"long":   "sango_long",
+	"float":  "sango_float",
+	"double": "sango_double",
+	"bool":   "sango_bool",
+	"string": "sango_string",
+	"void":   "void",
+	"char":   "sango_char",
+	"i8":     "int8_t",
+	"i16":    "int16_t",
+	"i32":    "int32_t",
+	"i64":    "int64_t",
+	"u8":     "uint8_t",
+	"u16":    "uint16_t",
+	"u32":    "uint32_t",
+	"u64":    "uint64_t",
+	"byte":   "uint8_t",
+	"f32":    "float",
+	"f64":    "double",
+}
+
+// CTypeName returns the C spelling of a named type. Names that are not
+// Sango primitives, such as structs, are used unchanged.
+func CTypeName(name string) string {
+	if c, ok := cTypeNames[name]; ok {
+		return c
+	}
+	return name
+}
+
+// isPrimitive reports whether name is a Sango primitive type, whose layout
+// must always be known
+func isPrimitive(name string) bool {
+	_, ok := cTypeNames[name]
+	return ok && name != "void"
+}
+
+// Declaration returns the C declaration of name with type te, such as
+// "uint8_t payload[16]" or "sango_int (*callback)(sango_int)". An empty
+// name yields an abstract declarator usable in casts and sizeof.
+func (g *Generator) Declaration(te *ast.TypeExpression, name string) (string, error) {
+	return g.declare(te, name)
+}
+
+// declare builds a C declarator from the inside out: pointers prefix the
+// declarator, while arrays and functions suffix it and bind tighter
+func (g *Generator) declare(te *ast.TypeExpression, inner string) (string, error) {
+	if te == nil {
+		return "", fmt.Errorf("missing type")
+	}
+
+	switch {
+	case te.Pointer:
+		return g.declare(te.ElementType, "*"+inner)
+	case te.Array && te.Length == nil:
+		return joinDecl("sango_array*", inner), nil
+	case te.Array:
+		n, err := g.layouts.ArrayLength(te)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(inner, "*") {
+			inner = "(" + inner + ")"
+		}
+		return g.declare(te.ElementType, fmt.Sprintf("%s[%d]", inner, n))
+	case te.Function != nil:
+		params := []string{}
+		for i := range te.Function.Parameters {
+			param, err := g.declare(&te.Function.Parameters[i], "")
+			if err != nil {
+				return "", err
+			}
+			params = append(params, param)
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		ret := te.Function.ReturnType
+		if ret == nil {
+			ret = &ast.TypeExpression{Name: "void"}
+		}
+		return g.declare(ret, "(*"+inner+")("+strings.Join(params, ", ")+")")
+	case len(te.Tuple) > 0:
+		fields := make([]*ast.StructFieldDecl, len(te.Tuple))
+		for i := range te.Tuple {
+			fields[i] = &ast.StructFieldDecl{
+				Name: &ast.Identifier{Value: fmt.Sprintf("_%d", i)},
+				Type: &te.Tuple[i],
+			}
+		}
+		return g.anonymousStruct(fields, inner)
+	case te.Record != nil:
+		return g.anonymousStruct(te.Record.Fields, inner)
+	}
+	if alias, ok := g.layouts.Alias(te.Name); ok {
+		var unknown *semantic.UnknownTypeError
+		if _, err := g.layouts.Named(te.Name); err != nil && !errors.As(err, &unknown) {
+			return "", err
+		}
+		return g.declare(alias, inner)
+	}
+	return joinDecl(CTypeName(te.Name), inner), nil
+}
+
+// anonymousStruct declares tuples and records as unnamed C structs, whose
+// members are laid out in the declared order
+func (g *Generator) anonymousStruct(fields []*ast.StructFieldDecl, inner string) (string, error) {
+	members := []string{}
+	for _, f := range fields {
+		decl, err := g.declare(f.Type, f.Name.Value)
+		if err != nil {
+			return "", err
+		}
+		members = append(members, decl+";")
+	}
+	return joinDecl("struct { "+strings.Join(members, " ")+" }", inner), nil
+}
+
+func joinDecl(base, inner string) string {
+	if inner == "" {
+		return base
+	}
+	return base + " " + inner
+}
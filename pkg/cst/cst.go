@@ -0,0 +1,310 @@
+// Package cst builds a lossless concrete syntax tree of Sango source.
+//
+// Every token keeps its source text and the whitespace and comments around
+// it as trivia: the trivia after a token up to and including the end of its
+// line is trailing, the rest is leading trivia of the next token. Printing
+// a tree gives back the source byte for byte, and printing it after editing
+// the Text or trivia of its tokens gives the edited source. Nodes group the
+// tokens of each statement, block, expression and type the parser builds,
+// and point to the ast.Node for them.
+package cst
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+// TriviaKind is the kind of a piece of trivia
+type TriviaKind int
+
+const (
+	// Whitespace is spaces and tabs, and anything else the lexer skips,
+	// such as a byte order mark
+	Whitespace   TriviaKind = iota
+	Newline                 // \n or \r\n
+	LineComment             // // and /// comments, without the line break
+	BlockComment            // /* */ and /** */ comments
+)
+
+// Trivia is source text between tokens
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
+
+// Token is a lexer token with its source text and trivia
+type Token struct {
+	lexer.Token
+	Text     string
+	Leading  []Trivia
+	Trailing []Trivia
+}
+
+// Node is the tokens of an ast.Node and the nodes inside it
+type Node struct {
+	AST      ast.Node
+	Tokens   []*Token // shared with the tree
+	Children []*Node
+	Parent   *Node
+}
+
+// Tree is the concrete syntax tree of a source file
+type Tree struct {
+	Source  string
+	Tokens  []*Token // ends with the EOF token, which holds the trailing trivia of the file
+	Root    *Node    // the node of Program
+	Program *ast.Program
+	Errors  []string // parser errors
+
+	nodes map[ast.Node]*Node
+}
+
+// Parse builds the tree of source. Source with syntax errors still gives a
+// complete tree, whose nodes for the broken parts hold ast.BadStatement and
+// ast.BadExpression values.
+func Parse(source string) *Tree {
+	tree := &Tree{Source: source, nodes: map[ast.Node]*Node{}}
+	tree.Tokens = tokens(source)
+
+	var spans []span
+	p := parser.New(lexer.New(source))
+	p.OnNode(func(node ast.Node, first, last lexer.Token) {
+		spans = append(spans, span{node: node, first: first.Offset, last: last.Offset, order: len(spans)})
+	})
+	tree.Program = p.ParseProgram()
+	tree.Errors = p.Errors()
+
+	tree.Root = &Node{AST: tree.Program, Tokens: tree.Tokens[:len(tree.Tokens)-1]}
+	tree.nodes[tree.Program] = tree.Root
+	tree.build(spans)
+	return tree
+}
+
+// String returns the source of the tree
+func (t *Tree) String() string {
+	var out bytes.Buffer
+	for _, tok := range t.Tokens {
+		tok.write(&out)
+	}
+	return out.String()
+}
+
+// Find returns the outermost node of an ast.Node of the tree, or nil
+func (t *Tree) Find(node ast.Node) *Node {
+	return t.nodes[node]
+}
+
+// At returns the innermost node whose tokens include the byte at offset,
+// or the root
+func (t *Tree) At(offset int) *Node {
+	node := t.Root
+	for {
+		var inner *Node
+		for _, child := range node.Children {
+			first, last := child.Tokens[0], child.Tokens[len(child.Tokens)-1]
+			if first.Offset <= offset && offset < last.End {
+				inner = child
+				break
+			}
+		}
+		if inner == nil {
+			return node
+		}
+		node = inner
+	}
+}
+
+// String returns the source of the node with its leading and trailing
+// trivia
+func (n *Node) String() string {
+	var out bytes.Buffer
+	for _, tok := range n.Tokens {
+		tok.write(&out)
+	}
+	return out.String()
+}
+
+// Text returns the source of the node from its first token to its last,
+// without the trivia around them
+func (n *Node) Text() string {
+	if len(n.Tokens) == 0 {
+		return ""
+	}
+	var out bytes.Buffer
+	for i, tok := range n.Tokens {
+		if i > 0 {
+			writeTrivia(&out, tok.Leading)
+		}
+		out.WriteString(tok.Text)
+		if i < len(n.Tokens)-1 {
+			writeTrivia(&out, tok.Trailing)
+		}
+	}
+	return out.String()
+}
+
+func (tok *Token) write(out *bytes.Buffer) {
+	writeTrivia(out, tok.Leading)
+	out.WriteString(tok.Text)
+	writeTrivia(out, tok.Trailing)
+}
+
+func writeTrivia(out *bytes.Buffer, trivia []Trivia) {
+	for _, tr := range trivia {
+		out.WriteString(tr.Text)
+	}
+}
+
+// tokens lexes source into tokens with trivia. Line breaks and doc comments,
+// which the lexer reports as tokens, become trivia.
+func tokens(source string) []*Token {
+	l := lexer.New(source)
+	result := []*Token{}
+	prev := 0
+	for {
+		tok := l.NextToken()
+		if tok.Type == lexer.NEWLINE || tok.Type == lexer.DOC_COMMENT {
+			continue
+		}
+
+		start := tok.Offset
+		if start < prev {
+			start = prev
+		}
+		gap := trivia(source[prev:start])
+		if len(result) > 0 {
+			last := result[len(result)-1]
+			n := trailing(gap)
+			last.Trailing, gap = gap[:n], gap[n:]
+		}
+
+		end := tok.End
+		if end < start {
+			end = start
+		}
+		result = append(result, &Token{Token: tok, Text: source[start:end], Leading: gap})
+		prev = end
+
+		if tok.Type == lexer.EOF {
+			return result
+		}
+	}
+}
+
+// trailing returns how many of the trivia after a token belong to it: those
+// up to and including the first line break
+func trailing(trivia []Trivia) int {
+	for i, tr := range trivia {
+		if tr.Kind == Newline {
+			return i + 1
+		}
+	}
+	return len(trivia)
+}
+
+// trivia splits the text between two tokens into trivia
+func trivia(text string) []Trivia {
+	result := []Trivia{}
+	for text != "" {
+		var tr Trivia
+		switch {
+		case text[0] == '\n':
+			tr = Trivia{Newline, "\n"}
+		case strings.HasPrefix(text, "\r\n"):
+			tr = Trivia{Newline, "\r\n"}
+		case strings.HasPrefix(text, "//"):
+			end := strings.IndexAny(text, "\r\n")
+			if end < 0 {
+				end = len(text)
+			}
+			tr = Trivia{LineComment, text[:end]}
+		case strings.HasPrefix(text, "/*"):
+			end := strings.Index(text[2:], "*/")
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += 4
+			}
+			tr = Trivia{BlockComment, text[:end]}
+		default:
+			end := 1
+			for end < len(text) && !startsTrivia(text[end:]) {
+				end++
+			}
+			tr = Trivia{Whitespace, text[:end]}
+		}
+		result = append(result, tr)
+		text = text[len(tr.Text):]
+	}
+	return result
+}
+
+// startsTrivia reports whether text starts a line break or comment
+func startsTrivia(text string) bool {
+	return text[0] == '\n' || strings.HasPrefix(text, "\r\n") ||
+		strings.HasPrefix(text, "//") || strings.HasPrefix(text, "/*")
+}
+
+// span is a node reported by the parser and the offsets of its first and
+// last tokens
+type span struct {
+	node        ast.Node
+	first, last int
+	order       int // nodes are reported after the nodes inside them
+	start, end  int // token indexes
+}
+
+// build nests the nodes of spans under the root
+func (t *Tree) build(spans []span) {
+	count := len(t.Tokens) - 1 // without EOF
+	if count == 0 {
+		return
+	}
+	for i := range spans {
+		s := &spans[i]
+		s.start = sort.Search(count, func(j int) bool { return t.Tokens[j].Offset >= s.first })
+		s.end = sort.Search(count, func(j int) bool { return t.Tokens[j].Offset > s.last }) - 1
+		if s.start >= count {
+			s.start = count - 1
+		}
+		if s.end < s.start {
+			s.end = s.start
+		}
+	}
+
+	// Outer nodes first: an earlier start, then a later end, then reported
+	// later
+	sort.SliceStable(spans, func(i, j int) bool {
+		a, b := spans[i], spans[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end > b.end
+		}
+		return a.order > b.order
+	})
+
+	type open struct {
+		node *Node
+		end  int
+	}
+	stack := []open{{t.Root, count - 1}}
+	for _, s := range spans {
+		for len(stack) > 1 && stack[len(stack)-1].end < s.start {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].node
+		node := &Node{AST: s.node, Tokens: t.Tokens[s.start : s.end+1], Parent: parent}
+		parent.Children = append(parent.Children, node)
+		if _, ok := t.nodes[s.node]; !ok {
+			t.nodes[s.node] = node
+		}
+		stack = append(stack, open{node, s.end})
+	}
+}
@@ -0,0 +1,145 @@
+package cst
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"   \n\n",
+		"val x = 5",
+		"\uFEFF// header\nval x = 5 // five\n\n/* gap */ var y = x\n",
+		"def add(a: int, b: int): int = {\r\n\treturn a + b;\r\n}\r\n",
+		"/// Doc\n/** more */\nstruct P { x: int, y: int }\nval p = P { x: 1, y: 2 }",
+		"val s = \"a ${x + 1:>4} b\" + r\"raw\" + \"\"\"\nmulti\n\"\"\"",
+		"val a = [1, 2, 3][..2]\nfor i <- 0..10 { println(i) } // loop",
+		"val = \nval y = (1 +\n/* unterminated",
+		"val x = 1\r\x00\nvar y = \"a\x00b\" // \x00\nval z = '\x00'",
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "parser", "testdata", "*.sango"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(source))
+	}
+
+	for i, input := range inputs {
+		tree := Parse(input)
+		if got := tree.String(); got != input {
+			t.Errorf("inputs[%d] - round trip differs\ngot:\n%q\nwant:\n%q", i, got, input)
+		}
+		eof := tree.Tokens[len(tree.Tokens)-1]
+		if got := tree.Root.String() + (&Node{Tokens: []*Token{eof}}).String(); got != input {
+			t.Errorf("inputs[%d] - root and EOF differ from the input", i)
+		}
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := "val x = 1 // one\n\n  /* two */ val y = 2\n"
+	tree := Parse(input)
+
+	// val x = 1 val y = 2 EOF
+	if len(tree.Tokens) != 9 {
+		t.Fatalf("expected 9 tokens, got %d", len(tree.Tokens))
+	}
+
+	one := tree.Tokens[3]
+	if one.Text != "1" {
+		t.Fatalf("expected token 1, got %q", one.Text)
+	}
+	wantTrailing := []Trivia{{Whitespace, " "}, {LineComment, "// one"}, {Newline, "\n"}}
+	if !sameTrivia(one.Trailing, wantTrailing) {
+		t.Errorf("trailing trivia of 1 - expected %v, got %v", wantTrailing, one.Trailing)
+	}
+
+	val := tree.Tokens[4]
+	wantLeading := []Trivia{{Newline, "\n"}, {Whitespace, "  "}, {BlockComment, "/* two */"}, {Whitespace, " "}}
+	if !sameTrivia(val.Leading, wantLeading) {
+		t.Errorf("leading trivia of val - expected %v, got %v", wantLeading, val.Leading)
+	}
+
+	eof := tree.Tokens[8]
+	if len(eof.Leading) != 0 || len(tree.Tokens[7].Trailing) != 1 {
+		t.Errorf("expected the last line break to trail 2, got %v and %v", tree.Tokens[7].Trailing, eof.Leading)
+	}
+}
+
+func TestMapping(t *testing.T) {
+	input := "def f(a: []int) = {\n  // sum\n  return a[0] + g(1, 2)\n}\nval z = f([1])\n"
+	tree := Parse(input)
+	if len(tree.Errors) > 0 {
+		t.Fatalf("parser errors: %v", tree.Errors)
+	}
+
+	fn := tree.Program.Statements[0].(*ast.FunctionStatement)
+	node := tree.Find(fn)
+	if node == nil {
+		t.Fatal("no node for the function")
+	}
+	if node.Parent != tree.Root {
+		t.Errorf("expected the function under the root")
+	}
+	if got, want := node.Text(), "def f(a: []int) = {\n  // sum\n  return a[0] + g(1, 2)\n}"; got != want {
+		t.Errorf("function text - expected %q, got %q", want, got)
+	}
+
+	ret := fn.Body.(*ast.BlockStatement).Statements[0].(*ast.ReturnStatement)
+	sum := tree.Find(ret.ReturnValue)
+	if sum == nil {
+		t.Fatal("no node for the return value")
+	}
+	if got := sum.Text(); got != "a[0] + g(1, 2)" {
+		t.Errorf("return value text - expected %q, got %q", "a[0] + g(1, 2)", got)
+	}
+	if sum.Parent == nil || sum.Parent.AST != ret {
+		t.Errorf("expected the return value inside the return statement")
+	}
+
+	infix := ret.ReturnValue.(*ast.InfixExpression)
+	if got := tree.Find(infix.Right).Text(); got != "g(1, 2)" {
+		t.Errorf("call text - expected %q, got %q", "g(1, 2)", got)
+	}
+	if got := tree.Find(fn.Parameters[0].Type).Text(); got != "[]int" {
+		t.Errorf("type text - expected %q, got %q", "[]int", got)
+	}
+
+	if got := tree.At(len("def f(a: []int) = {\n  // sum\n  return a[0] + g(")).AST; got.String() != "1" {
+		t.Errorf("expected the node at the offset of 1 to be 1, got %s", got.String())
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tree := Parse("val  x = 1 // keep\nprintln(x)\n")
+	for _, tok := range tree.Tokens {
+		if tok.Text == "x" {
+			tok.Text = "count"
+		}
+	}
+	if got, want := tree.String(), "val  count = 1 // keep\nprintln(count)\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func sameTrivia(a, b []Trivia) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+// Package doc renders the documentation of Sango declarations.
+//
+// Every top-level def, struct, type and impl is listed with its signature,
+// which is the declaration without its body, and the text of the /// or
+// /** */ doc comment before it. Methods are listed under their impl. The
+// result is Markdown, in which doc comments are written, or a standalone
+// HTML page.
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// Module is the documentation of a set of source files
+type Module struct {
+	Name  string
+	Decls []*Decl // in source order
+}
+
+// Decl is the documentation of one declaration
+type Decl struct {
+	Kind      string // def, struct, type or impl
+	Name      string
+	Signature string
+	Doc       string
+	Methods   []*Decl // for impl
+}
+
+// New collects the declarations of programs, in the order given
+func New(name string, programs ...*ast.Program) *Module {
+	m := &Module{Name: name, Decls: []*Decl{}}
+	for _, program := range programs {
+		for _, stmt := range program.Statements {
+			if d := declOf(stmt); d != nil {
+				m.Decls = append(m.Decls, d)
+			}
+		}
+	}
+	return m
+}
+
+func declOf(stmt ast.Statement) *Decl {
+	switch s := stmt.(type) {
+	case *ast.FunctionStatement:
+		if s == nil || s.Name == nil {
+			return nil
+		}
+		return &Decl{Kind: "def", Name: s.Name.Value, Signature: functionSignature(s), Doc: s.Doc}
+	case *ast.StructStatement:
+		if s == nil || s.Name == nil {
+			return nil
+		}
+		return &Decl{Kind: "struct", Name: s.Name.Value, Signature: structSignature(s), Doc: s.Doc}
+	case *ast.TypeStatement:
+		if s == nil || s.Name == nil || s.Type == nil {
+			return nil
+		}
+		sig := "type " + s.Name.Value + " " + s.Type.String()
+		return &Decl{Kind: "type", Name: s.Name.Value, Signature: sig, Doc: s.Doc}
+	case *ast.ImplStatement:
+		if s == nil || s.Type == nil {
+			return nil
+		}
+		d := &Decl{Kind: "impl", Name: s.Type.Value, Signature: "impl " + s.Type.Value, Doc: s.Doc}
+		for _, method := range s.Methods {
+			if m := declOf(method); m != nil {
+				d.Methods = append(d.Methods, m)
+			}
+		}
+		return d
+	}
+	return nil
+}
+
+// functionSignature renders a def without its body
+func functionSignature(fn *ast.FunctionStatement) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.String())
+	}
+	sig := "def " + fn.Name.Value + "(" + strings.Join(params, ", ") + ")"
+	if fn.ReturnType != nil {
+		sig += ": " + fn.ReturnType.String()
+	}
+	if fn.Const {
+		sig = "const " + sig
+	}
+	return sig
+}
+
+// structSignature renders a struct with one field per line
+func structSignature(s *ast.StructStatement) string {
+	var out bytes.Buffer
+	for _, attr := range s.Attributes {
+		out.WriteString(attr.String() + " ")
+	}
+	out.WriteString("struct " + s.Name.Value + " {\n")
+	for _, f := range s.Fields {
+		out.WriteString("    " + f.String() + "\n")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Anchor returns the id the declaration's heading is linked by
+func (d *Decl) Anchor() string {
+	name := strings.Map(func(r rune) rune {
+		if r == '*' || r == '&' {
+			return -1
+		}
+		return r
+	}, d.Name)
+	return d.Kind + "-" + name
+}
+
+// Markdown renders the module as Markdown
+func (m *Module) Markdown() string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# %s\n", m.Name)
+
+	if len(m.Decls) > 0 {
+		out.WriteString("\n")
+		for _, d := range m.Decls {
+			fmt.Fprintf(&out, "- [%s %s](#%s)\n", d.Kind, d.Name, d.Anchor())
+		}
+	}
+
+	for _, d := range m.Decls {
+		fmt.Fprintf(&out, "\n<a id=\"%s\"></a>\n\n## %s %s\n", d.Anchor(), d.Kind, d.Name)
+		writeMarkdownDecl(&out, d)
+		for _, method := range d.Methods {
+			fmt.Fprintf(&out, "\n### %s.%s\n", d.Name, method.Name)
+			writeMarkdownDecl(&out, method)
+		}
+	}
+	return out.String()
+}
+
+func writeMarkdownDecl(out *bytes.Buffer, d *Decl) {
+	fmt.Fprintf(out, "\n```sango\n%s\n```\n", d.Signature)
+	if d.Doc != "" {
+		fmt.Fprintf(out, "\n%s\n", d.Doc)
+	}
+}
+
+// Paragraphs splits the doc comment into paragraphs at blank lines
+func (d *Decl) Paragraphs() []string {
+	paragraphs := []string{}
+	for _, p := range strings.Split(d.Doc, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+var page = template.Must(template.New("doc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+h2, h3 { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{- if .Decls}}
+<ul>
+{{- range .Decls}}
+<li><a href="#{{.Anchor}}">{{.Kind}} {{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range $d := .Decls}}
+<h2 id="{{$d.Anchor}}">{{$d.Kind}} {{$d.Name}}</h2>
+<pre><code>{{$d.Signature}}</code></pre>
+{{- range $d.Paragraphs}}
+<p>{{.}}</p>
+{{- end}}
+{{- range $d.Methods}}
+<h3 id="{{$d.Anchor}}.{{.Name}}">{{$d.Name}}.{{.Name}}</h3>
+<pre><code>{{.Signature}}</code></pre>
+{{- range .Paragraphs}}
+<p>{{.}}</p>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML renders the module as a standalone HTML page
+func (m *Module) HTML() string {
+	var out bytes.Buffer
+	if err := page.Execute(&out, m); err != nil {
+		// The template only reads fields of m
+		panic(err)
+	}
+	return out.String()
+}
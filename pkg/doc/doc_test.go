@@ -0,0 +1,101 @@
+package doc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+const source = `/// A point in the plane.
+@packed struct Point {
+  x: i32
+  y: i32 = 0
+}
+
+/// Methods on points.
+impl Point {
+  /// Squared length.
+  def norm2(): i32 = x * x + y * y
+}
+
+/// Adds a and b.
+///
+/// Overflow wraps <silently>.
+const def add(a: int, b: int): int = a + b
+type Meters f64
+`
+
+func TestDecls(t *testing.T) {
+	m := New("geometry", parse(t, source))
+
+	tests := []struct {
+		kind      string
+		name      string
+		signature string
+		doc       string
+	}{
+		{"struct", "Point", "@packed struct Point {\n    x: i32\n    y: i32 = 0\n}", "A point in the plane."},
+		{"impl", "Point", "impl Point", "Methods on points."},
+		{"def", "add", "const def add(a: int, b: int): int", "Adds a and b.\n\nOverflow wraps <silently>."},
+		{"type", "Meters", "type Meters f64", ""},
+	}
+
+	if len(m.Decls) != len(tests) {
+		t.Fatalf("expected %d declarations, got %d", len(tests), len(m.Decls))
+	}
+	for i, tt := range tests {
+		d := m.Decls[i]
+		if d.Kind != tt.kind || d.Name != tt.name || d.Signature != tt.signature || d.Doc != tt.doc {
+			t.Errorf("decls[%d] - expected %s %s %q %q, got %s %s %q %q",
+				i, tt.kind, tt.name, tt.signature, tt.doc, d.Kind, d.Name, d.Signature, d.Doc)
+		}
+	}
+
+	methods := m.Decls[1].Methods
+	if len(methods) != 1 || methods[0].Signature != "def norm2(): i32" || methods[0].Doc != "Squared length." {
+		t.Errorf("wrong methods: %+v", methods)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	out := New("geometry", parse(t, source)).Markdown()
+
+	for _, want := range []string{
+		"# geometry\n",
+		"- [def add](#def-add)\n",
+		"## def add\n\n```sango\nconst def add(a: int, b: int): int\n```\n\nAdds a and b.\n\nOverflow wraps <silently>.\n",
+		"### Point.norm2\n\n```sango\ndef norm2(): i32\n```\n\nSquared length.\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	out := New("geometry", parse(t, source)).HTML()
+
+	for _, want := range []string{
+		"<title>geometry</title>",
+		`<h2 id="def-add">def add</h2>`,
+		"<p>Adds a and b.</p>\n<p>Overflow wraps &lt;silently&gt;.</p>",
+		`<h3 id="impl-Point.norm2">Point.norm2</h3>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/cinterop"
+	"github.com/rxxuzi/sango/pkg/project"
+)
+
+// Options control a build
+type Options struct {
+	Runtime string    // directory holding the runtime's sango.c and sango.h
+	Version string    // compiler version, part of every build cache key
+	Jobs    int       // modules to compile at once; the number of CPUs if 0
+	Verbose bool      // write the commands that are run to Log
+	Log     io.Writer // progress messages; nil discards them
+}
+
+// ModuleError holds the errors of a module that failed to compile
+type ModuleError struct {
+	File   string
+	Errors []string
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("%s:\n  %s", e.File, strings.Join(e.Errors, "\n  "))
+}
+
+// BuildError holds the errors of every module that failed to compile, in
+// module order
+type BuildError []*ModuleError
+
+func (e BuildError) Error() string {
+	msgs := make([]string, len(e))
+	for i, m := range e {
+		msgs[i] = m.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Build compiles each module of the project to C and to an object file
+// under the build directory, compiles the runtime, and links them into an
+// executable named after the package. It returns the executable's path.
+//
+// Modules are translated and compiled on up to Jobs goroutines at a time,
+// following the graph of buildGraph. Each module is analyzed with
+// registries of its own, and the results are gathered in module order, so
+// the log and the errors come out the same however the work was scheduled.
+//
+// Modules and object files whose inputs have not changed since an earlier
+// build are taken from the build cache instead; with Verbose set, Build
+// logs what it reused.
+//
+// The def main of the entry module becomes the C main function of the
+// executable; an entry module without one is an error.
+func Build(m *project.Manifest, opts Options) (string, error) {
+	log := opts.Log
+	if log == nil {
+		log = ioutil.Discard
+	}
+	runtime := filepath.Join(opts.Runtime, "sango.c")
+	if _, err := os.Stat(runtime); err != nil {
+		return "", fmt.Errorf("runtime not found: %s", runtime)
+	}
+
+	modules, err := m.Modules()
+	if err != nil {
+		return "", err
+	}
+
+	out := m.Path(project.BuildDir)
+	cache := &cache{dir: filepath.Join(out, CacheDir)}
+	cflags := append([]string{}, m.CFlags...)
+	cflags = append(cflags, "-I", opts.Runtime)
+	headerDirs := []string{opts.Runtime}
+	for _, dir := range m.Include {
+		cflags = append(cflags, "-I", m.Path(dir))
+		headerDirs = append(headerDirs, m.Path(dir))
+	}
+	// Objects depend on the project's headers as well as on their C; the
+	// system headers are assumed not to change
+	headers, err := hashHeaders(headerDirs)
+	if err != nil {
+		return "", err
+	}
+	code, err := ioutil.ReadFile(runtime)
+	if err != nil {
+		return "", err
+	}
+
+	type object struct {
+		name string // what the log calls the C file
+		src  cSource
+		path string
+
+		reused bool
+		log    bytes.Buffer // the commands run, for Verbose
+		err    error
+	}
+	compile := func(o *object) {
+		key := objectKey(opts.Version, m.CC, cflags, headers+o.src.code)
+		if cache.object(key, o.path) {
+			o.reused = true
+			return
+		}
+		if o.err = os.MkdirAll(filepath.Dir(o.path), 0755); o.err != nil {
+			return
+		}
+		args := append(append([]string{}, cflags...), "-c", o.src.path, "-o", o.path)
+		if o.err = run(&o.log, opts.Verbose, m.CC, args...); o.err != nil {
+			return
+		}
+		o.err = cache.storeObject(key, o.path)
+	}
+
+	// Every module is translated even if another fails, so that all the
+	// errors are reported at once. The object of a module is compiled as
+	// soon as its C is written, and the runtime alongside the translations.
+	n := len(modules)
+	translated := make([]*translation, n)
+	objects := make([]*object, n+1)
+	parallel(opts.Jobs, buildGraph(n), func(i int) {
+		switch {
+		case i < n:
+			translated[i] = translate(m, cache, opts.Version, modules[i], modules[i] == m.EntryPath())
+		case i < 2*n:
+			t := translated[i-n]
+			if t.err != nil || len(t.errors) > 0 {
+				return
+			}
+			rel, _ := filepath.Rel(filepath.Join(out, "c"), t.source.path)
+			path := filepath.Join(out, "obj", strings.TrimSuffix(rel, ".c")+".o")
+			objects[i-n] = &object{name: filepath.ToSlash(rel), src: t.source, path: path}
+			compile(objects[i-n])
+		default:
+			objects[n] = &object{name: "runtime", src: cSource{runtime, string(code)}, path: filepath.Join(out, "obj", "sango-runtime.o")}
+			compile(objects[n])
+		}
+	})
+
+	registry := cinterop.NewFunctionRegistry()
+	for _, lib := range m.Libs {
+		registry.AddLibrary(lib)
+	}
+	reusedModules := 0
+	var failed BuildError
+	for i, t := range translated {
+		if t.err != nil {
+			return "", t.err
+		}
+		if len(t.errors) > 0 {
+			failed = append(failed, &ModuleError{File: relative(m, modules[i]), Errors: t.errors})
+			continue
+		}
+		if t.reused {
+			reusedModules++
+			if opts.Verbose {
+				fmt.Fprintf(log, "reuse %s\n", relative(m, modules[i]))
+			}
+		}
+		for _, lib := range t.libs {
+			registry.AddLibrary(lib)
+		}
+	}
+	if len(failed) > 0 {
+		return "", failed
+	}
+
+	paths := []string{}
+	reusedObjects := 0
+	for _, o := range objects {
+		paths = append(paths, o.path)
+		if o.reused {
+			reusedObjects++
+			if opts.Verbose {
+				rel, _ := filepath.Rel(filepath.Join(out, "obj"), o.path)
+				fmt.Fprintf(log, "reuse %s\n", filepath.ToSlash(rel))
+			}
+			continue
+		}
+		fmt.Fprintf(log, "compile %s\n", o.name)
+		log.Write(o.log.Bytes())
+		if o.err != nil {
+			return "", o.err
+		}
+	}
+	if opts.Verbose {
+		fmt.Fprintf(log, "reused %d of %d modules and %d of %d objects\n", reusedModules, len(modules), reusedObjects, len(objects))
+	}
+
+	exe := filepath.Join(out, m.Name)
+	args := append(append([]string{}, paths...), "-o", exe)
+	args = append(args, m.LDFlags...)
+	args = append(args, registry.LinkFlags()...)
+	fmt.Fprintf(log, "link %s\n", exe)
+	if err := run(log, opts.Verbose, m.CC, args...); err != nil {
+		return "", err
+	}
+	return exe, nil
+}
+
+// buildGraph returns the dependencies of the tasks of a build of n modules:
+// tasks 0 to n-1 translate the modules, tasks n to 2n-1 compile their C, and
+// task 2n compiles the runtime. Sango has no import statement yet, so no
+// translation waits for another.
+func buildGraph(n int) [][]int {
+	deps := make([][]int, 2*n+1)
+	for i := 0; i < n; i++ {
+		deps[n+i] = []int{i}
+	}
+	return deps
+}
+
+// translation is the result of translating a module to C
+type translation struct {
+	source cSource
+	libs   []string // libraries the module links
+	reused bool     // taken from the build cache
+
+	errors []string // errors in the module
+	err    error    // failure to read or write files
+}
+
+// translate analyzes a module and writes its C to the build directory,
+// unless the build cache has it. It only touches files of its own module,
+// so modules can be translated concurrently. The entry module is
+// translated with a C main.
+func translate(m *project.Manifest, cache *cache, version, file string, main bool) *translation {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return &translation{err: err}
+	}
+	rel := relative(m, file)
+	key := moduleKey(version, rel, string(source), main)
+
+	t := &translation{}
+	entry, c, ok := cache.module(key)
+	if ok {
+		t.libs = entry.Libraries
+		t.reused = true
+	} else {
+		unit, errors := Analyze(string(source))
+		if len(errors) == 0 {
+			c, errors = unit.C(rel, main)
+		}
+		if len(errors) > 0 {
+			return &translation{errors: errors}
+		}
+		if err := cache.storeModule(key, unit, c); err != nil {
+			return &translation{err: err}
+		}
+		t.libs = unit.Parser.CRegistry().Libraries()
+	}
+
+	t.source = cSource{filepath.Join(m.Path(project.BuildDir), "c", strings.TrimSuffix(rel, ".sango")+".c"), c}
+	t.err = writeFile(t.source.path, c)
+	return t
+}
+
+// cSource is a C file and its text
+type cSource struct {
+	path, code string
+}
+
+// hashHeaders returns a hash of the names and contents of the C headers in
+// dirs and their subdirectories
+func hashHeaders(dirs []string) (string, error) {
+	parts := []string{"headers"}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() || filepath.Ext(path) != ".h" {
+				return nil
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, path, string(data))
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hash(parts...), nil
+}
+
+// relative returns the path of a module relative to the project directory
+func relative(m *project.Manifest, file string) string {
+	if rel, err := filepath.Rel(m.Dir, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+func writeFile(path, text string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(text), 0644)
+}
+
+// run runs a command, returning its output in the error if it fails
+func run(log io.Writer, verbose bool, name string, args ...string) error {
+	if verbose {
+		fmt.Fprintf(log, "  %s %s\n", name, strings.Join(args, " "))
+	}
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v\n%s", name, strings.Join(args, " "), err, output)
+	}
+	return nil
+}
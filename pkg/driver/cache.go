@@ -0,0 +1,159 @@
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// CacheDir is the directory, relative to the build directory, of the build
+// cache
+const CacheDir = "cache"
+
+// cache stores the results of analyzing and compiling modules. Entries are
+// named by a hash of everything that went into them, so an entry is never
+// stale, only unused.
+//
+//	modules/<key>/module.json  libraries and type layouts
+//	modules/<key>/ast.json     the analyzed AST
+//	modules/<key>/module.c     the generated C
+//	objects/<key>.o            an object file, keyed by its C and flags
+type cache struct {
+	dir string
+}
+
+// moduleEntry is the module.json of a cached module
+type moduleEntry struct {
+	Libraries []string                   `json:"libraries"`
+	Types     map[string]semantic.Layout `json:"types"`
+}
+
+// hash returns the hex SHA-256 of parts, each prefixed by its length so that
+// no two lists of parts hash alike
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// moduleKey is the cache key of a module: the compiler version, its path,
+// which the generated C names, its source and whether it is the entry
+// module. Sango has no import statement yet; when it has, the key will
+// take in what the imported modules export, and only that.
+func moduleKey(version, rel, source string, main bool) string {
+	return hash("module", version, rel, source, fmt.Sprint(main))
+}
+
+// objectKey is the cache key of an object file: the compiler version, the C
+// compiler and its flags, and the C it compiles
+func objectKey(version, cc string, cflags []string, c string) string {
+	return hash(append([]string{"object", version, cc, c}, cflags...)...)
+}
+
+// module returns the cached entry and C of a module
+func (c *cache) module(key string) (*moduleEntry, string, bool) {
+	dir := filepath.Join(c.dir, "modules", key)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "module.json"))
+	if err != nil {
+		return nil, "", false
+	}
+	entry := &moduleEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, "", false
+	}
+	code, err := ioutil.ReadFile(filepath.Join(dir, "module.c"))
+	if err != nil {
+		return nil, "", false
+	}
+	return entry, string(code), true
+}
+
+// storeModule caches an analyzed module. module.json is written last, so an
+// entry whose writing was interrupted is never read.
+func (c *cache) storeModule(key string, unit *Unit, code string) error {
+	dir := filepath.Join(c.dir, "modules", key)
+	data, err := ast.Marshal(unit.Program)
+	if err != nil {
+		return err
+	}
+	if err := store(filepath.Join(dir, "ast.json"), data); err != nil {
+		return err
+	}
+	if err := store(filepath.Join(dir, "module.c"), []byte(code)); err != nil {
+		return err
+	}
+
+	entry := moduleEntry{
+		Libraries: unit.Parser.CRegistry().Libraries(),
+		Types:     map[string]semantic.Layout{},
+	}
+	for _, stmt := range unit.Program.Statements {
+		name := ""
+		switch s := stmt.(type) {
+		case *ast.StructStatement:
+			name = s.Name.Value
+		case *ast.TypeStatement:
+			name = s.Name.Value
+		default:
+			continue
+		}
+		if layout, err := unit.Evaluator.Layouts().Named(name); err == nil {
+			entry.Types[name] = layout
+		}
+	}
+	data, err = json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store(filepath.Join(dir, "module.json"), data)
+}
+
+// object copies the cached object file with the given key to obj
+func (c *cache) object(key, obj string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, "objects", key+".o"))
+	if err != nil {
+		return false
+	}
+	return writeFile(obj, string(data)) == nil
+}
+
+// storeObject caches the object file obj under key
+func (c *cache) storeObject(key, obj string) error {
+	data, err := ioutil.ReadFile(obj)
+	if err != nil {
+		return err
+	}
+	return store(filepath.Join(c.dir, "objects", key+".o"), data)
+}
+
+// store writes a file of the cache by renaming a temporary file, so that a
+// partly written file is never read, even by builds running at once
+func store(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
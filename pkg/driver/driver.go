@@ -0,0 +1,89 @@
+// Package driver runs the stages of the compiler over a source file, and
+// over the modules of a project to build it with the C compiler.
+package driver
+
+import (
+	"fmt"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/codegen"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/macro"
+	"github.com/rxxuzi/sango/pkg/parser"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// Unit is an analyzed source file
+type Unit struct {
+	Program   *ast.Program
+	Parser    *parser.Parser // holds the C functions and libraries the file declares
+	Evaluator *semantic.Evaluator
+}
+
+// Analyze parses source, expands macros, fills in struct defaults, folds
+// constants and checks string interpolations, stopping after the first
+// stage that reports errors. Test and bench declarations are dropped after
+// parsing.
+func Analyze(source string) (*Unit, []string) {
+	return analyze(source, false)
+}
+
+// AnalyzeTests analyzes source like Analyze, but keeps its test and bench
+// declarations, as sangoc test and sangoc bench do
+func AnalyzeTests(source string) (*Unit, []string) {
+	return analyze(source, true)
+}
+
+func analyze(source string, tests bool) (*Unit, []string) {
+	p := parser.New(lexer.New(source))
+	u := &Unit{Program: p.ParseProgram(), Parser: p, Evaluator: semantic.NewEvaluator()}
+	if !tests {
+		stmts := u.Program.Statements[:0]
+		for _, stmt := range u.Program.Statements {
+			switch stmt.(type) {
+			case *ast.TestStatement, *ast.BenchStatement:
+			default:
+				stmts = append(stmts, stmt)
+			}
+		}
+		u.Program.Statements = stmts
+	}
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		errors = macro.Expand(u.Program)
+	}
+	if len(errors) == 0 {
+		errors = semantic.FillStructDefaults(u.Program)
+	}
+	if len(errors) == 0 {
+		u.Evaluator.EvaluateProgram(u.Program)
+		errors = u.Evaluator.Errors()
+	}
+	if len(errors) == 0 {
+		errors = semantic.CheckInterpolations(u.Program)
+	}
+	return u, errors
+}
+
+// C returns the C translation of the unit, generated from filename: its
+// structs, functions and globals. With main set, the unit is the entry
+// point of a program and its def main becomes the C main function.
+func (u *Unit) C(filename string, main bool) (string, []string) {
+	g := codegen.New(u.Evaluator.Layouts())
+	code, errors := g.Program(u.Program, main)
+	if len(errors) > 0 {
+		return "", errors
+	}
+	return fmt.Sprintf("/* Generated from %s */\n%s", filename, code), nil
+}
+
+// DefinesMain reports whether the unit has a def main
+func (u *Unit) DefinesMain() bool {
+	for _, stmt := range u.Program.Statements {
+		if fn, ok := stmt.(*ast.FunctionStatement); ok && fn != nil && fn.Name != nil && fn.Name.Value == "main" && !fn.Const {
+			return true
+		}
+	}
+	return false
+}
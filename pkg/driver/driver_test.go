@@ -0,0 +1,250 @@
+package driver
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/project"
+)
+
+func TestAnalyze(t *testing.T) {
+	if _, errors := Analyze("val x = 1 +"); len(errors) == 0 {
+		t.Errorf("expected parser errors")
+	}
+	if _, errors := Analyze(`val s = "${undefined}"`); len(errors) == 0 {
+		t.Errorf("expected interpolation errors")
+	}
+
+	unit, errors := Analyze("include \"math.h\"\nstruct P { x: i32 }\n")
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	c, errors := unit.C("p.sango", false)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	for _, want := range []string{"/* Generated from p.sango */", "#include \"sango.h\"\n#include <math.h>\n", "struct P {"} {
+		if !strings.Contains(c, want) {
+			t.Errorf("expected %q in\n%s", want, c)
+		}
+	}
+}
+
+// newProject creates a project in a temporary directory with the given
+// modules, by path relative to src/
+func newProject(t *testing.T, modules map[string]string) *project.Manifest {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "app")
+	m, err := project.New(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, source := range modules {
+		file := filepath.Join(dir, "src", path)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestBuild(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	m := newProject(t, map[string]string{
+		"geometry/point.sango": "struct Point { x: i32\n y: i32 }\n",
+	})
+
+	var log strings.Builder
+	exe, err := Build(m, Options{Runtime: "../../runtime", Log: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(exe).Output()
+	if err != nil || string(out) != "Hello, app!\n" {
+		t.Errorf("expected %s to print the greeting, got %q %v", exe, out, err)
+	}
+	for _, path := range []string{"c/src/main.c", "c/src/geometry/point.c", "obj/src/main.o", "obj/src/geometry/point.o", "obj/sango-runtime.o"} {
+		if _, err := os.Stat(filepath.Join(m.Dir, project.BuildDir, path)); err != nil {
+			t.Errorf("expected %s to be built: %v", path, err)
+		}
+	}
+	if !strings.Contains(log.String(), "link "+exe+"\n") {
+		t.Errorf("expected %s to be linked, got\n%s", exe, log.String())
+	}
+
+	// The entry module needs a def main
+	if err := ioutil.WriteFile(m.EntryPath(), []byte("val x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Build(m, Options{Runtime: "../../runtime"}); err == nil || !strings.Contains(err.Error(), "the entry module has no def main") {
+		t.Errorf("expected a missing def main error, got %v", err)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	m := newProject(t, map[string]string{
+		"a.sango": "val x = 1 +\n",
+		"b.sango": "val y = (1\n",
+	})
+	_, err := Build(m, Options{Runtime: "../../runtime"})
+	failed, ok := err.(BuildError)
+	if !ok {
+		t.Fatalf("expected a BuildError, got %v", err)
+	}
+	if len(failed) != 2 || failed[0].File != "src/a.sango" || failed[1].File != "src/b.sango" {
+		t.Errorf("expected the errors of src/a.sango and src/b.sango, got\n%v", err)
+	}
+
+	if _, err := Build(m, Options{Runtime: "nowhere"}); err == nil || !strings.Contains(err.Error(), "runtime not found") {
+		t.Errorf("expected a missing runtime error, got %v", err)
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	m := newProject(t, map[string]string{
+		"point.sango": "struct Point { x: i32\n y: i32 }\n",
+	})
+	build := func(version string) string {
+		t.Helper()
+		var log strings.Builder
+		if _, err := Build(m, Options{Runtime: "../../runtime", Version: version, Verbose: true, Log: &log}); err != nil {
+			t.Fatal(err)
+		}
+		return log.String()
+	}
+	expect := func(log string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(log, w+"\n") {
+				t.Errorf("expected %q in\n%s", w, log)
+			}
+		}
+	}
+
+	expect(build("v1"), "compile src/main.c", "compile src/point.c", "compile runtime",
+		"reused 0 of 2 modules and 0 of 3 objects")
+	expect(build("v1"), "reuse src/main.sango", "reuse src/point.sango", "reuse src/main.o", "reuse sango-runtime.o",
+		"reused 2 of 2 modules and 3 of 3 objects")
+
+	// A change to a function body compiles only its own module again
+	main := filepath.Join(m.Dir, "src", "main.sango")
+	if err := ioutil.WriteFile(main, []byte("include \"stdio.h\"\ndef main() = {\n  printf(\"Bye\\n\")\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(build("v1"), "reuse src/point.sango", "compile src/main.c", "reuse src/point.o", "reused 1 of 2 modules and 2 of 3 objects")
+
+	// A project header changes every object
+	if err := ioutil.WriteFile(filepath.Join(m.Dir, "include", "extra.h"), []byte("#define EXTRA 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(build("v1"), "compile src/main.c", "compile runtime", "reused 2 of 2 modules and 0 of 3 objects")
+
+	// So does a new compiler version
+	expect(build("v2"), "reused 0 of 2 modules and 0 of 3 objects")
+}
+
+func TestBuildParallel(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	modules := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		modules[name+".sango"] = "struct " + strings.ToUpper(name) + " { x: i32 }\n"
+	}
+	// Modules with the same source still get C of their own
+	modules["g.sango"] = modules["f.sango"]
+	m := newProject(t, modules)
+
+	var sequential, concurrent strings.Builder
+	if _, err := Build(m, Options{Runtime: "../../runtime", Jobs: 1, Log: &sequential}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(m.Dir, project.BuildDir)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Build(m, Options{Runtime: "../../runtime", Jobs: 8, Log: &concurrent}); err != nil {
+		t.Fatal(err)
+	}
+	if sequential.String() != concurrent.String() {
+		t.Errorf("expected the same log with -j 1 and -j 8, got\n%s\nand\n%s", sequential.String(), concurrent.String())
+	}
+	c, err := ioutil.ReadFile(filepath.Join(m.Dir, project.BuildDir, "c", "src", "g.c"))
+	if err != nil || !strings.Contains(string(c), "Generated from src/g.sango") {
+		t.Errorf("expected the C of src/g.sango, got %s %v", c, err)
+	}
+
+	// Errors come out in module order
+	for _, name := range []string{"b", "e", "a"} {
+		modules[name+".sango"] = "val " + name + " = (\n"
+	}
+	m = newProject(t, modules)
+	for i := 0; i < 5; i++ {
+		_, err := Build(m, Options{Runtime: "../../runtime", Jobs: 8})
+		failed, ok := err.(BuildError)
+		if !ok || len(failed) != 3 || failed[0].File != "src/a.sango" || failed[1].File != "src/b.sango" || failed[2].File != "src/e.sango" {
+			t.Fatalf("expected the errors of a, b and e in order, got %v", err)
+		}
+	}
+	// The modules that translated were still compiled
+	for name, want := range map[string]bool{"a": false, "c": true, "g": true} {
+		_, err := os.Stat(filepath.Join(m.Dir, project.BuildDir, "obj", "src", name+".o"))
+		if (err == nil) != want {
+			t.Errorf("expected src/%s.o to exist: %v, got %v", name, want, err)
+		}
+	}
+}
+
+func TestBuildGraph(t *testing.T) {
+	deps := buildGraph(2)
+	want := [][]int{nil, nil, {0}, {1}, nil}
+	if !reflect.DeepEqual(deps, want) {
+		t.Fatalf("expected %v, got %v", want, deps)
+	}
+	// Each object is compiled after its module is translated
+	var mu sync.Mutex
+	finished := map[int]bool{}
+	parallel(8, deps, func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, d := range deps[i] {
+			if !finished[d] {
+				t.Errorf("task %d started before task %d finished", i, d)
+			}
+		}
+		finished[i] = true
+	})
+}
+
+func TestParallel(t *testing.T) {
+	// 0 <- 1 <- 3, 0 <- 2 <- 3
+	deps := [][]int{nil, {0}, {0}, {1, 2}}
+	var mu sync.Mutex
+	finished := map[int]bool{}
+	parallel(4, deps, func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, d := range deps[i] {
+			if !finished[d] {
+				t.Errorf("task %d started before task %d finished", i, d)
+			}
+		}
+		finished[i] = true
+	})
+	if len(finished) != len(deps) {
+		t.Errorf("expected %d tasks to run, got %d", len(deps), len(finished))
+	}
+}
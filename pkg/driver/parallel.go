@@ -0,0 +1,43 @@
+package driver
+
+import (
+	"runtime"
+	"sync"
+)
+
+// jobs returns the number of tasks to run at once for a -j value, which is
+// the number of CPUs when n is not positive
+func jobs(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// parallel runs task(i) for every node i of a dependency graph, on at most
+// n goroutines at a time. deps[i] lists the nodes that must finish before
+// node i starts, and must not form a cycle. It returns when every task has
+// finished.
+func parallel(n int, deps [][]int, task func(i int)) {
+	done := make([]chan struct{}, len(deps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	slots := make(chan struct{}, jobs(n))
+
+	var wg sync.WaitGroup
+	for i := range deps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			for _, d := range deps[i] {
+				<-done[d]
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			task(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+// Package editor generates editor support files from the lexer's token
+// tables: a TextMate grammar for VS Code and other TextMate editors, a
+// tree-sitter grammar skeleton, and the legend and encoding of LSP semantic
+// tokens. Since the keywords, type names and operators are read from the
+// lexer, adding one to the lexer updates every generated file.
+package editor
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// Token classes that editors highlight differently from other keywords
+var (
+	control   = words(lexer.IF, lexer.ELSE, lexer.MATCH, lexer.FOR, lexer.IN, lexer.WHILE, lexer.BREAK, lexer.CONTINUE, lexer.RETURN, lexer.DEFER)
+	operators = words(lexer.SIZEOF, lexer.ALIGNOF, lexer.OFFSETOF)
+	constants = words(lexer.TRUE, lexer.FALSE, lexer.NULL)
+)
+
+func words(types ...lexer.TokenType) map[string]bool {
+	set := map[string]bool{}
+	for _, t := range types {
+		set[t.String()] = true
+	}
+	return set
+}
+
+// spellings returns the text of every token type for which keep reports
+// true, in declaration order
+func spellings(keep func(lexer.TokenType) bool) []string {
+	list := []string{}
+	for _, t := range lexer.TokenTypes() {
+		if keep(t) {
+			list = append(list, t.String())
+		}
+	}
+	return list
+}
+
+// keywords returns the keywords that are not in any of the given classes
+func keywords(classes ...map[string]bool) []string {
+	return spellings(func(t lexer.TokenType) bool {
+		if !t.IsKeyword() {
+			return false
+		}
+		for _, class := range classes {
+			if class[t.String()] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func sorted(set map[string]bool) []string {
+	list := []string{}
+	for word := range set {
+		list = append(list, word)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// alternation returns a regular expression matching any of the given
+// strings, trying longer ones first so that <<= is not matched as <
+func alternation(list []string) string {
+	quoted := []string{}
+	for _, s := range list {
+		quoted = append(quoted, regexp.QuoteMeta(s))
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return strings.Join(quoted, "|")
+}
+
+// wordsPattern returns a regular expression matching any of the given words
+// as a whole word
+func wordsPattern(list []string) string {
+	return `\b(?:` + alternation(list) + `)\b`
+}
+
+func marshal(v interface{}) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		panic(err) // only maps, slices and strings are encoded
+	}
+	return buf.Bytes()
+}
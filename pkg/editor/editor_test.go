@@ -0,0 +1,106 @@
+package editor
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+func TestTextMate(t *testing.T) {
+	data := TextMate()
+	var grammar struct {
+		ScopeName  string                     `json:"scopeName"`
+		Repository map[string]json.RawMessage `json:"repository"`
+	}
+	if err := json.Unmarshal(data, &grammar); err != nil {
+		t.Fatalf("grammar is not valid JSON: %v", err)
+	}
+	if grammar.ScopeName != ScopeName {
+		t.Errorf("scopeName = %q, want %q", grammar.ScopeName, ScopeName)
+	}
+
+	// Every keyword, type name and operator comes from the token table
+	text := string(data)
+	for _, tok := range lexer.TokenTypes() {
+		if !tok.IsKeyword() && !tok.IsTypeName() && !tok.IsOperator() {
+			continue
+		}
+		word := strings.Trim(quote(regexp.QuoteMeta(tok.String())), `"`)
+		if !strings.Contains(text, word) {
+			t.Errorf("grammar does not mention %s", tok)
+		}
+	}
+
+	// The operator pattern must try longer operators first
+	operators := alternation(spellings(lexer.TokenType.IsOperator))
+	re := regexp.MustCompile(`^(?:` + operators + `)`)
+	for _, op := range []string{"<<=", "..=", "...", "**", "->", "=>"} {
+		if got := re.FindString(op); got != op {
+			t.Errorf("operator pattern matches %q in %q", got, op)
+		}
+	}
+}
+
+func TestTreeSitter(t *testing.T) {
+	text := string(TreeSitter())
+	for _, tok := range lexer.TokenTypes() {
+		if !tok.IsKeyword() && !tok.IsTypeName() && !tok.IsOperator() && !tok.IsDelimiter() {
+			continue
+		}
+		if !strings.Contains(text, quote(tok.String())+",") && !strings.Contains(text, ": _ => "+quote(tok.String())) {
+			t.Errorf("grammar.js does not mention %s", tok)
+		}
+	}
+	if !strings.Contains(text, `"<<="`) {
+		t.Errorf("operators are not quoted as written:\n%s", text)
+	}
+}
+
+func TestLegend(t *testing.T) {
+	var legend Legend
+	if err := json.Unmarshal(LegendJSON(), &legend); err != nil {
+		t.Fatalf("legend is not valid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(legend, SemanticLegend()) {
+		t.Errorf("legend = %+v, want %+v", legend, SemanticLegend())
+	}
+	if legend.TokenTypes[TypeDecorator] != "decorator" || legend.TokenModifiers[1] != "documentation" {
+		t.Errorf("legend does not match the constants: %+v", legend)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	source := "/// A point\n@packed struct P { x: i32 }\ndef f(é: int) = g(é) + 1\nval s = r\"a\nbc\"\n"
+	tokens := lexer.Tokens(source)
+	got := SemanticTokens(source, tokens)
+	want := []uint32{
+		0, 0, 11, TypeComment, ModDocumentation, // /// A point
+		1, 0, 1, TypeDecorator, 0, // @
+		0, 1, 6, TypeDecorator, 0, // packed
+		0, 7, 6, TypeKeyword, 0, // struct
+		0, 7, 1, TypeStruct, ModDeclaration, // P
+		0, 4, 1, TypeVariable, 0, // x
+		0, 3, 3, TypeType, 0, // i32
+		1, 0, 3, TypeKeyword, 0, // def
+		0, 4, 1, TypeFunction, ModDeclaration, // f
+		0, 2, 1, TypeVariable, 0, // é
+		0, 3, 3, TypeType, 0, // int
+		0, 5, 1, TypeOperator, 0, // =
+		0, 2, 1, TypeFunction, 0, // g
+		0, 2, 1, TypeVariable, 0, // é
+		0, 3, 1, TypeOperator, 0, // +
+		0, 2, 1, TypeNumber, 0, // 1
+		1, 0, 3, TypeKeyword, 0, // val
+		0, 4, 1, TypeVariable, 0, // s
+		0, 2, 1, TypeOperator, 0, // =
+		0, 2, 3, TypeString, 0, // r"a
+		1, 0, 3, TypeString, 0, // bc"
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SemanticTokens =\n%v\nwant\n%v", got, want)
+	}
+}
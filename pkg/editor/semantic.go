@@ -0,0 +1,134 @@
+package editor
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// Legend is the LSP semantic tokens legend: the names of the token types
+// and modifiers that encoded tokens refer to by index
+type Legend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// Semantic token types, as indexes into the legend
+const (
+	TypeKeyword = iota
+	TypeType
+	TypeOperator
+	TypeString
+	TypeNumber
+	TypeComment
+	TypeVariable
+	TypeFunction
+	TypeStruct
+	TypeMacro
+	TypeDecorator
+)
+
+// Semantic token modifiers, as bits of the modifier set
+const (
+	ModDeclaration = 1 << iota
+	ModDocumentation
+)
+
+// SemanticLegend returns the legend of the tokens that SemanticTokens
+// encodes. The names are the standard LSP ones.
+func SemanticLegend() Legend {
+	return Legend{
+		TokenTypes:     []string{"keyword", "type", "operator", "string", "number", "comment", "variable", "function", "struct", "macro", "decorator"},
+		TokenModifiers: []string{"declaration", "documentation"},
+	}
+}
+
+// LegendJSON returns the legend as JSON
+func LegendJSON() []byte {
+	return marshal(SemanticLegend())
+}
+
+// SemanticTokens returns the tokens of source in the LSP semantic tokens
+// encoding: five numbers per token, the line and start relative to the
+// previous token, the length, the type and the modifiers. Positions and
+// lengths are in UTF-16 code units, and a token that spans lines, such as a
+// multi-line string, is split into one token per line. The tokens are those
+// Tokens returns for source.
+func SemanticTokens(source string, tokens []lexer.Token) []uint32 {
+	data := []uint32{}
+	prevLine, prevStart := 0, 0
+	for i, tok := range tokens {
+		kind, mods, ok := classify(tokens, i)
+		if !ok {
+			continue
+		}
+
+		line, start := tok.Line-1, tok.UTF16Column-1
+		for n, text := range strings.Split(source[tok.Offset:tok.End], "\n") {
+			if n > 0 {
+				line, start = line+1, 0
+			}
+			length := len(utf16.Encode([]rune(strings.TrimSuffix(text, "\r"))))
+			if length == 0 {
+				continue
+			}
+			deltaStart := start
+			if line == prevLine {
+				deltaStart -= prevStart
+			}
+			data = append(data, uint32(line-prevLine), uint32(deltaStart), uint32(length), uint32(kind), uint32(mods))
+			prevLine, prevStart = line, start
+		}
+	}
+	return data
+}
+
+// classify returns the semantic token type and modifiers of tokens[i], and
+// false if it is not highlighted. Identifiers are classified by the tokens
+// around them.
+func classify(tokens []lexer.Token, i int) (int, int, bool) {
+	tok := tokens[i]
+	switch t := tok.Type; {
+	case t == lexer.DOC_COMMENT:
+		return TypeComment, ModDocumentation, true
+	case t == lexer.STRING || t == lexer.CHAR || t == lexer.INTERP_START || t == lexer.INTERP_MID ||
+		t == lexer.INTERP_END || t == lexer.FORMAT_SPEC:
+		return TypeString, 0, true
+	case t == lexer.INT || t == lexer.FLOAT:
+		return TypeNumber, 0, true
+	case t.IsTypeName():
+		return TypeType, 0, true
+	case t.IsKeyword():
+		return TypeKeyword, 0, true
+	case t == lexer.AT:
+		return TypeDecorator, 0, true
+	case t.IsOperator():
+		return TypeOperator, 0, true
+	case t != lexer.IDENT:
+		return 0, 0, false
+	}
+
+	var prev, next lexer.TokenType
+	if i > 0 {
+		prev = tokens[i-1].Type
+	}
+	if i+1 < len(tokens) {
+		next = tokens[i+1].Type
+	}
+	switch {
+	case prev == lexer.DEF:
+		return TypeFunction, ModDeclaration, true
+	case prev == lexer.STRUCT:
+		return TypeStruct, ModDeclaration, true
+	case prev == lexer.TYPE || prev == lexer.IMPL:
+		return TypeType, ModDeclaration, true
+	case prev == lexer.AT:
+		return TypeDecorator, 0, true
+	case prev == lexer.DEFINE || (i >= 3 && tokens[i-3].Type == lexer.DEFINE && tokens[i-2].Type == lexer.AT):
+		return TypeMacro, ModDeclaration, true
+	case next == lexer.LPAREN:
+		return TypeFunction, 0, true
+	}
+	return TypeVariable, 0, true
+}
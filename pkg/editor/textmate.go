@@ -0,0 +1,96 @@
+package editor
+
+import "github.com/rxxuzi/sango/pkg/lexer"
+
+// ScopeName is the root scope of the TextMate grammar
+const ScopeName = "source.sango"
+
+type rule map[string]interface{}
+
+func match(pattern, name string) rule {
+	return rule{"match": pattern, "name": name}
+}
+
+func include(name string) rule {
+	return rule{"include": "#" + name}
+}
+
+// TextMate returns a TextMate grammar for Sango as JSON, in the form VS
+// Code reads from a .tmLanguage.json file
+func TextMate() []byte {
+	suffixes := spellings(lexer.TokenType.IsNumberSuffix)
+	suffix := `(?:` + alternation(suffixes) + `)?`
+	delimiters := spellings(func(t lexer.TokenType) bool { return t.IsDelimiter() && t != lexer.UNDERSCORE })
+
+	escape := match(`\\(?:[ntr0\\"'$]|x\h{2}|u\{\h{1,6}\})`, "constant.character.escape.sango")
+	repository := map[string]rule{
+		"comments": {"patterns": []rule{
+			{"begin": `///(?!/)`, "end": `$`, "name": "comment.line.documentation.sango"},
+			{"begin": `/\*\*(?![*/])`, "end": `\*/`, "name": "comment.block.documentation.sango"},
+			{"begin": `//`, "end": `$`, "name": "comment.line.double-slash.sango"},
+			{"begin": `/\*`, "end": `\*/`, "name": "comment.block.sango"},
+		}},
+		"strings": {"patterns": []rule{
+			{"begin": `"""`, "end": `"""`, "name": "string.quoted.triple.sango", "patterns": []rule{escape}},
+			{"begin": `\br"`, "end": `"`, "name": "string.quoted.raw.sango"},
+			{"begin": `"`, "end": `"|$`, "name": "string.quoted.double.sango", "patterns": []rule{
+				escape,
+				{
+					"begin": `\$\{`, "end": `\}`, "name": "meta.interpolation.sango",
+					"beginCaptures": rule{"0": rule{"name": "punctuation.section.interpolation.begin.sango"}},
+					"endCaptures":   rule{"0": rule{"name": "punctuation.section.interpolation.end.sango"}},
+					"patterns": []rule{
+						match(`:[^}"]*(?=\})`, "constant.other.format-spec.sango"),
+						{"include": "$self"},
+					},
+				},
+			}},
+			{"begin": `'`, "end": `'|$`, "name": "string.quoted.single.sango", "patterns": []rule{escape}},
+		}},
+		"numbers": {"patterns": []rule{
+			match(`\b0[xX]\h[\h_]*`+suffix+`\b`, "constant.numeric.hex.sango"),
+			match(`\b0[oO][0-7_]+`+suffix+`\b`, "constant.numeric.octal.sango"),
+			match(`\b0[bB][01_]+`+suffix+`\b`, "constant.numeric.binary.sango"),
+			match(`\b\d[\d_]*(?:\.\d[\d_]*)?(?:[eE][+-]?\d[\d_]*)?`+suffix+`\b`, "constant.numeric.decimal.sango"),
+		}},
+		"declarations": {"patterns": []rule{
+			{
+				"match":    `\b(def)\s+([\p{L}_][\p{L}\p{N}_]*)`,
+				"captures": rule{"1": rule{"name": "keyword.other.sango"}, "2": rule{"name": "entity.name.function.sango"}},
+			},
+			{
+				"match":    `\b(struct|type|impl)\s+([\p{L}_][\p{L}\p{N}_]*)`,
+				"captures": rule{"1": rule{"name": "keyword.other.sango"}, "2": rule{"name": "entity.name.type.sango"}},
+			},
+			match(`@[\p{L}_][\p{L}\p{N}_]*`, "entity.name.function.decorator.sango"),
+		}},
+		"keywords": {"patterns": []rule{
+			match(wordsPattern(sorted(control)), "keyword.control.sango"),
+			match(wordsPattern(sorted(operators)), "keyword.operator.word.sango"),
+			match(wordsPattern(sorted(constants)), "constant.language.sango"),
+			match(wordsPattern(keywords(control, operators, constants)), "keyword.other.sango"),
+			match(wordsPattern(spellings(lexer.TokenType.IsTypeName)), "support.type.primitive.sango"),
+			match(`\b_\b`, "variable.language.wildcard.sango"),
+		}},
+		"operators": {"patterns": []rule{
+			match(alternation(spellings(lexer.TokenType.IsOperator)), "keyword.operator.sango"),
+			match(alternation(delimiters), "punctuation.sango"),
+		}},
+	}
+
+	sections := []string{"comments", "strings", "numbers", "declarations", "keywords", "operators"}
+	patterns := []rule{}
+	for _, name := range sections {
+		patterns = append(patterns, include(name))
+	}
+
+	return marshal(rule{
+		"$schema":    "https://raw.githubusercontent.com/martinring/tmlanguage/master/tmlanguage.json",
+		"name":       "Sango",
+		"scopeName":  ScopeName,
+		"fileTypes":  []string{"sango"},
+		"comment":    "Generated by sangoc gen-grammar from the lexer's token tables; do not edit",
+		"patterns":   patterns,
+		"repository": repository,
+	})
+}
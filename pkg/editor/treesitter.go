@@ -0,0 +1,94 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// TreeSitter returns a skeleton of a tree-sitter grammar.js for Sango. The
+// lexical rules are complete, and the program is a flat sequence of tokens
+// for the syntax rules to replace.
+func TreeSitter() []byte {
+	suffix := fmt.Sprintf("(%s)?", strings.Join(spellings(lexer.TokenType.IsNumberSuffix), "|"))
+
+	var b strings.Builder
+	b.WriteString(`// Generated by sangoc gen-grammar from the lexer's token tables. The
+// token rules follow the lexer; source_file is a placeholder for the syntax.
+
+module.exports = grammar({
+  name: 'sango',
+
+  extras: $ => [/\s/, $.comment],
+
+  word: $ => $.identifier,
+
+  rules: {
+    source_file: $ => repeat($._token),
+
+    _token: $ => choice(
+      $.keyword,
+      $.primitive_type,
+      $.operator,
+      $.punctuation,
+      $.boolean,
+      $.null,
+      $.number,
+      $.string,
+      $.char,
+      $.identifier,
+    ),
+
+`)
+	writeChoice(&b, "keyword", keywords(constants))
+	writeChoice(&b, "primitive_type", spellings(lexer.TokenType.IsTypeName))
+	writeChoice(&b, "operator", spellings(lexer.TokenType.IsOperator))
+	writeChoice(&b, "punctuation", spellings(lexer.TokenType.IsDelimiter))
+	writeChoice(&b, "boolean", []string{lexer.TRUE.String(), lexer.FALSE.String()})
+	fmt.Fprintf(&b, "    null: _ => %s,\n\n", quote(lexer.NULL.String()))
+	b.WriteString(`    identifier: _ => /[\p{L}\p{Nl}_][\p{L}\p{Nl}\p{Mn}\p{Mc}\p{Nd}\p{Pc}_]*/u,
+
+    number: _ => token(choice(
+`)
+	fmt.Fprintf(&b, "      /0[xX][0-9a-fA-F_]+%s/,\n", suffix)
+	fmt.Fprintf(&b, "      /0[oO][0-7_]+%s/,\n", suffix)
+	fmt.Fprintf(&b, "      /0[bB][01_]+%s/,\n", suffix)
+	fmt.Fprintf(&b, "      /[0-9][0-9_]*(\\.[0-9][0-9_]*)?([eE][+-]?[0-9][0-9_]*)?%s/,\n", suffix)
+	b.WriteString(`    )),
+
+    string: _ => token(choice(
+      seq('"""', repeat(choice(/[^"\\]/, /\\(.|\n)/, /"[^"]/, /""[^"]/)), '"""'),
+      seq('r"', /[^"]*/, '"'),
+      seq('"', repeat(choice(/[^"\\\n]/, /\\./)), '"'),
+    )),
+
+    char: _ => token(seq("'", choice(/[^'\\\n]/, /\\[^u\n]/, /\\x[0-9a-fA-F]{2}/, /\\u\{[0-9a-fA-F]{1,6}\}/), "'")),
+
+    comment: _ => token(choice(
+      seq('//', /.*/),
+      seq('/*', /[^*]*\*+([^/*][^*]*\*+)*/, '/'),
+    )),
+  },
+});
+`)
+	return []byte(b.String())
+}
+
+func writeChoice(b *strings.Builder, name string, list []string) {
+	fmt.Fprintf(b, "    %s: _ => choice(\n", name)
+	for _, s := range list {
+		fmt.Fprintf(b, "      %s,\n", quote(s))
+	}
+	b.WriteString("    ),\n\n")
+}
+
+// quote returns s as a JavaScript string literal
+func quote(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,140 @@
+package lexer
+
+// Tokens returns all tokens of input, ending with EOF
+func Tokens(input string) []Token {
+	l := New(input)
+	tokens := []Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens
+		}
+	}
+}
+
+// Relex returns the tokens of source after an edit, given the tokens of the
+// source before it as Tokens returned them. The edit replaced the bytes
+// [start, oldEnd) of the old source with the bytes [start, newEnd) of
+// source.
+//
+// Only the region around the edit is lexed again. Lexing restarts at the
+// last token that ends before the edit outside a string interpolation, and
+// stops at the first token after the edit that comes out as it did before,
+// with the same brackets open. The old tokens from there on are reused,
+// moved by the change in offsets and lines.
+func Relex(old []Token, source string, start, oldEnd, newEnd int) []Token {
+	tokens, _ := relex(old, source, start, oldEnd, newEnd)
+	return tokens
+}
+
+// relex is Relex that also returns how many tokens it lexed
+func relex(old []Token, source string, start, oldEnd, newEnd int) ([]Token, int) {
+	// Replay the old tokens before the edit to find the restart token and
+	// the state of the lexer before it
+	replay := &Lexer{}
+	interps := 0
+	restart := -1
+	var before Lexer
+	for i, tok := range old {
+		if tok.End >= start || tok.Type == EOF {
+			break
+		}
+		if interps == 0 && tok.Type != NEWLINE && tok.Type != DOC_COMMENT {
+			restart = i
+			before = Lexer{nesting: append([]TokenType{}, replay.nesting...), last: replay.last}
+		}
+		replay.track(tok)
+		interps += interpolationDelta(tok.Type)
+	}
+
+	var l *Lexer
+	tokens := []Token{}
+	if restart < 0 {
+		restart = 0
+		l = New(source)
+	} else {
+		tok := old[restart]
+		tokens = append(tokens, old[:restart]...)
+		l = &Lexer{
+			input:        source,
+			readPosition: tok.Offset,
+			line:         tok.Line,
+			column:       tok.Column - 1,
+			lineUnits:    tok.UTF16Column - 1,
+			nesting:      before.nesting,
+			last:         before.last,
+			errors:       []string{},
+			invalid:      map[int]bool{},
+		}
+		l.readChar()
+	}
+
+	// The state of the old lexer before old[j]
+	prev := &Lexer{nesting: append([]TokenType{}, l.nesting...), last: l.last}
+	prevInterps := 0
+	j := restart
+
+	delta := newEnd - oldEnd
+	lexed := 0
+	for {
+		nesting := append([]TokenType{}, l.nesting...)
+		last, clean := l.last, len(l.interps) == 0
+		tok := l.NextToken()
+		lexed++
+
+		for j < len(old) && (old[j].Offset < oldEnd || old[j].Offset+delta < tok.Offset) {
+			prev.track(old[j])
+			prevInterps += interpolationDelta(old[j].Type)
+			j++
+		}
+
+		// Once a token after the edit and the state before it are as they
+		// were, the rest is too
+		if j < len(old) && clean && prevInterps == 0 && last == prev.last && equalNesting(nesting, prev.nesting) {
+			want := old[j]
+			want.Offset += delta
+			want.End += delta
+			want.Line = tok.Line
+			if want == tok {
+				lines := tok.Line - old[j].Line
+				for _, rest := range old[j:] {
+					rest.Offset += delta
+					rest.End += delta
+					rest.Line += lines
+					tokens = append(tokens, rest)
+				}
+				return tokens, lexed
+			}
+		}
+
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens, lexed
+		}
+	}
+}
+
+// interpolationDelta returns how tokens of type t change the number of
+// open string interpolations
+func interpolationDelta(t TokenType) int {
+	switch t {
+	case INTERP_START:
+		return 1
+	case INTERP_END:
+		return -1
+	}
+	return 0
+}
+
+func equalNesting(a, b []TokenType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
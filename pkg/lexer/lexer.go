@@ -1,50 +1,147 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-// Lexer tokenizes Sango source code
+// Lexer tokenizes Sango source code. The input is decoded as UTF-8 and
+// columns count runes; the column in UTF-16 code units is tracked as well
+// for editors that address text that way.
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
 	line         int
 	column       int
+	column16     int // column of the current char in UTF-16 code units
+	lineUnits    int // UTF-16 code units read so far on the current line
+	lineEnd      int // column of the last line break read
+	lineEnd16    int // lineEnd in UTF-16 code units
+	interps      []interpolation
+	nesting      []TokenType // open brackets, innermost last
+	last         TokenType   // type of the last token returned
+	start        int         // offset of the token being scanned
+	errors       []string
+	invalid      map[int]bool // offsets of bytes that are not valid UTF-8
+}
+
+// interpolation is a ${...} being lexed inside a string literal
+type interpolation struct {
+	quote int // offset of the string's opening quote
+	open  int // offset of the '$'
+	depth int // brackets opened inside the interpolation
 }
 
 // New creates a new Lexer
 func New(input string) *Lexer {
 	l := &Lexer{
-		input:  input,
-		line:   1,
-		column: 0,
+		input:   input,
+		line:    1,
+		column:  0,
+		errors:  []string{},
+		invalid: map[int]bool{},
+	}
+	// A byte order mark is not part of the source
+	if strings.HasPrefix(input, "\uFEFF") {
+		l.readPosition = len("\uFEFF")
 	}
 	l.readChar()
 	return l
 }
 
-// NextToken returns the next token from the input
-func (l *Lexer) NextToken() Token {
-	var tok Token
+// Errors returns the errors found while decoding the input
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
+
+// InvalidUTF8 reports whether the byte at offset is not valid UTF-8, which
+// the lexer has reported as an error and read as utf8.RuneError
+func (l *Lexer) InvalidUTF8(offset int) bool {
+	return l.invalid[offset]
+}
 
-	l.skipWhitespace()
+// NextToken returns the next token from the input. A line break that
+// ends a statement is returned as a NEWLINE token; see endsStatement.
+func (l *Lexer) NextToken() Token {
+	tok := l.scan()
+	tok.Offset, tok.End = l.start, l.position
+	l.track(tok)
+	return tok
+}
 
-	// Skip comments
-	if l.ch == '/' {
-		if l.peekChar() == '/' {
-			l.skipLineComment()
-			return l.NextToken()
-		} else if l.peekChar() == '*' {
-			l.skipBlockComment()
-			return l.NextToken()
+// track updates the open brackets and the last token after tok
+func (l *Lexer) track(tok Token) {
+	switch tok.Type {
+	case LPAREN, LBRACKET, LBRACE:
+		l.nesting = append(l.nesting, tok.Type)
+	case RPAREN, RBRACKET, RBRACE:
+		if n := len(l.nesting); n > 0 {
+			l.nesting = l.nesting[:n-1]
 		}
 	}
+	// Doc comments do not decide whether a line break ends a statement
+	if tok.Type != DOC_COMMENT {
+		l.last = tok.Type
+	}
+}
+
+// scan reads the next token from the input
+func (l *Lexer) scan() Token {
+	var tok Token
+
+	newline := l.skipWhitespace()
 
+	l.start = l.position
 	tok.Line = l.line
 	tok.Column = l.column
+	column16 := l.column16
+
+	if newline {
+		// A line break is placed at the end of the line it ends. Reading
+		// it has already moved the lexer to the next line.
+		tok.Type = NEWLINE
+		tok.Literal = "\n"
+		tok.UTF16Column = column16
+		if l.ch == '\n' {
+			tok.Line, tok.Column, tok.UTF16Column = l.line-1, l.lineEnd, l.lineEnd16
+			l.readChar()
+		}
+		return tok
+	}
+
+	// Inside ${...}, a '}' or ':' outside brackets ends the expression
+	if n := len(l.interps); n > 0 {
+		interp := &l.interps[n-1]
+		switch l.ch {
+		case '(', '[', '{':
+			interp.depth++
+		case ')', ']':
+			interp.depth--
+		case '}':
+			if interp.depth == 0 {
+				tok.Literal, tok.Type = l.continueString()
+				tok.UTF16Column = column16
+				l.readChar()
+				return tok
+			}
+			interp.depth--
+		case ':':
+			if interp.depth == 0 {
+				tok.Type = FORMAT_SPEC
+				tok.Literal = l.readFormatSpec()
+				tok.UTF16Column = column16
+				l.readChar()
+				return tok
+			}
+		}
+	}
 
 	switch l.ch {
 	case '=':
@@ -92,6 +189,12 @@ func (l *Lexer) NextToken() Token {
 			tok = NewToken(ASTERISK, string(l.ch), tok.Line, tok.Column)
 		}
 	case '/':
+		if isDocComment(l.input[l.position:]) {
+			tok.Type = DOC_COMMENT
+			tok.Literal = l.readDocComment()
+			tok.UTF16Column = column16
+			return tok
+		}
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
@@ -212,6 +315,9 @@ func (l *Lexer) NextToken() Token {
 			if l.peekChar() == '=' {
 				l.readChar()
 				tok = NewToken(DOTDOTEQ, ".."+string(l.ch), tok.Line, tok.Column)
+			} else if l.peekChar() == '.' {
+				l.readChar()
+				tok = NewToken(ELLIPSIS, ".."+string(l.ch), tok.Line, tok.Column)
 			} else {
 				tok = NewToken(DOTDOT, string(ch)+string(l.ch), tok.Line, tok.Column)
 			}
@@ -221,17 +327,43 @@ func (l *Lexer) NextToken() Token {
 	case '@':
 		tok = NewToken(AT, string(l.ch), tok.Line, tok.Column)
 	case '_':
+		if isIdentContinue(l.peekChar()) {
+			tok.Literal = l.readIdentifier()
+			tok.Type = LookupIdent(tok.Literal)
+			tok.UTF16Column = column16
+			return tok
+		}
 		tok = NewToken(UNDERSCORE, string(l.ch), tok.Line, tok.Column)
 	case '"':
 		tok.Type = STRING
-		tok.Literal = l.readString()
+		if strings.HasPrefix(l.input[l.position:], `"""`) {
+			tok.Literal = l.readMultilineString()
+		} else {
+			tok.Literal, tok.Type = l.readString()
+		}
+	case '\'':
+		tok.Type = CHAR
+		tok.Literal = l.readCharLiteral()
 	case 0:
+		if !l.atEOF() {
+			// A NUL byte in the input, which is not its end
+			tok = NewToken(ILLEGAL, string(l.ch), tok.Line, tok.Column)
+			break
+		}
+		if n := len(l.interps); n > 0 {
+			l.errorAt(l.interps[n-1].open, "unterminated string interpolation")
+			l.interps = nil
+		}
 		tok.Literal = ""
 		tok.Type = EOF
 	default:
-		if isLetter(l.ch) {
+		if l.ch == 'r' && l.peekChar() == '"' {
+			tok.Type = STRING
+			tok.Literal = l.readRawString()
+		} else if isIdentStart(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = LookupIdent(tok.Literal)
+			tok.UTF16Column = column16
 			return tok
 		} else if isDigit(l.ch) {
 			literal, isFloat := l.readNumber()
@@ -241,112 +373,555 @@ func (l *Lexer) NextToken() Token {
 			} else {
 				tok.Type = INT
 			}
+			tok.UTF16Column = column16
 			return tok
 		} else {
 			tok = NewToken(ILLEGAL, string(l.ch), tok.Line, tok.Column)
 		}
 	}
 
+	tok.UTF16Column = column16
 	l.readChar()
 	return tok
 }
 
+// readChar decodes the next rune. Bytes that are not valid UTF-8 are
+// reported and read as utf8.RuneError.
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
-		if l.ch == '\n' {
-			l.line++
-			l.column = 0
-		} else {
-			l.column++
-		}
+		l.position = len(l.input)
+		return
 	}
+
+	r, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = r
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
+
+	if r == '\n' {
+		l.lineEnd, l.lineEnd16 = l.column+1, l.lineUnits+1
+		l.line++
+		l.column = 0
+		l.column16 = 0
+		l.lineUnits = 0
+	} else {
+		l.column++
+		l.column16 = l.lineUnits + 1
+		l.lineUnits += utf16Len(r)
+	}
+
+	if r == utf8.RuneError && width == 1 {
+		l.invalid[l.position] = true
+		l.errors = append(l.errors, fmt.Sprintf("invalid UTF-8 encoding (byte 0x%02x) at line %d:%d",
+			l.input[l.position], l.line, l.column))
+	}
+}
+
+// atEOF reports whether the whole input has been read. A NUL byte in the
+// input is read as 0 too, but does not end it.
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return r
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '_' {
+	for isIdentContinue(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// readNumber reads an integer or float literal and returns it as written.
+// Integers may be decimal or have a 0x, 0o or 0b prefix, and decimals may
+// have a fraction and an exponent. Digits may be separated by '_', and a
+// type suffix such as u8 or f32 may follow.
 func (l *Lexer) readNumber() (string, bool) {
-	position := l.position
+	start := l.position
 	isFloat := false
 
-	for isDigit(l.ch) {
-		l.readChar()
+	base := 10
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			l.readChar()
+			l.readChar() // skip the prefix
+		}
+	}
+
+	if l.readDigits(base) == 0 && base != 10 {
+		l.errorAt(start, fmt.Sprintf("%s literal has no digits", baseNames[base]))
+	}
+
+	if base == 10 {
+		// Check for decimal point
+		if l.ch == '.' && isDigit(l.peekChar()) {
+			isFloat = true
+			l.readChar() // consume '.'
+			l.readDigits(10)
+		}
+
+		// Check for scientific notation
+		if l.ch == 'e' || l.ch == 'E' {
+			isFloat = true
+			exponent := l.position
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			if l.readDigits(10) == 0 {
+				l.errorAt(exponent, "exponent has no digits")
+			}
+		}
 	}
 
-	// Check for decimal point
-	if l.ch == '.' && isDigit(l.peekChar()) {
-		isFloat = true
-		l.readChar() // consume '.'
-		for isDigit(l.ch) {
+	if isIdentContinue(l.ch) {
+		suffixStart := l.position
+		for isIdentContinue(l.ch) {
 			l.readChar()
 		}
+		suffix := l.input[suffixStart:l.position]
+		switch {
+		case !isTypeSuffix(suffix):
+			l.errorAt(suffixStart, fmt.Sprintf("invalid suffix %s on number literal", suffix))
+		case suffix[0] == 'f' && base != 10:
+			l.errorAt(suffixStart, fmt.Sprintf("invalid suffix %s on %s literal", suffix, baseNames[base]))
+		case suffix[0] == 'f':
+			isFloat = true
+		case isFloat:
+			l.errorAt(suffixStart, fmt.Sprintf("invalid suffix %s on float literal", suffix))
+		}
 	}
 
-	// Check for scientific notation
-	if l.ch == 'e' || l.ch == 'E' {
-		isFloat = true
+	return l.input[start:l.position], isFloat
+}
+
+var baseNames = map[int]string{2: "binary", 8: "octal", 10: "decimal", 16: "hex"}
+
+// readDigits reads digits of the given base and the '_' separators between
+// them, returning the number of digits read
+func (l *Lexer) readDigits(base int) int {
+	count := 0
+	for isDigit(l.ch) || (base == 16 && isHexDigit(l.ch)) || l.ch == '_' {
+		switch {
+		case l.ch == '_':
+			next := l.peekChar()
+			if count == 0 || !(isDigit(next) || (base == 16 && isHexDigit(next))) {
+				l.errorAt(l.position, "'_' must separate successive digits")
+			}
+		case base < 10 && int(l.ch-'0') >= base:
+			l.errorAt(l.position, fmt.Sprintf("invalid digit '%c' in %s literal", l.ch, baseNames[base]))
+			count++
+		default:
+			count++
+		}
 		l.readChar()
-		if l.ch == '+' || l.ch == '-' {
+	}
+	return count
+}
+
+// isTypeSuffix reports whether s names one of the sized number types, which
+// a number literal may end with
+func isTypeSuffix(s string) bool {
+	t, ok := keywords[s]
+	return ok && t.IsNumberSuffix()
+}
+
+// SplitNumber splits a number literal into its digits, without '_'
+// separators, and its type suffix, which is empty if there is none. Hex
+// literals never have a float suffix, since 'f' is a hex digit.
+func SplitNumber(literal string) (string, string) {
+	digits := strings.ReplaceAll(literal, "_", "")
+	hex := strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X")
+	for _, n := range []int{3, 2} {
+		if len(digits) <= n {
+			continue
+		}
+		suffix := digits[len(digits)-n:]
+		if isTypeSuffix(suffix) && !(hex && suffix[0] == 'f') {
+			return digits[:len(digits)-n], suffix
+		}
+	}
+	return digits, ""
+}
+
+// ParseInteger returns the value of the digits of an integer literal, as
+// split off by SplitNumber. Decimal digits are read in base 10, and a
+// leading zero is an error rather than an octal prefix as in C.
+func ParseInteger(digits string) (*big.Int, error) {
+	base := 10
+	if len(digits) > 1 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		default:
+			return nil, errors.New("leading zero in decimal literal (use 0o for octal)")
+		}
+		digits = digits[2:]
+	}
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s digits", baseNames[base])
+	}
+	return n, nil
+}
+
+// readString reads a "..." string and decodes its escapes. The string must
+// end on the line it starts on. A string with ${...} in it is read up to the
+// first interpolation and returned as INTERP_START.
+func (l *Lexer) readString() (string, TokenType) {
+	quote := l.position
+	l.readChar() // skip opening quote
+	return l.readStringSegment(quote, STRING, INTERP_START)
+}
+
+// continueString reads the text that follows the closing '}' of an
+// interpolation, up to the next interpolation or the end of the string
+func (l *Lexer) continueString() (string, TokenType) {
+	interp := l.interps[len(l.interps)-1]
+	l.interps = l.interps[:len(l.interps)-1]
+	l.readChar() // skip '}'
+	return l.readStringSegment(interp.quote, INTERP_END, INTERP_MID)
+}
+
+// readStringSegment reads string text up to the closing quote, returning
+// last, or up to a ${, returning open. The lexer is left on the quote or on
+// the '{'.
+func (l *Lexer) readStringSegment(quote int, last, open TokenType) (string, TokenType) {
+	start := l.position
+	for l.ch != '"' {
+		if l.atEOF() || l.ch == '\n' {
+			l.errorAt(quote, "unterminated string literal")
+			break
+		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			l.interps = append(l.interps, interpolation{quote: quote, open: l.position})
+			text := l.unescape(l.input[start:l.position], start)
 			l.readChar()
+			return text, open
 		}
-		for isDigit(l.ch) {
+		if l.ch == '\\' && l.peekChar() != '\n' {
 			l.readChar()
 		}
+		l.readChar()
 	}
+	return l.unescape(l.input[start:l.position], start), last
+}
 
-	return l.input[position:l.position], isFloat
+// readFormatSpec reads the format spec after the ':' of ${x:.2f}, leaving
+// the lexer on its last character
+func (l *Lexer) readFormatSpec() string {
+	start := l.readPosition
+	for {
+		if l.readPosition >= len(l.input) {
+			return l.input[start:l.readPosition]
+		}
+		switch l.peekChar() {
+		case '}', '"', '\n':
+			return l.input[start:l.readPosition]
+		}
+		l.readChar()
+	}
 }
 
-func (l *Lexer) readString() string {
-	var result strings.Builder
-	l.readChar() // skip opening quote
+// readCharLiteral reads a '...' literal holding exactly one character
+func (l *Lexer) readCharLiteral() string {
+	start := l.position
+	text, ok := l.readQuoted('\'')
+	if !ok {
+		l.errorAt(start, "unterminated character literal")
+		return l.unescape(text, start+1)
+	}
 
-	for l.ch != '"' && l.ch != 0 {
-		if l.ch == '\\' {
-			l.readChar()
-			switch l.ch {
-			case 'n':
-				result.WriteByte('\n')
-			case 't':
-				result.WriteByte('\t')
-			case 'r':
-				result.WriteByte('\r')
-			case '\\':
-				result.WriteByte('\\')
-			case '"':
-				result.WriteByte('"')
-			default:
-				result.WriteByte(l.ch)
-			}
-		} else {
-			result.WriteByte(l.ch)
+	value := l.unescape(text, start+1)
+	switch utf8.RuneCountInString(value) {
+	case 0:
+		l.errorAt(start, "empty character literal")
+	case 1:
+	default:
+		l.errorAt(start, fmt.Sprintf("character literal '%s' has more than one character", text))
+	}
+	return value
+}
+
+// readQuoted reads the raw text up to an unescaped closing quote, leaving
+// the lexer on the quote. It reports false if the line or input ends first.
+func (l *Lexer) readQuoted(quote rune) (string, bool) {
+	l.readChar() // skip opening quote
+	start := l.position
+	for l.ch != quote {
+		if l.atEOF() || l.ch == '\n' {
+			return l.input[start:l.position], false
+		}
+		if l.ch == '\\' && l.peekChar() != '\n' {
+			l.readChar()
 		}
 		l.readChar()
 	}
+	return l.input[start:l.position], true
+}
 
-	return result.String()
+// readRawString reads an r"..." string, whose text is taken as written and
+// may span lines
+func (l *Lexer) readRawString() string {
+	start := l.position
+	l.readChar() // skip r
+	l.readChar() // skip opening quote
+	text := l.position
+	for l.ch != '"' {
+		if l.atEOF() {
+			l.errorAt(start, "unterminated raw string literal")
+			break
+		}
+		l.readChar()
+	}
+	return l.input[text:l.position]
 }
 
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+// readMultilineString reads a """...""" string. A line break right after
+// the opening quotes is dropped, as is a last line holding only the
+// indentation of the closing quotes. The indentation common to the lines,
+// including that of the closing quotes, is then stripped from each of them.
+// Escapes are decoded after stripping, so escaped whitespace is kept.
+func (l *Lexer) readMultilineString() string {
+	start := l.position
+	l.readChar()
+	l.readChar()
+	l.readChar() // skip """
+	textStart := l.position
+	for !strings.HasPrefix(l.input[l.position:], `"""`) {
+		if l.atEOF() {
+			l.errorAt(start, "unterminated multi-line string literal")
+			break
+		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			l.errorAt(l.position, "string interpolation is not supported in multi-line strings")
+		}
+		if l.ch == '\\' && l.peekChar() != '\n' {
+			l.readChar()
+		}
+		l.readChar()
+	}
+	text := l.input[textStart:l.position]
+	if !l.atEOF() {
 		l.readChar()
+		l.readChar() // leave the lexer on the last quote
+	}
+
+	type line struct {
+		text   string
+		offset int
+	}
+	lines := []line{}
+	offset := textStart
+	for _, s := range strings.Split(text, "\n") {
+		lines = append(lines, line{strings.TrimSuffix(s, "\r"), offset})
+		offset += len(s) + 1
+	}
+
+	if len(lines) > 1 && isBlank(lines[0].text) {
+		lines = lines[1:]
+	}
+	indent := ""
+	first := true
+	for i, ln := range lines {
+		closing := i == len(lines)-1 && len(lines) > 1 && isBlank(ln.text)
+		if isBlank(ln.text) && !closing {
+			continue
+		}
+		lead := ln.text[:len(ln.text)-len(strings.TrimLeft(ln.text, " \t"))]
+		if first {
+			indent, first = lead, false
+		} else {
+			indent = commonPrefix(indent, lead)
+		}
+	}
+	if len(lines) > 1 && isBlank(lines[len(lines)-1].text) {
+		lines = lines[:len(lines)-1]
+	}
+
+	out := make([]string, len(lines))
+	for i, ln := range lines {
+		if isBlank(ln.text) {
+			continue
+		}
+		out[i] = l.unescape(ln.text[len(indent):], ln.offset+len(indent))
+	}
+	return strings.Join(out, "\n")
+}
+
+// unescape decodes the escape sequences of literal text that starts at
+// offset in the input, reporting the invalid ones where they occur
+func (l *Lexer) unescape(text string, offset int) string {
+	if !strings.Contains(text, "\\") {
+		return text
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '\\' {
+			_, width := utf8.DecodeRuneInString(text[i:])
+			out.WriteString(text[i : i+width])
+			i += width
+			continue
+		}
+		value, n, err := decodeEscape(text[i:])
+		if err != "" {
+			l.errorAt(offset+i, err)
+		}
+		out.WriteString(value)
+		i += n
+	}
+	return out.String()
+}
+
+// decodeEscape decodes the escape sequence at the start of s, returning its
+// value, its length in bytes and an error message if it is invalid
+func decodeEscape(s string) (string, int, string) {
+	if len(s) < 2 {
+		return "", len(s), "invalid escape sequence \\ at end of line"
+	}
+
+	switch s[1] {
+	case 'n':
+		return "\n", 2, ""
+	case 't':
+		return "\t", 2, ""
+	case 'r':
+		return "\r", 2, ""
+	case '0':
+		return "\x00", 2, ""
+	case '\\', '"', '\'', '$':
+		return s[1:2], 2, ""
+	case 'x':
+		if len(s) < 4 || !isHexDigit(rune(s[2])) || !isHexDigit(rune(s[3])) {
+			return "", 2, "invalid escape sequence \\x, expected two hex digits"
+		}
+		b, _ := strconv.ParseUint(s[2:4], 16, 8)
+		return string([]byte{byte(b)}), 4, ""
+	case 'u':
+		end := strings.IndexByte(s, '}')
+		if len(s) < 3 || s[2] != '{' || end < 0 {
+			return "", 2, "invalid escape sequence \\u, expected \\u{...}"
+		}
+		digits := s[3:end]
+		if len(digits) == 0 || len(digits) > 6 || strings.IndexFunc(digits, func(r rune) bool { return !isHexDigit(r) }) >= 0 {
+			return "", end + 1, fmt.Sprintf("invalid Unicode escape %s, expected 1 to 6 hex digits", s[:end+1])
+		}
+		n, _ := strconv.ParseUint(digits, 16, 32)
+		r := rune(n)
+		if r > unicode.MaxRune || (0xD800 <= r && r <= 0xDFFF) {
+			return "", end + 1, fmt.Sprintf("invalid Unicode escape %s, not a Unicode scalar value", s[:end+1])
+		}
+		return string(r), end + 1, ""
+	}
+
+	_, width := utf8.DecodeRuneInString(s[1:])
+	return s[1 : 1+width], 1 + width, fmt.Sprintf("invalid escape sequence \\%s", s[1:1+width])
+}
+
+// errorAt reports an error at a byte offset in the input
+func (l *Lexer) errorAt(offset int, msg string) {
+	line, column := l.positionAt(offset)
+	l.errors = append(l.errors, fmt.Sprintf("%s at line %d:%d", msg, line, column))
+}
+
+// positionAt converts a byte offset in the input to a line and rune column
+func (l *Lexer) positionAt(offset int) (int, int) {
+	before := l.input[:offset]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	if lineStart == 0 && strings.HasPrefix(before, "\uFEFF") {
+		lineStart = len("\uFEFF")
+	}
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// skipWhitespace skips blanks and comments. It stops at a line break that
+// ends a statement and reports whether it did; a block comment spanning
+// lines counts as a line break.
+func (l *Lexer) skipWhitespace() bool {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '\n':
+			if l.endsStatement() {
+				return true
+			}
+			l.readChar()
+		case l.ch == '/' && isDocComment(l.input[l.position:]):
+			return false
+		case l.ch == '/' && l.peekChar() == '/':
+			l.skipLineComment()
+		case l.ch == '/' && l.peekChar() == '*':
+			line := l.line
+			l.skipBlockComment()
+			if l.line > line && l.endsStatement() {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+// endsStatement reports whether a line break here ends a statement. It
+// does when the last token can end one, the innermost open bracket, if
+// any, is a '{', and the next line does not continue the statement.
+func (l *Lexer) endsStatement() bool {
+	if len(l.interps) > 0 || !terminators[l.last] {
+		return false
+	}
+	if n := len(l.nesting); n > 0 && l.nesting[n-1] != LBRACE {
+		return false
+	}
+	return !l.continuesLine()
+}
+
+// continuesLine reports whether the next line of code begins with '.', as
+// in a method chain, or with else
+func (l *Lexer) continuesLine() bool {
+	rest := l.input[l.position:]
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				return false
+			}
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return false
+			}
+			rest = rest[end+4:]
+		case strings.HasPrefix(rest, "else"):
+			r, _ := utf8.DecodeRuneInString(rest[len("else"):])
+			return !isIdentContinue(r)
+		default:
+			return strings.HasPrefix(rest, ".")
+		}
 	}
 }
 
@@ -356,7 +931,7 @@ func (l *Lexer) skipLineComment() {
 	l.readChar()
 
 	// Skip until end of line
-	for l.ch != '\n' && l.ch != 0 {
+	for l.ch != '\n' && !l.atEOF() {
 		l.readChar()
 	}
 }
@@ -367,7 +942,7 @@ func (l *Lexer) skipBlockComment() {
 	l.readChar()
 
 	// Skip until */
-	for l.ch != 0 {
+	for !l.atEOF() {
 		if l.ch == '*' && l.peekChar() == '/' {
 			l.readChar() // skip *
 			l.readChar() // skip /
@@ -377,10 +952,99 @@ func (l *Lexer) skipBlockComment() {
 	}
 }
 
-func isLetter(ch byte) bool {
-	return unicode.IsLetter(rune(ch)) || ch == '_'
+// isDocComment reports whether s begins with a /// or /** doc comment. As
+// in Rust, //// and /*** begin ordinary comments, and so does /**/.
+func isDocComment(s string) bool {
+	if strings.HasPrefix(s, "///") {
+		return !strings.HasPrefix(s, "////")
+	}
+	return strings.HasPrefix(s, "/**") && !strings.HasPrefix(s, "/***") && !strings.HasPrefix(s, "/**/")
 }
 
-func isDigit(ch byte) bool {
+// readDocComment reads a doc comment and returns its text. The space after
+// /// is dropped; in a /** */ comment, each line loses its indentation and a
+// leading '*', and blank lines around the text are dropped.
+func (l *Lexer) readDocComment() string {
+	start := l.position
+	if strings.HasPrefix(l.input[start:], "///") {
+		for l.ch != '\n' && !l.atEOF() {
+			l.readChar()
+		}
+		text := strings.TrimSuffix(l.input[start+len("///"):l.position], "\r")
+		return strings.TrimPrefix(text, " ")
+	}
+
+	l.readChar() // skip "/**"
+	l.readChar()
+	l.readChar()
+	for !l.atEOF() && !(l.ch == '*' && l.peekChar() == '/') {
+		l.readChar()
+	}
+	end := l.position
+	if l.atEOF() {
+		l.errorAt(start, "unterminated doc comment")
+	} else {
+		l.readChar() // skip "*/"
+		l.readChar()
+	}
+
+	lines := strings.Split(l.input[start+len("/**"):end], "\n")
+	for i, line := range lines {
+		line = strings.TrimLeft(strings.TrimRight(line, " \t\r"), " \t")
+		if strings.HasPrefix(line, "*") {
+			line = strings.TrimPrefix(line[1:], " ")
+		}
+		lines[i] = line
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isIdentStart reports whether r may begin an identifier. Identifiers
+// follow the default syntax of Unicode Standard Annex #31: an XID_Start
+// character or '_', followed by XID_Continue characters. Identifiers are
+// compared as written, without normalization.
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) ||
+		unicode.In(r, unicode.Nl, unicode.Other_ID_Start)
+}
+
+// isIdentContinue reports whether r may appear after the first character
+// of an identifier
+func isIdentContinue(r rune) bool {
+	return isIdentStart(r) ||
+		unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
+
+func isBlank(s string) bool {
+	return strings.TrimLeft(s, " \t") == ""
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// utf16Len returns the number of UTF-16 code units that encode r
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -1,6 +1,9 @@
 package lexer
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -32,16 +35,19 @@ val a, b = (10, 20)
 		{IDENT, "x"},
 		{ASSIGN, "="},
 		{INT, "5"},
+		{NEWLINE, "\n"},
 		{VAR, "var"},
 		{IDENT, "y"},
 		{ASSIGN, "="},
 		{INT, "10"},
+		{NEWLINE, "\n"},
 		{VAL, "val"},
 		{IDENT, "result"},
 		{ASSIGN, "="},
 		{IDENT, "x"},
 		{PLUS, "+"},
 		{IDENT, "y"},
+		{NEWLINE, "\n"},
 		{DEF, "def"},
 		{IDENT, "add"},
 		{LPAREN, "("},
@@ -59,14 +65,17 @@ val a, b = (10, 20)
 		{IDENT, "x"},
 		{PLUS, "+"},
 		{IDENT, "y"},
+		{NEWLINE, "\n"},
 		{VAL, "val"},
 		{IDENT, "name"},
 		{ASSIGN, "="},
 		{STRING, "Sango"},
+		{NEWLINE, "\n"},
 		{VAL, "val"},
 		{IDENT, "pi"},
 		{ASSIGN, "="},
 		{FLOAT, "3.14159"},
+		{NEWLINE, "\n"},
 		{IF, "if"},
 		{LPAREN, "("},
 		{IDENT, "x"},
@@ -78,6 +87,7 @@ val a, b = (10, 20)
 		{LPAREN, "("},
 		{STRING, "positive"},
 		{RPAREN, ")"},
+		{NEWLINE, "\n"},
 		{RBRACE, "}"},
 		{ELSE, "else"},
 		{LBRACE, "{"},
@@ -85,7 +95,9 @@ val a, b = (10, 20)
 		{LPAREN, "("},
 		{STRING, "negative"},
 		{RPAREN, ")"},
+		{NEWLINE, "\n"},
 		{RBRACE, "}"},
+		{NEWLINE, "\n"},
 		{VAL, "val"},
 		{IDENT, "a"},
 		{COMMA, ","},
@@ -96,6 +108,7 @@ val a, b = (10, 20)
 		{COMMA, ","},
 		{INT, "20"},
 		{RPAREN, ")"},
+		{NEWLINE, "\n"},
 		{EOF, ""},
 	}
 
@@ -123,7 +136,7 @@ func TestOperators(t *testing.T) {
 & | ^ ~ << >>
 += -= *= /= %=
 &= |= ^= <<= >>=
--> => <- .. ..=
+-> => <- .. ..= ...
 `
 
 	tests := []struct {
@@ -166,6 +179,7 @@ func TestOperators(t *testing.T) {
 		{LARROW, "<-"},
 		{DOTDOT, ".."},
 		{DOTDOTEQ, "..="},
+		{ELLIPSIS, "..."},
 		{EOF, ""},
 	}
 
@@ -203,6 +217,7 @@ i8 i16 i32 i64 u8 u16 u32 u64 f32 f64 byte
 		{BOOL_TYPE, "bool"},
 		{STRING_TYPE, "string"},
 		{VOID_TYPE, "void"},
+		{NEWLINE, "\n"},
 		{I8_TYPE, "i8"},
 		{I16_TYPE, "i16"},
 		{I32_TYPE, "i32"},
@@ -214,6 +229,7 @@ i8 i16 i32 i64 u8 u16 u32 u64 f32 f64 byte
 		{F32_TYPE, "f32"},
 		{F64_TYPE, "f64"},
 		{BYTE_TYPE, "byte"},
+		{NEWLINE, "\n"},
 		{LBRACKET, "["},
 		{RBRACKET, "]"},
 		{INT_TYPE, "int"},
@@ -222,6 +238,7 @@ i8 i16 i32 i64 u8 u16 u32 u64 f32 f64 byte
 		{LBRACKET, "["},
 		{RBRACKET, "]"},
 		{FLOAT_TYPE, "float"},
+		{NEWLINE, "\n"},
 		{EOF, ""},
 	}
 
@@ -245,7 +262,7 @@ i8 i16 i32 i64 u8 u16 u32 u64 f32 f64 byte
 func TestKeywords(t *testing.T) {
 	input := `def val var if else match type struct impl
 return true false for in while break continue
-defer sizeof include import define null
+defer sizeof alignof offsetof include import define null extern const
 `
 
 	tests := []struct {
@@ -269,12 +286,17 @@ defer sizeof include import define null
 		{WHILE, "while"},
 		{BREAK, "break"},
 		{CONTINUE, "continue"},
+		{NEWLINE, "\n"},
 		{DEFER, "defer"},
 		{SIZEOF, "sizeof"},
+		{ALIGNOF, "alignof"},
+		{OFFSETOF, "offsetof"},
 		{INCLUDE, "include"},
 		{IMPORT, "import"},
 		{DEFINE, "define"},
 		{NULL, "null"},
+		{EXTERN, "extern"},
+		{CONST, "const"},
 		{EOF, ""},
 	}
 
@@ -294,3 +316,664 @@ defer sizeof include import define null
 		}
 	}
 }
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `// 日本語のコメント
+val 値 = 1
+val café = "こんにちは"
+val _tmp = x_1
+/* ブロック
+   コメント */
+val résumé₁ = Ⅻ + é
+_`
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{VAL, "val"},
+		{IDENT, "値"},
+		{ASSIGN, "="},
+		{INT, "1"},
+		{NEWLINE, "\n"},
+		{VAL, "val"},
+		{IDENT, "café"},
+		{ASSIGN, "="},
+		{STRING, "こんにちは"},
+		{NEWLINE, "\n"},
+		{VAL, "val"},
+		{IDENT, "_tmp"},
+		{ASSIGN, "="},
+		{IDENT, "x_1"},
+		{NEWLINE, "\n"},
+		{VAL, "val"},
+		{IDENT, "résumé"},
+		{ILLEGAL, "₁"},
+		{ASSIGN, "="},
+		{IDENT, "Ⅻ"},
+		{PLUS, "+"},
+		{IDENT, "é"},
+		{NEWLINE, "\n"},
+		{UNDERSCORE, "_"},
+		{EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestNulIsNotEOF(t *testing.T) {
+	input := "val a = \"x\x00y\" // \x00\n\x00 val b"
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{VAL, "val"},
+		{IDENT, "a"},
+		{ASSIGN, "="},
+		{STRING, "x\x00y"},
+		{NEWLINE, "\n"},
+		{ILLEGAL, "\x00"},
+		{VAL, "val"},
+		{IDENT, "b"},
+		{EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestColumns(t *testing.T) {
+	input := "val 値 = \"😀\" + x\n  y"
+
+	tests := []struct {
+		literal     string
+		line        int
+		column      int
+		utf16Column int
+	}{
+		{"val", 1, 1, 1},
+		{"値", 1, 5, 5},
+		{"=", 1, 7, 7},
+		{"😀", 1, 9, 9},
+		{"+", 1, 13, 14},
+		{"x", 1, 15, 16},
+		{"\n", 1, 16, 17},
+		{"y", 2, 3, 3},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+		if tok.Line != tt.line || tok.Column != tt.column || tok.UTF16Column != tt.utf16Column {
+			t.Errorf("tests[%d] - %q at %d:%d (UTF-16 %d), expected %d:%d (UTF-16 %d)",
+				i, tok.Literal, tok.Line, tok.Column, tok.UTF16Column, tt.line, tt.column, tt.utf16Column)
+		}
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	l := New("\uFEFFval x")
+	tok := l.NextToken()
+	if tok.Type != VAL || tok.Column != 1 {
+		t.Fatalf("expected val at column 1, got %s", tok)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	l := New("val a\xffb = \"\xc3\"")
+	for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+	}
+
+	expected := []string{
+		"invalid UTF-8 encoding (byte 0xff) at line 1:6",
+		"invalid UTF-8 encoding (byte 0xc3) at line 1:12",
+	}
+	errors := l.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] - expected %q, got %q", i, msg, errors[i])
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected TokenType
+		literal  string
+	}{
+		{`"a\tb\\c\"d"`, STRING, "a\tb\\c\"d"},
+		{`"\x41\u{3042}\u{1F600}\0"`, STRING, "Aあ😀\x00"},
+		{`"\xff"`, STRING, "\xff"},
+		{`'a'`, CHAR, "a"},
+		{`'\''`, CHAR, "'"},
+		{`'"'`, CHAR, `"`},
+		{`'値'`, CHAR, "値"},
+		{`'\u{7f}'`, CHAR, "\x7f"},
+		{`r"C:\dir\n"`, STRING, `C:\dir\n`},
+		{"r\"two\nlines\"", STRING, "two\nlines"},
+		{`"""one line"""`, STRING, "one line"},
+		{"\"\"\"\n    first\n      second\n\n    third\n    \"\"\"", STRING, "first\n  second\n\nthird"},
+		{"\"\"\"\n    kept\n  \"\"\"", STRING, "  kept"},
+		{"\"\"\"\n\tx\\n\\ty\n\ty \\\"\"\" z\n\t\"\"\"", STRING, "x\n\ty\ny \"\"\" z"},
+		{"\"\"\"\r\n  crlf\r\n  \"\"\"", STRING, "crlf"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expected || tok.Literal != tt.literal {
+			t.Errorf("tests[%d] - expected %s %q, got %s %q", i, tt.expected, tt.literal, tok.Type, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != EOF {
+			t.Errorf("tests[%d] - expected EOF after literal, got %s", i, next)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("tests[%d] - unexpected errors: %v", i, l.Errors())
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`val s = "a\qb"`, []string{`invalid escape sequence \q at line 1:11`}},
+		{`"\x4"`, []string{`invalid escape sequence \x, expected two hex digits at line 1:2`}},
+		{`"\u0041"`, []string{`invalid escape sequence \u, expected \u{...} at line 1:2`}},
+		{`"\u{}"`, []string{`invalid Unicode escape \u{}, expected 1 to 6 hex digits at line 1:2`}},
+		{`"\u{D800}"`, []string{`invalid Unicode escape \u{D800}, not a Unicode scalar value at line 1:2`}},
+		{`"\u{110000}"`, []string{`invalid Unicode escape \u{110000}, not a Unicode scalar value at line 1:2`}},
+		{"val s = \"open\nval t = 1", []string{"unterminated string literal at line 1:9"}},
+		{"x = 'a", []string{"unterminated character literal at line 1:5"}},
+		{"''", []string{"empty character literal at line 1:1"}},
+		{"'ab'", []string{"character literal 'ab' has more than one character at line 1:1"}},
+		{"r\"open", []string{"unterminated raw string literal at line 1:1"}},
+		{"\n  \"\"\"\n  open", []string{"unterminated multi-line string literal at line 2:3"}},
+		{"\"\"\"\n    ok\n    \\z\n    \"\"\"", []string{`invalid escape sequence \z at line 3:5`}},
+		{`"\é"`, []string{`invalid escape sequence \é at line 1:2`}},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		}
+		errors := l.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("tests[%d] - expected %v, got %v", i, tt.expected, errors)
+			continue
+		}
+		for j, msg := range tt.expected {
+			if errors[j] != msg {
+				t.Errorf("tests[%d] - expected %q, got %q", i, msg, errors[j])
+			}
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"Hello ${name}!" "${a[(1)]:>8}${ P { x: "${y}" }.x }" "\${not}"`
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{INTERP_START, "Hello "},
+		{IDENT, "name"},
+		{INTERP_END, "!"},
+		{INTERP_START, ""},
+		{IDENT, "a"},
+		{LBRACKET, "["},
+		{LPAREN, "("},
+		{INT, "1"},
+		{RPAREN, ")"},
+		{RBRACKET, "]"},
+		{FORMAT_SPEC, ">8"},
+		{INTERP_MID, ""},
+		{IDENT, "P"},
+		{LBRACE, "{"},
+		{IDENT, "x"},
+		{COLON, ":"},
+		{INTERP_START, ""},
+		{IDENT, "y"},
+		{INTERP_END, ""},
+		{RBRACE, "}"},
+		{DOT, "."},
+		{IDENT, "x"},
+		{INTERP_END, ""},
+		{STRING, "${not}"},
+		{EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestStringInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val s = "a ${x + 1`, "unterminated string interpolation at line 1:12"},
+		{"val s = \"${x} and\nval t = 1", "unterminated string literal at line 1:9"},
+		{"\"\"\"\n  ${x}\n  \"\"\"", "string interpolation is not supported in multi-line strings at line 2:3"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		}
+		if errs := l.Errors(); len(errs) != 1 || errs[0] != tt.expected {
+			t.Errorf("tests[%d] - expected %q, got %v", i, tt.expected, errs)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected TokenType
+		digits   string
+		suffix   string
+	}{
+		{"0xFF", INT, "0xFF", ""},
+		{"0Xdead_BEEF", INT, "0XdeadBEEF", ""},
+		{"0o755", INT, "0o755", ""},
+		{"0b1010_0101", INT, "0b10100101", ""},
+		{"1_000_000", INT, "1000000", ""},
+		{"255u8", INT, "255", "u8"},
+		{"0xFFu8", INT, "0xFF", "u8"},
+		{"0x1f32", INT, "0x1f32", ""},
+		{"18446744073709551615u64", INT, "18446744073709551615", "u64"},
+		{"1.5f32", FLOAT, "1.5", "f32"},
+		{"2f64", FLOAT, "2", "f64"},
+		{"6.02e23", FLOAT, "6.02e23", ""},
+		{"1_0.2_5e-1_0", FLOAT, "10.25e-10", ""},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expected || tok.Literal != tt.input {
+			t.Errorf("tests[%d] - expected %s %q, got %s %q", i, tt.expected, tt.input, tok.Type, tok.Literal)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("tests[%d] - unexpected errors: %v", i, l.Errors())
+		}
+		digits, suffix := SplitNumber(tok.Literal)
+		if digits != tt.digits || suffix != tt.suffix {
+			t.Errorf("tests[%d] - expected split %q %q, got %q %q", i, tt.digits, tt.suffix, digits, suffix)
+		}
+	}
+}
+
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0x", "hex literal has no digits at line 1:1"},
+		{"0b102", "invalid digit '2' in binary literal at line 1:5"},
+		{"0o78", "invalid digit '8' in octal literal at line 1:4"},
+		{"1__000", "'_' must separate successive digits at line 1:2"},
+		{"1000_", "'_' must separate successive digits at line 1:5"},
+		{"0x_FF", "'_' must separate successive digits at line 1:3"},
+		{"12abc", "invalid suffix abc on number literal at line 1:3"},
+		{"1.5u8", "invalid suffix u8 on float literal at line 1:4"},
+		{"0b1f32", "invalid suffix f32 on binary literal at line 1:4"},
+		{"1e+", "exponent has no digits at line 1:2"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		}
+		if errs := l.Errors(); len(errs) != 1 || errs[0] != tt.expected {
+			t.Errorf("tests[%d] - expected %q, got %v", i, tt.expected, errs)
+		}
+	}
+}
+
+func TestNewlines(t *testing.T) {
+	input := `val x = a
+(b, c)
+f(a,
+  b)
+y = a +
+  b
+list
+  .map(f) // comment
+
+  // another
+  .sum()
+if (c) { 1 }
+else { 2 }
+def g() = {
+  return
+}
+z /* a
+  b */ w`
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{VAL, "val"},
+		{IDENT, "x"},
+		{ASSIGN, "="},
+		{IDENT, "a"},
+		{NEWLINE, "\n"},
+		{LPAREN, "("},
+		{IDENT, "b"},
+		{COMMA, ","},
+		{IDENT, "c"},
+		{RPAREN, ")"},
+		{NEWLINE, "\n"},
+		{IDENT, "f"},
+		{LPAREN, "("},
+		{IDENT, "a"},
+		{COMMA, ","},
+		{IDENT, "b"},
+		{RPAREN, ")"},
+		{NEWLINE, "\n"},
+		{IDENT, "y"},
+		{ASSIGN, "="},
+		{IDENT, "a"},
+		{PLUS, "+"},
+		{IDENT, "b"},
+		{NEWLINE, "\n"},
+		{IDENT, "list"},
+		{DOT, "."},
+		{IDENT, "map"},
+		{LPAREN, "("},
+		{IDENT, "f"},
+		{RPAREN, ")"},
+		{DOT, "."},
+		{IDENT, "sum"},
+		{LPAREN, "("},
+		{RPAREN, ")"},
+		{NEWLINE, "\n"},
+		{IF, "if"},
+		{LPAREN, "("},
+		{IDENT, "c"},
+		{RPAREN, ")"},
+		{LBRACE, "{"},
+		{INT, "1"},
+		{RBRACE, "}"},
+		{ELSE, "else"},
+		{LBRACE, "{"},
+		{INT, "2"},
+		{RBRACE, "}"},
+		{NEWLINE, "\n"},
+		{DEF, "def"},
+		{IDENT, "g"},
+		{LPAREN, "("},
+		{RPAREN, ")"},
+		{ASSIGN, "="},
+		{LBRACE, "{"},
+		{RETURN, "return"},
+		{NEWLINE, "\n"},
+		{RBRACE, "}"},
+		{NEWLINE, "\n"},
+		{IDENT, "z"},
+		{NEWLINE, "\n"},
+		{IDENT, "w"},
+		{EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNewlinePositions(t *testing.T) {
+	// A line break is placed at the end of the line it ends
+	l := New("val é = 1\nval 😀 = 2\n")
+	expected := [][3]int{{1, 10, 10}, {2, 10, 11}}
+	for _, want := range expected {
+		tok := l.NextToken()
+		for tok.Type != NEWLINE && tok.Type != EOF {
+			tok = l.NextToken()
+		}
+		if got := [3]int{tok.Line, tok.Column, tok.UTF16Column}; got != want {
+			t.Errorf("expected a line break at %v, got %v", want, got)
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	input := "/// Adds numbers.\n///\n///   Indented.\n//// plain\n/**/ /*** plain */\n" +
+		"/**\n * Block doc.\n *\n * More.\n */\n/** one line */ x /// trailing\ny"
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{DOC_COMMENT, "Adds numbers."},
+		{DOC_COMMENT, ""},
+		{DOC_COMMENT, "  Indented."},
+		{DOC_COMMENT, "Block doc.\n\nMore."},
+		{DOC_COMMENT, "one line"},
+		{IDENT, "x"},
+		{DOC_COMMENT, "trailing"},
+		{NEWLINE, "\n"},
+		{IDENT, "y"},
+		{EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	l = New("/** open")
+	l.NextToken()
+	if errs := l.Errors(); len(errs) != 1 || errs[0] != "unterminated doc comment at line 1:1" {
+		t.Errorf("expected unterminated doc comment error, got %v", errs)
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	input := "\uFEFFval s = \"a\\tb ${x + 1:>4} c\" // note\n" +
+		"/* block */ var r = r\"raw\" + 'c' + 0x1F_u8\n" +
+		"/// doc\nλ(1.5e3, \"\"\"multi\"\"\")"
+
+	tests := []string{
+		"val", "s", "=", "\"a\\tb ${", "x", "+", "1", ":>4", "} c\"", "\n",
+		"var", "r", "=", "r\"raw\"", "+", "'c'", "+", "0x1F_u8", "\n",
+		"/// doc", "λ", "(", "1.5e3", ",", "\"\"\"multi\"\"\"", ")", "",
+	}
+
+	l := New(input)
+	for i, want := range tests {
+		tok := l.NextToken()
+		if tok.Type == NEWLINE {
+			// A line break is placed where the comment before it ends
+			continue
+		}
+		if got := input[tok.Offset:tok.End]; got != want {
+			t.Errorf("tests[%d] - expected %s at %d:%d to span %q, got %q",
+				i, tok.Type, tok.Line, tok.Column, want, got)
+		}
+	}
+}
+
+func TestLookupTokenType(t *testing.T) {
+	for tt := range tokenStrings {
+		got, ok := LookupTokenType(tt.String())
+		if !ok || got != tt {
+			t.Errorf("LookupTokenType(%q) - expected %d, got %d", tt.String(), tt, got)
+		}
+	}
+	if _, ok := LookupTokenType("nope"); ok {
+		t.Errorf("expected no token type for nope")
+	}
+}
+
+func TestTokenClasses(t *testing.T) {
+	for word, tt := range keywords {
+		if tt.IsKeyword() == tt.IsTypeName() {
+			t.Errorf("%s - expected a keyword or a type name", word)
+		}
+		if tt.String() != word {
+			t.Errorf("%s - token type spelled %q", word, tt.String())
+		}
+	}
+	for _, tt := range TokenTypes() {
+		classes := 0
+		for _, in := range []bool{tt.IsOperator(), tt.IsDelimiter(), tt.IsKeyword(), tt.IsTypeName()} {
+			if in {
+				classes++
+			}
+		}
+		if _, isWord := keywords[tt.String()]; classes > 1 || (classes == 0) != (tt <= FORMAT_SPEC) || isWord != (tt.IsKeyword() || tt.IsTypeName()) {
+			t.Errorf("%s - wrong token class", tt)
+		}
+	}
+	if len(TokenTypes()) != len(tokenStrings) {
+		t.Errorf("TokenTypes - expected %d types, got %d", len(tokenStrings), len(TokenTypes()))
+	}
+}
+
+func TestRelex(t *testing.T) {
+	source := "\uFEFFdef f(x: int): int = {\n" +
+		"  val s = \"a ${x + g(1, 2):>4} b\" // note\n" +
+		"  /* block\n     comment */\n" +
+		"  val y = [1, 2,\n    3]\n" +
+		"  if (x > 0) {\n    y\n  }\n" +
+		"  else { 0 }\n" +
+		"}\n" +
+		"/// doc\n" +
+		"val total = f(1)\n" +
+		"  .add(2)\n" +
+		"val z = 0x1F_u8 + 1.5e3 + 'c' + r\"raw\" + \"\"\"\nmulti\n\"\"\"\n"
+
+	edits := []struct {
+		at, remove int
+		insert     string
+	}{
+		{0, 0, "val a = 1\n"},
+		{len(source), 0, "val b = 2"},
+		{strings.Index(source, "int = {"), 3, "long"},
+		{strings.Index(source, "g(1"), 1, "hh"},
+		{strings.Index(source, ":>4"), 3, ""},
+		{strings.Index(source, "} b"), 0, "}"},
+		{strings.Index(source, "a ${"), 0, "\" + "},
+		{strings.Index(source, "block"), 5, "*/ x /*"},
+		{strings.Index(source, "2,\n"), 2, "2]"},
+		{strings.Index(source, "\n  else"), 1, ""},
+		{strings.Index(source, "val total"), 0, "\n\n"},
+		{strings.Index(source, ".add"), 1, ""},
+		{strings.Index(source, "/// doc"), 1, ""},
+		{strings.Index(source, "0x1F"), 0, "λ"},
+		{strings.Index(source, "\"\"\"\nmulti"), 1, ""},
+		{strings.Index(source, "val z"), len("val z"), "var zz"},
+		{strings.Index(source, "+ 1.5"), 2, "\n."},
+	}
+
+	old := Tokens(source)
+	for i, e := range edits {
+		edited := source[:e.at] + e.insert + source[e.at+e.remove:]
+		got := Relex(old, edited, e.at, e.at+e.remove, e.at+len(e.insert))
+		want := Tokens(edited)
+		if len(got) != len(want) {
+			t.Errorf("edits[%d] - expected %d tokens, got %d", i, len(want), len(got))
+			continue
+		}
+		for k := range want {
+			if got[k] != want[k] {
+				t.Errorf("edits[%d] - token %d: expected %+v, got %+v", i, k, want[k], got[k])
+				break
+			}
+		}
+	}
+}
+
+func TestRelexReuse(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "def f%d(x: int) = {\n  val y = x * %d\n  y + 1\n}\n", i, i)
+	}
+	source := b.String()
+	old := Tokens(source)
+
+	at := strings.Index(source, "x * 500")
+	edited := source[:at] + "(x + 1)" + source[at+1:]
+	got, lexed := relex(old, edited, at, at+1, at+len("(x + 1)"))
+	if lexed > 20 {
+		t.Errorf("expected a few tokens to be lexed again, got %d of %d", lexed, len(got))
+	}
+	if want := Tokens(edited); len(got) != len(want) || got[len(got)-1] != want[len(want)-1] {
+		t.Errorf("expected %d tokens ending with %+v, got %d ending with %+v",
+			len(want), want[len(want)-1], len(got), got[len(got)-1])
+	}
+}
+
+func TestTokenJSON(t *testing.T) {
+	tokens := Tokens("val s = \"${x}\" >>= 1")
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `[{"type":"val","literal":"val","line":1,"column":1,"utf16Column":1,"offset":0,"end":3}`) {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	var back []Token
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != len(tokens) {
+		t.Fatalf("expected %d tokens, got %d", len(tokens), len(back))
+	}
+	for i := range tokens {
+		if back[i] != tokens[i] {
+			t.Errorf("tokens[%d] - expected %+v, got %+v", i, tokens[i], back[i])
+		}
+	}
+}
@@ -16,8 +16,22 @@ const (
 	INT    // 123
 	FLOAT  // 123.45
 	STRING // "hello"
+	CHAR   // 'a'
+
+	// Doc comments: /// text and /** text */. The literal is the text
+	// without the comment markers.
+	DOC_COMMENT
+
+	// String interpolation: "a${x}b${y:.2f}c" is split into INTERP_START "a",
+	// the tokens of x, INTERP_MID "b", the tokens of y, FORMAT_SPEC ".2f" and
+	// INTERP_END "c"
+	INTERP_START
+	INTERP_MID
+	INTERP_END
+	FORMAT_SPEC
 
 	// Operators
+	operatorBeg
 	PLUS            // +
 	MINUS           // -
 	ASTERISK        // *
@@ -55,9 +69,12 @@ const (
 	LARROW          // <-
 	DOTDOT          // ..
 	DOTDOTEQ        // ..=
+	ELLIPSIS        // ...
 	AT              // @
+	operatorEnd
 
 	// Delimiters
+	delimiterBeg
 	LPAREN     // (
 	RPAREN     // )
 	LBRACE     // {
@@ -69,8 +86,10 @@ const (
 	COLON      // :
 	DOT        // .
 	UNDERSCORE // _
+	delimiterEnd
 
 	// Keywords
+	keywordBeg
 	DEF      // def
 	VAL      // val
 	VAR      // var
@@ -91,12 +110,18 @@ const (
 	DEFER    // defer
 	ASSERT   // assert
 	SIZEOF   // sizeof
+	ALIGNOF  // alignof
+	OFFSETOF // offsetof
 	INCLUDE  // include
 	IMPORT   // import
 	DEFINE   // define
 	NULL     // null
+	EXTERN   // extern
+	CONST    // const
+	keywordEnd
 
 	// Basic types
+	typeBeg
 	INT_TYPE    // int
 	LONG_TYPE   // long
 	FLOAT_TYPE  // float
@@ -117,6 +142,7 @@ const (
 	F32_TYPE  // f32
 	F64_TYPE  // f64
 	BYTE_TYPE // byte
+	typeEnd
 )
 
 var tokenStrings = map[TokenType]string{
@@ -128,6 +154,14 @@ var tokenStrings = map[TokenType]string{
 	INT:    "INT",
 	FLOAT:  "FLOAT",
 	STRING: "STRING",
+	CHAR:   "CHAR",
+
+	DOC_COMMENT: "DOC_COMMENT",
+
+	INTERP_START: "INTERP_START",
+	INTERP_MID:   "INTERP_MID",
+	INTERP_END:   "INTERP_END",
+	FORMAT_SPEC:  "FORMAT_SPEC",
 
 	PLUS:            "+",
 	MINUS:           "-",
@@ -166,6 +200,7 @@ var tokenStrings = map[TokenType]string{
 	LARROW:          "<-",
 	DOTDOT:          "..",
 	DOTDOTEQ:        "..=",
+	ELLIPSIS:        "...",
 	AT:              "@",
 
 	LPAREN:     "(",
@@ -200,10 +235,14 @@ var tokenStrings = map[TokenType]string{
 	DEFER:    "defer",
 	ASSERT:   "assert",
 	SIZEOF:   "sizeof",
+	ALIGNOF:  "alignof",
+	OFFSETOF: "offsetof",
 	INCLUDE:  "include",
 	IMPORT:   "import",
 	DEFINE:   "define",
 	NULL:     "null",
+	EXTERN:   "extern",
+	CONST:    "const",
 
 	INT_TYPE:    "int",
 	LONG_TYPE:   "long",
@@ -254,10 +293,14 @@ var keywords = map[string]TokenType{
 	"defer":    DEFER,
 	"assert":   ASSERT,
 	"sizeof":   SIZEOF,
+	"alignof":  ALIGNOF,
+	"offsetof": OFFSETOF,
 	"include":  INCLUDE,
 	"import":   IMPORT,
 	"define":   DEFINE,
 	"null":     NULL,
+	"extern":   EXTERN,
+	"const":    CONST,
 
 	// Basic types
 	"int":    INT_TYPE,
@@ -282,6 +325,73 @@ var keywords = map[string]TokenType{
 	"byte": BYTE_TYPE,
 }
 
+// terminators are the tokens that may end a statement. A line break after
+// one of them is a NEWLINE.
+var terminators = map[TokenType]bool{
+	IDENT:      true,
+	INT:        true,
+	FLOAT:      true,
+	STRING:     true,
+	CHAR:       true,
+	INTERP_END: true,
+	TRUE:       true,
+	FALSE:      true,
+	NULL:       true,
+	UNDERSCORE: true,
+	RPAREN:     true,
+	RBRACKET:   true,
+	RBRACE:     true,
+	RETURN:     true,
+	BREAK:      true,
+	CONTINUE:   true,
+
+	INT_TYPE:    true,
+	LONG_TYPE:   true,
+	FLOAT_TYPE:  true,
+	DOUBLE_TYPE: true,
+	BOOL_TYPE:   true,
+	STRING_TYPE: true,
+	VOID_TYPE:   true,
+	I8_TYPE:     true,
+	I16_TYPE:    true,
+	I32_TYPE:    true,
+	I64_TYPE:    true,
+	U8_TYPE:     true,
+	U16_TYPE:    true,
+	U32_TYPE:    true,
+	U64_TYPE:    true,
+	F32_TYPE:    true,
+	F64_TYPE:    true,
+	BYTE_TYPE:   true,
+}
+
+// IsOperator reports whether t is an operator such as + or ->
+func (t TokenType) IsOperator() bool { return operatorBeg < t && t < operatorEnd }
+
+// IsDelimiter reports whether t is a delimiter such as ( or ;
+func (t TokenType) IsDelimiter() bool { return delimiterBeg < t && t < delimiterEnd }
+
+// IsKeyword reports whether t is a keyword other than a type name
+func (t TokenType) IsKeyword() bool { return keywordBeg < t && t < keywordEnd }
+
+// IsTypeName reports whether t is a built-in type name such as int or u8
+func (t TokenType) IsTypeName() bool { return typeBeg < t && t < typeEnd }
+
+// IsNumberSuffix reports whether t is a type name that may follow a number
+// literal, as in 255u8 or 1.5f32
+func (t TokenType) IsNumberSuffix() bool { return I8_TYPE <= t && t <= F64_TYPE }
+
+// TokenTypes returns every token type in the order they are declared
+func TokenTypes() []TokenType {
+	types := []TokenType{}
+	for t := ILLEGAL; t < typeEnd; t++ {
+		if _, ok := tokenStrings[t]; ok {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
 // LookupIdent checks if an identifier is a keyword
 func LookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
@@ -290,12 +400,41 @@ func LookupIdent(ident string) TokenType {
 	return IDENT
 }
 
-// Token represents a lexical token
+// MarshalText writes a token type as its String, as in JSON
+func (t TokenType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText reads a token type written by MarshalText
+func (t *TokenType) UnmarshalText(text []byte) error {
+	tt, ok := LookupTokenType(string(text))
+	if !ok {
+		return fmt.Errorf("unknown token type %q", text)
+	}
+	*t = tt
+	return nil
+}
+
+// LookupTokenType returns the token type whose String is name
+func LookupTokenType(name string) (TokenType, bool) {
+	for t, s := range tokenStrings {
+		if s == name {
+			return t, true
+		}
+	}
+	return ILLEGAL, false
+}
+
+// Token represents a lexical token. Column counts runes from 1; UTF16Column
+// is the same position in UTF-16 code units, as used by LSP clients.
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type        TokenType `json:"type"`
+	Literal     string    `json:"literal"`
+	Line        int       `json:"line"`
+	Column      int       `json:"column"`
+	UTF16Column int       `json:"utf16Column"`
+	Offset      int       `json:"offset"` // byte offset of the token in the input
+	End         int       `json:"end"`    // byte offset just past the token
 }
 
 // NewToken creates a new token
@@ -0,0 +1,252 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/cinterop"
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+func init() {
+	for _, c := range []*Check{
+		{Name: "unused", Doc: "val and var bindings that are never used", Run: checkUnused},
+		{Name: "varneverassigned", Doc: "var bindings that are never reassigned and could be val", Run: checkVarNeverAssigned},
+		{Name: "shadow", Doc: "bindings that hide a binding of the same name in an enclosing scope", Run: checkShadow},
+		{Name: "unreachable", Doc: "statements after a return", Run: checkUnreachable},
+		{Name: "deferinloop", Doc: "defer statements inside a loop, which run only when the function returns", Run: checkDeferInLoop},
+		{Name: "assertsideeffect", Doc: "assert conditions that call functions or assign", Run: checkAssertSideEffect},
+		{Name: "nullcompare", Doc: "comparisons with null of values that are not pointers", Run: checkNullCompare},
+		{Name: "unusedinclude", Doc: "includes none of whose C functions are used", Run: checkUnusedInclude},
+	} {
+		Register(c)
+	}
+}
+
+// checkUnused reports local bindings that are never read. Top-level
+// bindings may be used by other files, and names starting with an
+// underscore are unused on purpose.
+func checkUnused(p *Pass) {
+	for _, b := range p.Bindings() {
+		if (b.Kind == Val || b.Kind == Var) && !b.Global && len(b.Uses) == 0 && !strings.HasPrefix(b.Name.Value, "_") {
+			p.Report(b.Name, "%s %s is never used", b.Kind, b.Name.Value)
+		}
+	}
+}
+
+func checkVarNeverAssigned(p *Pass) {
+	for _, b := range p.Bindings() {
+		if b.Kind == Var && !b.Global && len(b.Assigns) == 0 && !b.Borrowed {
+			p.Report(b.Name, "var %s is never reassigned, declare it with val", b.Name.Value)
+		}
+	}
+}
+
+// checkShadow reports bindings that hide another. Parameters may shadow
+// top-level bindings, which is how they are usually named.
+func checkShadow(p *Pass) {
+	for _, b := range p.Bindings() {
+		if b.Shadows == nil || (b.Kind == Param && b.Shadows.Global) {
+			continue
+		}
+		p.Report(b.Name, "%s %s shadows the %s declared on line %d", b.Kind, b.Name.Value, b.Shadows.Kind, b.Shadows.Name.Token.Line)
+	}
+}
+
+func checkUnreachable(p *Pass) {
+	ast.Inspect(p.Program, func(n ast.Node) bool {
+		block, ok := n.(*ast.BlockStatement)
+		if !ok {
+			return true
+		}
+		for i, stmt := range block.Statements {
+			if terminates(stmt) && i+1 < len(block.Statements) {
+				p.Report(block.Statements[i+1], "unreachable code")
+				break
+			}
+		}
+		return true
+	})
+}
+
+// terminates reports whether control never continues after stmt: it is a
+// return, a block holding one, or an if whose branches both terminate
+func terminates(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.BlockStatement:
+		for _, inner := range s.Statements {
+			if terminates(inner) {
+				return true
+			}
+		}
+	case *ast.ExpressionStatement:
+		switch e := s.Expression.(type) {
+		case *ast.BlockStatement:
+			return terminates(e)
+		case *ast.IfExpression:
+			return e.Consequence != nil && e.Alternative != nil && terminates(e.Consequence) && terminates(e.Alternative)
+		}
+	}
+	return false
+}
+
+func checkDeferInLoop(p *Pass) {
+	var visit func(n ast.Node, loop bool)
+	visit = func(n ast.Node, loop bool) {
+		switch n.(type) {
+		case *ast.DeferStatement:
+			if loop {
+				p.Report(n, "defer in a loop runs when the function returns, not at the end of each iteration")
+			}
+		case *ast.ForStatement, *ast.WhileStatement:
+			loop = true
+		case *ast.FunctionStatement, *ast.FunctionLiteral:
+			loop = false
+		}
+		for _, child := range ast.Children(n) {
+			visit(child, loop)
+		}
+	}
+	visit(p.Program, false)
+}
+
+// checkAssertSideEffect reports asserts whose condition calls a function
+// other than a const def, or assigns, since the program then behaves
+// differently when asserts are not checked
+func checkAssertSideEffect(p *Pass) {
+	constant := map[string]bool{}
+	for _, stmt := range p.Program.Statements {
+		if fn, ok := stmt.(*ast.FunctionStatement); ok && fn.Const && fn.Name != nil {
+			constant[fn.Name.Value] = true
+		}
+	}
+
+	ast.Inspect(p.Program, func(n ast.Node) bool {
+		assert, ok := n.(*ast.AssertStatement)
+		if !ok {
+			return true
+		}
+		effect := ""
+		ast.Inspect(assert.Expression, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FunctionLiteral:
+				return false
+			case *ast.CallExpression:
+				if name := calleeName(n.Function); !constant[name] && effect == "" {
+					effect = "calls " + name
+				}
+			case *ast.BuiltinFunctionCall:
+				if effect == "" {
+					effect = "calls " + n.Name
+				}
+			case *ast.AssignmentStatement:
+				if effect == "" && n.Name != nil {
+					effect = "assigns " + n.Name.Value
+				}
+			}
+			return effect == ""
+		})
+		if effect != "" {
+			p.Report(assert, "assert condition %s, which may have side effects", effect)
+		}
+		return true
+	})
+}
+
+// calleeName names the function a call calls: f for f(x) and x.f()
+func calleeName(fn ast.Expression) string {
+	switch fn := fn.(type) {
+	case *ast.Identifier:
+		return fn.Value
+	case *ast.InfixExpression:
+		if id, ok := fn.Right.(*ast.Identifier); ok && fn.Operator == "." {
+			return id.Value
+		}
+	}
+	return "a function"
+}
+
+func checkNullCompare(p *Pass) {
+	structs := map[string]bool{}
+	aliases := map[string]*ast.TypeExpression{}
+	for _, stmt := range p.Program.Statements {
+		switch s := stmt.(type) {
+		case *ast.StructStatement:
+			if s.Name != nil {
+				structs[s.Name.Value] = true
+			}
+		case *ast.TypeStatement:
+			if s.Name != nil && s.Type != nil {
+				aliases[s.Name.Value] = s.Type
+			}
+		}
+	}
+
+	// nullable reports whether a value of type t may be null. Types that
+	// are not known, such as those of C, may be.
+	var nullable func(t *ast.TypeExpression, depth int) bool
+	nullable = func(t *ast.TypeExpression, depth int) bool {
+		switch {
+		case t.Pointer || t.Function != nil || (t.Array && t.Length == nil):
+			return true
+		case t.Array || len(t.Tuple) > 0 || t.Record != nil || structs[t.Name]:
+			return false
+		case t.Name == "char" || (t.Name != "string" && lexer.LookupIdent(t.Name).IsTypeName()):
+			return false
+		case aliases[t.Name] != nil && depth < len(aliases):
+			return nullable(aliases[t.Name], depth+1)
+		}
+		return true
+	}
+
+	ast.Inspect(p.Program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || (infix.Operator != "==" && infix.Operator != "!=") {
+			return true
+		}
+		value := infix.Left
+		if _, null := value.(*ast.NullLiteral); null {
+			value = infix.Right
+		} else if _, null := infix.Right.(*ast.NullLiteral); !null {
+			return true
+		}
+
+		typ := literalType(value)
+		if id, ok := value.(*ast.Identifier); ok && p.BindingOf(id) != nil {
+			typ = p.BindingOf(id).Type
+		}
+		if typ != nil && !nullable(typ, 0) {
+			p.Report(infix, "%s has type %s, which is never null, so the comparison is always %t",
+				value, typ, infix.Operator == "!=")
+		}
+		return true
+	})
+}
+
+// checkUnusedInclude reports includes of known headers none of whose
+// functions the program uses. Functions that an extern declares again
+// count for the extern rather than the include.
+func checkUnusedInclude(p *Pass) {
+	for _, stmt := range p.Program.Statements {
+		include, ok := stmt.(*ast.IncludeStatement)
+		if !ok {
+			continue
+		}
+		functions := cinterop.GetFunctionsForHeader(include.Path)
+		if len(functions) == 0 {
+			continue
+		}
+		used := false
+		for _, fn := range functions {
+			if header, ok := p.CRegistry.Header(fn.Name); ok && header == include.Path && p.Free(fn.Name) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			p.Report(include, "include %q is not used: none of its functions are called", include.Path)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package lint reports suspicious constructs in Sango programs: code that
+// compiles but is likely a mistake, such as a binding that is never used or
+// a defer inside a loop.
+//
+// Each check is registered under a name and can be enabled or disabled on
+// its own. A // sango:ignore comment silences the diagnostics on its line,
+// or on the next line if the comment stands alone; sango:ignore followed by
+// check names, as in // sango:ignore shadow,unused, silences only theirs.
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/cinterop"
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// Diagnostic is a problem a check found
+type Diagnostic struct {
+	Check   string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s at line %d:%d (%s)", d.Message, d.Line, d.Column, d.Check)
+}
+
+// Check is a named analysis of a program
+type Check struct {
+	Name string
+	Doc  string // what the check reports, in one line
+	Run  func(*Pass)
+}
+
+// Pass is a program being checked. Checks read it and report what they
+// find.
+type Pass struct {
+	Program   *ast.Program
+	CRegistry *cinterop.FunctionRegistry // C functions of the program's includes and externs
+
+	scope       *scopeInfo
+	check       *Check
+	diagnostics []Diagnostic
+}
+
+// Report records a diagnostic at the position of node
+func (p *Pass) Report(node ast.Node, format string, args ...interface{}) {
+	tok := tokenOf(node)
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Check:   p.check.Name,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+var checks = map[string]*Check{}
+
+// Register adds a check to the registry. It panics if a check of the same
+// name is registered already.
+func Register(c *Check) {
+	if _, ok := checks[c.Name]; ok {
+		panic("lint: check " + c.Name + " registered twice")
+	}
+	checks[c.Name] = c
+}
+
+// Checks returns the registered checks sorted by name
+func Checks() []*Check {
+	list := make([]*Check, 0, len(checks))
+	for _, c := range checks {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Select returns the checks that settings, which maps check names to
+// whether they run, enables. If any check is set to true, only the checks
+// set to true run; otherwise every check runs but those set to false.
+func Select(settings map[string]bool) ([]*Check, error) {
+	only := false
+	for name, on := range settings {
+		if _, ok := checks[name]; !ok {
+			return nil, fmt.Errorf("unknown check %s", name)
+		}
+		only = only || on
+	}
+
+	selected := []*Check{}
+	for _, c := range Checks() {
+		on, set := settings[c.Name]
+		if (only && on) || (!only && (!set || on)) {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+// Run runs checks on program, which was parsed from source by a parser
+// whose C registry is registry, and returns the diagnostics in source
+// order, without those silenced by sango:ignore comments
+func Run(program *ast.Program, source string, registry *cinterop.FunctionRegistry, checks []*Check) []Diagnostic {
+	if registry == nil {
+		registry = cinterop.NewFunctionRegistry()
+	}
+	pass := &Pass{Program: program, CRegistry: registry, scope: resolve(program)}
+	for _, c := range checks {
+		pass.check = c
+		c.Run(pass)
+	}
+
+	ignored := ignores(source)
+	diagnostics := []Diagnostic{}
+	for _, d := range pass.diagnostics {
+		if names, ok := ignored[d.Line]; ok && (len(names) == 0 || names[d.Check]) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// ignores finds the sango:ignore comments of source and returns, by line,
+// the checks they silence there. An empty set silences every check.
+func ignores(source string) map[int]map[string]bool {
+	ignored := map[int]map[string]bool{}
+	lines := []int{0} // offsets at which lines start
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	lineOf := func(offset int) int { return sort.SearchInts(lines, offset+1) }
+
+	// Comments are the only text between tokens other than whitespace
+	end := 0
+	for _, tok := range lexer.Tokens(source) {
+		gap := source[end:tok.Offset]
+		for i := 0; i < len(gap); i++ {
+			switch {
+			case strings.HasPrefix(gap[i:], "/*"):
+				if n := strings.Index(gap[i+2:], "*/"); n >= 0 {
+					i += n + 3
+				} else {
+					i = len(gap)
+				}
+			case strings.HasPrefix(gap[i:], "//"):
+				n := strings.IndexByte(gap[i:], '\n')
+				if n < 0 {
+					n = len(gap) - i
+				}
+				text := strings.TrimSpace(gap[i+2 : i+n])
+				if rest := strings.TrimPrefix(text, "sango:ignore"); rest != text && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+					line := lineOf(end + i)
+					if strings.TrimSpace(source[lines[line-1]:end+i]) == "" {
+						line++ // the comment stands alone
+					}
+					ignored[line] = ignoredChecks(rest)
+				}
+				i += n
+			}
+		}
+		if tok.End > end {
+			end = tok.End
+		}
+	}
+	return ignored
+}
+
+// ignoredChecks returns the checks named in the text after sango:ignore,
+// which is a comma-separated list of names followed by an optional reason.
+// It returns an empty set if the text does not start with check names.
+func ignoredChecks(text string) map[string]bool {
+	names := map[string]bool{}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return names
+	}
+	for _, name := range strings.Split(fields[0], ",") {
+		if _, ok := checks[name]; !ok {
+			return map[string]bool{}
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// tokenOf returns the token a node is reported at: its Token field, or that
+// of its first child if it has none
+func tokenOf(node ast.Node) lexer.Token {
+	v := reflect.Indirect(reflect.ValueOf(node))
+	if f := v.FieldByName("Token"); f.IsValid() {
+		if tok, ok := f.Interface().(lexer.Token); ok {
+			return tok
+		}
+	}
+	if children := ast.Children(node); len(children) > 0 {
+		return tokenOf(children[0])
+	}
+	return lexer.Token{}
+}
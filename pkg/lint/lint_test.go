@@ -0,0 +1,225 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+// vet runs the named checks on input and returns the diagnostics as
+// "line check" strings
+func vet(t *testing.T, input string, names ...string) []string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+
+	settings := map[string]bool{}
+	for _, name := range names {
+		settings[name] = true
+	}
+	selected, err := Select(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, d := range Run(program, input, p.CRegistry(), selected) {
+		got = append(got, fmt.Sprintf("%d %s", d.Line, d.Check))
+	}
+	return got
+}
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		check string
+		input string
+		want  []string
+	}{
+		{"unused", `
+val top = 1
+def f(a: int) = {
+  val x = 1
+  var y = 2
+  val _skip = 3
+  val used = a
+  used
+}`, []string{"4 unused", "5 unused"}},
+		{"varneverassigned", `
+def f(p: Point) = {
+  var a = 1
+  var b = 2
+  b = 3
+  var c = p
+  c.move(1)
+  a + b + c.x
+}`, []string{"3 varneverassigned"}},
+		{"shadow", `
+val limit = 10
+def f(limit: int, n: int) = {
+  val n = 1
+  for i in 0..n {
+    val i = 2
+    val limit = i
+  }
+  match n {
+    n => n
+    m => m
+  }
+}`, []string{"4 shadow", "6 shadow", "7 shadow"}},
+		{"unreachable", `
+def f(x: int): int = {
+  if (x > 0) {
+    return 1
+    print(x)
+  } else {
+    return 2
+  }
+  print(x)
+  return 3
+}
+def g(x: int): int = {
+  if (x > 0) {
+    return 1
+  }
+  return 2
+}`, []string{"5 unreachable", "9 unreachable"}},
+		{"deferinloop", `
+def f(items: []int) = {
+  defer done()
+  for x <- items {
+    defer close(x)
+    val g = def(y: int) = {
+      defer close(y)
+    }
+  }
+  while (running) {
+    if (ready) {
+      defer stop()
+    }
+  }
+}`, []string{"5 deferinloop", "12 deferinloop"}},
+		{"assertsideeffect", `
+const def square(x: int): int = x * x
+def f(x: int) = {
+  assert(x > 0)
+  assert(square(x) > 0)
+  assert(pop() > 0)
+  assert(v.len() > 0)
+}`, []string{"6 assertsideeffect", "7 assertsideeffect"}},
+		{"nullcompare", `
+struct Point { x: int }
+type Id u32
+type Handle *Point
+def f(p: *Point, q: Point, h: Handle, id: Id, s: string, c: CType) = {
+  val n = 1
+  p == null
+  q == null
+  null != n
+  h == null
+  id == null
+  s == null
+  c == null
+}`, []string{"8 nullcompare", "9 nullcompare", "11 nullcompare"}},
+		{"unusedinclude", `
+include "math.h"
+include "stdio.h"
+include "string.h"
+include "mylib.h"
+extern "C" {
+  def strlen(s: *char): u64
+}
+def f(x: double) = {
+  printf("%f", x)
+  strlen("a")
+}`, []string{"2 unusedinclude", "4 unusedinclude"}},
+	}
+
+	for _, tt := range tests {
+		got := vet(t, tt.input, tt.check)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s - expected %v, got %v", tt.check, tt.want, got)
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	input := `def f() = {
+  val a = 1 // sango:ignore
+  // sango:ignore unused, kept for later
+  val b = 2
+  val c = 3 // sango:ignore shadow
+  // sango:ignore shadow,unused
+  val d = 4
+  /* sango:ignore */ val e = 5
+  val s = "// sango:ignore"
+  val f = 6 // sango:ignored
+}`
+	got := vet(t, input, "unused")
+	want := []string{"5 unused", "8 unused", "9 unused", "10 unused"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	names := func(checks []*Check) []string {
+		list := []string{}
+		for _, c := range checks {
+			list = append(list, c.Name)
+		}
+		return list
+	}
+
+	all, _ := Select(nil)
+	if len(all) != len(Checks()) {
+		t.Errorf("Select(nil) - expected every check, got %v", names(all))
+	}
+
+	only, _ := Select(map[string]bool{"shadow": true, "unused": true, "unreachable": false})
+	if want := []string{"shadow", "unused"}; !reflect.DeepEqual(names(only), want) {
+		t.Errorf("expected %v, got %v", want, names(only))
+	}
+
+	but, _ := Select(map[string]bool{"shadow": false})
+	if len(but) != len(Checks())-1 {
+		t.Errorf("expected every check but shadow, got %v", names(but))
+	}
+	for _, c := range but {
+		if c.Name == "shadow" {
+			t.Errorf("shadow is disabled but selected")
+		}
+	}
+
+	if _, err := Select(map[string]bool{"nope": true}); err == nil || err.Error() != "unknown check nope" {
+		t.Errorf("expected an unknown check error, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	c := &Check{Name: "testcheck", Doc: "bindings named boom", Run: func(p *Pass) {
+		for _, b := range p.Bindings() {
+			if b.Name.Value == "boom" {
+				p.Report(b.Name, "boom")
+			}
+		}
+	}}
+	Register(c)
+	defer delete(checks, c.Name)
+
+	if got := vet(t, "val boom = 1", "testcheck"); !reflect.DeepEqual(got, []string{"1 testcheck"}) {
+		t.Errorf("expected the registered check to run, got %v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a check twice to panic")
+		}
+	}()
+	Register(c)
+}
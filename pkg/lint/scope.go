@@ -0,0 +1,287 @@
+package lint
+
+import (
+	"reflect"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// BindingKind is the construct that binds a name
+type BindingKind int
+
+const (
+	Val     BindingKind = iota // val x = ...
+	Var                        // var x = ...
+	Param                      // a function or method parameter
+	Loop                       // the variable of a for loop
+	Pattern                    // a match case that binds the value
+)
+
+var bindingKinds = map[BindingKind]string{
+	Val: "val", Var: "var", Param: "parameter", Loop: "loop variable", Pattern: "match binding",
+}
+
+func (k BindingKind) String() string { return bindingKinds[k] }
+
+// Binding is a name bound in the program and the places it is used
+type Binding struct {
+	Name    *ast.Identifier
+	Kind    BindingKind
+	Type    *ast.TypeExpression // declared or inferred from a literal, nil if unknown
+	Global  bool                // bound at the top level
+	Uses    []*ast.Identifier
+	Assigns []*ast.AssignmentStatement
+	Shadows *Binding // the binding of the same name it hides, if any
+
+	// Borrowed is true if a method is called on the binding, which may
+	// change its value without assigning to it
+	Borrowed bool
+}
+
+// Bindings returns the bindings of the program in source order
+func (p *Pass) Bindings() []*Binding {
+	return p.scope.bindings
+}
+
+// BindingOf returns the binding an identifier refers to, or nil if it
+// refers to no val, var, parameter, loop variable or match binding, as the
+// names of functions and types do not
+func (p *Pass) BindingOf(id *ast.Identifier) *Binding {
+	return p.scope.uses[id]
+}
+
+// Free reports whether name is used somewhere without being bound, as the
+// names of functions are
+func (p *Pass) Free(name string) bool {
+	return p.scope.free[name]
+}
+
+type scopeInfo struct {
+	bindings []*Binding
+	uses     map[*ast.Identifier]*Binding
+	free     map[string]bool
+}
+
+// resolver binds the identifiers of a program to their bindings
+type resolver struct {
+	*scopeInfo
+	scopes []map[string]*Binding // innermost last
+}
+
+func resolve(program *ast.Program) *scopeInfo {
+	r := &resolver{scopeInfo: &scopeInfo{
+		uses: map[*ast.Identifier]*Binding{},
+		free: map[string]bool{},
+	}}
+	r.push()
+
+	// Top-level bindings may be used in functions declared before them
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.ValStatement:
+			r.bind(s.Names, Val, s.Type, s.Value)
+		case *ast.VarStatement:
+			r.bind(s.Names, Var, s.Type, s.Value)
+		}
+	}
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.ValStatement:
+			r.node(s.Value)
+		case *ast.VarStatement:
+			r.node(s.Value)
+		default:
+			r.node(stmt)
+		}
+	}
+	return r.scopeInfo
+}
+
+func (r *resolver) push() { r.scopes = append(r.scopes, map[string]*Binding{}) }
+func (r *resolver) pop()  { r.scopes = r.scopes[:len(r.scopes)-1] }
+
+func (r *resolver) lookup(name string) *Binding {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if b, ok := r.scopes[i][name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (r *resolver) declare(name *ast.Identifier, kind BindingKind, typ *ast.TypeExpression) {
+	if name == nil || name.Value == "_" {
+		return
+	}
+	b := &Binding{Name: name, Kind: kind, Type: typ, Global: len(r.scopes) == 1, Shadows: r.lookup(name.Value)}
+	r.bindings = append(r.bindings, b)
+	r.scopes[len(r.scopes)-1][name.Value] = b
+}
+
+// bind declares the names of a val or var. A single name without a type
+// takes the type of a literal value.
+func (r *resolver) bind(names []*ast.Identifier, kind BindingKind, typ *ast.TypeExpression, value ast.Expression) {
+	if typ == nil && len(names) == 1 {
+		typ = literalType(value)
+	}
+	for i, name := range names {
+		switch {
+		case len(names) == 1:
+			r.declare(name, kind, typ)
+		case typ != nil && i < len(typ.Tuple):
+			r.declare(name, kind, &typ.Tuple[i])
+		default:
+			r.declare(name, kind, nil)
+		}
+	}
+}
+
+func (r *resolver) use(id *ast.Identifier) {
+	if b := r.lookup(id.Value); b != nil {
+		r.uses[id] = b
+		b.Uses = append(b.Uses, id)
+		return
+	}
+	r.free[id.Value] = true
+}
+
+func (r *resolver) borrow(id *ast.Identifier) {
+	if b := r.uses[id]; b != nil {
+		b.Borrowed = true
+	}
+}
+
+func (r *resolver) function(params []*ast.Parameter, body ast.Node) {
+	r.push()
+	for _, param := range params {
+		if param != nil {
+			r.declare(param.Name, Param, param.Type)
+		}
+	}
+	r.node(body)
+	r.pop()
+}
+
+// node resolves the identifiers in n. Names that are not variables, such as
+// those of fields, types and declarations, are skipped.
+func (r *resolver) node(n ast.Node) {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return
+	}
+
+	switch n := n.(type) {
+	case *ast.Identifier:
+		r.use(n)
+	case *ast.ValStatement:
+		r.node(n.Value)
+		r.bind(n.Names, Val, n.Type, n.Value)
+	case *ast.VarStatement:
+		r.node(n.Value)
+		r.bind(n.Names, Var, n.Type, n.Value)
+	case *ast.AssignmentStatement:
+		r.node(n.Value)
+		if n.Name == nil {
+			return
+		}
+		if b := r.lookup(n.Name.Value); b != nil {
+			b.Assigns = append(b.Assigns, n)
+		} else {
+			r.free[n.Name.Value] = true
+		}
+	case *ast.FunctionStatement:
+		r.function(n.Parameters, n.Body)
+	case *ast.FunctionLiteral:
+		r.function(n.Parameters, n.Body)
+	case *ast.ImplStatement:
+		for _, m := range n.Methods {
+			r.node(m)
+		}
+	case *ast.BlockStatement:
+		r.push()
+		for _, stmt := range n.Statements {
+			r.node(stmt)
+		}
+		r.pop()
+	case *ast.ForStatement:
+		r.node(n.Iterable)
+		r.push()
+		r.declare(n.Variable, Loop, nil)
+		r.node(n.Body)
+		r.pop()
+	case *ast.MatchExpression:
+		r.node(n.Value)
+		for _, mc := range n.Cases {
+			r.push()
+			// A bare name is a binding unless it names a value already
+			if id, ok := mc.Pattern.(*ast.Identifier); ok && r.lookup(id.Value) == nil {
+				r.declare(id, Pattern, nil)
+			} else {
+				r.node(mc.Pattern)
+			}
+			r.node(mc.Guard)
+			r.node(mc.Value)
+			r.pop()
+		}
+	case *ast.CallExpression:
+		r.node(n.Function)
+		if dot, ok := n.Function.(*ast.InfixExpression); ok && dot.Operator == "." {
+			if id, ok := dot.Left.(*ast.Identifier); ok {
+				r.borrow(id)
+			}
+		}
+		for _, arg := range n.Arguments {
+			r.node(arg)
+		}
+	case *ast.InfixExpression:
+		r.node(n.Left)
+		if _, field := n.Right.(*ast.Identifier); !(n.Operator == "." && field) {
+			r.node(n.Right)
+		}
+	case *ast.StructLiteral:
+		for _, f := range n.Fields {
+			r.node(f)
+		}
+	case *ast.StructField:
+		r.node(n.Value)
+	case *ast.StructStatement:
+		for _, f := range n.Fields {
+			r.node(f)
+		}
+	case *ast.StructFieldDecl:
+		r.node(n.Default)
+	case *ast.TypeExpression, *ast.OffsetofExpression, *ast.TypeStatement, *ast.DefineStatement,
+		*ast.IncludeStatement, *ast.ExternStatement:
+	default:
+		for _, child := range ast.Children(n) {
+			r.node(child)
+		}
+	}
+}
+
+// literalType returns the type of a literal, or nil if e is not one
+func literalType(e ast.Expression) *ast.TypeExpression {
+	named := func(name string) *ast.TypeExpression { return &ast.TypeExpression{Name: name} }
+	switch n := e.(type) {
+	case *ast.IntegerLiteral:
+		if n.Type != "" {
+			return named(n.Type)
+		}
+		return named("int")
+	case *ast.FloatLiteral:
+		if n.Type != "" {
+			return named(n.Type)
+		}
+		return named("double")
+	case *ast.StringLiteral, *ast.InterpolatedString:
+		return named("string")
+	case *ast.CharLiteral:
+		return named("char")
+	case *ast.BooleanLiteral:
+		return named("bool")
+	case *ast.StructLiteral:
+		if n.Name != nil {
+			return named(n.Name.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+package macro
+
+import (
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// copier produces a deep copy of an AST subtree. While copying, every
+// expression is passed through expr (after its children have been copied)
+// and every binding identifier through binder, which lets the expander
+// substitute arguments and rename bindings in a single pass.
+//
+// Field names (the right side of '.', struct literal keys) and type names
+// are never passed to the callbacks. stmt, if set, is called on each
+// statement before it is copied, and enter and leave around each scope:
+// blocks, functions, for loops and match cases.
+type copier struct {
+	expr   func(ast.Expression) ast.Expression
+	binder func(*ast.Identifier) *ast.Identifier
+	stmt   func(ast.Statement)
+	enter  func()
+	leave  func()
+}
+
+// clone returns a deep copy of an expression without any substitution
+func clone(e ast.Expression) ast.Expression {
+	c := &copier{}
+	return c.copyExpr(e)
+}
+
+// Clone returns a deep copy of an expression
+func Clone(e ast.Expression) ast.Expression {
+	return clone(e)
+}
+
+// Rewrite replaces each statement of the program with a copy in which every
+// expression has been passed through fn, children first
+func Rewrite(program *ast.Program, fn func(ast.Expression) ast.Expression) {
+	c := &copier{expr: fn}
+	for i, stmt := range program.Statements {
+		program.Statements[i] = c.copyStmt(stmt)
+	}
+}
+
+func (c *copier) open() {
+	if c.enter != nil {
+		c.enter()
+	}
+}
+
+func (c *copier) close() {
+	if c.leave != nil {
+		c.leave()
+	}
+}
+
+func (c *copier) mapExpr(e ast.Expression) ast.Expression {
+	if c.expr == nil || e == nil {
+		return e
+	}
+	return c.expr(e)
+}
+
+func (c *copier) mapBinder(id *ast.Identifier) *ast.Identifier {
+	if id == nil {
+		return nil
+	}
+	cp := &ast.Identifier{Token: id.Token, Value: id.Value}
+	if c.binder == nil {
+		return cp
+	}
+	return c.binder(cp)
+}
+
+func (c *copier) copyIdent(id *ast.Identifier) *ast.Identifier {
+	if id == nil {
+		return nil
+	}
+	return &ast.Identifier{Token: id.Token, Value: id.Value}
+}
+
+func (c *copier) copyExprs(exprs []ast.Expression) []ast.Expression {
+	if exprs == nil {
+		return nil
+	}
+	result := make([]ast.Expression, len(exprs))
+	for i, e := range exprs {
+		result[i] = c.copyExpr(e)
+	}
+	return result
+}
+
+func (c *copier) copyExpr(e ast.Expression) ast.Expression {
+	switch n := e.(type) {
+	case nil:
+		return nil
+	case *ast.Identifier:
+		return c.mapExpr(c.copyIdent(n))
+	case *ast.IntegerLiteral:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.FloatLiteral:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.StringLiteral:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.CharLiteral:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.InterpolatedString:
+		return c.mapExpr(&ast.InterpolatedString{Token: n.Token, Parts: c.copyExprs(n.Parts)})
+	case *ast.Interpolation:
+		cp := *n
+		cp.Value = c.copyExpr(n.Value)
+		cp.Type = copyType(n.Type)
+		return c.mapExpr(&cp)
+	case *ast.BooleanLiteral:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.NullLiteral:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.WildcardExpression:
+		cp := *n
+		return c.mapExpr(&cp)
+	case *ast.TypeExpression:
+		return c.mapExpr(c.copyTypeExpr(n))
+	case *ast.SizeofExpression:
+		return c.mapExpr(&ast.SizeofExpression{
+			Token:    n.Token,
+			Operator: n.Operator,
+			Type:     c.copyTypeExpr(n.Type),
+			Value:    c.copyExpr(n.Value),
+		})
+	case *ast.OffsetofExpression:
+		cp := &ast.OffsetofExpression{Token: n.Token, Type: c.copyTypeExpr(n.Type)}
+		for _, f := range n.Field {
+			cp.Field = append(cp.Field, c.copyIdent(f))
+		}
+		return c.mapExpr(cp)
+	case *ast.PrefixExpression:
+		return c.mapExpr(&ast.PrefixExpression{
+			Token:    n.Token,
+			Operator: n.Operator,
+			Right:    c.copyExpr(n.Right),
+		})
+	case *ast.InfixExpression:
+		cp := &ast.InfixExpression{
+			Token:    n.Token,
+			Operator: n.Operator,
+			Left:     c.copyExpr(n.Left),
+		}
+		if n.Operator == "." {
+			// The right side of member access is a field name
+			if id, ok := n.Right.(*ast.Identifier); ok {
+				cp.Right = c.copyIdent(id)
+			} else {
+				cp.Right = c.copyExpr(n.Right)
+			}
+		} else {
+			cp.Right = c.copyExpr(n.Right)
+		}
+		return c.mapExpr(cp)
+	case *ast.BlockStatement:
+		return c.mapExpr(c.copyBlock(n))
+	case *ast.IfExpression:
+		return c.mapExpr(&ast.IfExpression{
+			Token:       n.Token,
+			Condition:   c.copyExpr(n.Condition),
+			Consequence: c.copyBlock(n.Consequence),
+			Alternative: c.copyBlock(n.Alternative),
+		})
+	case *ast.FunctionLiteral:
+		c.open()
+		cp := &ast.FunctionLiteral{
+			Token:      n.Token,
+			Name:       c.mapBinder(n.Name),
+			Parameters: c.copyParams(n.Parameters),
+			ReturnType: c.copyTypeExpr(n.ReturnType),
+			Body:       c.copyExpr(n.Body),
+		}
+		c.close()
+		return c.mapExpr(cp)
+	case *ast.CallExpression:
+		return c.mapExpr(&ast.CallExpression{
+			Token:     n.Token,
+			Function:  c.copyExpr(n.Function),
+			Arguments: c.copyExprs(n.Arguments),
+		})
+	case *ast.BuiltinFunctionCall:
+		return c.mapExpr(&ast.BuiltinFunctionCall{
+			Token:     n.Token,
+			Name:      n.Name,
+			Arguments: c.copyExprs(n.Arguments),
+		})
+	case *ast.ArrayLiteral:
+		return c.mapExpr(&ast.ArrayLiteral{Token: n.Token, Elements: c.copyExprs(n.Elements)})
+	case *ast.IndexExpression:
+		return c.mapExpr(&ast.IndexExpression{
+			Token: n.Token,
+			Left:  c.copyExpr(n.Left),
+			Index: c.copyExpr(n.Index),
+		})
+	case *ast.RangeExpression:
+		return c.mapExpr(&ast.RangeExpression{
+			Token:     n.Token,
+			Start:     c.copyExpr(n.Start),
+			End:       c.copyExpr(n.End),
+			Inclusive: n.Inclusive,
+		})
+	case *ast.TupleLiteral:
+		return c.mapExpr(&ast.TupleLiteral{Token: n.Token, Elements: c.copyExprs(n.Elements)})
+	case *ast.StructLiteral:
+		cp := &ast.StructLiteral{Token: n.Token, Name: c.copyIdent(n.Name)}
+		if n.Fields != nil {
+			cp.Fields = make([]*ast.StructField, len(n.Fields))
+			for i, f := range n.Fields {
+				cp.Fields[i] = &ast.StructField{Name: c.copyIdent(f.Name), Value: c.copyExpr(f.Value)}
+			}
+		}
+		return c.mapExpr(cp)
+	case *ast.MatchExpression:
+		cp := &ast.MatchExpression{Token: n.Token, Value: c.copyExpr(n.Value)}
+		if n.Cases != nil {
+			cp.Cases = make([]*ast.MatchCase, len(n.Cases))
+			for i, mc := range n.Cases {
+				c.open()
+				cp.Cases[i] = &ast.MatchCase{
+					Pattern: c.copyPattern(mc.Pattern),
+					Guard:   c.copyExpr(mc.Guard),
+					Value:   c.copyExpr(mc.Value),
+				}
+				c.close()
+			}
+		}
+		return c.mapExpr(cp)
+	default:
+		// Unknown node: share it rather than dropping it
+		return c.mapExpr(e)
+	}
+}
+
+// copyPattern copies a match pattern, treating bare identifiers as bindings
+func (c *copier) copyPattern(e ast.Expression) ast.Expression {
+	if id, ok := e.(*ast.Identifier); ok {
+		return c.mapBinder(id)
+	}
+	return c.copyExpr(e)
+}
+
+func (c *copier) copyParams(params []*ast.Parameter) []*ast.Parameter {
+	if params == nil {
+		return nil
+	}
+	result := make([]*ast.Parameter, len(params))
+	for i, param := range params {
+		result[i] = &ast.Parameter{Name: c.mapBinder(param.Name), Type: c.copyTypeExpr(param.Type)}
+	}
+	return result
+}
+
+func (c *copier) copyBinders(names []*ast.Identifier) []*ast.Identifier {
+	if names == nil {
+		return nil
+	}
+	result := make([]*ast.Identifier, len(names))
+	for i, name := range names {
+		result[i] = c.mapBinder(name)
+	}
+	return result
+}
+
+func (c *copier) copyBlock(b *ast.BlockStatement) *ast.BlockStatement {
+	if b == nil {
+		return nil
+	}
+	cp := &ast.BlockStatement{Token: b.Token, Statements: make([]ast.Statement, 0, len(b.Statements))}
+	c.open()
+	for _, s := range b.Statements {
+		if stmt := c.copyStmt(s); stmt != nil {
+			cp.Statements = append(cp.Statements, stmt)
+		}
+	}
+	c.close()
+	return cp
+}
+
+func (c *copier) copyStmt(s ast.Statement) ast.Statement {
+	if c.stmt != nil && s != nil {
+		c.stmt(s)
+	}
+	switch n := s.(type) {
+	case nil:
+		return nil
+	case *ast.ValStatement:
+		// The value is copied first, since the names are not in scope in it
+		cp := &ast.ValStatement{Token: n.Token, Type: c.copyTypeExpr(n.Type), Value: c.copyExpr(n.Value)}
+		cp.Names = c.copyBinders(n.Names)
+		return cp
+	case *ast.VarStatement:
+		cp := &ast.VarStatement{Token: n.Token, Type: c.copyTypeExpr(n.Type), Value: c.copyExpr(n.Value)}
+		cp.Names = c.copyBinders(n.Names)
+		return cp
+	case *ast.ReturnStatement:
+		return &ast.ReturnStatement{Token: n.Token, ReturnValue: c.copyExpr(n.ReturnValue)}
+	case *ast.AssignmentStatement:
+		cp := &ast.AssignmentStatement{
+			Token:    n.Token,
+			Operator: n.Operator,
+			Value:    c.copyExpr(n.Value),
+		}
+		// The assignment target refers to an existing binding
+		if target, ok := c.mapExpr(c.copyIdent(n.Name)).(*ast.Identifier); ok {
+			cp.Name = target
+		} else {
+			cp.Name = c.copyIdent(n.Name)
+		}
+		return cp
+	case *ast.ExpressionStatement:
+		return &ast.ExpressionStatement{Token: n.Token, Expression: c.copyExpr(n.Expression)}
+	case *ast.BlockStatement:
+		return c.copyBlock(n)
+	case *ast.FunctionStatement:
+		cp := &ast.FunctionStatement{Token: n.Token, Name: c.mapBinder(n.Name), Const: n.Const, Doc: n.Doc}
+		c.open()
+		cp.Parameters = c.copyParams(n.Parameters)
+		cp.ReturnType = c.copyTypeExpr(n.ReturnType)
+		cp.Body = c.copyExpr(n.Body)
+		c.close()
+		return cp
+	case *ast.ForStatement:
+		cp := &ast.ForStatement{Token: n.Token, Iterable: c.copyExpr(n.Iterable), IsInRange: n.IsInRange}
+		c.open()
+		cp.Variable = c.mapBinder(n.Variable)
+		cp.Body = c.copyBlock(n.Body)
+		c.close()
+		return cp
+	case *ast.WhileStatement:
+		return &ast.WhileStatement{
+			Token:     n.Token,
+			Condition: c.copyExpr(n.Condition),
+			Body:      c.copyBlock(n.Body),
+		}
+	case *ast.DeferStatement:
+		return &ast.DeferStatement{Token: n.Token, Expression: c.copyExpr(n.Expression)}
+	case *ast.AssertStatement:
+		return &ast.AssertStatement{Token: n.Token, Expression: c.copyExpr(n.Expression)}
+	case *ast.TestStatement:
+		return &ast.TestStatement{Token: n.Token, Name: n.Name, Body: c.copyBlock(n.Body)}
+	case *ast.BenchStatement:
+		return &ast.BenchStatement{Token: n.Token, Name: n.Name, Body: c.copyBlock(n.Body)}
+	case *ast.StructStatement:
+		cp := &ast.StructStatement{Token: n.Token, Name: n.Name, Doc: n.Doc}
+		for _, attr := range n.Attributes {
+			cp.Attributes = append(cp.Attributes, &ast.Attribute{
+				Token:     attr.Token,
+				Name:      attr.Name,
+				Arguments: c.copyExprs(attr.Arguments),
+			})
+		}
+		cp.Fields = make([]*ast.StructFieldDecl, len(n.Fields))
+		for i, f := range n.Fields {
+			cp.Fields[i] = &ast.StructFieldDecl{
+				Token:   f.Token,
+				Name:    c.copyIdent(f.Name),
+				Type:    c.copyTypeExpr(f.Type),
+				Default: c.copyExpr(f.Default),
+			}
+		}
+		return cp
+	case *ast.ImplStatement:
+		cp := &ast.ImplStatement{Token: n.Token, Type: n.Type, ReceiverInfo: n.ReceiverInfo, Doc: n.Doc}
+		if n.Methods != nil {
+			cp.Methods = make([]*ast.FunctionStatement, len(n.Methods))
+			for i, method := range n.Methods {
+				cp.Methods[i] = c.copyStmt(method).(*ast.FunctionStatement)
+			}
+		}
+		return cp
+	default:
+		// Declarations (struct, type, impl, include, define...) are shared
+		return s
+	}
+}
+
+// copyTypeExpr copies a type expression, expanding macros used in array
+// lengths such as [SIZE]u8
+func (c *copier) copyTypeExpr(te *ast.TypeExpression) *ast.TypeExpression {
+	if te == nil {
+		return nil
+	}
+	cp := copyType(te)
+	for t := cp; t != nil; t = t.ElementType {
+		if t.Length != nil {
+			t.Length = c.copyExpr(t.Length)
+		}
+	}
+	return cp
+}
+
+// copyType returns a deep copy of a type expression
+func copyType(te *ast.TypeExpression) *ast.TypeExpression {
+	if te == nil {
+		return nil
+	}
+	cp := *te
+	cp.Length = clone(te.Length)
+	cp.ElementType = copyType(te.ElementType)
+	if te.Tuple != nil {
+		cp.Tuple = make([]ast.TypeExpression, len(te.Tuple))
+		for i := range te.Tuple {
+			cp.Tuple[i] = *copyType(&te.Tuple[i])
+		}
+	}
+	if te.Function != nil {
+		fn := &ast.FunctionType{ReturnType: copyType(te.Function.ReturnType)}
+		for i := range te.Function.Parameters {
+			fn.Parameters = append(fn.Parameters, *copyType(&te.Function.Parameters[i]))
+		}
+		cp.Function = fn
+	}
+	if te.Record != nil {
+		rec := &ast.RecordType{Fields: make([]*ast.StructFieldDecl, len(te.Record.Fields))}
+		for i, f := range te.Record.Fields {
+			rec.Fields[i] = &ast.StructFieldDecl{
+				Token:   f.Token,
+				Name:    &ast.Identifier{Token: f.Name.Token, Value: f.Name.Value},
+				Type:    copyType(f.Type),
+				Default: clone(f.Default),
+			}
+		}
+		cp.Record = rec
+	}
+	return &cp
+}
@@ -0,0 +1,288 @@
+// Package macro expands define macros at the AST level.
+//
+// Constants (define N = expr) replace every later use of N with a copy of
+// expr. Function-like macros (define max(a, b) = expr) replace calls with a
+// copy of the body in which the parameters are substituted by the call
+// arguments. Expansion is hygienic: bindings introduced inside a macro body
+// are renamed so they can neither capture nor shadow identifiers at the call
+// site, and the other identifiers of the body refer to what they named where
+// the macro was defined; a local binding that would hide one from a later
+// use is renamed instead. A define in a block is in scope until the block
+// ends. Raw C macros (define @c NAME ...) are left for the C compiler.
+package macro
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// Expander holds the macros defined so far in a compilation unit
+type Expander struct {
+	macros map[string]*definition
+	errors []string
+	stack  []string // macros currently being expanded, for recursion checks
+	gensym int
+
+	scopes [][]binding // the local scopes open at this point, innermost last
+	order  int         // bindings and defines seen so far
+}
+
+// definition is a macro in scope
+type definition struct {
+	def   *ast.DefineStatement
+	depth int             // local scopes open where it was defined
+	order int             // bindings seen before it
+	free  map[string]bool // identifiers its body does not bind
+}
+
+// binding is a local variable, parameter or function, under the name it is
+// given in the expansion
+type binding struct {
+	name, fresh string
+	order       int
+}
+
+// New creates an expander with no macros defined
+func New() *Expander {
+	return &Expander{
+		macros: make(map[string]*definition),
+		errors: []string{},
+	}
+}
+
+// Expand expands every macro use in the program in place and returns the
+// expansion errors
+func Expand(program *ast.Program) []string {
+	x := New()
+	x.ExpandProgram(program)
+	return x.Errors()
+}
+
+// Errors returns the errors reported so far
+func (x *Expander) Errors() []string {
+	return x.errors
+}
+
+// Lookup returns the definition of a macro
+func (x *Expander) Lookup(name string) (*ast.DefineStatement, bool) {
+	if m, ok := x.macros[name]; ok {
+		return m.def, true
+	}
+	return nil, false
+}
+
+// Define registers a macro. Redefining an existing macro is an error.
+func (x *Expander) Define(def *ast.DefineStatement) {
+	if def == nil || def.Name == nil {
+		return
+	}
+	if prev, ok := x.macros[def.Name.Value]; ok {
+		x.addError(fmt.Sprintf("macro %s redefined at line %d:%d (previously defined at line %d:%d)",
+			def.Name.Value, def.Token.Line, def.Token.Column, prev.def.Token.Line, prev.def.Token.Column))
+		return
+	}
+	x.order++
+	x.macros[def.Name.Value] = &definition{def: def, depth: len(x.scopes), order: x.order, free: freeNames(def)}
+}
+
+// freeNames returns the identifiers a macro body uses but does not bind
+func freeNames(def *ast.DefineStatement) map[string]bool {
+	used := map[string]bool{}
+	bound := map[string]bool{}
+	for _, param := range def.Parameters {
+		bound[param.Value] = true
+	}
+	c := &copier{
+		expr: func(e ast.Expression) ast.Expression {
+			if id, ok := e.(*ast.Identifier); ok {
+				used[id.Value] = true
+			}
+			return e
+		},
+		binder: func(id *ast.Identifier) *ast.Identifier {
+			bound[id.Value] = true
+			return id
+		},
+	}
+	c.copyExpr(def.Value)
+	for name := range bound {
+		delete(used, name)
+	}
+	return used
+}
+
+// ExpandProgram walks the program in order, registering each define and
+// expanding uses in the statements that follow it
+func (x *Expander) ExpandProgram(program *ast.Program) {
+	for i, stmt := range program.Statements {
+		program.Statements[i] = x.ExpandStatement(stmt)
+	}
+}
+
+// ExpandStatement returns the statement with all macro uses expanded.
+// Defines nested in blocks are registered as they are reached.
+func (x *Expander) ExpandStatement(stmt ast.Statement) ast.Statement {
+	return x.copier().copyStmt(stmt)
+}
+
+func (x *Expander) copier() *copier {
+	return &copier{expr: x.expand, binder: x.bind, stmt: x.visitStatement, enter: x.enter, leave: x.leave}
+}
+
+func (x *Expander) enter() {
+	x.scopes = append(x.scopes, nil)
+}
+
+// leave closes the innermost scope and the defines made in it
+func (x *Expander) leave() {
+	x.scopes = x.scopes[:len(x.scopes)-1]
+	for name, m := range x.macros {
+		if m.depth > len(x.scopes) {
+			delete(x.macros, name)
+		}
+	}
+}
+
+// bind declares a local binding. It is renamed if a macro in scope uses the
+// name for something it would hide.
+func (x *Expander) bind(id *ast.Identifier) *ast.Identifier {
+	n := len(x.scopes)
+	if n == 0 {
+		return id
+	}
+	x.order++
+	b := binding{name: id.Value, fresh: id.Value, order: x.order}
+	for _, m := range x.macros {
+		if m.free[id.Value] {
+			x.gensym++
+			b.fresh = fmt.Sprintf("%s__%d", id.Value, x.gensym)
+			break
+		}
+	}
+	x.scopes[n-1] = append(x.scopes[n-1], b)
+	id.Value = b.fresh
+	return id
+}
+
+// resolve returns an identifier under the name given to the innermost
+// binding of it that was seen before order
+func (x *Expander) resolve(id *ast.Identifier, order int) *ast.Identifier {
+	for i := len(x.scopes) - 1; i >= 0; i-- {
+		scope := x.scopes[i]
+		for j := len(scope) - 1; j >= 0; j-- {
+			if b := scope[j]; b.name == id.Value && b.order < order {
+				if b.fresh == id.Value {
+					return id
+				}
+				return &ast.Identifier{Token: id.Token, Value: b.fresh}
+			}
+		}
+	}
+	return id
+}
+
+func (x *Expander) visitStatement(stmt ast.Statement) {
+	if def, ok := stmt.(*ast.DefineStatement); ok {
+		x.Define(def)
+	}
+}
+
+// ExpandExpression returns the expression with all macro uses expanded
+func (x *Expander) ExpandExpression(e ast.Expression) ast.Expression {
+	return x.copier().copyExpr(e)
+}
+
+func (x *Expander) addError(msg string) {
+	x.errors = append(x.errors, msg)
+}
+
+// expand is the copier callback: it sees every expression after its
+// children have been expanded
+func (x *Expander) expand(e ast.Expression) ast.Expression {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		m, ok := x.macros[n.Value]
+		if !ok || m.def.IsC || m.def.Value == nil || m.def.IsFunctionLike() {
+			return x.resolve(n, x.order+1)
+		}
+		return x.instantiate(m, n.Token.Line, n.Token.Column, nil)
+	case *ast.CallExpression:
+		callee, ok := n.Function.(*ast.Identifier)
+		if !ok {
+			return n
+		}
+		m, ok := x.macros[callee.Value]
+		if !ok || m.def.IsC || !m.def.IsFunctionLike() {
+			return n
+		}
+		def := m.def
+		if len(n.Arguments) != len(def.Parameters) {
+			x.addError(fmt.Sprintf("macro %s expects %d arguments, got %d at line %d:%d",
+				def.Name.Value, len(def.Parameters), len(n.Arguments), callee.Token.Line, callee.Token.Column))
+			return n
+		}
+		return x.instantiate(m, callee.Token.Line, callee.Token.Column, n.Arguments)
+	}
+	return e
+}
+
+// instantiate produces a hygienic copy of a macro body with the parameters
+// bound to args
+func (x *Expander) instantiate(m *definition, line, column int, args []ast.Expression) ast.Expression {
+	def := m.def
+	name := def.Name.Value
+	for i, active := range x.stack {
+		if active == name {
+			cycle := append(append([]string{}, x.stack[i:]...), name)
+			x.addError(fmt.Sprintf("recursive expansion of macro %s (%s) at line %d:%d",
+				name, strings.Join(cycle, " -> "), line, column))
+			return &ast.Identifier{Value: name}
+		}
+	}
+
+	x.stack = append(x.stack, name)
+	defer func() { x.stack = x.stack[:len(x.stack)-1] }()
+
+	// Collect the names bound inside the body and pick fresh names for them
+	renames := map[string]string{}
+	collect := &copier{binder: func(id *ast.Identifier) *ast.Identifier {
+		if _, ok := renames[id.Value]; !ok {
+			x.gensym++
+			renames[id.Value] = fmt.Sprintf("%s__%s%d", id.Value, name, x.gensym)
+		}
+		return id
+	}}
+	collect.copyExpr(def.Value)
+
+	params := map[string]ast.Expression{}
+	for i, param := range def.Parameters {
+		params[param.Value] = args[i]
+	}
+
+	c := &copier{
+		expr: func(e ast.Expression) ast.Expression {
+			if id, ok := e.(*ast.Identifier); ok {
+				if fresh, ok := renames[id.Value]; ok {
+					return &ast.Identifier{Token: id.Token, Value: fresh}
+				}
+				if arg, ok := params[id.Value]; ok {
+					return clone(arg)
+				}
+				// Other names are looked up where the macro was defined
+				if _, ok := x.macros[id.Value]; !ok {
+					return x.resolve(id, m.order)
+				}
+			}
+			return x.expand(e)
+		},
+		binder: func(id *ast.Identifier) *ast.Identifier {
+			if fresh, ok := renames[id.Value]; ok {
+				id.Value = fresh
+			}
+			return id
+		},
+	}
+	return c.copyExpr(def.Value)
+}
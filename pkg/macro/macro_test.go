@@ -0,0 +1,194 @@
+package macro
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+func TestExpandConstants(t *testing.T) {
+	program := parse(t, `define KB = 1 << 10
+define SIZE: u32 = KB * 4
+val x = SIZE + 1;`)
+
+	if errs := Expand(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	def := program.Statements[1].(*ast.DefineStatement)
+	if def.Type == nil || def.Type.String() != "u32" {
+		t.Errorf("constant type not u32. got=%v", def.Type)
+	}
+
+	val := program.Statements[2].(*ast.ValStatement)
+	expected := "(((1 << 10) * 4) + 1)"
+	if val.Value.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, val.Value.String())
+	}
+}
+
+func TestExpandFunctionLikeMacro(t *testing.T) {
+	program := parse(t, `define mix(a, b) = a * b + a
+val m = mix(x + 1, y);`)
+
+	if errs := Expand(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	val := program.Statements[1].(*ast.ValStatement)
+	expected := "(((x + 1) * y) + (x + 1))"
+	if val.Value.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, val.Value.String())
+	}
+}
+
+func TestExpandIsHygienic(t *testing.T) {
+	program := parse(t, `define twice(e) = { val t = e; t + t }
+val t = 1;
+val r = twice(t);`)
+
+	if errs := Expand(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	val := program.Statements[2].(*ast.ValStatement)
+	block, ok := val.Value.(*ast.BlockStatement)
+	if !ok {
+		t.Fatalf("expansion not *ast.BlockStatement. got=%T", val.Value)
+	}
+
+	inner := block.Statements[0].(*ast.ValStatement)
+	local := inner.Names[0].Value
+	if local == "t" {
+		t.Fatalf("binding inside macro body was not renamed")
+	}
+	if inner.Value.String() != "t" {
+		t.Errorf("argument should refer to the caller's t. got=%s", inner.Value)
+	}
+	if got := block.Statements[1].String(); got != "("+local+" + "+local+")" {
+		t.Errorf("body should use the renamed binding. got=%s", got)
+	}
+}
+
+func TestExpandResolvesAtDefinition(t *testing.T) {
+	program := parse(t, `val k = 10
+define addk(x) = x + k
+def f(k: i32): i32 = addk(k)
+def g(): i32 = {
+  val k = 1
+  define addl(x) = x + k
+  val r = addk(k) + addl(k)
+  k = r
+  r
+}`)
+
+	if errs := Expand(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// A parameter would hide the k of the macro, so it is renamed
+	f := program.Statements[2].(*ast.FunctionStatement)
+	param := f.Parameters[0].Name.Value
+	if param == "k" {
+		t.Fatalf("parameter hiding a name the macro uses was not renamed")
+	}
+	if got := f.Body.String(); got != "("+param+" + k)" {
+		t.Errorf("expected the argument to be the parameter and k the global, got %s", got)
+	}
+
+	// A macro defined inside the block sees the local k
+	body := program.Statements[3].(*ast.FunctionStatement).Body.(*ast.BlockStatement)
+	local := body.Statements[0].(*ast.ValStatement).Names[0].Value
+	expected := map[int]string{
+		0: "val " + local + " = 1",
+		2: "val r = ((" + local + " + k) + (" + local + " + " + local + "))",
+		3: local + " = r",
+	}
+	for i, want := range expected {
+		if got := body.Statements[i].String(); !strings.HasPrefix(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestDefineInBlockIsScoped(t *testing.T) {
+	program := parse(t, `def f(): i32 = {
+  define N = 1
+  N
+}
+def g(): i32 = {
+  define N = 2
+  N
+}
+val n = N;`)
+
+	if errs := Expand(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for i, want := range []string{"1", "2"} {
+		body := program.Statements[i].(*ast.FunctionStatement).Body.(*ast.BlockStatement)
+		if got := body.Statements[len(body.Statements)-1].String(); got != want {
+			t.Errorf("expected N to expand to %s in its block, got %s", want, got)
+		}
+	}
+	if got := program.Statements[2].(*ast.ValStatement).Value.String(); got != "N" {
+		t.Errorf("expected N to be out of scope after its block, got %s", got)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"define A = 1\ndefine A = 2", "macro A redefined"},
+		{"define A = B\ndefine B = A\nval x = A;", "recursive expansion of macro A (A -> B -> A)"},
+		{"define sq(x) = x * x\nval y = sq(1, 2);", "macro sq expects 1 arguments, got 2"},
+		{"define @c DEBUG 1\ndefine DEBUG = 0", "macro DEBUG redefined"},
+	}
+
+	for _, tt := range tests {
+		errs := Expand(parse(t, tt.input))
+		if len(errs) == 0 {
+			t.Errorf("expected error %q for %q", tt.expected, tt.input)
+			continue
+		}
+		if !strings.Contains(errs[0], tt.expected) {
+			t.Errorf("expected error containing %q, got %q", tt.expected, errs[0])
+		}
+	}
+}
+
+func TestRawCMacro(t *testing.T) {
+	program := parse(t, `define @c LOG(msg) fprintf(stderr, "%s\n", msg)
+val x = LOG;`)
+
+	if errs := Expand(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	def := program.Statements[0].(*ast.DefineStatement)
+	if !def.IsC || def.Name.Value != "LOG" {
+		t.Fatalf("raw C macro parsed wrong. got=%s", def)
+	}
+	expected := `( msg ) fprintf ( stderr , "%s\n" , msg )`
+	if def.Raw != expected {
+		t.Errorf("raw body wrong. expected=%q, got=%q", expected, def.Raw)
+	}
+	if program.Statements[1].(*ast.ValStatement).Value.String() != "LOG" {
+		t.Errorf("raw C macros must not be expanded")
+	}
+}
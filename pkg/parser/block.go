@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// parseBlockStatement parses the statements between '{' and '}', and
+// leaves curToken on the '}'
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	depth := len(p.bracketStack)
+	p.nextToken() // consume '{'
+
+	for !p.atBlockEnd(depth) {
+		if p.curTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+			continue
+		}
+
+		block.Statements = append(block.Statements, p.parseStatement())
+
+		// Each statement ends on its last token, which is the '}' of this
+		// block only if the statement failed to parse
+		if !p.atBlockEnd(depth) {
+			p.nextToken()
+		}
+	}
+
+	p.spanned(block, block.Token)
+	return block
+}
+
+// atBlockEnd reports whether curToken is the '}' that closes the block
+// opened at the given bracket depth, or the end of input
+func (p *Parser) atBlockEnd(depth int) bool {
+	return len(p.bracketStack) < depth || p.curTokenIs(lexer.EOF)
+}
@@ -1,7 +1,12 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/rxxuzi/sango/pkg/ast"
 	"github.com/rxxuzi/sango/pkg/lexer"
@@ -9,16 +14,24 @@ import (
 
 // Expression parsing using Pratt parsing
 func (p *Parser) parseExpression(precedence Precedence) ast.Expression {
+	token := p.curToken
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		leftExp := &ast.BadExpression{Token: token}
+		p.spanned(leftExp, token)
+		return leftExp
 	}
 	leftExp := prefix()
+	if isNil(leftExp) {
+		leftExp = &ast.BadExpression{Token: token}
+	}
+	p.spanned(leftExp, token)
 
-	for !p.peekTokenIs(lexer.SEMICOLON) &&
+	for !p.peekTokenIs(lexer.SEMICOLON) && !p.peekNewline &&
 		!p.peekTokenIs(lexer.RBRACE) && !p.peekTokenIs(lexer.RBRACKET) &&
-		!p.peekTokenIs(lexer.RPAREN) && !p.peekTokenIs(lexer.LBRACE) &&
+		!p.peekTokenIs(lexer.RPAREN) &&
+		!(p.peekTokenIs(lexer.LBRACE) && !p.startsStructLiteral(leftExp)) &&
 		!p.peekTokenIs(lexer.COMMA) && !p.peekTokenIs(lexer.EOF) &&
 		precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -27,34 +40,31 @@ func (p *Parser) parseExpression(precedence Precedence) ast.Expression {
 		}
 
 		p.nextToken()
+		operator := p.curToken
 		leftExp = infix(leftExp)
+		if isNil(leftExp) {
+			leftExp = &ast.BadExpression{Token: operator}
+		}
+		p.spanned(leftExp, token)
 	}
 
 	return leftExp
 }
 
-// parseArgumentExpression parses expressions in function call arguments
-func (p *Parser) parseArgumentExpression() ast.Expression {
-	prefix := p.prefixParseFns[p.curToken.Type]
-	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
-	}
-	leftExp := prefix()
-
-	// In argument context, stop at ) or ,
-	for !p.peekTokenIs(lexer.RPAREN) && !p.peekTokenIs(lexer.COMMA) && 
-		!p.peekTokenIs(lexer.EOF) && LOWEST < p.peekPrecedence() {
-		infix := p.infixParseFns[p.peekToken.Type]
-		if infix == nil {
-			return leftExp
-		}
-
-		p.nextToken()
-		leftExp = infix(leftExp)
-	}
+// startsStructLiteral reports whether a '{' after left opens a struct
+// literal such as Point { x: 1 }
+func (p *Parser) startsStructLiteral(left ast.Expression) bool {
+	_, ok := left.(*ast.Identifier)
+	return ok && !p.noStructLiteral
+}
 
-	return leftExp
+// parseHeaderExpression parses an expression that is followed by a block,
+// such as a for iterable or a match subject, where Name { opens the block
+func (p *Parser) parseHeaderExpression() ast.Expression {
+	saved := p.noStructLiteral
+	p.noStructLiteral = true
+	defer func() { p.noStructLiteral = saved }()
+	return p.parseExpression(LOWEST)
 }
 
 // Prefix expression parsers
@@ -69,31 +79,71 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseIntegerLiteral parses an integer literal and checks it against the
+// range of its suffix type. Untyped literals may take any u64 value.
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
+	negated := p.negated
+	p.negated = false
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	digits, suffix := lexer.SplitNumber(p.curToken.Literal)
+	value, err := lexer.ParseInteger(digits)
 	if err != nil {
-		msg := "could not parse " + p.curToken.Literal + " as integer"
-		p.errors = append(p.errors, msg)
+		p.addError(fmt.Sprintf("could not parse %s as integer: %v at line %d:%d",
+			p.curToken.Literal, err, p.curToken.Line, p.curToken.Column))
 		return nil
 	}
 
-	lit.Value = value
+	typ := suffix
+	if typ == "" {
+		typ = "u64"
+	}
+	bits, _ := strconv.Atoi(typ[1:])
+	max := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if typ[0] == 'i' {
+		max.Rsh(max, 1)
+		if !negated {
+			max.Sub(max, big.NewInt(1))
+		}
+	} else {
+		max.Sub(max, big.NewInt(1))
+	}
+	if value.Cmp(max) > 0 {
+		p.reportError(fmt.Sprintf("integer literal %s overflows %s at line %d:%d",
+			p.curToken.Literal, typ, p.curToken.Line, p.curToken.Column))
+		return nil
+	}
+
+	lit.Value = int64(value.Uint64())
+	lit.Type = suffix
 	return lit
 }
 
 func (p *Parser) parseFloatLiteral() ast.Expression {
 	lit := &ast.FloatLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	digits, suffix := lexer.SplitNumber(p.curToken.Literal)
+	value, err := strconv.ParseFloat(digits, 64)
+	if err == nil && suffix == "f32" && math.Abs(value) > math.MaxFloat32 {
+		err = strconv.ErrRange
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		typ := suffix
+		if typ == "" {
+			typ = "f64"
+		}
+		p.reportError(fmt.Sprintf("float literal %s overflows %s at line %d:%d",
+			p.curToken.Literal, typ, p.curToken.Line, p.curToken.Column))
+		return nil
+	}
 	if err != nil {
-		msg := "could not parse " + p.curToken.Literal + " as float"
-		p.errors = append(p.errors, msg)
+		p.addError(fmt.Sprintf("could not parse %s as float at line %d:%d",
+			p.curToken.Literal, p.curToken.Line, p.curToken.Column))
 		return nil
 	}
 
 	lit.Value = value
+	lit.Type = suffix
 	return lit
 }
 
@@ -101,6 +151,63 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString parses the tokens the lexer splits an
+// interpolated string into, starting at INTERP_START
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken, Parts: []ast.Expression{}}
+	p.addStringPart(str)
+
+	for {
+		part := &ast.Interpolation{Token: p.curToken}
+		if p.peekTokenIs(lexer.INTERP_MID) || p.peekTokenIs(lexer.INTERP_END) || p.peekTokenIs(lexer.FORMAT_SPEC) {
+			p.addError(fmt.Sprintf("empty string interpolation at line %d:%d",
+				p.peekToken.Line, p.peekToken.Column))
+			return nil
+		}
+		p.nextToken()
+		part.Value = p.parseExpression(LOWEST)
+		if part.Value == nil {
+			return nil
+		}
+		if p.peekTokenIs(lexer.FORMAT_SPEC) {
+			p.nextToken()
+			part.Format = p.curToken.Literal
+		}
+		str.Parts = append(str.Parts, part)
+
+		if p.peekTokenIs(lexer.INTERP_MID) {
+			p.nextToken()
+			p.addStringPart(str)
+			continue
+		}
+		if !p.expectPeek(lexer.INTERP_END) {
+			return nil
+		}
+		p.addStringPart(str)
+		return str
+	}
+}
+
+// addStringPart adds the text of the current string token, if any
+func (p *Parser) addStringPart(str *ast.InterpolatedString) {
+	if p.curToken.Literal != "" {
+		str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+	}
+}
+
+// parseCharLiteral takes the value of a character literal, which the lexer
+// has already decoded and checked
+func (p *Parser) parseCharLiteral() ast.Expression {
+	lit := &ast.CharLiteral{Token: p.curToken}
+	r, width := utf8.DecodeRuneInString(p.curToken.Literal)
+	if r == utf8.RuneError && width == 1 {
+		// A \xNN escape above 0x7f is a single byte
+		r = rune(p.curToken.Literal[0])
+	}
+	lit.Value = r
+	return lit
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curTokenIs(lexer.TRUE)}
 }
@@ -119,14 +226,19 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 		Operator: p.curToken.Literal,
 	}
 
-	p.nextToken()
+	if !p.nextOperand() {
+		return nil
+	}
+	p.negated = expression.Operator == "-" && p.curTokenIs(lexer.INT)
 	expression.Right = p.parseExpression(PREFIX)
 
 	return expression
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
-	p.nextToken()
+	if !p.nextOperand() {
+		return nil
+	}
 
 	// Check if this is a tuple literal
 	if p.curTokenIs(lexer.RPAREN) {
@@ -158,7 +270,9 @@ func (p *Parser) parseTupleLiteral(firstElement ast.Expression) ast.Expression {
 			// Trailing comma
 			break
 		}
-		p.nextToken()
+		if !p.nextOperand() {
+			return nil
+		}
 		tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
 	}
 
@@ -188,7 +302,8 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 		return array
 	}
 
-	array.Elements = p.parseExpressionList(lexer.RBRACKET)
+	// An unfinished array keeps the elements parsed before the error
+	array.Elements, _ = p.parseElements(lexer.RBRACKET)
 	return array
 }
 
@@ -214,7 +329,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
-	p.nextToken()
+	if !p.nextOperand() {
+		return nil
+	}
 
 	// Handle right-associative operators (power **)
 	if expression.Operator == "**" {
@@ -246,46 +363,23 @@ func (p *Parser) parseRangeExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: fn}
-	args := []ast.Expression{}
-
-	// Check if the next token is ')', meaning empty arguments
-	if p.peekTokenIs(lexer.RPAREN) {
-		p.nextToken() // consume ')'
-		exp.Arguments = args
-		return exp
-	}
-
-	// Parse the first argument
-	p.nextToken()
-	args = append(args, p.parseArgumentExpression())
-
-	// Parse additional arguments
-	for p.peekTokenIs(lexer.COMMA) {
-		p.nextToken() // consume comma
-		p.nextToken() // move to next argument
-		args = append(args, p.parseArgumentExpression())
-	}
-
-	// Expect the closing ')'
-	if !p.expectPeek(lexer.RPAREN) {
+	exp.Arguments = p.parseExpressionList(lexer.RPAREN)
+	if exp.Arguments == nil {
 		return nil
 	}
-
-	exp.Arguments = args
 	return exp
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	// Check if this is a slice operation by looking ahead
-	if p.peekTokenIs(lexer.DOTDOT) || p.peekTokenIs(lexer.DOTDOTEQ) {
-		// Use v2 slice parser for complex slice operations
-		return p.v2.Array.ParseSliceExpression(p, left, p.curToken)
-	}
-	
-	// Regular index expression
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+
+	// A slice may leave out its start, as in a[..n]
+	if p.curTokenIs(lexer.DOTDOT) || p.curTokenIs(lexer.DOTDOTEQ) {
+		exp.Index = p.parseRangeExpression(nil)
+	} else {
+		exp.Index = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(lexer.RBRACKET) {
 		return nil
@@ -310,20 +404,33 @@ func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
 
 // Helper function to parse expression lists
 func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
+	args, ok := p.parseElements(end)
+	if !ok {
+		return nil
+	}
+	return args
+}
+
+// parseElements parses a comma-separated list up to end. It also returns
+// the expressions parsed before a syntax error, and reports whether there
+// was none.
+func (p *Parser) parseElements(end lexer.TokenType) ([]ast.Expression, bool) {
 	args := []ast.Expression{}
 
 	// If next token is the end token, we have an empty list
 	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return args, true
 	}
 
 	// Move to the first argument
-	p.nextToken()
+	if !p.nextOperand() {
+		return args, false
+	}
 
 	// Check if we immediately hit the end token after moving
 	if p.curTokenIs(end) {
-		return args
+		return args, true
 	}
 
 	args = append(args, p.parseExpression(LOWEST))
@@ -331,16 +438,18 @@ func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 	// Parse additional arguments separated by commas
 	for p.peekTokenIs(lexer.COMMA) {
 		p.nextToken() // consume comma
-		p.nextToken() // move to next argument
+		if !p.nextOperand() {
+			return args, false
+		}
 		args = append(args, p.parseExpression(LOWEST))
 	}
 
 	// Expect the end token
 	if !p.expectPeek(end) {
-		return nil
+		return args, false
 	}
 
-	return args
+	return args, true
 }
 
 // Complex expression parsing
@@ -364,10 +473,8 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	expression.Consequence = p.parseBlockStatement()
 
-	// Handle else clause
 	if p.peekTokenIs(lexer.ELSE) {
 		p.nextToken()
-
 		if !p.expectPeek(lexer.LBRACE) {
 			return nil
 		}
@@ -382,7 +489,7 @@ func (p *Parser) parseMatchExpression() ast.Expression {
 	expr := &ast.MatchExpression{Token: p.curToken}
 
 	p.nextToken()
-	expr.Value = p.parseExpression(LOWEST)
+	expr.Value = p.parseHeaderExpression()
 
 	if !p.expectPeek(lexer.LBRACE) {
 		return nil
@@ -390,18 +497,16 @@ func (p *Parser) parseMatchExpression() ast.Expression {
 
 	expr.Cases = []*ast.MatchCase{}
 
+	depth := len(p.bracketStack)
 	p.nextToken()
-	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
+	for !p.atBlockEnd(depth) {
 		matchCase := p.parseMatchCase()
 		if matchCase != nil {
 			expr.Cases = append(expr.Cases, matchCase)
 		}
-		p.nextToken()
-	}
-
-	// Consume the closing RBRACE
-	if p.curTokenIs(lexer.RBRACE) {
-		p.nextToken()
+		if !p.atBlockEnd(depth) {
+			p.nextToken()
+		}
 	}
 
 	return expr
@@ -461,7 +566,6 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	// Function body can be a single expression or block
 	if p.curTokenIs(lexer.LBRACE) {
 		lit.Body = p.parseBlockStatement()
-		// parseBlockStatementFixed already handles RBRACE consumption
 	} else {
 		lit.Body = p.parseExpression(LOWEST)
 	}
@@ -473,55 +577,29 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 func (p *Parser) parseBraceExpression() ast.Expression {
 	token := p.curToken
 
-	// Push the opening brace onto the bracket stack
-	p.pushBracket(lexer.LBRACE)
-
 	// Look ahead to determine if this is a struct literal or block statement
 	if p.peekTokenIs(lexer.RBRACE) {
 		// Empty braces - treat as empty struct literal
 		p.nextToken()
-		p.popBracket() // pop the matching '{'
 		return &ast.StructLiteral{Token: token, Fields: []*ast.StructField{}}
 	}
 
-	// Look for struct literal patterns: { name: value } or { .name = value }
-	if p.peekTokenIs(lexer.IDENT) || p.peekTokenIs(lexer.DOT) {
-		// Save current position for backtracking
-		currentPos := p.curToken
-		peekPos := p.peekToken
-
-		p.nextToken() // move to IDENT or DOT
-		
-		if p.curTokenIs(lexer.IDENT) && p.peekTokenIs(lexer.COLON) {
-			// This is a struct literal: { name: value }
-			result := p.parseStructLiteralFromBrace(token)
-			p.popBracket() // pop the matching '{'
-			return result
-		} else if p.curTokenIs(lexer.DOT) && p.peekTokenIs(lexer.IDENT) {
-			// This is a struct literal: { .name = value }
-			result := p.parseStructLiteralFromBrace(token)
-			p.popBracket() // pop the matching '{'
-			return result
-		}
-
-		// Not a struct literal, restore position and parse as block
-		p.curToken = currentPos
-		p.peekToken = peekPos
+	// Struct literals start with name: value or .name = value
+	after := p.tokenAfterPeek().Type
+	if (p.peekTokenIs(lexer.IDENT) && after == lexer.COLON) ||
+		(p.peekTokenIs(lexer.DOT) && after == lexer.IDENT) {
+		return p.parseStructLiteral(nil)
 	}
 
-	// Parse as block expression
-	result := p.parseBlockExpressionFromBrace(token)
-	p.popBracket() // pop the matching '{'
-	return result
+	return p.parseBlockStatement()
 }
 
-// parseBlockExpressionFromBrace moved to block_parser.go
-
-// parseStructLiteralFromBrace parses struct literals starting from after '{'
-func (p *Parser) parseStructLiteralFromBrace(token lexer.Token) ast.Expression {
-	lit := &ast.StructLiteral{Token: token}
+// parseStructLiteral parses the fields of a struct literal from its '{',
+// as in Point { x: 1 } or { .x = 1 }, where name is Point or nil
+func (p *Parser) parseStructLiteral(name *ast.Identifier) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.curToken, Name: name}
 
-	// We're already positioned at the first identifier
+	p.nextToken()
 	lit.Fields = p.parseStructFields()
 
 	if !p.expectPeek(lexer.RBRACE) {
@@ -614,9 +692,10 @@ func (p *Parser) parseTypeIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
-// parseSizeofExpression parses sizeof(type) expressions
+// parseSizeofExpression parses sizeof(operand) and alignof(operand), where
+// the operand is a type or an expression
 func (p *Parser) parseSizeofExpression() ast.Expression {
-	expression := &ast.PrefixExpression{
+	expression := &ast.SizeofExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 	}
@@ -626,7 +705,10 @@ func (p *Parser) parseSizeofExpression() ast.Expression {
 	}
 
 	p.nextToken()
-	expression.Right = p.parseExpression(LOWEST)
+	expression.Type, expression.Value = p.parseTypeOrExpression()
+	if expression.Type == nil && expression.Value == nil {
+		return nil
+	}
 
 	if !p.expectPeek(lexer.RPAREN) {
 		return nil
@@ -635,23 +717,46 @@ func (p *Parser) parseSizeofExpression() ast.Expression {
 	return expression
 }
 
-// parseStructConstructorExpression parses struct constructor calls like Type { field: value }
-func (p *Parser) parseStructConstructorExpression(left ast.Expression) ast.Expression {
-	// Create a struct literal with the left expression as the name
-	lit := &ast.StructLiteral{Token: p.curToken}
-	
-	// If left is an identifier, use it as the struct name
-	if ident, ok := left.(*ast.Identifier); ok {
-		lit.Name = ident
+// parseOffsetofExpression parses offsetof(Type, field) and
+// offsetof(Type, outer.inner)
+func (p *Parser) parseOffsetofExpression() ast.Expression {
+	expression := &ast.OffsetofExpression{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
 	}
 
-	// Parse the struct fields inside the braces
-	p.nextToken() // Move past '{'
-	lit.Fields = p.parseStructFields()
+	p.nextToken()
+	expression.Type = p.parseTypeExpression()
+	if expression.Type == nil {
+		return nil
+	}
 
-	if !p.expectPeek(lexer.RBRACE) {
+	if !p.expectPeek(lexer.COMMA) {
 		return nil
 	}
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	expression.Field = append(expression.Field, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 
-	return lit
+	for p.peekTokenIs(lexer.DOT) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		expression.Field = append(expression.Field, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	return expression
+}
+
+// parseStructConstructorExpression parses struct constructor calls like Type { field: value }
+func (p *Parser) parseStructConstructorExpression(left ast.Expression) ast.Expression {
+	name, _ := left.(*ast.Identifier)
+	return p.parseStructLiteral(name)
 }
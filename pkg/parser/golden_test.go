@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files in testdata")
+
+// TestGolden parses each testdata/*.sango file and compares its statements
+// and errors with the .golden file next to it. Run go test -update to
+// rewrite the .golden files after a deliberate change.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.sango"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no testdata files")
+	}
+
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := New(lexer.New(string(source)))
+		program := p.ParseProgram()
+
+		var out bytes.Buffer
+		for _, stmt := range program.Statements {
+			out.WriteString(stmt.String() + "\n")
+		}
+		if errs := p.Errors(); len(errs) > 0 {
+			out.WriteString("-- errors --\n")
+			for _, e := range errs {
+				out.WriteString(e + "\n")
+			}
+		}
+
+		golden := strings.TrimSuffix(file, ".sango") + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%v (run go test -update to create it)", err)
+		}
+		if got := out.String(); got != string(want) {
+			t.Errorf("%s: parse differs from %s\ngot:\n%s\nwant:\n%s", file, golden, got, want)
+		}
+	}
+}
+
+// TestGrammar checks that every production in grammar.ebnf is defined once
+// and used, and that every production it uses is defined
+func TestGrammar(t *testing.T) {
+	source, err := ioutil.ReadFile("grammar.ebnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop comments and tokens, leaving production names and operators
+	text := regexp.MustCompile(`(?s)\(\*.*?\*\)`).ReplaceAllString(string(source), "")
+	text = regexp.MustCompile(`"[^"]*"`).ReplaceAllString(text, "")
+
+	defined := map[string]bool{}
+	for _, m := range regexp.MustCompile(`(?m)^(\w+)\s*=`).FindAllStringSubmatch(text, -1) {
+		if defined[m[1]] {
+			t.Errorf("production %s is defined twice", m[1])
+		}
+		defined[m[1]] = true
+	}
+
+	used := map[string]bool{"Program": true}
+	body := regexp.MustCompile(`(?m)^\w+\s*=`).ReplaceAllString(text, "")
+	for _, name := range regexp.MustCompile(`\b[A-Z][A-Za-z]*[a-z][A-Za-z]*\b`).FindAllString(body, -1) {
+		used[name] = true
+		if !defined[name] {
+			t.Errorf("production %s is used but not defined", name)
+		}
+	}
+	for name := range defined {
+		if !used[name] {
+			t.Errorf("production %s is defined but not used", name)
+		}
+	}
+}
@@ -1,3 +1,6 @@
+// Package parser builds an ast.Program from the tokens of the lexer. The
+// grammar it accepts is written out in grammar.ebnf, and every construct
+// is parsed by one function that leaves curToken on its last token.
 package parser
 
 import (
@@ -95,8 +98,23 @@ type Parser struct {
 	curToken  lexer.Token
 	peekToken lexer.Token
 
+	// Tokens read past peekToken by tokenAfterPeek
+	ahead []lexer.Token
+
+	// Set when a NEWLINE came between curToken and peekToken, so that
+	// peekToken starts a new statement
+	peekNewline bool
+
+	// Doc comments that came before curToken and peekToken
+	curDoc  string
+	peekDoc string
+
 	errors []string
 
+	// Set by a syntax error until the statement it is in has been skipped,
+	// so that the errors it causes are not reported
+	panicking bool
+
 	// Parsing functions
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
@@ -104,11 +122,19 @@ type Parser struct {
 	// C function registry
 	cRegistry *cinterop.FunctionRegistry
 
-	// Bracket tracking stack for proper nesting
+	// The '(', '[' and '{' that enclose curToken, innermost last. A '}'
+	// also closes the '(' and '[' left open inside its block.
 	bracketStack []lexer.TokenType
-	
-	// V2 parsers
-	v2 *V2Parsers
+
+	// Set while parsing for and match headers, where '{' starts the body
+	noStructLiteral bool
+
+	// Set when an integer literal is the operand of unary minus, so that
+	// -128i8 is in range
+	negated bool
+
+	// Called with each node and the tokens it spans; see OnNode
+	onNode func(node ast.Node, first, last lexer.Token)
 }
 
 // Function types for Pratt parsing
@@ -132,6 +158,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.INT, p.parseIntegerLiteral)
 	p.registerPrefix(lexer.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(lexer.STRING, p.parseStringLiteral)
+	p.registerPrefix(lexer.CHAR, p.parseCharLiteral)
+	p.registerPrefix(lexer.INTERP_START, p.parseInterpolatedString)
 	p.registerPrefix(lexer.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(lexer.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(lexer.NULL, p.parseNullLiteral)
@@ -147,6 +175,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.DEF, p.parseFunctionLiteral)
 	p.registerPrefix(lexer.DOT, p.parseDotFieldExpression)
 	p.registerPrefix(lexer.SIZEOF, p.parseSizeofExpression)
+	p.registerPrefix(lexer.ALIGNOF, p.parseSizeofExpression)
+	p.registerPrefix(lexer.OFFSETOF, p.parseOffsetofExpression)
 	
 	// Register primitive type tokens as prefix parsers
 	p.registerPrefix(lexer.INT_TYPE, p.parseTypeIdentifier)
@@ -196,9 +226,6 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.LBRACE, p.parseStructConstructorExpression)
 	p.registerInfix(lexer.DOT, p.parseDotExpression)
 
-	// Initialize v2 parsers
-	p.initV2Parsers()
-
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
 	p.nextToken()
@@ -206,33 +233,116 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// ParseTypeExpression parses the type that starts at the current token
+func (p *Parser) ParseTypeExpression() *ast.TypeExpression {
+	return p.parseTypeExpression()
+}
+
+// OnNode registers fn to be called with every statement, block, expression
+// and type the parser builds, and the first and last tokens of its source.
+// Nodes are reported after the nodes inside them.
+func (p *Parser) OnNode(fn func(node ast.Node, first, last lexer.Token)) {
+	p.onNode = fn
+}
+
+// spanned reports node to the OnNode callback as ending at curToken
+func (p *Parser) spanned(node ast.Node, first lexer.Token) {
+	if p.onNode != nil && !isNil(node) {
+		p.onNode(node, first, p.curToken)
+	}
+}
+
+// CRegistry returns the C functions and link libraries visible to the
+// compilation unit, including those declared in extern blocks
+func (p *Parser) CRegistry() *cinterop.FunctionRegistry {
+	return p.cRegistry
+}
+
 // Error handling
 func (p *Parser) Errors() []string {
-	return p.errors
+	return append(append([]string{}, p.l.Errors()...), p.errors...)
 }
 
 func (p *Parser) peekError(t lexer.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead at line %d:%d",
 		t, p.peekToken.Type, p.peekToken.Line, p.peekToken.Column)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t lexer.TokenType) {
+	// Invalid UTF-8 has already been reported by the lexer
+	if t == lexer.ILLEGAL && p.l.InvalidUTF8(p.curToken.Offset) {
+		return
+	}
 	msg := fmt.Sprintf("no prefix parse function for %s found at line %d:%d",
 		t, p.curToken.Line, p.curToken.Column)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
 }
 
 func (p *Parser) unexpectedTokenError(expected string) {
 	msg := fmt.Sprintf("unexpected token %s, expected %s at line %d:%d",
 		p.curToken.Type, expected, p.curToken.Line, p.curToken.Column)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
 }
 
-// Token management
+// Token management. NEWLINE and DOC_COMMENT tokens are not returned: a
+// NEWLINE sets peekNewline, as the lexer emits them where a statement may
+// end, and doc comments on lines of their own are collected for the token
+// that follows them.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.curDoc = p.peekDoc
+	switch p.curToken.Type {
+	case lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE:
+		p.pushBracket(p.curToken.Type)
+	case lexer.RPAREN:
+		p.popBracketIf(lexer.LPAREN)
+	case lexer.RBRACKET:
+		p.popBracketIf(lexer.LBRACKET)
+	case lexer.RBRACE:
+		for len(p.bracketStack) > 0 && p.popBracket() != lexer.LBRACE {
+		}
+	}
+	p.peekToken = p.readToken()
+	p.peekNewline = false
+	p.peekDoc = ""
+	for p.peekToken.Type == lexer.NEWLINE || p.peekToken.Type == lexer.DOC_COMMENT {
+		if p.peekToken.Type == lexer.NEWLINE {
+			p.peekNewline = true
+		} else if p.peekToken.Line == p.curToken.Line {
+			// A doc comment after code on the same line documents nothing
+		} else if p.peekDoc == "" {
+			p.peekDoc = p.peekToken.Literal
+		} else {
+			p.peekDoc += "\n" + p.peekToken.Literal
+		}
+		p.peekToken = p.readToken()
+	}
+}
+
+// readToken returns the next token from the lexer, or from ahead
+func (p *Parser) readToken() lexer.Token {
+	if len(p.ahead) > 0 {
+		tok := p.ahead[0]
+		p.ahead = p.ahead[1:]
+		return tok
+	}
+	return p.l.NextToken()
+}
+
+// tokenAfterPeek returns the token that will follow peekToken, without
+// moving past either
+func (p *Parser) tokenAfterPeek() lexer.Token {
+	for i := 0; ; i++ {
+		if i == len(p.ahead) {
+			p.ahead = append(p.ahead, p.l.NextToken())
+		}
+		switch tok := p.ahead[i]; tok.Type {
+		case lexer.NEWLINE, lexer.DOC_COMMENT:
+		default:
+			return tok
+		}
+	}
 }
 
 func (p *Parser) curTokenIs(t lexer.TokenType) bool {
@@ -253,6 +363,19 @@ func (p *Parser) expectPeek(t lexer.TokenType) bool {
 	}
 }
 
+// nextOperand moves to the token an operand starts with, unless it is a
+// keyword that only starts statements. The operand is then missing, and the
+// keyword is left to start the next statement.
+func (p *Parser) nextOperand() bool {
+	if p.peekStartsStatement() {
+		p.addError(fmt.Sprintf("no prefix parse function for %s found at line %d:%d",
+			p.peekToken.Type, p.peekToken.Line, p.peekToken.Column))
+		return false
+	}
+	p.nextToken()
+	return true
+}
+
 // Precedence helpers
 func (p *Parser) peekPrecedence() Precedence {
 	if prec, ok := precedences[p.peekToken.Type]; ok {
@@ -289,18 +412,11 @@ func (p *Parser) peekBracket() lexer.TokenType {
 	return p.bracketStack[len(p.bracketStack)-1]
 }
 
-func (p *Parser) isInParentheses() bool {
-	return p.peekBracket() == lexer.LPAREN
-}
-
-// shouldStopExpression determines if expression parsing should stop based on context
-func (p *Parser) shouldStopExpression() bool {
-	// If we see a closing brace, only stop if we're not inside parentheses
-	if p.peekTokenIs(lexer.RBRACE) {
-		// If we're inside parentheses, don't stop for braces
-		return !p.isInParentheses()
+// popBracketIf pops the innermost bracket if it is open
+func (p *Parser) popBracketIf(open lexer.TokenType) {
+	if p.peekBracket() == open {
+		p.popBracket()
 	}
-	return false
 }
 
 // Parser function registration
@@ -318,22 +434,11 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(lexer.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
-		}
-		
-		// Only advance token if we're not at a natural statement boundary
-		// Some statements (like functions with blocks) handle their own token advancement
-		if !p.curTokenIs(lexer.EOF) && 
-		   !p.curTokenIs(lexer.DEF) && 
-		   !p.curTokenIs(lexer.STRUCT) && 
-		   !p.curTokenIs(lexer.TYPE) && 
-		   !p.curTokenIs(lexer.IMPL) &&
-		   !p.curTokenIs(lexer.FOR) &&
-		   !p.curTokenIs(lexer.WHILE) {
-			p.nextToken()
+		if !p.curTokenIs(lexer.SEMICOLON) {
+			program.Statements = append(program.Statements, p.parseStatement())
 		}
+		// Each statement ends on its last token
+		p.nextToken()
 	}
 
 	// Validate program structure for executables
@@ -356,14 +461,14 @@ func (p *Parser) validateProgram(program *ast.Program) {
 
 					// Validate main function signature
 					if len(fn.Parameters) > 1 {
-						p.addError("main function can have at most one parameter (args: []string)")
+						p.reportError("main function can have at most one parameter (args: []string)")
 					}
 
 					// Check if main has proper signature
 					if len(fn.Parameters) == 1 {
 						param := fn.Parameters[0]
 						if param.Type == nil {
-							p.addError("main function parameter should have type []string")
+							p.reportError("main function parameter should have type []string")
 						}
 					}
 
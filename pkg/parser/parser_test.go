@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/rxxuzi/sango/pkg/ast"
@@ -16,6 +18,8 @@ func TestValStatements(t *testing.T) {
 		{"val x = 5;", "x", 5},
 		{"val y = true;", "y", true},
 		{"val foobar = y;", "foobar", "y"},
+		{"val test = 1;", "test", 1},
+		{"val bench = test;", "bench", "test"},
 	}
 
 	for _, tt := range tests {
@@ -41,6 +45,28 @@ func TestValStatements(t *testing.T) {
 	}
 }
 
+func TestTestDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`test "adds" { assert(1 + 1 == 2) }`, "*ast.TestStatement"},
+		{`bench "adds" { 1 + 1 }`, "*ast.BenchStatement"},
+		{`test("adds")`, "*ast.ExpressionStatement"},
+		{"test\n\"adds\"", "*ast.ExpressionStatement"},
+		{"bench = 2", "*ast.AssignmentStatement"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := fmt.Sprintf("%T", program.Statements[0]); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -139,6 +165,79 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestTypedNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input string
+		value interface{}
+		typ   string
+	}{
+		{"0xFF;", int64(255), ""},
+		{"0b1010;", int64(10), ""},
+		{"0o17;", int64(15), ""},
+		{"0;", int64(0), ""},
+		{"1_000_000;", int64(1000000), ""},
+		{"255u8;", int64(255), "u8"},
+		{"18446744073709551615;", int64(-1), ""},
+		{"1.5f32;", 1.5, "f32"},
+		{"2f64;", 2.0, "f64"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		switch lit := exp.(type) {
+		case *ast.IntegerLiteral:
+			if lit.Value != tt.value || lit.Type != tt.typ {
+				t.Errorf("%s: expected %v %q, got %d %q", tt.input, tt.value, tt.typ, lit.Value, lit.Type)
+			}
+		case *ast.FloatLiteral:
+			if lit.Value != tt.value || lit.Type != tt.typ {
+				t.Errorf("%s: expected %v %q, got %v %q", tt.input, tt.value, tt.typ, lit.Value, lit.Type)
+			}
+		default:
+			t.Errorf("%s: expected a number literal, got %T", tt.input, exp)
+		}
+	}
+}
+
+func TestNumberLiteralRanges(t *testing.T) {
+	valid := []string{"127i8;", "-128i8;", "255u8;", "-9223372036854775808i64;", "65535u16;", "3.4e38f32;"}
+	for _, input := range valid {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"128i8;", "integer literal 128i8 overflows i8 at line 1:1"},
+		{"-129i8;", "integer literal 129i8 overflows i8 at line 1:2"},
+		{"256u8;", "integer literal 256u8 overflows u8 at line 1:1"},
+		{"-f(128i8);", "integer literal 128i8 overflows i8 at line 1:4"},
+		{"0x1_0000_0000u32;", "integer literal 0x1_0000_0000u32 overflows u32 at line 1:1"},
+		{"18446744073709551616;", "integer literal 18446744073709551616 overflows u64 at line 1:1"},
+		{"3.5e38f32;", "float literal 3.5e38f32 overflows f32 at line 1:1"},
+		{"1e309;", "float literal 1e309 overflows f64 at line 1:1"},
+		{"val x = 010;", "could not parse 010 as integer: leading zero in decimal literal (use 0o for octal) at line 1:9"},
+		{"val x = 09;", "could not parse 09 as integer: leading zero in decimal literal (use 0o for octal) at line 1:9"},
+		{"0_7u8;", "could not parse 0_7u8 as integer: leading zero in decimal literal (use 0o for octal) at line 1:1"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%s: expected first error %q, got %v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -564,6 +663,82 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestCharLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected rune
+	}{
+		{`'a';`, 'a'},
+		{`'\n';`, '\n'},
+		{`'値';`, '値'},
+		{`'\u{1F600}';`, 0x1F600},
+		{`'\xff';`, 0xff},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.CharLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.CharLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %q. got=%q", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	input := `"sum: ${a + b:>6} of ${items[0]}!";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	expected := []string{`"sum: "`, "${(a + b):>6}", `" of "`, "${(items[0])}", `"!"`}
+	if len(str.Parts) != len(expected) {
+		t.Fatalf("expected %d parts, got %d", len(expected), len(str.Parts))
+	}
+	for i, part := range str.Parts {
+		if part.String() != expected[i] {
+			t.Errorf("parts[%d] - expected %s, got %s", i, expected[i], part.String())
+		}
+	}
+	if in := str.Parts[1].(*ast.Interpolation); in.Format != ">6" {
+		t.Errorf("format not %q. got=%q", ">6", in.Format)
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${} b";`, "empty string interpolation at line 1:6"},
+		{`"a ${x y} b";`, "expected next token to be INTERP_END, got IDENT instead at line 1:8"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%s: expected first error %q, got %v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -610,6 +785,424 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSizeofExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		isType   bool
+		expected string
+	}{
+		{"sizeof(int)", true, "sizeof(int)"},
+		{"sizeof([]int)", true, "sizeof([]int)"},
+		{"sizeof([4]u8)", true, "sizeof([4]u8)"},
+		{"sizeof([2][3]i16)", true, "sizeof([2][3]i16)"},
+		{"sizeof([N]Point)", true, "sizeof([N]Point)"},
+		{"sizeof((int, double))", true, "sizeof((int, double))"},
+		{"sizeof(*Point)", true, "sizeof(*Point)"},
+		{"alignof(double)", true, "alignof(double)"},
+		{"sizeof(x)", false, "sizeof(x)"},
+		{"sizeof(p.header)", false, "sizeof((p . header))"},
+		{"sizeof([1, 2, 3])", false, "sizeof([1, 2, 3])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.SizeofExpression)
+		if !ok {
+			t.Fatalf("%s: exp not *ast.SizeofExpression. got=%T", tt.input, stmt.Expression)
+		}
+		if (exp.Type != nil) != tt.isType {
+			t.Errorf("%s: type operand=%v, want %v", tt.input, exp.Type != nil, tt.isType)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestOffsetofExpression(t *testing.T) {
+	l := lexer.New("offsetof(Packet, header.flags)")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.OffsetofExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.OffsetofExpression. got=%T", stmt.Expression)
+	}
+	if exp.Type.String() != "Packet" || len(exp.Field) != 2 || exp.Field[1].Value != "flags" {
+		t.Errorf("wrong offsetof. got=%s", exp.String())
+	}
+}
+
+func TestExternStatement(t *testing.T) {
+	input := `extern "libm" {
+    def cbrt(x: double): double;
+    def my_printf(fmt: *char, ...): int = "printf";
+    def reset();
+}
+extern "pthread"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExternStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExternStatement. got=%T", program.Statements[0])
+	}
+	if stmt.ABI != "libm" {
+		t.Errorf("stmt.ABI not %q. got=%q", "libm", stmt.ABI)
+	}
+	if len(stmt.Functions) != 3 {
+		t.Fatalf("wrong number of extern functions. got=%d", len(stmt.Functions))
+	}
+
+	printf := stmt.Functions[1]
+	if !printf.Variadic || printf.CName != "printf" || len(printf.Parameters) != 1 {
+		t.Errorf("variadic declaration parsed wrong. got=%s", printf)
+	}
+	if printf.Parameters[0].Type.String() != "*char" {
+		t.Errorf("parameter type not *char. got=%s", printf.Parameters[0].Type)
+	}
+
+	sig, ok := p.CRegistry().LookupFunction("my_printf")
+	if !ok {
+		t.Fatalf("my_printf not registered")
+	}
+	if sig.Symbol() != "printf" || !sig.Variadic || sig.Library != "m" {
+		t.Errorf("registered signature wrong. got=%+v", sig)
+	}
+
+	flags := p.CRegistry().LinkFlags()
+	if len(flags) != 2 || flags[0] != "-lm" || flags[1] != "-lpthread" {
+		t.Errorf("link flags wrong. got=%v", flags)
+	}
+}
+
+func TestStructDeclaration(t *testing.T) {
+	input := `@packed @align(8) struct Header {
+  version: u8 = 1
+  length: u32, flags: u16
+  extra: { zeta: int, alpha: double }
+}
+val h = Header { length: 4 };
+for x in items { x; };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if len(stmt.Attributes) != 2 || stmt.Attribute("packed") == nil || stmt.Attribute("align") == nil {
+		t.Fatalf("wrong attributes. got=%v", stmt.Attributes)
+	}
+	if arg := stmt.Attribute("align").Arguments; len(arg) != 1 || arg[0].String() != "8" {
+		t.Errorf("wrong @align arguments. got=%v", arg)
+	}
+
+	names := []string{"version", "length", "flags", "extra"}
+	if len(stmt.Fields) != len(names) {
+		t.Fatalf("wrong number of fields. got=%d", len(stmt.Fields))
+	}
+	for i, name := range names {
+		if stmt.Fields[i].Name.Value != name {
+			t.Errorf("field %d is not %s. got=%s", i, name, stmt.Fields[i].Name.Value)
+		}
+	}
+	if stmt.Fields[0].Default == nil || stmt.Fields[0].Default.String() != "1" {
+		t.Errorf("version has no default 1. got=%v", stmt.Fields[0].Default)
+	}
+	if stmt.Fields[1].Type.String() != "u32" || stmt.Fields[1].Default != nil {
+		t.Errorf("wrong length field. got=%s", stmt.Fields[1])
+	}
+	if stmt.Fields[3].Type.String() != "{ zeta: int, alpha: double }" {
+		t.Errorf("record fields out of order. got=%s", stmt.Fields[3].Type)
+	}
+
+	val := program.Statements[1].(*ast.ValStatement)
+	if _, ok := val.Value.(*ast.StructLiteral); !ok {
+		t.Errorf("val value not *ast.StructLiteral. got=%T", val.Value)
+	}
+	if _, ok := program.Statements[2].(*ast.ForStatement); !ok {
+		t.Errorf("for over identifier not parsed as *ast.ForStatement. got=%T", program.Statements[2])
+	}
+}
+
+func TestStructDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"struct P { x: int, x: int }", "duplicate field x in struct P"},
+		{"@packed val x = 1;", "attribute @packed must precede a struct declaration"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if len(errs) == 0 || !strings.Contains(errs[0], tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.err, errs)
+		}
+	}
+}
+
+func TestNewlineTermination(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"val x = a\n(b, c)", []string{"val x = a;", "(b, c)"}},
+		{"val x = a\n[0]", []string{"val x = a;", "[0]"}},
+		{"val x = a\n- b", []string{"val x = a;", "(-b)"}},
+		{"val x = a +\n  b", []string{"val x = (a + b);"}},
+		{"val x = f(a,\n  b)", []string{"val x = f(a, b);"}},
+		{"val x = list\n  .sum()", []string{"val x = (list . sum)();"}},
+		{"val x = if (c) { 1 }\nelse { 2 }", []string{"val x = ifc {1}else {2};"}},
+		{"def f() = {\n  return\n}\ng()", []string{"def f() = {return ;}", "g()"}},
+		{"def f() = {\n  if (c) { g(1) }\n  g(2)\n}", []string{"def f() = {ifc {g(1)}g(2)}"}},
+		{"val m = match x {\n  1 => a\n  _ => b\n}\nf(m)", []string{"val m = match x { 1 => a; _ => b };", "f(m)"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != len(tt.expected) {
+			t.Errorf("%q: expected %d statements, got %d: %s",
+				tt.input, len(tt.expected), len(program.Statements), program.String())
+			continue
+		}
+		for i, stmt := range program.Statements {
+			if stmt.String() != tt.expected[i] {
+				t.Errorf("%q: statements[%d] - expected %s, got %s", tt.input, i, tt.expected[i], stmt.String())
+			}
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	input := `/// Adds two numbers.
+///
+/// Overflow wraps.
+def add(a: int, b: int): int = a + b
+
+/** A point. */
+@packed struct Point { x: int, y: int }
+
+/// Distance in meters.
+type Meters f64
+
+/// Point methods.
+impl Point {
+  /// Squared length.
+  def norm2(): int = x * x + y * y
+  def zero(): int = 0
+}
+
+/// Folded at compile time.
+const def sq(n: int): int = n * n
+val x = 1 /// ignored on values
+def plain() = 0
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 7 {
+		t.Fatalf("expected 7 statements, got %d: %s", len(program.Statements), program.String())
+	}
+
+	docs := []string{
+		program.Statements[0].(*ast.FunctionStatement).Doc,
+		program.Statements[1].(*ast.StructStatement).Doc,
+		program.Statements[2].(*ast.TypeStatement).Doc,
+		program.Statements[3].(*ast.ImplStatement).Doc,
+		program.Statements[3].(*ast.ImplStatement).Methods[0].Doc,
+		program.Statements[3].(*ast.ImplStatement).Methods[1].Doc,
+		program.Statements[4].(*ast.FunctionStatement).Doc,
+		program.Statements[6].(*ast.FunctionStatement).Doc,
+	}
+	expected := []string{
+		"Adds two numbers.\n\nOverflow wraps.",
+		"A point.",
+		"Distance in meters.",
+		"Point methods.",
+		"Squared length.",
+		"",
+		"Folded at compile time.",
+		"",
+	}
+	for i, doc := range docs {
+		if doc != expected[i] {
+			t.Errorf("docs[%d] - expected %q, got %q", i, expected[i], doc)
+		}
+	}
+}
+
+func TestIllegalCharacters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// Invalid UTF-8 is reported once, by the lexer
+		{"val x = \xff", []string{"invalid UTF-8 encoding (byte 0xff) at line 1:9"}},
+		// A U+FFFD written in the source is valid UTF-8, but not a token
+		{"val x = \uFFFD", []string{"no prefix parse function for ILLEGAL found at line 1:9"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if strings.Join(errs, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: expected errors %q, got %q", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      string
+	}{
+		{"def f() = {\n  val = 1\n  return 2\n}\ndef g() = 3",
+			[]string{"def f() = {<bad statement>return 2;}", "def g() = 3"},
+			"expected next token to be IDENT, got = instead at line 2:7"},
+		{"val x = 1 + ;\nval y = 2",
+			[]string{"val x = (1 + <bad expression>);", "val y = 2;"},
+			"no prefix parse function for ; found at line 1:13"},
+		{"val a = f(1,, 2)\nval b = 3",
+			[]string{"val a = <bad expression>;", "val b = 3;"},
+			"no prefix parse function for , found at line 1:13"},
+		{"val a = [1, 2\nval b = 3",
+			[]string{"val a = [1, 2];", "val b = 3;"},
+			"expected next token to be ], got val instead at line 2:1"},
+		{"def main() = {\n  if (x) {\n    val = (1,\n      2)\n  }\n  foo(1)\n}",
+			[]string{"def main() = {ifx {<bad statement>}foo(1)}"},
+			"expected next token to be IDENT, got = instead at line 3:9"},
+		{"val a = [1, 2,\nval b = 3",
+			[]string{"val a = [1, 2];", "val b = 3;"},
+			"no prefix parse function for val found at line 2:1"},
+		{"val z = (1 +\nval w = 3",
+			[]string{"val z = <bad expression>;", "val w = 3;"},
+			"no prefix parse function for val found at line 2:1"},
+		{"val a = f(1,\nvar b = 3",
+			[]string{"val a = <bad expression>;", "var b = 3;"},
+			"no prefix parse function for var found at line 2:1"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) != 1 || errs[0] != tt.err {
+			t.Errorf("%q: expected error %q, got %q", tt.input, tt.err, errs)
+		}
+		if len(program.Statements) != len(tt.expected) {
+			t.Errorf("%q: expected %d statements, got %d: %s",
+				tt.input, len(tt.expected), len(program.Statements), program.String())
+			continue
+		}
+		for i, stmt := range program.Statements {
+			if stmt.String() != tt.expected[i] {
+				t.Errorf("%q: statements[%d] - expected %s, got %s", tt.input, i, tt.expected[i], stmt.String())
+			}
+		}
+	}
+}
+
+// TestErrorsAfterSyntaxErrors checks that only syntax errors that follow
+// another in the same statement are left out
+func TestErrorsAfterSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"struct P { x: int, x: int, y: int, y: int }", []string{
+			"duplicate field x in struct P at line 1:20",
+			"duplicate field y in struct P at line 1:36",
+		}},
+		{"struct P { x: int, x: int, = }", []string{
+			"duplicate field x in struct P at line 1:20",
+			"expected field name, got = at line 1:28",
+		}},
+		{"val a = [256u8, 300u8]", []string{
+			"integer literal 256u8 overflows u8 at line 1:10",
+			"integer literal 300u8 overflows u8 at line 1:17",
+		}},
+		{"val a = f(1,, 2,, 3)", []string{
+			"no prefix parse function for , found at line 1:13",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if strings.Join(errs, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: expected errors %q, got %q", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestBadStatement(t *testing.T) {
+	p := New(lexer.New("val x = 1\nval = (2,\n  3)\nval y = 4"))
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d: %s", len(program.Statements), program.String())
+	}
+	bad, ok := program.Statements[1].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("statements[1] is not *ast.BadStatement, got %T", program.Statements[1])
+	}
+	if bad.Token.Line != 2 || bad.Token.Type != lexer.VAL || bad.End.Line != 3 || bad.End.Type != lexer.RPAREN {
+		t.Errorf("bad statement spans %s at line %d to %s at line %d",
+			bad.Token.Type, bad.Token.Line, bad.End.Type, bad.End.Line)
+	}
+}
+
+func TestErrorLimit(t *testing.T) {
+	input := strings.Repeat("val = 1\n", maxErrors+5) + "val x = 2"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	errs := p.Errors()
+	if len(errs) != maxErrors+1 || errs[maxErrors] != "too many errors" {
+		t.Errorf("expected %d errors and then too many errors, got %q", maxErrors, errs)
+	}
+	if n := len(program.Statements); n != maxErrors+6 || program.Statements[n-1].String() != "val x = 2;" {
+		t.Errorf("expected every statement to be kept, got %s", program.String())
+	}
+}
+
 // Helper functions
 func testValStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "val" {
@@ -2,13 +2,45 @@ package parser
 
 import (
 	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
 
 	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/cinterop"
 	"github.com/rxxuzi/sango/pkg/lexer"
 )
 
-// Statement parsing
+// parseStatement parses one statement. A statement with a syntax error is
+// skipped up to the next statement, and if nothing of it could be parsed,
+// an ast.BadStatement takes its place, so that the rest is still parsed.
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.curToken
+	depth := len(p.bracketStack)
+	if isOpeningBracket(start.Type) {
+		depth--
+	}
+	outer := p.panicking
+	p.panicking = false
+
+	stmt := p.parseStatementKind()
+	if isNil(stmt) {
+		if !p.panicking {
+			p.addError(fmt.Sprintf("invalid %s statement at line %d:%d",
+				start.Type, start.Line, start.Column))
+		}
+		stmt = &ast.BadStatement{Token: start, End: p.synchronize(depth)}
+	} else if p.panicking {
+		p.synchronize(depth)
+	}
+
+	p.panicking = outer
+	p.spanned(stmt, start)
+	return stmt
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.curToken.Type {
 	case lexer.VAL:
 		return p.parseValStatement()
@@ -17,15 +49,25 @@ func (p *Parser) parseStatement() ast.Statement {
 	case lexer.RETURN:
 		return p.parseReturnStatement()
 	case lexer.DEF:
+		// Anonymous functions (def(x) = ...) are expressions
+		if p.peekTokenIs(lexer.LPAREN) {
+			return p.parseExpressionStatement()
+		}
 		return p.parseFunctionStatement()
+	case lexer.CONST:
+		return p.parseConstFunctionStatement()
 	case lexer.TYPE:
 		return p.parseTypeStatement()
 	case lexer.STRUCT:
 		return p.parseStructStatement()
+	case lexer.AT:
+		return p.parseAttributedStatement()
 	case lexer.IMPL:
 		return p.parseImplStatement()
 	case lexer.INCLUDE:
 		return p.parseIncludeStatement()
+	case lexer.EXTERN:
+		return p.parseExternStatement()
 	case lexer.IMPORT:
 		return p.parseImportStatement()
 	case lexer.DEFINE:
@@ -38,6 +80,18 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseDeferStatement()
 	case lexer.ASSERT:
 		return p.parseAssertStatement()
+	case lexer.IDENT:
+		// test and bench are only keywords before the name of a
+		// declaration, so they can still name values
+		if p.peekTokenIs(lexer.STRING) && !p.peekNewline {
+			switch p.curToken.Literal {
+			case "test":
+				return p.parseTestStatement()
+			case "bench":
+				return p.parseBenchStatement()
+			}
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -74,7 +128,9 @@ func (p *Parser) parseValStatement() *ast.ValStatement {
 		return nil
 	}
 
-	p.nextToken()
+	if !p.nextOperand() {
+		return nil
+	}
 	stmt.Value = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(lexer.SEMICOLON) {
@@ -115,7 +171,9 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 		return nil
 	}
 
-	p.nextToken()
+	if !p.nextOperand() {
+		return nil
+	}
 	stmt.Value = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(lexer.SEMICOLON) {
@@ -128,6 +186,14 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
+	// A bare return ends at a semicolon, a closing brace or a line break
+	if p.peekNewline || p.peekTokenIs(lexer.SEMICOLON) || p.peekTokenIs(lexer.RBRACE) || p.peekTokenIs(lexer.EOF) {
+		if p.peekTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
@@ -180,7 +246,9 @@ func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 	stmt.Operator = p.curToken.Literal
 
 	// Parse the value expression
-	p.nextToken()
+	if !p.nextOperand() {
+		return nil
+	}
 	stmt.Value = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(lexer.SEMICOLON) {
@@ -190,38 +258,99 @@ func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 	return stmt
 }
 
-// Block statement parsing
-// parseBlockStatement moved to block_parser.go
+// synchronize skips the rest of a statement that failed to parse, which
+// started inside depth brackets, and returns its last token. Brackets
+// opened within the statement are skipped whole; it ends at a ';' or a
+// line break outside them, or before a statement keyword or the '}' that
+// closes the enclosing block.
+func (p *Parser) synchronize(depth int) lexer.Token {
+	for !p.atBlockEnd(depth) && !p.endsStatement(depth) {
+		p.nextToken()
+	}
+	return p.curToken
+}
 
-// Enhanced error recovery and synchronization
-func (p *Parser) synchronize() {
-	p.nextToken()
+// endsStatement reports whether curToken is the last token of a statement
+// that started inside depth brackets
+func (p *Parser) endsStatement(depth int) bool {
+	open := p.bracketStack[depth:]
+	if len(open) == 0 {
+		return p.curTokenIs(lexer.SEMICOLON) || p.peekNewline || p.peekTokenIs(lexer.EOF) ||
+			syncTokens[p.peekToken.Type] || (depth > 0 && p.peekTokenIs(lexer.RBRACE))
+	}
 
-	for !p.curTokenIs(lexer.EOF) {
-		if p.curTokenIs(lexer.SEMICOLON) {
-			return
-		}
+	// A statement keyword inside '(' or '[' means they were left open, as
+	// does a '}' that closes no '{' of the statement
+	inBlock := false
+	for _, bracket := range open {
+		inBlock = inBlock || bracket == lexer.LBRACE
+	}
+	if (!inBlock && depth > 0 && p.peekTokenIs(lexer.RBRACE)) ||
+		(p.peekBracket() != lexer.LBRACE && p.peekStartsStatement()) {
+		p.bracketStack = p.bracketStack[:depth]
+		return true
+	}
+	return false
+}
 
-		switch p.peekToken.Type {
-		case lexer.DEF, lexer.VAL, lexer.VAR, lexer.TYPE, lexer.STRUCT, lexer.IMPL, lexer.RETURN:
-			return
-		}
+// peekStartsStatement reports whether peekToken is a keyword that only
+// starts statements. Only def with a name counts, as anonymous functions
+// are expressions.
+func (p *Parser) peekStartsStatement() bool {
+	return syncTokens[p.peekToken.Type] &&
+		(!p.peekTokenIs(lexer.DEF) || p.tokenAfterPeek().Type == lexer.IDENT)
+}
 
-		p.nextToken()
-	}
+// syncTokens are the keywords that only start statements
+var syncTokens = map[lexer.TokenType]bool{
+	lexer.VAL: true, lexer.VAR: true, lexer.RETURN: true, lexer.DEF: true,
+	lexer.CONST: true, lexer.TYPE: true, lexer.STRUCT: true, lexer.IMPL: true,
+	lexer.INCLUDE: true, lexer.EXTERN: true, lexer.IMPORT: true, lexer.DEFINE: true,
+	lexer.FOR: true, lexer.WHILE: true, lexer.DEFER: true, lexer.ASSERT: true,
 }
 
+// maxErrors is the number of syntax errors after which the rest are
+// reported as one
+const maxErrors = 10
+
+// addError records a syntax error, unless it follows another in the same
+// statement, as it is then likely to be caused by the first
 func (p *Parser) addError(msg string) {
-	p.errors = append(p.errors, msg)
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.reportError(msg)
+}
+
+// reportError records an error in code that parsed, such as a duplicate
+// field, which is reported even after a syntax error in the same statement
+func (p *Parser) reportError(msg string) {
+	switch {
+	case len(p.errors) < maxErrors:
+		p.errors = append(p.errors, msg)
+	case len(p.errors) == maxErrors:
+		p.errors = append(p.errors, "too many errors")
+	}
+}
+
+func isOpeningBracket(t lexer.TokenType) bool {
+	return t == lexer.LPAREN || t == lexer.LBRACKET || t == lexer.LBRACE
 }
 
-func (p *Parser) recoverFromError() {
-	p.synchronize()
+// isNil reports whether node is nil, or a nil pointer of a node type, as
+// the parse functions return when they fail
+func isNil(node ast.Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
 }
 
 // Statement implementations (basic versions for completeness)
 func (p *Parser) parseTypeStatement() ast.Statement {
-	stmt := &ast.TypeStatement{Token: p.curToken}
+	stmt := &ast.TypeStatement{Token: p.curToken, Doc: p.curDoc}
 
 	if !p.expectPeek(lexer.IDENT) {
 		return nil
@@ -238,7 +367,7 @@ func (p *Parser) parseTypeStatement() ast.Statement {
 }
 
 func (p *Parser) parseStructStatement() ast.Statement {
-	stmt := &ast.StructStatement{Token: p.curToken}
+	stmt := &ast.StructStatement{Token: p.curToken, Doc: p.curDoc}
 
 	if !p.expectPeek(lexer.IDENT) {
 		return nil
@@ -250,14 +379,23 @@ func (p *Parser) parseStructStatement() ast.Statement {
 		return nil
 	}
 
-	// Parse struct fields
-	stmt.Fields = []*ast.StructField{}
+	// Parse struct fields, separated by newlines, commas or semicolons
+	stmt.Fields = []*ast.StructFieldDecl{}
 
 	p.nextToken()
 	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
-		field := p.parseStructFieldDefinition()
+		if p.curTokenIs(lexer.COMMA) || p.curTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+			continue
+		}
+		field := p.parseStructFieldDecl()
 		if field != nil {
-			stmt.Fields = append(stmt.Fields, field)
+			if stmt.Field(field.Name.Value) != nil {
+				p.reportError(fmt.Sprintf("duplicate field %s in struct %s at line %d:%d",
+					field.Name.Value, stmt.Name.Value, field.Token.Line, field.Token.Column))
+			} else {
+				stmt.Fields = append(stmt.Fields, field)
+			}
 		}
 		p.nextToken()
 	}
@@ -265,12 +403,15 @@ func (p *Parser) parseStructStatement() ast.Statement {
 	return stmt
 }
 
-func (p *Parser) parseStructFieldDefinition() *ast.StructField {
+// parseStructFieldDecl parses name: Type with an optional = default
+func (p *Parser) parseStructFieldDecl() *ast.StructFieldDecl {
 	if !p.curTokenIs(lexer.IDENT) {
+		p.addError(fmt.Sprintf("expected field name, got %s at line %d:%d",
+			p.curToken.Type, p.curToken.Line, p.curToken.Column))
 		return nil
 	}
 
-	field := &ast.StructField{}
+	field := &ast.StructFieldDecl{Token: p.curToken}
 	field.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	if !p.expectPeek(lexer.COLON) {
@@ -278,17 +419,71 @@ func (p *Parser) parseStructFieldDefinition() *ast.StructField {
 	}
 
 	p.nextToken()
-	fieldType := p.parseTypeExpression()
+	field.Type = p.parseTypeExpression()
+	if field.Type == nil {
+		return nil
+	}
 
-	// For struct definitions, we store the type as a simple identifier expression
-	// This is a simplification for now
-	field.Value = &ast.Identifier{Token: p.curToken, Value: fieldType.String()}
+	if p.peekTokenIs(lexer.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		field.Default = p.parseExpression(LOWEST)
+	}
 
 	return field
 }
 
+// parseAttributedStatement parses a declaration preceded by attributes,
+// such as @packed struct Header { ... }
+func (p *Parser) parseAttributedStatement() ast.Statement {
+	doc := p.curDoc
+	attrs := p.parseAttributes()
+	if attrs == nil {
+		return nil
+	}
+
+	if !p.curTokenIs(lexer.STRUCT) {
+		p.addError(fmt.Sprintf("attribute %s must precede a struct declaration at line %d:%d",
+			attrs[0], attrs[0].Token.Line, attrs[0].Token.Column))
+		return nil
+	}
+
+	stmt, ok := p.parseStructStatement().(*ast.StructStatement)
+	if !ok || stmt == nil {
+		return nil
+	}
+	stmt.Attributes = attrs
+	stmt.Doc = doc
+	return stmt
+}
+
+// parseAttributes parses a run of @name and @name(args) attributes and
+// leaves the current token on what follows them
+func (p *Parser) parseAttributes() []*ast.Attribute {
+	attrs := []*ast.Attribute{}
+	for p.curTokenIs(lexer.AT) {
+		attr := &ast.Attribute{Token: p.curToken}
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		attr.Name = p.curToken.Literal
+
+		if p.peekTokenIs(lexer.LPAREN) {
+			p.nextToken()
+			attr.Arguments = p.parseExpressionList(lexer.RPAREN)
+			if attr.Arguments == nil {
+				return nil
+			}
+		}
+
+		attrs = append(attrs, attr)
+		p.nextToken()
+	}
+	return attrs
+}
+
 func (p *Parser) parseImplStatement() ast.Statement {
-	stmt := &ast.ImplStatement{Token: p.curToken}
+	stmt := &ast.ImplStatement{Token: p.curToken, Doc: p.curDoc}
 
 	p.nextToken() // Move past 'impl'
 
@@ -336,38 +531,22 @@ func (p *Parser) parseImplStatement() ast.Statement {
 		return nil
 	}
 
-	// Parse impl methods directly using main parser
+	// Parse impl methods like the statements of a block
 	stmt.Methods = []*ast.FunctionStatement{}
 
+	depth := len(p.bracketStack)
 	p.nextToken() // consume '{'
-	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
-		// Skip semicolons and newlines
-		if p.curTokenIs(lexer.SEMICOLON) {
-			p.nextToken()
-			continue
-		}
-
+	for !p.atBlockEnd(depth) {
 		if p.curTokenIs(lexer.DEF) {
-			method := p.parseFunctionStatement()
-			if method != nil {
+			if method, ok := p.parseStatement().(*ast.FunctionStatement); ok {
 				stmt.Methods = append(stmt.Methods, method)
 			}
-			// After parsing function, we should be positioned correctly
-			// Only advance if we're not at a logical boundary
-			if !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.DEF) && !p.curTokenIs(lexer.EOF) {
-				p.nextToken()
-			}
-		} else {
-			// If we're not at a DEF token and not at the end, advance
+		}
+		if !p.atBlockEnd(depth) {
 			p.nextToken()
 		}
 	}
 
-	// Consume the closing RBRACE
-	if p.curTokenIs(lexer.RBRACE) {
-		p.nextToken()
-	}
-
 	return stmt
 }
 
@@ -386,38 +565,306 @@ func (p *Parser) parseIncludeStatement() ast.Statement {
 	return stmt
 }
 
+// parseExternStatement parses extern "C" { ... } declaration blocks and
+// bare extern "libname" link hints. Declared functions are registered in the
+// C function registry so later stages can resolve them like header functions.
+func (p *Parser) parseExternStatement() ast.Statement {
+	stmt := &ast.ExternStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.STRING) {
+		return nil
+	}
+
+	stmt.ABI = p.curToken.Literal
+	p.cRegistry.AddLibrary(stmt.ABI)
+
+	// Bare link hint: extern "libm"
+	if !p.peekTokenIs(lexer.LBRACE) {
+		if p.peekTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
+	p.nextToken() // move to '{'
+	stmt.Functions = []*ast.ExternFunction{}
+
+	p.nextToken() // consume '{'
+	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
+		if p.curTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+			continue
+		}
+
+		if !p.curTokenIs(lexer.DEF) {
+			p.unexpectedTokenError("def in extern block")
+			p.nextToken()
+			continue
+		}
+
+		fn := p.parseExternFunction()
+		if fn == nil {
+			// Skip to the next declaration
+			for !p.curTokenIs(lexer.DEF) && !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
+				p.nextToken()
+			}
+			continue
+		}
+
+		stmt.Functions = append(stmt.Functions, fn)
+		p.cRegistry.RegisterFunction(externSignature(fn, stmt.ABI))
+		p.nextToken()
+	}
+
+	if !p.curTokenIs(lexer.RBRACE) {
+		p.addError(fmt.Sprintf("unterminated extern block starting at line %d:%d",
+			stmt.Token.Line, stmt.Token.Column))
+	}
+
+	return stmt
+}
+
+// parseExternFunction parses def name(params, ...): type = "c_name"
+func (p *Parser) parseExternFunction() *ast.ExternFunction {
+	fn := &ast.ExternFunction{Token: p.curToken}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+
+	fn.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	fn.Parameters = []*ast.Parameter{}
+	for !p.peekTokenIs(lexer.RPAREN) {
+		p.nextToken()
+
+		if p.curTokenIs(lexer.ELLIPSIS) {
+			fn.Variadic = true
+			if !p.peekTokenIs(lexer.RPAREN) {
+				p.addError(fmt.Sprintf("... must be the last parameter of %s at line %d:%d",
+					fn.Name.Value, p.curToken.Line, p.curToken.Column))
+				return nil
+			}
+			break
+		}
+
+		if !p.curTokenIs(lexer.IDENT) {
+			p.unexpectedTokenError("parameter name")
+			return nil
+		}
+
+		param := &ast.Parameter{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+		p.nextToken()
+		param.Type = p.parseTypeExpression()
+		fn.Parameters = append(fn.Parameters, param)
+
+		if p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+		} else if !p.peekTokenIs(lexer.RPAREN) {
+			p.peekError(lexer.RPAREN)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	if p.peekTokenIs(lexer.COLON) {
+		p.nextToken()
+		p.nextToken()
+		fn.ReturnType = p.parseTypeExpression()
+	}
+
+	// Optional C name override: = "c_name"
+	if p.peekTokenIs(lexer.ASSIGN) {
+		p.nextToken()
+		if !p.expectPeek(lexer.STRING) {
+			return nil
+		}
+		fn.CName = p.curToken.Literal
+	}
+
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return fn
+}
+
+// externSignature converts an extern declaration into a registry signature
+func externSignature(fn *ast.ExternFunction, abi string) cinterop.FunctionSignature {
+	sig := cinterop.FunctionSignature{
+		Name:       fn.Name.Value,
+		ReturnType: "void",
+		Variadic:   fn.Variadic,
+		CName:      fn.CName,
+		Library:    cinterop.NormalizeLibrary(abi),
+	}
+	if fn.ReturnType != nil {
+		sig.ReturnType = fn.ReturnType.String()
+	}
+	for _, param := range fn.Parameters {
+		arg := cinterop.Argument{Name: param.Name.Value}
+		if param.Type != nil {
+			arg.Type = param.Type.String()
+		}
+		sig.Args = append(sig.Args, arg)
+	}
+	return sig
+}
+
 func (p *Parser) parseImportStatement() ast.Statement {
 	// Sango module imports: import "module.sango"
 	p.addError("import statements not fully implemented yet")
-	p.recoverFromError()
 	return nil
 }
 
 func (p *Parser) parseDefineStatement() ast.Statement {
 	stmt := &ast.DefineStatement{Token: p.curToken}
 
+	// Raw C macro: define @c NAME tokens...
+	if p.peekTokenIs(lexer.AT) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		if p.curToken.Literal != "c" {
+			p.addError(fmt.Sprintf("unknown define attribute @%s at line %d:%d",
+				p.curToken.Literal, p.curToken.Line, p.curToken.Column))
+			return nil
+		}
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.IsC = true
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		stmt.Raw = p.collectLineTokens()
+		return stmt
+	}
+
 	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-	// Simple implementation: collect everything until end of line as value
+	// Function-like macro: the '(' must follow the name directly, as in C
+	if p.peekTokenIs(lexer.LPAREN) && p.peekToken.Line == p.curToken.Line &&
+		p.peekToken.Column == p.curToken.Column+utf8.RuneCountInString(p.curToken.Literal) {
+		p.nextToken()
+		stmt.Parameters = p.parseMacroParameters()
+		if stmt.Parameters == nil {
+			return nil
+		}
+		if !p.expectPeek(lexer.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+		if p.peekTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
+	// Optional type annotation: define N: u32 = 4
+	if p.peekTokenIs(lexer.COLON) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Type = p.parseTypeExpression()
+	}
+
+	if p.peekTokenIs(lexer.ASSIGN) {
+		p.nextToken()
+	}
+
+	// Flag macro without a value: define DEBUG
+	if p.peekTokenIs(lexer.EOF) || p.peekTokenIs(lexer.SEMICOLON) || p.peekToken.Line != p.curToken.Line {
+		if p.peekTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+		}
+		if stmt.Type != nil {
+			p.reportError(fmt.Sprintf("typed constant %s has no value at line %d:%d",
+				stmt.Name.Value, stmt.Token.Line, stmt.Token.Column))
+		}
+		return stmt
+	}
+
+	if !p.nextOperand() {
+		return nil
+	}
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseMacroParameters parses the identifier list of a function-like macro
+func (p *Parser) parseMacroParameters() []*ast.Identifier {
+	params := []*ast.Identifier{}
+	seen := map[string]bool{}
+
+	if p.peekTokenIs(lexer.RPAREN) {
+		p.nextToken()
+		return params
+	}
+
+	for {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		if seen[p.curToken.Literal] {
+			p.addError(fmt.Sprintf("duplicate macro parameter %s at line %d:%d",
+				p.curToken.Literal, p.curToken.Line, p.curToken.Column))
+			return nil
+		}
+		seen[p.curToken.Literal] = true
+		params = append(params, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(lexer.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	return params
+}
+
+// collectLineTokens joins the remaining tokens on the current line back into
+// source text for raw C macros
+func (p *Parser) collectLineTokens() string {
 	var value bytes.Buffer
 	for !p.peekTokenIs(lexer.EOF) && p.peekToken.Line == p.curToken.Line {
 		p.nextToken()
-		value.WriteString(p.curToken.Literal)
+		if p.curTokenIs(lexer.STRING) {
+			value.WriteString(strconv.Quote(p.curToken.Literal))
+		} else {
+			value.WriteString(p.curToken.Literal)
+		}
 		if !p.peekTokenIs(lexer.EOF) && p.peekToken.Line == p.curToken.Line {
 			value.WriteString(" ")
 		}
 	}
-
-	stmt.Value = value.String()
-	return stmt
+	return value.String()
 }
 
 func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
-	stmt := &ast.FunctionStatement{Token: p.curToken}
+	stmt := &ast.FunctionStatement{Token: p.curToken, Doc: p.curDoc}
 
 	if !p.expectPeek(lexer.IDENT) {
 		return nil
@@ -448,7 +895,6 @@ func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
 	// Handle function body - could be expression or block
 	if p.curTokenIs(lexer.LBRACE) {
 		stmt.Body = p.parseBlockStatement()
-		// parseBlockStatement handles RBRACE consumption
 	} else {
 		stmt.Body = p.parseExpression(0)
 	}
@@ -456,6 +902,24 @@ func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
 	return stmt
 }
 
+// parseConstFunctionStatement parses const def functions, which the
+// compiler evaluates at build time
+func (p *Parser) parseConstFunctionStatement() ast.Statement {
+	doc := p.curDoc
+	if !p.expectPeek(lexer.DEF) {
+		return nil
+	}
+
+	stmt := p.parseFunctionStatement()
+	if stmt == nil {
+		return nil
+	}
+
+	stmt.Const = true
+	stmt.Doc = doc
+	return stmt
+}
+
 func (p *Parser) parseForStatement() ast.Statement {
 	stmt := &ast.ForStatement{Token: p.curToken}
 
@@ -480,14 +944,13 @@ func (p *Parser) parseForStatement() ast.Statement {
 	}
 
 	p.nextToken()
-	stmt.Iterable = p.parseExpression(0)
+	stmt.Iterable = p.parseHeaderExpression()
 
 	if !p.expectPeek(lexer.LBRACE) {
 		return nil
 	}
 
 	stmt.Body = p.parseBlockStatement()
-	// parseBlockStatementFixed already handles RBRACE consumption
 	return stmt
 }
 
@@ -510,7 +973,6 @@ func (p *Parser) parseWhileStatement() ast.Statement {
 	}
 
 	stmt.Body = p.parseBlockStatement()
-	// parseBlockStatementFixed already handles RBRACE consumption
 	return stmt
 }
 
@@ -547,3 +1009,45 @@ func (p *Parser) parseAssertStatement() ast.Statement {
 
 	return stmt
 }
+
+// parseTestStatement parses test "name" { ... }, which is only allowed at
+// the top level
+func (p *Parser) parseTestStatement() ast.Statement {
+	stmt := &ast.TestStatement{Token: p.curToken}
+	if len(p.bracketStack) > 0 {
+		p.addError(fmt.Sprintf("test must be declared at the top level at line %d:%d",
+			stmt.Token.Line, stmt.Token.Column))
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Name = p.curToken.Literal
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+// parseBenchStatement parses bench "name" { ... }, which is only allowed at
+// the top level
+func (p *Parser) parseBenchStatement() ast.Statement {
+	stmt := &ast.BenchStatement{Token: p.curToken}
+	if len(p.bracketStack) > 0 {
+		p.addError(fmt.Sprintf("bench must be declared at the top level at line %d:%d",
+			stmt.Token.Line, stmt.Token.Column))
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Name = p.curToken.Literal
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
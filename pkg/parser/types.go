@@ -7,6 +7,15 @@ import (
 
 // Type expression parsing
 func (p *Parser) parseTypeExpression() *ast.TypeExpression {
+	first := p.curToken
+	typ := p.parseType()
+	if typ != nil {
+		p.spanned(typ, first)
+	}
+	return typ
+}
+
+func (p *Parser) parseType() *ast.TypeExpression {
 	type_expr := &ast.TypeExpression{Token: p.curToken}
 
 	// Handle array types []
@@ -23,11 +32,12 @@ func (p *Parser) parseTypeExpression() *ast.TypeExpression {
 				type_expr.ElementType = elementType
 			}
 		} else {
-			// Fixed size array [N]T - for now treat as dynamic
-			for !p.curTokenIs(lexer.RBRACKET) {
-				p.nextToken()
+			// Fixed size array [N]T
+			p.nextToken()
+			type_expr.Length = p.parseExpression(LOWEST)
+			if !p.expectPeek(lexer.RBRACKET) {
+				return nil
 			}
-			p.nextToken() // consume ]
 			p.nextToken() // move to element type
 			type_expr.Array = true
 			// Recursively parse element type
@@ -40,6 +50,18 @@ func (p *Parser) parseTypeExpression() *ast.TypeExpression {
 		return type_expr
 	}
 
+	// Handle pointer types *T
+	if p.curTokenIs(lexer.ASTERISK) {
+		p.nextToken() // move to pointee type
+		type_expr.Pointer = true
+		elementType := p.parseTypeExpression()
+		if elementType != nil {
+			type_expr.Name = elementType.String()
+			type_expr.ElementType = elementType
+		}
+		return type_expr
+	}
+
 	// Handle parenthesized types - could be tuple or function parameters
 	if p.curTokenIs(lexer.LPAREN) {
 		return p.parseParenthesizedType()
@@ -181,31 +203,16 @@ func (p *Parser) parseFunctionType(paramTypes []ast.TypeExpression) *ast.TypeExp
 // parseRecordType parses record types: { field: type, ... }
 func (p *Parser) parseRecordType() *ast.TypeExpression {
 	type_expr := &ast.TypeExpression{Token: p.curToken}
-	type_expr.Record = &ast.RecordType{Fields: make(map[string]*ast.TypeExpression)}
+	type_expr.Record = &ast.RecordType{Fields: []*ast.StructFieldDecl{}}
 	
 	p.nextToken() // consume '{'
 	
 	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
-		// Parse field name
-		if !p.curTokenIs(lexer.IDENT) {
-			p.addError("expected field name in record type")
-			return nil
-		}
-		fieldName := p.curToken.Literal
-		
-		// Expect ':'
-		if !p.expectPeek(lexer.COLON) {
+		field := p.parseStructFieldDecl()
+		if field == nil {
 			return nil
 		}
-		
-		// Parse field type
-		p.nextToken() // move to type
-		fieldType := p.parseTypeExpression()
-		if fieldType == nil {
-			return nil
-		}
-		
-		type_expr.Record.Fields[fieldName] = fieldType
+		type_expr.Record.Fields = append(type_expr.Record.Fields, field)
 		
 		// Check for comma or end
 		p.nextToken()
@@ -225,3 +232,61 @@ func (p *Parser) parseRecordType() *ast.TypeExpression {
 	
 	return type_expr
 }
+
+// parseTypeOrExpression parses an operand that may be a type or a value, as
+// in sizeof. Operands with type syntax ([]T, [N]T, *T, tuples of types and
+// primitive type names) become types. A bare identifier stays an expression;
+// the checker treats it as a type when a type of that name is declared.
+func (p *Parser) parseTypeOrExpression() (*ast.TypeExpression, ast.Expression) {
+	switch {
+	case p.isTypeToken(p.curToken.Type), p.curTokenIs(lexer.ASTERISK), p.curTokenIs(lexer.LBRACE):
+		return p.parseTypeExpression(), nil
+	case p.curTokenIs(lexer.LBRACKET) && p.peekTokenIs(lexer.RBRACKET):
+		return p.parseTypeExpression(), nil
+	case p.curTokenIs(lexer.LPAREN) && (p.isTypeToken(p.peekToken.Type) ||
+		p.peekTokenIs(lexer.LBRACKET) || p.peekTokenIs(lexer.ASTERISK)):
+		return p.parseTypeExpression(), nil
+	}
+
+	expr := p.parseExpression(LOWEST)
+
+	// [N]T and [N][M]T first parse as the array literal [N], possibly
+	// indexed; the element type that follows tells them apart
+	lengths := arrayLengths(expr)
+	if lengths == nil || !(p.isTypeToken(p.peekToken.Type) || p.peekTokenIs(lexer.IDENT) ||
+		p.peekTokenIs(lexer.LBRACKET) || p.peekTokenIs(lexer.ASTERISK) || p.peekTokenIs(lexer.LPAREN)) {
+		return nil, expr
+	}
+
+	p.nextToken()
+	elem := p.parseTypeExpression()
+	if elem == nil {
+		return nil, nil
+	}
+	for i := len(lengths) - 1; i >= 0; i-- {
+		elem = &ast.TypeExpression{
+			Token:       elem.Token,
+			Name:        elem.String(),
+			Array:       true,
+			Length:      lengths[i],
+			ElementType: elem,
+		}
+	}
+	return elem, nil
+}
+
+// arrayLengths returns the lengths of [N] or [N][M]... parsed as an
+// expression, or nil if expr has another shape
+func arrayLengths(expr ast.Expression) []ast.Expression {
+	switch e := expr.(type) {
+	case *ast.ArrayLiteral:
+		if len(e.Elements) == 1 {
+			return []ast.Expression{e.Elements[0]}
+		}
+	case *ast.IndexExpression:
+		if outer := arrayLengths(e.Left); outer != nil {
+			return append(outer, e.Index)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Package project reads the sango.toml manifest of a multi-file project and
+// lays out new projects.
+//
+// A manifest names the package and says where its sources are and how they
+// are compiled and linked:
+//
+//	[package]
+//	name = "hello"
+//	version = "0.1.0"
+//	entry = "src/main.sango"   # the module that defines main
+//
+//	[build]
+//	sources = ["src"]          # directories searched for .sango files
+//	include = ["include"]      # C include paths
+//	libs = ["m"]               # libraries to link
+//	cflags = ["-O2", "-Wall"]  # flags passed to the C compiler
+//	ldflags = []               # flags passed to the linker
+//	cc = "gcc"                 # the C compiler, cc by default
+//
+// Paths are relative to the directory of the manifest.
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestName is the file name of a project manifest
+const ManifestName = "sango.toml"
+
+// BuildDir is the directory, relative to the manifest, that builds write to
+const BuildDir = "build"
+
+// Manifest is a parsed sango.toml
+type Manifest struct {
+	Dir     string // directory holding the manifest
+	Name    string
+	Version string
+	Entry   string // path of the entry module, relative to Dir
+
+	Sources []string // source directories, relative to Dir
+	Include []string // C include paths, relative to Dir
+	Libs    []string // libraries to link, as given to -l
+	CFlags  []string
+	LDFlags []string
+	CC      string
+}
+
+// fields lists the keys of each manifest table and where their values go
+func (m *Manifest) fields() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"package": {"name": &m.Name, "version": &m.Version, "entry": &m.Entry},
+		"build": {
+			"sources": &m.Sources, "include": &m.Include, "libs": &m.Libs,
+			"cflags": &m.CFlags, "ldflags": &m.LDFlags, "cc": &m.CC,
+		},
+	}
+}
+
+// Parse parses the text of a manifest in dir. Unknown tables and keys are
+// errors, so that misspellings are not ignored.
+func Parse(data []byte, dir string) (*Manifest, error) {
+	t, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ManifestName, err)
+	}
+
+	m := &Manifest{
+		Dir:     dir,
+		Entry:   "src/main.sango",
+		Sources: []string{"src"},
+		Include: []string{},
+		Libs:    []string{},
+		CFlags:  []string{},
+		LDFlags: []string{},
+		CC:      "cc",
+	}
+	fields := m.fields()
+	for name, values := range t {
+		if name == "" {
+			for key, v := range values {
+				return nil, fmt.Errorf("%s: key %s is not in a table at line %d", ManifestName, key, v.line)
+			}
+			continue
+		}
+		table, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown table [%s]", ManifestName, name)
+		}
+		for key, v := range values {
+			field, ok := table[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown key %s in [%s] at line %d", ManifestName, key, name, v.line)
+			}
+			if !assign(field, v.v) {
+				return nil, fmt.Errorf("%s: %s.%s must be %s at line %d", ManifestName, name, key, kind(field), v.line)
+			}
+		}
+	}
+
+	if m.Name == "" {
+		return nil, fmt.Errorf("%s: missing package name", ManifestName)
+	}
+	if !isBareKey(m.Name) {
+		return nil, fmt.Errorf("%s: invalid package name %q, use letters, digits, '-' and '_'", ManifestName, m.Name)
+	}
+	return m, nil
+}
+
+func assign(field, v interface{}) bool {
+	switch f := field.(type) {
+	case *string:
+		s, ok := v.(string)
+		*f = s
+		return ok
+	case *[]string:
+		list, ok := v.([]string)
+		*f = list
+		return ok
+	}
+	return false
+}
+
+func kind(field interface{}) string {
+	if _, ok := field.(*string); ok {
+		return "a string"
+	}
+	return "an array of strings"
+}
+
+// Load reads the manifest in dir
+func Load(dir string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no %s in %s", ManifestName, dir)
+		}
+		return nil, err
+	}
+	return Parse(data, dir)
+}
+
+// Find returns the directory of the manifest of the project holding dir:
+// dir itself or the nearest parent with a sango.toml
+func Find(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ManifestName)); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no %s in %s or any parent directory", ManifestName, dir)
+		}
+	}
+}
+
+// Path returns a path of the manifest, which is relative to its directory,
+// as a path relative to the working directory
+func (m *Manifest) Path(rel string) string {
+	if filepath.IsAbs(rel) {
+		return rel
+	}
+	return filepath.Join(m.Dir, rel)
+}
+
+// EntryPath returns the path of the entry module
+func (m *Manifest) EntryPath() string {
+	return filepath.Clean(m.Path(m.Entry))
+}
+
+// Modules returns the .sango files in the source directories and their
+// subdirectories, sorted by path. The entry module must be one of them.
+func (m *Manifest) Modules() ([]string, error) {
+	seen := map[string]bool{}
+	modules := []string{}
+	for _, src := range m.Sources {
+		root := m.Path(src)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("source directory %s does not exist", src)
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && filepath.Ext(path) == ".sango" && !seen[path] {
+				seen[path] = true
+				modules = append(modules, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(modules)
+
+	if !seen[m.EntryPath()] {
+		return nil, fmt.Errorf("entry %s is not in the source directories %s", m.Entry, strings.Join(m.Sources, ", "))
+	}
+	return modules, nil
+}
@@ -0,0 +1,59 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// layout lists the directories of a new project, as make init lays out the
+// compiler's own: sources, C headers, tests, examples and documentation
+var layout = []string{"src", "include", "tests", "examples", "docs"}
+
+// New creates a project named name in the directory dir, which must not
+// exist or be empty, with a manifest, a hello world entry module and a
+// .gitignore for the build directory. It returns the manifest.
+func New(dir, name string) (*Manifest, error) {
+	if !isBareKey(name) {
+		return nil, fmt.Errorf("invalid project name %q, use letters, digits, '-' and '_'", name)
+	}
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("directory %s is not empty", dir)
+	}
+
+	for _, sub := range layout {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	files := []struct{ path, text string }{
+		{ManifestName, fmt.Sprintf(`[package]
+name = %q
+version = "0.1.0"
+entry = "src/main.sango"
+
+[build]
+sources = ["src"]
+include = ["include"]
+libs = []
+cflags = ["-O2", "-Wall", "-std=c11"]
+ldflags = []
+`, name)},
+		{"src/main.sango", `include "stdio.h"
+
+/// Prints a greeting.
+def main() = {
+  printf("Hello, ` + name + `!\n")
+}
+`},
+		{".gitignore", BuildDir + "/\n"},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.path), []byte(f.text), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return Load(dir)
+}
@@ -0,0 +1,137 @@
+package project
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `# A project
+[package]
+name = "demo"      # the executable's name
+version = '1.2.0'
+entry = "src/app.sango"
+
+[build]
+sources = ["src", "lib"]
+include = [
+  "include",       # our headers
+  "/opt/c # not a comment",
+]
+libs = ["m", "pthread"]
+cflags = ["-O2", "-DNAME=\"x\""]
+ldflags = []
+cc = "clang"
+`
+	m, err := Parse([]byte(input), "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Manifest{
+		Dir:     "proj",
+		Name:    "demo",
+		Version: "1.2.0",
+		Entry:   "src/app.sango",
+		Sources: []string{"src", "lib"},
+		Include: []string{"include", "/opt/c # not a comment"},
+		Libs:    []string{"m", "pthread"},
+		CFlags:  []string{"-O2", `-DNAME="x"`},
+		LDFlags: []string{},
+		CC:      "clang",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("expected %+v, got %+v", want, m)
+	}
+	if got := m.Path("include"); got != filepath.Join("proj", "include") {
+		t.Errorf("Path - got %s", got)
+	}
+	if got := m.Path("/opt/c"); got != "/opt/c" {
+		t.Errorf("Path of an absolute path - got %s", got)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	m, err := Parse([]byte("[package]\nname = \"demo\"\n"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Entry != "src/main.sango" || !reflect.DeepEqual(m.Sources, []string{"src"}) || m.CC != "cc" {
+		t.Errorf("unexpected defaults %+v", m)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"[package]\nversion = \"1\"", "missing package name"},
+		{"[package]\nname = \"a b\"", `invalid package name "a b"`},
+		{"name = \"a\"", "key name is not in a table at line 1"},
+		{"[pkg]\nname = \"a\"", "unknown table [pkg]"},
+		{"[package]\nname = \"a\"\nauthor = \"me\"", "unknown key author in [package] at line 3"},
+		{"[package]\nname = [\"a\"]", "package.name must be a string at line 2"},
+		{"[package]\nname = \"a\"\n[build]\nlibs = \"m\"", "build.libs must be an array of strings at line 4"},
+		{"[package]\nname = \"a\"\nname = \"b\"", "key name defined twice at line 3"},
+		{"[package]\nname = \"a", "unterminated string at line 2"},
+		{"[package]\nname = \"a\"\n[build]\nlibs = [\"m\" \"c\"]", "expected , or ] in array at line 4"},
+		{"[package]\nname = \"a\"\n[build]\nlibs = [1]", "arrays may only hold strings at line 4"},
+		{"[package]\nname", "expected key = value at line 2"},
+		{"[package\nname = \"a\"", "invalid table header [package at line 1"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.input), ".")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q - expected error %q, got %v", tt.input, tt.err, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hello")
+	m, err := New(dir, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "hello" || m.Dir != dir {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+
+	modules, err := m.Modules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "src", "main.sango")}; !reflect.DeepEqual(modules, want) {
+		t.Errorf("Modules - expected %v, got %v", want, modules)
+	}
+
+	found, err := Find(filepath.Join(dir, "src"))
+	if err != nil || found != dir {
+		t.Errorf("Find - expected %s, got %s (%v)", dir, found, err)
+	}
+
+	if _, err := New(dir, "hello"); err == nil || !strings.Contains(err.Error(), "is not empty") {
+		t.Errorf("expected an error for a directory that is not empty, got %v", err)
+	}
+	if _, err := New(t.TempDir(), "no good"); err == nil {
+		t.Errorf("expected an error for an invalid name")
+	}
+}
+
+func TestModulesEntry(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "app")
+	m, err := New(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Entry = "src/other.sango"
+	if _, err := m.Modules(); err == nil || !strings.Contains(err.Error(), "entry src/other.sango is not in the source directories src") {
+		t.Errorf("expected a missing entry error, got %v", err)
+	}
+	m.Sources = []string{"lib"}
+	if _, err := m.Modules(); err == nil || !strings.Contains(err.Error(), "source directory lib does not exist") {
+		t.Errorf("expected a missing source directory error, got %v", err)
+	}
+}
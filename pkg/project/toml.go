@@ -0,0 +1,208 @@
+package project
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// table is a parsed TOML file: values by table name, then key. Keys before
+// the first [table] header are in the table "".
+type table map[string]map[string]value
+
+// value is a TOML value: a string, a bool, an int64 or a []string
+type value struct {
+	v    interface{}
+	line int
+}
+
+// parseTOML parses the subset of TOML that manifests use: [table] headers,
+// and key = value lines whose values are basic or literal strings, booleans,
+// integers or arrays of strings, which may span lines
+func parseTOML(data string) (table, error) {
+	t := table{"": {}}
+	current := ""
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("invalid table header %s at line %d", line, lineNo)
+			}
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			if !isBareKey(current) {
+				return nil, fmt.Errorf("invalid table name %q at line %d", current, lineNo)
+			}
+			if _, ok := t[current]; ok && current != "" {
+				return nil, fmt.Errorf("table [%s] defined twice at line %d", current, lineNo)
+			}
+			t[current] = map[string]value{}
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("expected key = value at line %d", lineNo)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !isBareKey(key) {
+			return nil, fmt.Errorf("invalid key %q at line %d", key, lineNo)
+		}
+		if _, ok := t[current][key]; ok {
+			return nil, fmt.Errorf("key %s defined twice at line %d", key, lineNo)
+		}
+
+		text := strings.TrimSpace(line[eq+1:])
+		// An array continues until its closing bracket
+		for strings.HasPrefix(text, "[") && !closed(text) && i+1 < len(lines) {
+			i++
+			text += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		v, err := parseValue(text)
+		if err != nil {
+			return nil, fmt.Errorf("%v at line %d", err, lineNo)
+		}
+		t[current][key] = value{v: v, line: lineNo}
+	}
+	return t, nil
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r == '-' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripComment removes a # comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// closed reports whether the brackets outside strings in s are balanced
+func closed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+func parseValue(text string) (interface{}, error) {
+	switch {
+	case text == "":
+		return nil, fmt.Errorf("missing value")
+	case text == "true" || text == "false":
+		return text == "true", nil
+	case text[0] == '"' || text[0] == '\'':
+		s, rest, err := parseString(text)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %s after string", strings.TrimSpace(rest))
+		}
+		return s, nil
+	case text[0] == '[':
+		return parseArray(text)
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(text, "_", ""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s", text)
+	}
+	return n, nil
+}
+
+// parseString parses the string at the start of text and returns it with
+// the text after it
+func parseString(text string) (string, string, error) {
+	if text[0] == '\'' {
+		end := strings.IndexByte(text[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return text[1 : end+1], text[end+2:], nil
+	}
+
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(text[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", text[:i+1])
+			}
+			return s, text[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func parseArray(text string) ([]string, error) {
+	list := []string{}
+	rest := strings.TrimSpace(text[1:])
+	for {
+		if strings.HasPrefix(rest, "]") {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return nil, fmt.Errorf("unexpected %s after array", strings.TrimSpace(rest[1:]))
+			}
+			return list, nil
+		}
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return nil, fmt.Errorf("arrays may only hold strings")
+		}
+		s, after, err := parseString(rest)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+		rest = strings.TrimSpace(after)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
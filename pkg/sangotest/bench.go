@@ -0,0 +1,346 @@
+package sangotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/codegen"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// DefaultBenchTime is how long each round of a benchmark runs for when
+// BenchOptions do not say
+const DefaultBenchTime = time.Second
+
+// DefaultRounds is how many rounds each benchmark is run for when
+// BenchOptions do not say
+const DefaultRounds = 5
+
+// maxIterations bounds the iterations of a benchmark
+const maxIterations = 1000000000
+
+// BenchOptions control how benchmarks are run
+type BenchOptions struct {
+	Run     *regexp.Regexp // run only the benchmarks whose names match; all if nil
+	Time    time.Duration  // how long to run each round for; DefaultBenchTime if 0
+	Rounds  int            // DefaultRounds if 0
+	CC      string         // C compiler; "cc" if empty
+	Runtime string         // directory of sango.h and sango.c
+	Timeout time.Duration  // how long a round may run past Time; DefaultTimeout if 0
+}
+
+// BenchResult is the outcome of a benchmark: rounds of the same number of
+// iterations
+type BenchResult struct {
+	Name   string
+	Line   int // of the bench declaration
+	Column int
+	N      int             // iterations of each round
+	Rounds []time.Duration // of the N iterations
+	Allocs int             // blocks allocated in the N iterations of a round
+	Err    error           // nil unless the benchmark failed
+}
+
+// NsPerOp returns the time of an iteration in nanoseconds, in the median
+// round
+func (r BenchResult) NsPerOp() float64 {
+	if r.N == 0 || len(r.Rounds) == 0 {
+		return 0
+	}
+	rounds := append([]time.Duration{}, r.Rounds...)
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+	median := float64(rounds[len(rounds)/2].Nanoseconds())
+	if len(rounds)%2 == 0 {
+		median = (median + float64(rounds[len(rounds)/2-1].Nanoseconds())) / 2
+	}
+	return median / float64(r.N)
+}
+
+// MinNsPerOp returns the time of an iteration in nanoseconds, in the
+// fastest round
+func (r BenchResult) MinNsPerOp() float64 {
+	if r.N == 0 || len(r.Rounds) == 0 {
+		return 0
+	}
+	min := r.Rounds[0]
+	for _, d := range r.Rounds[1:] {
+		if d < min {
+			min = d
+		}
+	}
+	return float64(min.Nanoseconds()) / float64(r.N)
+}
+
+// AllocsPerOp returns the allocations of an iteration
+func (r BenchResult) AllocsPerOp() float64 {
+	if r.N == 0 {
+		return 0
+	}
+	return float64(r.Allocs) / float64(r.N)
+}
+
+// Benchmarks returns the bench declarations of a program in source order,
+// and an error for each name declared twice
+func Benchmarks(program *ast.Program) ([]*ast.BenchStatement, []string) {
+	benches := []*ast.BenchStatement{}
+	errors := []string{}
+	seen := map[string]bool{}
+	for _, stmt := range program.Statements {
+		bench, ok := stmt.(*ast.BenchStatement)
+		if !ok {
+			continue
+		}
+		if seen[bench.Name] {
+			errors = append(errors, fmt.Sprintf("bench %q is declared twice at line %d:%d", bench.Name, bench.Token.Line, bench.Token.Column))
+			continue
+		}
+		seen[bench.Name] = true
+		benches = append(benches, bench)
+	}
+	return benches, errors
+}
+
+// Bench compiles the benchmarks of an analyzed program and runs them. It
+// returns an error if the runtime cannot be compiled.
+func Bench(program *ast.Program, benches []*ast.BenchStatement, opts BenchOptions) ([]BenchResult, error) {
+	if opts.Time <= 0 {
+		opts.Time = DefaultBenchTime
+	}
+	if opts.Rounds <= 0 {
+		opts.Rounds = DefaultRounds
+	}
+	if opts.CC == "" {
+		opts.CC = "cc"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	results := []BenchResult{}
+	selected := []*ast.BenchStatement{}
+	for _, bench := range benches {
+		if opts.Run == nil || opts.Run.MatchString(bench.Name) {
+			selected = append(selected, bench)
+		}
+	}
+	if len(selected) == 0 {
+		return results, nil
+	}
+
+	c, err := newCompiler(opts.CC, opts.Runtime, "-O2")
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	ev := semantic.NewEvaluator()
+	ev.EvaluateProgram(program)
+	r := &runner{program: program, compiler: c, gen: codegen.New(ev.Layouts()), codec: codec{ev: ev}}
+	for i, bench := range selected {
+		results = append(results, r.bench(fmt.Sprintf("bench%d", i), bench, opts))
+	}
+	return results, nil
+}
+
+// bench compiles a benchmark with optimizations and runs it in a process of
+// its own. It runs a growing number of iterations until a round takes at
+// least opts.Time, then more rounds of as many iterations until it has
+// opts.Rounds of them.
+func (r *runner) bench(name string, bench *ast.BenchStatement, opts BenchOptions) BenchResult {
+	result := BenchResult{Name: bench.Name, Line: bench.Token.Line, Column: bench.Token.Column}
+	exe, errs := r.gen.Bench(r.program, bench)
+	if len(errs) > 0 {
+		result.Err = errors.New(strings.Join(errs, "; "))
+		return result
+	}
+	path, err := r.compiler.build(name, exe, "-O2")
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	proc, err := start(path, nil, true)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	n := 1
+	for {
+		elapsed, allocs, err := r.round(proc, exe, n, opts.Time+opts.Timeout)
+		if err != nil {
+			var assert *semantic.AssertionError
+			if !errors.As(err, &assert) {
+				err = fmt.Errorf("%v at line %d:%d", err, bench.Token.Line, bench.Token.Column)
+			}
+			result.Err = err
+			return result
+		}
+		if len(result.Rounds) == 0 && elapsed < opts.Time && n < maxIterations {
+			n = iterations(n, elapsed, opts.Time)
+			continue
+		}
+		if len(result.Rounds) == 0 || allocs < result.Allocs {
+			result.Allocs = allocs
+		}
+		result.N = n
+		result.Rounds = append(result.Rounds, elapsed)
+		if len(result.Rounds) == opts.Rounds {
+			break
+		}
+	}
+	proc.wait(false)
+	return result
+}
+
+// round runs n iterations of a benchmark, returning how long they took and
+// how many blocks they allocated
+func (r *runner) round(proc *process, exe *codegen.Executable, n int, timeout time.Duration) (time.Duration, int, error) {
+	if _, err := fmt.Fprintf(proc.stdin, "%d\n", n); err != nil {
+		return 0, 0, proc.exited("bench", proc.wait(false))
+	}
+	line, err := proc.line(timeout)
+	if errors.Is(err, errTimeout) {
+		proc.wait(true)
+		return 0, 0, fmt.Errorf("bench %w after %s", errTimeout, timeout)
+	}
+	if err != nil {
+		return 0, 0, proc.exited("bench", proc.wait(false))
+	}
+	if strings.HasPrefix(line, "assert ") {
+		assert, err := r.codec.report(line, proc.reader, exe)
+		proc.wait(false)
+		if err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, assert
+	}
+	var ns int64
+	var allocs int
+	if _, err := fmt.Sscanf(line, "%d %d", &ns, &allocs); err != nil {
+		proc.wait(true)
+		return 0, 0, fmt.Errorf("malformed report %q", line)
+	}
+	return time.Duration(ns), allocs, nil
+}
+
+// iterations returns how many iterations to run after n took elapsed,
+// aiming a fifth past benchtime, but growing at most a hundredfold
+func iterations(n int, elapsed, benchtime time.Duration) int {
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	next := int64(float64(n) * 1.2 * float64(benchtime) / float64(elapsed))
+	if next > 100*int64(n) {
+		next = 100 * int64(n)
+	}
+	if next <= int64(n) {
+		next = int64(n) + 1
+	}
+	if next > maxIterations {
+		next = maxIterations
+	}
+	return int(next)
+}
+
+// Baseline holds earlier benchmark results to compare new ones with, by
+// file and benchmark name. It is saved as JSON.
+type Baseline map[string]map[string]Measurement
+
+// Measurement is the cost of an iteration of a benchmark
+type Measurement struct {
+	NsPerOp     float64 `json:"ns_per_op"` // in the median round
+	MinNsPerOp  float64 `json:"min_ns_per_op"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+}
+
+// LoadBaseline reads a baseline file; one that does not exist is empty
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Baseline{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := Baseline{}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return b, nil
+}
+
+// Save writes the baseline to a file
+func (b Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Add records the results of the benchmarks of a file that did not fail,
+// replacing earlier ones of the same names
+func (b Baseline) Add(file string, results []BenchResult) {
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if b[file] == nil {
+			b[file] = map[string]Measurement{}
+		}
+		b[file][r.Name] = Measurement{NsPerOp: r.NsPerOp(), MinNsPerOp: r.MinNsPerOp(), AllocsPerOp: r.AllocsPerOp()}
+	}
+}
+
+// Change is how a benchmark changed from its baseline, in percent: +10 is
+// ten percent slower or allocating ten percent more
+type Change struct {
+	Time    float64 // of the median round
+	MinTime float64 // of the fastest round
+	Allocs  float64
+}
+
+// Compare returns how a result changed from the baseline, and false if the
+// baseline has no result for it
+func (b Baseline) Compare(file string, r BenchResult) (Change, bool) {
+	old, ok := b[file][r.Name]
+	if !ok || r.Err != nil {
+		return Change{}, false
+	}
+	// Baselines saved with a single round have no fastest round
+	if old.MinNsPerOp == 0 {
+		old.MinNsPerOp = old.NsPerOp
+	}
+	return Change{
+		Time:    percent(old.NsPerOp, r.NsPerOp()),
+		MinTime: percent(old.MinNsPerOp, r.MinNsPerOp()),
+		Allocs:  percent(old.AllocsPerOp, r.AllocsPerOp()),
+	}, true
+}
+
+// Regressed reports whether the time or the allocations grew by more than
+// threshold percent. The time has only grown if the median and the fastest
+// round both did, so a round slowed down by something else running on the
+// machine is not taken for a regression.
+func (c Change) Regressed(threshold float64) bool {
+	return c.Time > threshold && c.MinTime > threshold || c.Allocs > threshold
+}
+
+// percent returns the change from old to new in percent, which is infinite
+// for growth from zero
+func percent(old, new float64) float64 {
+	if old == 0 {
+		if new == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (new - old) / old * 100
+}
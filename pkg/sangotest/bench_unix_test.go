@@ -0,0 +1,51 @@
+//go:build unix
+
+package sangotest
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/driver"
+)
+
+func TestBenchFreesAllocations(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	if testing.Short() {
+		t.Skip("runs for the default bench time")
+	}
+	unit, errors := driver.AnalyzeTests("bench \"alloc\" {\n  val a = [1, 2, 3]\n}\n")
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	benches, _ := Benchmarks(unit.Program)
+	results, err := Bench(unit.Program, benches, BenchOptions{Runtime: filepath.Join("..", "..", "runtime")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil || len(results[0].Rounds) != DefaultRounds {
+		t.Fatalf("expected alloc to run %d rounds, got %v", DefaultRounds, results)
+	}
+	// An array and its elements
+	if results[0].AllocsPerOp() != 2 {
+		t.Errorf("expected 2 allocs/op, got %g", results[0].AllocsPerOp())
+	}
+
+	// Without freeing, the default rounds allocate gigabytes
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &usage); err != nil {
+		t.Fatal(err)
+	}
+	rss := int64(usage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		rss *= 1024
+	}
+	if rss > 512<<20 {
+		t.Errorf("expected the bench to stay under 512MB, it used %dMB", rss>>20)
+	}
+}
@@ -0,0 +1,463 @@
+package sangotest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/codegen"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// DefaultChecks is the number of arguments check tries a property with
+// when neither the call nor Options say
+const DefaultChecks = 100
+
+const (
+	maxSize    = 100  // largest magnitude of numbers and length of arrays
+	maxShrinks = 1000 // calls of a property spent shrinking a counterexample
+)
+
+// CheckError is a property that check found a counterexample to. Args are
+// the arguments after shrinking, and Err is how the property failed with
+// them: an assertion error, a crash, a timeout, or errFalse.
+type CheckError struct {
+	Seed    int64
+	Tries   int // arguments tried, the failing ones included
+	Shrinks int // times the counterexample was made smaller
+	Names   []string
+	Args    []semantic.Value
+	Err     error
+	Line    int // of the call of check
+	Column  int
+}
+
+// Position returns the position of the call of check
+func (e *CheckError) Position() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *CheckError) Error() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = fmt.Sprintf("%s = %s", e.Names[i], arg)
+	}
+	return fmt.Sprintf("check failed for %s (seed %d): %v at line %d:%d", strings.Join(args, ", "), e.Seed, e.Err, e.Line, e.Column)
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// errFalse is the failure of a property that returned false
+var errFalse = errors.New("property returned false")
+
+// checker runs the properties of the checks of a test.
+//
+// check is built into the test runner rather than written in Sango: to
+// generate and shrink arguments it needs the types of the parameters of the
+// property, and Sango has neither generics nor reflection to get at them.
+type checker struct {
+	gen    *generator
+	seed   int64
+	checks int
+}
+
+// check runs the property of a call of check(property) or check(property,
+// n). The property is a function literal whose parameters all have types;
+// check calls it with n arguments generated from those types, or
+// DefaultChecks of them, starting small and growing. The property fails if
+// it returns false, fails an assert, crashes or times out. check then
+// shrinks the arguments while the property keeps failing, and returns the
+// smallest it found, or nil if the property held.
+//
+// Every call of check generates the same arguments for the same seed, so a
+// counterexample can be reproduced by running with its seed again.
+func (c *checker) check(p *property, call *codegen.Check) (*CheckError, error) {
+	checks := c.checks
+	if call.Count > 0 {
+		checks = int(call.Count)
+	}
+	names := []string{}
+	types := []*ast.TypeExpression{}
+	for _, param := range call.Property.Parameters {
+		names = append(names, param.Name.Value)
+		types = append(types, param.Type)
+	}
+
+	c.gen.rand = rand.New(rand.NewSource(c.seed))
+	for try := 0; try < checks; try++ {
+		size := 1 + try*maxSize/checks
+		values := make([]semantic.Value, len(types))
+		for i, te := range types {
+			v, err := c.gen.generate(te, size)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+
+		failure, err := p.holds(values, types)
+		if err != nil {
+			return nil, err
+		}
+		if failure == nil {
+			continue
+		}
+
+		line, column := position(call.Call)
+		e := &CheckError{Seed: c.seed, Tries: try + 1, Names: names, Args: values, Err: failure, Line: line, Column: column}
+		if !errors.Is(failure, errTimeout) {
+			if err := c.shrink(p, types, e); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	}
+	return nil, nil
+}
+
+// position returns the position of the name of a called function
+func position(call *ast.CallExpression) (int, int) {
+	if id, ok := call.Function.(*ast.Identifier); ok {
+		return id.Token.Line, id.Token.Column
+	}
+	return call.Token.Line, call.Token.Column
+}
+
+// shrink replaces the arguments of a counterexample by smaller ones as long
+// as the property still fails with them. It takes the first smaller
+// argument that fails and starts over, until no argument can be shrunk or
+// it has tried maxShrinks of them. Arguments for which the property times
+// out are not taken, since they may only be slower.
+func (c *checker) shrink(p *property, types []*ast.TypeExpression, e *CheckError) error {
+	attempts := 0
+	for attempts < maxShrinks {
+		shrunk := false
+		for i := 0; i < len(e.Args) && !shrunk && attempts < maxShrinks; i++ {
+			for _, candidate := range c.gen.shrink(e.Args[i], types[i]) {
+				if attempts++; attempts > maxShrinks {
+					break
+				}
+				args := append([]semantic.Value{}, e.Args...)
+				args[i] = candidate
+				failure, err := p.holds(args, types)
+				if err != nil {
+					return err
+				}
+				if failure == nil || errors.Is(failure, errTimeout) {
+					continue
+				}
+				e.Args, e.Err = args, failure
+				e.Shrinks++
+				shrunk = true
+				break
+			}
+		}
+		if !shrunk {
+			return nil
+		}
+	}
+	return nil
+}
+
+// generator makes random values of the types of a program
+type generator struct {
+	ev   *semantic.Evaluator
+	rand *rand.Rand
+}
+
+// generate returns a random value of a type. size bounds the magnitude of
+// numbers and the length of arrays and strings, though edge cases such as
+// the largest value of an integer type are generated at any size.
+func (g *generator) generate(te *ast.TypeExpression, size int) (semantic.Value, error) {
+	switch {
+	case te.Pointer, te.Function != nil, te.Record != nil:
+		return semantic.Value{}, fmt.Errorf("check cannot generate values of type %s", te)
+	case len(te.Tuple) > 0:
+		elems := make([]semantic.Value, len(te.Tuple))
+		for i := range te.Tuple {
+			elem, err := g.generate(&te.Tuple[i], size)
+			if err != nil {
+				return semantic.Value{}, err
+			}
+			elems[i] = elem
+		}
+		return semantic.TupleValue(elems), nil
+	case te.Array:
+		n := g.rand.Intn(size + 1)
+		if te.Length != nil {
+			length, err := g.ev.Eval(te.Length)
+			if err != nil || length.Kind != semantic.IntConst || !length.Int.IsInt64() {
+				return semantic.Value{}, fmt.Errorf("check cannot generate values of type %s", te)
+			}
+			n = int(length.Int.Int64())
+		}
+		elems := make([]semantic.Value, n)
+		for i := range elems {
+			elem, err := g.generate(te.ElementType, size)
+			if err != nil {
+				return semantic.Value{}, err
+			}
+			elems[i] = elem
+		}
+		return semantic.Value{Kind: semantic.ArrayConst, Type: te.String(), Elems: elems}, nil
+	}
+
+	if it, ok := semantic.LookupIntType(te.Name); ok {
+		return semantic.Convert(semantic.Value{Kind: semantic.IntConst, Int: g.integer(it, size)}, te.Name)
+	}
+	if semantic.IsFloatType(te.Name) {
+		return semantic.Convert(semantic.FloatValue(g.float(te.Name, size)), te.Name)
+	}
+	switch te.Name {
+	case "bool":
+		return semantic.BoolValue(g.rand.Intn(2) == 0), nil
+	case "char":
+		return semantic.Convert(semantic.IntValue(int64(g.char())), "char")
+	case "string":
+		s := make([]byte, g.rand.Intn(size+1))
+		for i := range s {
+			s[i] = g.char()
+		}
+		return semantic.StringValue(string(s)), nil
+	}
+	if decl, ok := g.ev.Struct(te.Name); ok {
+		v := semantic.Value{Kind: semantic.StructConst, Type: decl.Name.Value}
+		for _, f := range decl.Fields {
+			field, err := g.generate(f.Type, size)
+			if err != nil {
+				return semantic.Value{}, err
+			}
+			v.Fields = append(v.Fields, f.Name.Value)
+			v.Elems = append(v.Elems, field)
+		}
+		return v, nil
+	}
+	if alias, ok := g.ev.Alias(te.Name); ok {
+		return g.generate(alias, size)
+	}
+	return semantic.Value{}, fmt.Errorf("check cannot generate values of type %s", te)
+}
+
+// integer returns a random integer of a type: mostly one within size of
+// zero, sometimes an edge case of the type or any value of it
+func (g *generator) integer(it semantic.IntType, size int) *big.Int {
+	switch g.rand.Intn(10) {
+	case 0:
+		edges := []*big.Int{big.NewInt(0), big.NewInt(1), it.Max(), new(big.Int).Sub(it.Max(), big.NewInt(1))}
+		if it.Signed {
+			edges = append(edges, big.NewInt(-1), it.Min(), new(big.Int).Add(it.Min(), big.NewInt(1)))
+		}
+		return edges[g.rand.Intn(len(edges))]
+	case 1:
+		span := new(big.Int).Sub(it.Max(), it.Min())
+		n := new(big.Int).Rand(g.rand, span.Add(span, big.NewInt(1)))
+		return n.Add(n, it.Min())
+	}
+	n := big.NewInt(g.rand.Int63n(int64(size) + 1))
+	if it.Signed && g.rand.Intn(2) == 0 {
+		n.Neg(n)
+	}
+	if !it.Fits(n) {
+		return it.Max()
+	}
+	return n
+}
+
+// float returns a random finite float: mostly one within size of zero,
+// sometimes an edge case
+func (g *generator) float(name string, size int) float64 {
+	single := name == "f32" || name == "float"
+	if g.rand.Intn(10) == 0 {
+		largest, smallest := math.MaxFloat64, math.SmallestNonzeroFloat64
+		if single {
+			largest, smallest = math.MaxFloat32, math.SmallestNonzeroFloat32
+		}
+		edges := []float64{0, 1, -1, 0.5, largest, -largest, smallest, -smallest}
+		return edges[g.rand.Intn(len(edges))]
+	}
+	f := (g.rand.Float64()*2 - 1) * float64(size)
+	if single {
+		f = float64(float32(f))
+	}
+	return f
+}
+
+// specialChars are the characters strings get now and then besides
+// printable ASCII, since they are the ones parsers tend to get wrong. NUL
+// is not one of them, since it ends a string in C.
+const specialChars = "\t\n\r \"'\\\x7f\xff"
+
+// char returns a random character, mostly printable ASCII
+func (g *generator) char() byte {
+	if g.rand.Intn(10) == 0 {
+		return specialChars[g.rand.Intn(len(specialChars))]
+	}
+	return byte(' ' + g.rand.Intn('~'-' '+1))
+}
+
+// shrink returns values of a type that are smaller than v, the smallest
+// first: numbers closer to zero, shorter arrays and strings, false, and
+// structs, tuples and arrays with a smaller element
+func (g *generator) shrink(v semantic.Value, te *ast.TypeExpression) []semantic.Value {
+	switch {
+	case te.Pointer, te.Function != nil, te.Record != nil:
+		return nil
+	case len(te.Tuple) > 0:
+		types := make([]*ast.TypeExpression, len(te.Tuple))
+		for i := range te.Tuple {
+			types[i] = &te.Tuple[i]
+		}
+		return g.shrinkElems(v, types)
+	case te.Array:
+		types := make([]*ast.TypeExpression, len(v.Elems))
+		for i := range types {
+			types[i] = te.ElementType
+		}
+		shrunk := []semantic.Value{}
+		if te.Length == nil {
+			for _, elems := range removals(len(v.Elems)) {
+				w := v
+				w.Elems = nil
+				for _, i := range elems {
+					w.Elems = append(w.Elems, v.Elems[i])
+				}
+				shrunk = append(shrunk, w)
+			}
+		}
+		return append(shrunk, g.shrinkElems(v, types)...)
+	}
+
+	switch v.Kind {
+	case semantic.IntConst:
+		return shrinkInt(v)
+	case semantic.FloatConst:
+		return shrinkFloat(v)
+	case semantic.BoolConst:
+		if v.Bool {
+			return []semantic.Value{semantic.BoolValue(false)}
+		}
+		return nil
+	case semantic.StringConst:
+		shrunk := []semantic.Value{}
+		for _, keep := range removals(len(v.Str)) {
+			s := make([]byte, len(keep))
+			for i, j := range keep {
+				s[i] = v.Str[j]
+			}
+			shrunk = append(shrunk, semantic.StringValue(string(s)))
+		}
+		for i := 0; i < len(v.Str); i++ {
+			if v.Str[i] != 'a' {
+				shrunk = append(shrunk, semantic.StringValue(v.Str[:i]+"a"+v.Str[i+1:]))
+			}
+		}
+		return shrunk
+	case semantic.StructConst:
+		decl, ok := g.ev.Struct(v.Type)
+		if !ok || len(decl.Fields) != len(v.Elems) {
+			return nil
+		}
+		types := make([]*ast.TypeExpression, len(decl.Fields))
+		for i, f := range decl.Fields {
+			types[i] = f.Type
+		}
+		return g.shrinkElems(v, types)
+	}
+	return nil
+}
+
+// shrinkElems returns copies of a struct, tuple or array with one element
+// shrunk
+func (g *generator) shrinkElems(v semantic.Value, types []*ast.TypeExpression) []semantic.Value {
+	shrunk := []semantic.Value{}
+	for i, elem := range v.Elems {
+		for _, smaller := range g.shrink(elem, types[i]) {
+			w := v
+			w.Elems = append([]semantic.Value{}, v.Elems...)
+			w.Elems[i] = smaller
+			shrunk = append(shrunk, w)
+		}
+	}
+	return shrunk
+}
+
+// removals lists the indexes to keep of a sequence of length n with parts
+// of it removed: all of it, either half, and each element in turn
+func removals(n int) [][]int {
+	if n == 0 {
+		return nil
+	}
+	keep := func(from, to, skip int) []int {
+		indexes := []int{}
+		for i := from; i < to; i++ {
+			if i != skip {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes
+	}
+	lists := [][]int{{}}
+	if n > 2 {
+		lists = append(lists, keep(0, n/2, -1), keep(n/2, n, -1))
+	}
+	if n > 1 {
+		for i := 0; i < n; i++ {
+			lists = append(lists, keep(0, n, i))
+		}
+	}
+	return lists
+}
+
+// shrinkInt returns integers closer to zero: zero, then ever closer to v
+// down to one closer, and the positive value of a negative one. Trying
+// them in order searches for the smallest failing integer by halving.
+func shrinkInt(v semantic.Value) []semantic.Value {
+	shrunk := []semantic.Value{}
+	if v.Int.Sign() < 0 {
+		if abs := new(big.Int).Neg(v.Int); fits(v.Type, abs) {
+			shrunk = append(shrunk, semantic.Value{Kind: v.Kind, Type: v.Type, Int: abs})
+		}
+	}
+	for delta := new(big.Int).Set(v.Int); delta.Sign() != 0; delta = new(big.Int).Quo(delta, big.NewInt(2)) {
+		n := new(big.Int).Sub(v.Int, delta)
+		shrunk = append(shrunk, semantic.Value{Kind: v.Kind, Type: v.Type, Int: n})
+	}
+	return shrunk
+}
+
+// fits reports whether n is a value of the integer type name, or of any
+// type if name is not one
+func fits(name string, n *big.Int) bool {
+	it, ok := semantic.LookupIntType(name)
+	return !ok || it.Fits(n)
+}
+
+// shrinkFloat returns floats closer to zero or with fewer digits: zero,
+// the integer part, half, and the positive value of a negative one
+func shrinkFloat(v semantic.Value) []semantic.Value {
+	if v.Float == 0 || math.IsNaN(v.Float) {
+		return nil
+	}
+	with := func(f float64) semantic.Value {
+		w := v
+		w.Float = f
+		return w
+	}
+	shrunk := []semantic.Value{with(0)}
+	if t := math.Trunc(v.Float); t != v.Float && t != 0 {
+		shrunk = append(shrunk, with(t))
+	}
+	if half := v.Float / 2; half != 0 && math.Abs(v.Float) > 1 {
+		shrunk = append(shrunk, with(half))
+	}
+	if v.Float < 0 {
+		shrunk = append(shrunk, with(-v.Float))
+	}
+	return shrunk
+}
@@ -0,0 +1,408 @@
+package sangotest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/codegen"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// cflags are the flags tests are compiled with. Signed overflow wraps, as
+// it does in Sango.
+var cflags = []string{"-std=gnu11", "-fwrapv", "-fno-strict-aliasing", "-w"}
+
+// compiler builds the executables of tests in a temporary directory, with
+// the runtime compiled once for all of them
+type compiler struct {
+	cc      string
+	runtime string // directory of sango.h and sango.c
+	dir     string
+	object  string // the compiled runtime
+}
+
+func newCompiler(cc, runtime string, optimize string) (*compiler, error) {
+	if _, err := os.Stat(filepath.Join(runtime, "sango.h")); err != nil {
+		return nil, fmt.Errorf("runtime not found: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "sangotest")
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{cc: cc, runtime: runtime, dir: dir, object: filepath.Join(dir, "sango.o")}
+	args := append(append([]string{}, cflags...), optimize, "-c", filepath.Join(runtime, "sango.c"), "-o", c.object)
+	if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+		c.close()
+		return nil, fmt.Errorf("compiling the runtime: %v\n%s", err, out)
+	}
+	return c, nil
+}
+
+func (c *compiler) close() {
+	os.RemoveAll(c.dir)
+}
+
+// build compiles an executable, returning its path
+func (c *compiler) build(name string, exe *codegen.Executable, optimize string) (string, error) {
+	source := filepath.Join(c.dir, name+".c")
+	if err := ioutil.WriteFile(source, []byte(exe.Source), 0644); err != nil {
+		return "", err
+	}
+	path := filepath.Join(c.dir, name)
+	args := append(append([]string{}, cflags...), optimize, "-I", c.runtime, source, c.object, "-o", path)
+	for _, lib := range exe.Libraries {
+		args = append(args, "-l"+lib)
+	}
+	if out, err := exec.Command(c.cc, args...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("compiling to C failed: %v\n%s", err, out)
+	}
+	return path, nil
+}
+
+// errTimeout is the failure of a run that took longer than the timeout
+var errTimeout = errors.New("timed out")
+
+// process is a running executable that reports on file descriptor 3
+type process struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	reports *os.File
+	reader  *bufio.Reader
+	output  bytes.Buffer // of stdout and stderr
+}
+
+// start runs an executable, with a pipe to its input if input is set
+func start(path string, args []string, input bool) (*process, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	p := &process{cmd: exec.Command(path, args...), reports: r, reader: bufio.NewReader(r)}
+	p.cmd.Stdout = &p.output
+	p.cmd.Stderr = &p.output
+	p.cmd.ExtraFiles = []*os.File{w}
+	if input {
+		if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+			r.Close()
+			w.Close()
+			return nil, err
+		}
+	}
+	err = p.cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// line reads the next line the process reports, waiting at most timeout
+func (p *process) line(timeout time.Duration) (string, error) {
+	p.reports.SetReadDeadline(time.Now().Add(timeout))
+	line, err := p.reader.ReadString('\n')
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return "", errTimeout
+	}
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+// wait ends the process, killing it if it still runs, and returns how it
+// exited: nil for status 0, errTimeout if it was killed
+func (p *process) wait(kill bool) error {
+	if p.stdin != nil {
+		p.stdin.Close()
+	}
+	if kill {
+		p.cmd.Process.Kill()
+	}
+	err := p.cmd.Wait()
+	p.reports.Close()
+	if kill {
+		return errTimeout
+	}
+	return err
+}
+
+// exited describes how a process that did not report ended: a crash names
+// the signal and the last line of the output, which is where the runtime
+// explains a panic
+func (p *process) exited(what string, err error) error {
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return fmt.Errorf("%s exited without reporting", what)
+	}
+	if exit.ExitCode() >= 0 {
+		return fmt.Errorf("%s exited with status %d", what, exit.ExitCode())
+	}
+	lines := strings.Split(strings.TrimSpace(p.output.String()), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		return fmt.Errorf("%s crashed (%s): %s", what, exit, last)
+	}
+	return fmt.Errorf("%s crashed (%s)", what, exit)
+}
+
+// property runs the property of a check in a process of its own, which is
+// started again after each failure that ends it
+type property struct {
+	path    string
+	id      int
+	exe     *codegen.Executable
+	codec   codec
+	timeout time.Duration
+	proc    *process
+}
+
+// holds calls the property with args, returning how it failed: errFalse, a
+// failed assert, a crash or errTimeout. err is set when it cannot be called.
+func (p *property) holds(args []semantic.Value, types []*ast.TypeExpression) (failure, err error) {
+	if p.proc == nil {
+		if p.proc, err = start(p.path, []string{"check", strconv.Itoa(p.id)}, true); err != nil {
+			return nil, err
+		}
+	}
+	var in bytes.Buffer
+	for i, arg := range args {
+		p.codec.encode(&in, arg, types[i])
+	}
+	in.WriteString("\n")
+	if _, err := p.proc.stdin.Write(in.Bytes()); err != nil {
+		return p.stop(err), nil
+	}
+
+	line, err := p.proc.line(p.timeout)
+	switch {
+	case err != nil:
+		return p.stop(err), nil
+	case line == "pass":
+		return nil, nil
+	case line == "fail":
+		return errFalse, nil
+	}
+	// A malformed report is an error of the check, not a counterexample
+	failed, err := p.codec.report(line, p.proc.reader, p.exe)
+	p.stop(nil)
+	if err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// stop ends the process of the property after it failed with err, which is
+// errTimeout or what reading its report failed with, and returns the failure
+func (p *property) stop(err error) error {
+	if p.proc == nil {
+		return nil
+	}
+	proc := p.proc
+	p.proc = nil
+	if errors.Is(err, errTimeout) {
+		proc.wait(true)
+		return fmt.Errorf("property %w after %s", errTimeout, p.timeout)
+	}
+	return proc.exited("property", proc.wait(false))
+}
+
+// codec encodes the arguments of properties and decodes the values that
+// executables report, in the format codegen.Executable describes
+type codec struct {
+	ev *semantic.Evaluator // of the program, for its structs and aliases
+}
+
+// resolve follows the aliases a type names
+func (c codec) resolve(te *ast.TypeExpression) *ast.TypeExpression {
+	for i := 0; i < 64 && te != nil && te.Name != "" && !te.Array && !te.Pointer; i++ {
+		alias, ok := c.ev.Alias(te.Name)
+		if !ok {
+			break
+		}
+		te = alias
+	}
+	return te
+}
+
+func (c codec) encode(b *bytes.Buffer, v semantic.Value, te *ast.TypeExpression) {
+	te = c.resolve(te)
+	switch v.Kind {
+	case semantic.IntConst:
+		fmt.Fprintf(b, "%s ", v.Int)
+	case semantic.FloatConst:
+		fmt.Fprintf(b, "%s ", strconv.FormatFloat(v.Float, 'x', -1, 64))
+	case semantic.BoolConst:
+		if v.Bool {
+			b.WriteString("1 ")
+		} else {
+			b.WriteString("0 ")
+		}
+	case semantic.StringConst:
+		fmt.Fprintf(b, "%d:%s ", len(v.Str), v.Str)
+	case semantic.ArrayConst, semantic.TupleConst, semantic.StructConst:
+		types := c.elementTypes(te, len(v.Elems))
+		if te.Array && te.Length == nil {
+			fmt.Fprintf(b, "%d ", len(v.Elems))
+		}
+		for i, elem := range v.Elems {
+			c.encode(b, elem, types[i])
+		}
+	}
+}
+
+// elementTypes returns the types of the n elements of a value of an array,
+// tuple or struct type
+func (c codec) elementTypes(te *ast.TypeExpression, n int) []*ast.TypeExpression {
+	types := make([]*ast.TypeExpression, n)
+	for i := range types {
+		switch {
+		case te.Array:
+			types[i] = te.ElementType
+		case i < len(te.Tuple):
+			types[i] = &te.Tuple[i]
+		}
+	}
+	if decl, ok := c.ev.Struct(te.Name); ok && !te.Array && len(te.Tuple) == 0 {
+		for i, f := range decl.Fields {
+			if i < n {
+				types[i] = f.Type
+			}
+		}
+	}
+	return types
+}
+
+// report decodes what an executable reports when an assert fails: the line
+// "assert <id>" and the values of its operands. It returns the failed
+// assert, or an error if the report is malformed.
+func (c codec) report(line string, r *bufio.Reader, exe *codegen.Executable) (*semantic.AssertionError, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(line, "assert "))
+	if !strings.HasPrefix(line, "assert ") || err != nil || id < 0 || id >= len(exe.Asserts) {
+		return nil, fmt.Errorf("malformed report %q", line)
+	}
+	a := exe.Asserts[id]
+	e := semantic.NewAssertionError(a.Statement)
+	for _, op := range a.Operands {
+		v, err := c.decode(r, op.Type)
+		if err != nil {
+			break
+		}
+		e.Operands = append(e.Operands, semantic.Operand{Expression: semantic.Source(op.Expression), Value: v})
+	}
+	return e, nil
+}
+
+func (c codec) decode(r *bufio.Reader, te *ast.TypeExpression) (semantic.Value, error) {
+	te = c.resolve(te)
+	switch {
+	case te == nil || te.Pointer || te.Function != nil || te.Record != nil:
+		return semantic.Value{}, fmt.Errorf("cannot decode values of type %s", te)
+	case len(te.Tuple) > 0 || te.Array:
+		var n int
+		if len(te.Tuple) > 0 {
+			n = len(te.Tuple)
+		} else if te.Length == nil {
+			length, err := token(r)
+			if err != nil {
+				return semantic.Value{}, err
+			}
+			if n, err = strconv.Atoi(length); err != nil {
+				return semantic.Value{}, err
+			}
+		} else {
+			length, err := c.ev.Eval(te.Length)
+			if err != nil || length.Kind != semantic.IntConst || !length.Int.IsInt64() {
+				return semantic.Value{}, fmt.Errorf("cannot decode values of type %s", te)
+			}
+			n = int(length.Int.Int64())
+		}
+		elems := make([]semantic.Value, n)
+		for i, elemType := range c.elementTypes(te, n) {
+			elem, err := c.decode(r, elemType)
+			if err != nil {
+				return semantic.Value{}, err
+			}
+			elems[i] = elem
+		}
+		if te.Array {
+			return semantic.Value{Kind: semantic.ArrayConst, Type: te.String(), Elems: elems}, nil
+		}
+		return semantic.TupleValue(elems), nil
+	}
+
+	if decl, ok := c.ev.Struct(te.Name); ok {
+		v := semantic.Value{Kind: semantic.StructConst, Type: decl.Name.Value}
+		for _, f := range decl.Fields {
+			field, err := c.decode(r, f.Type)
+			if err != nil {
+				return semantic.Value{}, err
+			}
+			v.Fields = append(v.Fields, f.Name.Value)
+			v.Elems = append(v.Elems, field)
+		}
+		return v, nil
+	}
+	if te.Name == "string" {
+		return decodeString(r)
+	}
+	tok, err := token(r)
+	if err != nil {
+		return semantic.Value{}, err
+	}
+	if _, ok := semantic.LookupIntType(te.Name); ok || te.Name == "char" {
+		n, ok := new(big.Int).SetString(tok, 10)
+		if !ok {
+			return semantic.Value{}, fmt.Errorf("malformed integer %q", tok)
+		}
+		return semantic.Convert(semantic.Value{Kind: semantic.IntConst, Int: n}, te.Name)
+	}
+	if semantic.IsFloatType(te.Name) {
+		if strings.HasSuffix(tok, "nan") {
+			tok = "nan" // C writes NaNs with a sign
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return semantic.Value{}, err
+		}
+		return semantic.Convert(semantic.FloatValue(f), te.Name)
+	}
+	if te.Name == "bool" {
+		return semantic.BoolValue(tok != "0"), nil
+	}
+	return semantic.Value{}, fmt.Errorf("cannot decode values of type %s", te)
+}
+
+// token reads a field up to the next space
+func token(r *bufio.Reader) (string, error) {
+	tok, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(tok), nil
+}
+
+// decodeString reads a string written as its length, a colon and its bytes
+func decodeString(r *bufio.Reader) (semantic.Value, error) {
+	length, err := r.ReadString(':')
+	if err != nil {
+		return semantic.Value{}, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(length, ":")))
+	if err != nil {
+		return semantic.Value{}, err
+	}
+	s := make([]byte, n+1) // and the space after it
+	if _, err := io.ReadFull(r, s); err != nil {
+		return semantic.Value{}, err
+	}
+	return semantic.StringValue(string(s[:n])), nil
+}
@@ -0,0 +1,195 @@
+// Package sangotest runs the test and bench declarations of a program.
+//
+// Each test is compiled to a C executable of its own, with the defs and
+// values it uses, and run in a child process. A test that fails, loops
+// forever or crashes is reported and the others still run. Failed asserts
+// write the values of their operands back to the runner on file descriptor
+// 3, which decodes them with the evaluator.
+//
+// Tests can also check properties: check calls a function with arguments
+// generated at random from the types of its parameters, and reports the
+// smallest arguments it can find for which the function fails. The runner
+// generates and shrinks the arguments, and the test executable, started
+// once per property, calls the function with each of them.
+//
+// Benchmarks are compiled with optimizations and run the same way. The
+// executable times its iterations itself and counts the blocks the runtime
+// allocates, and the runner runs several rounds of them, so a comparison
+// with a baseline can look past one slow round.
+package sangotest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/codegen"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+// DefaultTimeout is how long a test may run, and each call of a property,
+// when Options do not say
+const DefaultTimeout = 10 * time.Second
+
+// Options control how tests are run
+type Options struct {
+	Run     *regexp.Regexp // run only the tests whose names match; all if nil
+	Seed    int64          // seed of the arguments check generates
+	Checks  int            // arguments check tries a property with; DefaultChecks if 0
+	CC      string         // C compiler; "cc" if empty
+	Runtime string         // directory of sango.h and sango.c
+	Timeout time.Duration  // DefaultTimeout if 0
+}
+
+// Result is the outcome of a test
+type Result struct {
+	Name    string
+	Line    int // of the test declaration
+	Column  int
+	Err     error  // nil if the test passed; a *semantic.AssertionError or *CheckError if one failed
+	Output  string // what the test printed
+	Elapsed time.Duration
+}
+
+// Passed reports whether the test passed
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Tests returns the test declarations of a program in source order, and an
+// error for each name declared twice
+func Tests(program *ast.Program) ([]*ast.TestStatement, []string) {
+	tests := []*ast.TestStatement{}
+	errors := []string{}
+	seen := map[string]bool{}
+	for _, stmt := range program.Statements {
+		test, ok := stmt.(*ast.TestStatement)
+		if !ok {
+			continue
+		}
+		if seen[test.Name] {
+			errors = append(errors, fmt.Sprintf("test %q is declared twice at line %d:%d", test.Name, test.Token.Line, test.Token.Column))
+			continue
+		}
+		seen[test.Name] = true
+		tests = append(tests, test)
+	}
+	return tests, errors
+}
+
+// Run compiles the tests of an analyzed program and runs them. It returns
+// an error if the runtime cannot be compiled.
+func Run(program *ast.Program, tests []*ast.TestStatement, opts Options) ([]Result, error) {
+	if opts.Checks <= 0 {
+		opts.Checks = DefaultChecks
+	}
+	if opts.CC == "" {
+		opts.CC = "cc"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	results := []Result{}
+	selected := []*ast.TestStatement{}
+	for _, test := range tests {
+		if opts.Run == nil || opts.Run.MatchString(test.Name) {
+			selected = append(selected, test)
+		}
+	}
+	if len(selected) == 0 {
+		return results, nil
+	}
+
+	c, err := newCompiler(opts.CC, opts.Runtime, "-O0")
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	ev := semantic.NewEvaluator()
+	ev.EvaluateProgram(program)
+	r := &runner{program: program, compiler: c, gen: codegen.New(ev.Layouts()), codec: codec{ev: ev}, opts: opts}
+	for i, test := range selected {
+		start := time.Now()
+		output, err := r.test(fmt.Sprintf("test%d", i), test)
+		results = append(results, Result{
+			Name:    test.Name,
+			Line:    test.Token.Line,
+			Column:  test.Token.Column,
+			Err:     err,
+			Output:  output,
+			Elapsed: time.Since(start),
+		})
+	}
+	return results, nil
+}
+
+// runner compiles and runs the tests and benchmarks of a program
+type runner struct {
+	program  *ast.Program
+	compiler *compiler
+	gen      *codegen.Generator
+	codec    codec
+	opts     Options // of tests
+}
+
+// test compiles a test to an executable and runs it in a process of its
+// own, so a test that crashes or loops forever does not affect the others.
+// The properties of its checks are run first, and the checks with a
+// counterexample fail when the test reaches them.
+func (r *runner) test(name string, test *ast.TestStatement) (string, error) {
+	exe, errs := r.gen.Test(r.program, test)
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "; "))
+	}
+	path, err := r.compiler.build(name, exe, "-O0")
+	if err != nil {
+		return "", err
+	}
+
+	failed := map[int]*CheckError{}
+	args := []string{}
+	for id, check := range exe.Checks {
+		p := &property{path: path, id: id, exe: exe, codec: r.codec, timeout: r.opts.Timeout}
+		c := &checker{gen: &generator{ev: r.codec.ev}, seed: r.opts.Seed, checks: r.opts.Checks}
+		e, err := c.check(p, check)
+		p.stop(nil)
+		if err != nil {
+			line, column := position(check.Call)
+			return "", fmt.Errorf("%v at line %d:%d", err, line, column)
+		}
+		if e != nil {
+			failed[id] = e
+			args = append(args, strconv.Itoa(id))
+		}
+	}
+
+	proc, err := start(path, args, false)
+	if err != nil {
+		return "", err
+	}
+	line, err := proc.line(r.opts.Timeout)
+	if errors.Is(err, errTimeout) {
+		proc.wait(true)
+		return proc.output.String(), fmt.Errorf("test %w after %s at line %d:%d", errTimeout, r.opts.Timeout, test.Token.Line, test.Token.Column)
+	}
+	if err != nil {
+		if err := proc.wait(false); err != nil {
+			return proc.output.String(), fmt.Errorf("%v at line %d:%d", proc.exited("test", err), test.Token.Line, test.Token.Column)
+		}
+		return proc.output.String(), nil
+	}
+	var failure error
+	if id, err := strconv.Atoi(strings.TrimPrefix(line, "check ")); err == nil && failed[id] != nil {
+		failure = failed[id]
+	} else if assert, err := r.codec.report(line, proc.reader, exe); err != nil {
+		failure = fmt.Errorf("%v at line %d:%d", err, test.Token.Line, test.Token.Column)
+	} else {
+		failure = assert
+	}
+	proc.wait(false)
+	return proc.output.String(), failure
+}
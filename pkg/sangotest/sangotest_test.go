@@ -0,0 +1,419 @@
+package sangotest
+
+import (
+	"math/big"
+	"math/rand"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/driver"
+	"github.com/rxxuzi/sango/pkg/semantic"
+)
+
+const input = `
+define LIMIT = 10
+
+def add(a: i32, b: i32): i32 = a + b
+
+const def square(x: i32): i32 = x * x
+
+def sum(n: i32): i32 = {
+  var total = 0
+  var i = 1
+  while (i <= n) {
+    total += i
+    i += 1
+  }
+  total
+}
+
+test "add" {
+  assert(add(2, 3) == 5)
+  assert(square(LIMIT) == 100)
+}
+
+test "sum" {
+  val n = 4
+  assert(sum(n) == 11)
+}
+
+test "forever" {
+  while (true) { }
+}
+
+test "runtime" {
+  printf("sango")
+}
+
+test "strings" {
+  val s = "sango"
+  assert(len(s) == 5)
+  assert(s != "")
+}
+
+test "crash" {
+  val xs = [1, 2]
+  assert(xs[2] == 0)
+}
+`
+
+func run(t *testing.T, source string, opts Options) []Result {
+	t.Helper()
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	unit, errors := driver.AnalyzeTests(source)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	tests, errors := Tests(unit.Program)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	opts.Runtime = filepath.Join("..", "..", "runtime")
+	results, err := Run(unit.Program, tests, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string // empty if the test passes
+	}{
+		{"add", ""},
+		{"sum", "assertion failed: sum(n) == 11 (sum(n) = 10)"},
+		{"forever", "test timed out after 500ms at line 28:1"},
+		{"runtime", ""},
+		{"strings", ""},
+		{"crash", "test crashed (signal: aborted): Panic: Index out of range at line 42:1"},
+	}
+
+	results := run(t, input, Options{Timeout: 500 * time.Millisecond})
+	if len(results) != len(tests) {
+		t.Fatalf("expected %d results, got %d", len(tests), len(results))
+	}
+	for i, tt := range tests {
+		r := results[i]
+		if r.Name != tt.name {
+			t.Errorf("results[%d] - expected test %s, got %s", i, tt.name, r.Name)
+			continue
+		}
+		switch {
+		case tt.err == "" && !r.Passed():
+			t.Errorf("test %s - expected to pass, got %v", tt.name, r.Err)
+		case tt.err != "" && r.Passed():
+			t.Errorf("test %s - expected to fail with %q", tt.name, tt.err)
+		case tt.err != "" && !strings.Contains(r.Err.Error(), tt.err):
+			t.Errorf("test %s - expected %q, got %q", tt.name, tt.err, r.Err)
+		}
+	}
+
+	failed, ok := results[1].Err.(*semantic.AssertionError)
+	if !ok || failed.Line != 25 || len(failed.Operands) != 1 || failed.Operands[0].Value.String() != "10" {
+		t.Errorf("expected the value of sum(n) in %#v", results[1].Err)
+	}
+	if results[3].Output != "sango" {
+		t.Errorf("expected the output of runtime, got %q", results[3].Output)
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	results := run(t, input, Options{Run: regexp.MustCompile("^s")})
+	if len(results) != 2 || results[0].Name != "sum" || results[1].Name != "strings" {
+		t.Errorf("expected sum and strings, got %v", results)
+	}
+}
+
+func TestTests(t *testing.T) {
+	unit, errors := driver.AnalyzeTests(`test "a" { }
+test "b" { }
+test "a" { }`)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	tests, errors := Tests(unit.Program)
+	if len(tests) != 2 || len(errors) != 1 || errors[0] != `test "a" is declared twice at line 3:1` {
+		t.Errorf("expected a and b and an error for a, got %d tests and %v", len(tests), errors)
+	}
+
+	// Outside of test mode the declarations are dropped
+	unit, _ = driver.Analyze(`test "a" { }
+bench "b" { }`)
+	if len(unit.Program.Statements) != 0 {
+		t.Errorf("expected no statements, got %s", unit.Program)
+	}
+}
+
+const properties = `
+struct Point { x: i32, y: i32 }
+type Points []Point
+
+def below(n: i32): bool = n < 100
+
+test "holds" {
+  check(def(a: i32, b: i32) = a + 0 == a && b * 1 == b)
+  check(def(p: Point, q: (bool, string), r: [3]u8, s: Points, f: f64, c: char) = {
+    assert(len(r) == 3)
+    assert(f == f)
+  })
+}
+
+test "below" {
+  check(def(n: i32) = below(n), 1000)
+}
+
+test "sorted" {
+  check(def(xs: []i32) = {
+    var i = 1
+    while (i < len(xs)) {
+      assert(xs[i - 1] <= xs[i])
+      i += 1
+    }
+  })
+}
+
+test "untyped" {
+  check(def(n) = true)
+}
+
+def add(a: i32, b: i32): i32 = a + b
+
+test "wraps" {
+  check(def(a: i32, b: i32) = add(a, b) == add(b, a))
+}
+
+test "unsupported" {
+  check(def(n: i32) = {
+    val f = def(x: i32) = x
+    f(n) == n
+  })
+}
+`
+
+func TestCheck(t *testing.T) {
+	results := run(t, properties, Options{Seed: 1})
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(results))
+	}
+	if !results[0].Passed() {
+		t.Errorf("expected holds to pass, got %v", results[0].Err)
+	}
+	// Compiled code wraps around where constant evaluation overflows
+	if !results[4].Passed() {
+		t.Errorf("expected wraps to pass, got %v", results[4].Err)
+	}
+
+	// Counterexamples are shrunk to the smallest failing arguments
+	below, ok := results[1].Err.(*CheckError)
+	if !ok {
+		t.Fatalf("expected a CheckError, got %v", results[1].Err)
+	}
+	if below.Args[0].String() != "100" || below.Err != errFalse || below.Seed != 1 || below.Line != 16 {
+		t.Errorf("expected n = 100 at line 16 with seed 1, got %v", below)
+	}
+	sorted, ok := results[2].Err.(*CheckError)
+	if !ok {
+		t.Fatalf("expected a CheckError, got %v", results[2].Err)
+	}
+	if len(sorted.Args[0].Elems) != 2 || sorted.Args[0].Elems[0].String() != "1" || sorted.Args[0].Elems[1].String() != "0" {
+		t.Errorf("expected xs = [1, 0], got %v", sorted)
+	}
+	if _, ok := sorted.Err.(*semantic.AssertionError); !ok {
+		t.Errorf("expected the failed assert, got %v", sorted.Err)
+	}
+
+	if results[3].Passed() || !strings.Contains(results[3].Err.Error(), "check cannot generate n, which has no type") {
+		t.Errorf("expected an error for the untyped parameter, got %v", results[3].Err)
+	}
+	// Code that cannot be compiled is an error of the check, not a counterexample
+	if _, ok := results[5].Err.(*CheckError); ok || results[5].Err == nil || !strings.Contains(results[5].Err.Error(), "cannot compile") {
+		t.Errorf("expected an error for the unsupported property, got %v", results[5].Err)
+	}
+
+	// The same seed finds the same counterexample before shrinking
+	again := run(t, properties, Options{Seed: 1, Run: regexp.MustCompile("below")})
+	if again[0].Err.(*CheckError).Tries != below.Tries {
+		t.Errorf("expected the same counterexample for the same seed")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	unit, errors := driver.AnalyzeTests(properties)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	ev := semantic.NewEvaluator()
+	ev.EvaluateProgram(unit.Program)
+	g := &generator{ev: ev, rand: rand.New(rand.NewSource(1))}
+
+	for _, tt := range []struct {
+		typ  *ast.TypeExpression
+		kind semantic.ConstKind
+	}{
+		{&ast.TypeExpression{Name: "u8"}, semantic.IntConst},
+		{&ast.TypeExpression{Name: "f32"}, semantic.FloatConst},
+		{&ast.TypeExpression{Name: "bool"}, semantic.BoolConst},
+		{&ast.TypeExpression{Name: "string"}, semantic.StringConst},
+		{&ast.TypeExpression{Name: "Point"}, semantic.StructConst},
+		{&ast.TypeExpression{Name: "Points"}, semantic.ArrayConst},
+		{&ast.TypeExpression{Tuple: []ast.TypeExpression{{Name: "i64"}, {Name: "char"}}}, semantic.TupleConst},
+	} {
+		for size := 0; size <= maxSize; size += 10 {
+			v, err := g.generate(tt.typ, size)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.typ, err)
+			}
+			if v.Kind != tt.kind {
+				t.Fatalf("%s: expected %s, got %s", tt.typ, tt.kind, v)
+			}
+			if v.Kind == semantic.IntConst && (v.Int.Sign() < 0 || v.Int.Cmp(big.NewInt(255)) > 0) {
+				t.Errorf("u8: %s is out of range", v)
+			}
+			if v.Kind == semantic.StringConst && len(v.Str) > size {
+				t.Errorf("string: %q is longer than %d", v.Str, size)
+			}
+		}
+	}
+
+	if _, err := g.generate(&ast.TypeExpression{Pointer: true, ElementType: &ast.TypeExpression{Name: "i32"}}, 10); err == nil {
+		t.Errorf("expected an error for a pointer type")
+	}
+}
+
+const benchmarks = `
+def join(n: i32): string = {
+  var s = ""
+  var i = 0
+  while (i < n) {
+    s = s + "x"
+    i += 1
+  }
+  s
+}
+
+bench "join" {
+  val s = join(3)
+  val a = [1, 2]
+}
+
+bench "runtime" {
+  printf("sango")
+}
+
+bench "join" { }
+`
+
+func TestBench(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	unit, errors := driver.AnalyzeTests(benchmarks)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	benches, errors := Benchmarks(unit.Program)
+	if len(benches) != 2 || len(errors) != 1 || errors[0] != `bench "join" is declared twice at line 21:1` {
+		t.Fatalf("expected join and runtime and an error for join, got %d benchmarks and %v", len(benches), errors)
+	}
+
+	runtime := filepath.Join("..", "..", "runtime")
+	results, err := Bench(unit.Program, benches, BenchOptions{Time: 10 * time.Millisecond, Rounds: 3, Runtime: runtime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	join := results[0]
+	if join.Err != nil || join.N < 2 || len(join.Rounds) != 3 || join.Rounds[0] < 10*time.Millisecond {
+		t.Errorf("expected join to run 3 rounds of 10ms, got %d iterations in %v and %v", join.N, join.Rounds, join.Err)
+	}
+	if join.MinNsPerOp() > join.NsPerOp() {
+		t.Errorf("expected the fastest round to be at most the median, got %g and %g", join.MinNsPerOp(), join.NsPerOp())
+	}
+	// Three concatenations, and an array and its elements
+	if join.AllocsPerOp() != 5 {
+		t.Errorf("expected 5 allocs/op, got %g", join.AllocsPerOp())
+	}
+	if results[1].Err != nil {
+		t.Errorf("expected runtime to pass, got %v", results[1].Err)
+	}
+
+	results, err = Bench(unit.Program, benches, BenchOptions{Time: time.Millisecond, Run: regexp.MustCompile("^run"), Runtime: runtime})
+	if err != nil || len(results) != 1 || results[0].Name != "runtime" {
+		t.Errorf("expected runtime, got %v %v", results, err)
+	}
+}
+
+func TestIterations(t *testing.T) {
+	tests := []struct {
+		n         int
+		elapsed   time.Duration
+		benchtime time.Duration
+		expected  int
+	}{
+		{1, time.Millisecond, time.Second, 100},
+		{100, 100 * time.Millisecond, time.Second, 1200},
+		{10, 0, time.Second, 1000},
+		{5, time.Second, time.Second, 6},
+		{maxIterations / 10, time.Millisecond, time.Second, maxIterations},
+	}
+	for _, tt := range tests {
+		if got := iterations(tt.n, tt.elapsed, tt.benchtime); got != tt.expected {
+			t.Errorf("iterations(%d, %s, %s) - expected %d, got %d", tt.n, tt.elapsed, tt.benchtime, tt.expected, got)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bench.json")
+	b, err := LoadBaseline(path)
+	if err != nil || len(b) != 0 {
+		t.Fatalf("expected an empty baseline, got %v %v", b, err)
+	}
+
+	b.Add("a.sango", []BenchResult{
+		{Name: "fast", N: 10, Rounds: []time.Duration{1000, 900, 1100}, Allocs: 0},
+		{Name: "alloc", N: 10, Rounds: []time.Duration{1000}, Allocs: 20},
+		{Name: "failed", Err: errFalse},
+	})
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = LoadBaseline(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(b["a.sango"]) != 2 || b["a.sango"]["alloc"].AllocsPerOp != 2 || b["a.sango"]["fast"].NsPerOp != 100 || b["a.sango"]["fast"].MinNsPerOp != 90 {
+		t.Fatalf("expected fast and alloc, got %v", b)
+	}
+
+	tests := []struct {
+		file      string
+		result    BenchResult
+		found     bool
+		regressed bool
+	}{
+		{"a.sango", BenchResult{Name: "fast", N: 10, Rounds: []time.Duration{1050, 950, 1100}}, true, false},
+		{"a.sango", BenchResult{Name: "fast", N: 10, Rounds: []time.Duration{1200, 1100, 1300}}, true, true},
+		// A slow median with a fast round is noise, not a regression
+		{"a.sango", BenchResult{Name: "fast", N: 10, Rounds: []time.Duration{1300, 900, 1400}}, true, false},
+		{"a.sango", BenchResult{Name: "fast", N: 10, Rounds: []time.Duration{500}, Allocs: 1}, true, true},
+		{"a.sango", BenchResult{Name: "alloc", N: 10, Rounds: []time.Duration{1000}, Allocs: 10}, true, false},
+		{"a.sango", BenchResult{Name: "new", N: 10, Rounds: []time.Duration{1000}}, false, false},
+		{"b.sango", BenchResult{Name: "fast", N: 10, Rounds: []time.Duration{1000}}, false, false},
+	}
+	for _, tt := range tests {
+		change, ok := b.Compare(tt.file, tt.result)
+		if ok != tt.found || change.Regressed(10) != tt.regressed {
+			t.Errorf("%s %s - expected found=%t regressed=%t, got %t %+v", tt.file, tt.result.Name, tt.found, tt.regressed, ok, change)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package semantic
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// ConstKind identifies the kind of a compile-time constant
+type ConstKind int
+
+const (
+	IntConst ConstKind = iota
+	FloatConst
+	BoolConst
+	StringConst
+	ArrayConst
+	StructConst
+	FuncConst
+	TupleConst
+)
+
+func (k ConstKind) String() string {
+	switch k {
+	case IntConst:
+		return "integer"
+	case FloatConst:
+		return "float"
+	case BoolConst:
+		return "bool"
+	case StringConst:
+		return "string"
+	case ArrayConst:
+		return "array"
+	case StructConst:
+		return "struct"
+	case FuncConst:
+		return "function"
+	case TupleConst:
+		return "tuple"
+	default:
+		return fmt.Sprintf("ConstKind(%d)", int(k))
+	}
+}
+
+// Value is a compile-time constant. Integers are kept at arbitrary precision
+// and range checked against their type, so overflow is detected per width.
+// An empty Type means the constant is untyped and takes the type of the
+// context it is used in, as with literals.
+//
+// Structs keep their field values in Elems, named by Fields, and have the
+// struct's name as Type. Functions are function literals with the scope
+// they were evaluated in. Neither is folded into the program.
+type Value struct {
+	Kind   ConstKind
+	Type   string
+	Int    *big.Int
+	Float  float64
+	Bool   bool
+	Str    string
+	Elems  []Value
+	Fields []string
+	Func   *ast.FunctionLiteral
+	env    *scope
+}
+
+// IntValue creates an untyped integer constant
+func IntValue(n int64) Value {
+	return Value{Kind: IntConst, Int: big.NewInt(n)}
+}
+
+// FloatValue creates an untyped float constant
+func FloatValue(f float64) Value {
+	return Value{Kind: FloatConst, Float: f}
+}
+
+// BoolValue creates a bool constant
+func BoolValue(b bool) Value {
+	return Value{Kind: BoolConst, Type: "bool", Bool: b}
+}
+
+// StringValue creates a string constant
+func StringValue(s string) Value {
+	return Value{Kind: StringConst, Type: "string", Str: s}
+}
+
+// ArrayValue creates an array constant
+func ArrayValue(elems []Value) Value {
+	return Value{Kind: ArrayConst, Elems: elems}
+}
+
+// TupleValue creates a tuple constant
+func TupleValue(elems []Value) Value {
+	return Value{Kind: TupleConst, Elems: elems}
+}
+
+func (v Value) String() string {
+	switch v.Kind {
+	case IntConst:
+		if v.Type == "char" {
+			return strconv.QuoteRune(rune(v.Int.Int64()))
+		}
+		return v.Int.String()
+	case FloatConst:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case BoolConst:
+		return strconv.FormatBool(v.Bool)
+	case StringConst:
+		return strconv.Quote(v.Str)
+	case ArrayConst:
+		elems := []string{}
+		for _, e := range v.Elems {
+			elems = append(elems, e.String())
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case TupleConst:
+		elems := []string{}
+		for _, e := range v.Elems {
+			elems = append(elems, e.String())
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	case StructConst:
+		fields := []string{}
+		for i, e := range v.Elems {
+			fields = append(fields, v.Fields[i]+": "+e.String())
+		}
+		return v.Type + " { " + strings.Join(fields, ", ") + " }"
+	case FuncConst:
+		return v.Func.String()
+	default:
+		return "?"
+	}
+}
+
+// foldable reports whether the value can be written back into the program
+// as a literal
+func (v Value) foldable() bool {
+	if v.Kind == StructConst || v.Kind == FuncConst {
+		return false
+	}
+	for _, e := range v.Elems {
+		if !e.foldable() {
+			return false
+		}
+	}
+	return true
+}
+
+// IntType describes the width and signedness of an integer type
+type IntType struct {
+	Bits   uint
+	Signed bool
+}
+
+// intTypes maps every integer type name to its C representation. int is
+// 32 bits wide as in the runtime's sango_int.
+var intTypes = map[string]IntType{
+	"i8":   {8, true},
+	"i16":  {16, true},
+	"i32":  {32, true},
+	"i64":  {64, true},
+	"u8":   {8, false},
+	"u16":  {16, false},
+	"u32":  {32, false},
+	"u64":  {64, false},
+	"byte": {8, false},
+	"int":  {32, true},
+	"long": {64, true},
+}
+
+// floatTypes lists the floating point type names
+var floatTypes = map[string]bool{
+	"float":  true,
+	"double": true,
+	"f32":    true,
+	"f64":    true,
+}
+
+// validChar reports whether n is a Unicode scalar value, which is what a
+// char holds
+func validChar(n *big.Int) bool {
+	return n.Sign() >= 0 && n.IsInt64() && n.Int64() <= utf8.MaxRune && utf8.ValidRune(rune(n.Int64()))
+}
+
+// LookupIntType returns the integer type with the given name
+func LookupIntType(name string) (IntType, bool) {
+	t, ok := intTypes[name]
+	return t, ok
+}
+
+// IsFloatType reports whether name is a floating point type
+func IsFloatType(name string) bool {
+	return floatTypes[name]
+}
+
+// Min returns the smallest value of the type
+func (t IntType) Min() *big.Int {
+	if !t.Signed {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), t.Bits-1))
+}
+
+// Max returns the largest value of the type
+func (t IntType) Max() *big.Int {
+	bits := t.Bits
+	if t.Signed {
+		bits--
+	}
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+}
+
+// Fits reports whether n is representable in the type
+func (t IntType) Fits(n *big.Int) bool {
+	return n.Cmp(t.Min()) >= 0 && n.Cmp(t.Max()) <= 0
+}
+
+// Convert gives an untyped constant the type name, checking that the value is
+// representable. Typed constants must already have that type.
+func Convert(v Value, typeName string) (Value, error) {
+	if typeName == "" {
+		return v, nil
+	}
+	if v.Type != "" && v.Type != typeName && !sameType(v.Type, typeName) {
+		return v, fmt.Errorf("cannot use %s constant %s as %s", v.Type, v, typeName)
+	}
+
+	if it, ok := LookupIntType(typeName); ok {
+		switch v.Kind {
+		case IntConst:
+			if !it.Fits(v.Int) {
+				return v, fmt.Errorf("constant %s overflows %s", v.Int, typeName)
+			}
+			return Value{Kind: IntConst, Type: typeName, Int: v.Int}, nil
+		case FloatConst:
+			f := new(big.Float).SetFloat64(v.Float)
+			n, acc := f.Int(nil)
+			if acc != big.Exact {
+				return v, fmt.Errorf("constant %s truncated to integer %s", v, typeName)
+			}
+			if !it.Fits(n) {
+				return v, fmt.Errorf("constant %s overflows %s", v, typeName)
+			}
+			return Value{Kind: IntConst, Type: typeName, Int: n}, nil
+		}
+		return v, fmt.Errorf("cannot use %s constant %s as %s", v.Kind, v, typeName)
+	}
+
+	if typeName == "char" {
+		if v.Kind != IntConst {
+			return v, fmt.Errorf("cannot use %s constant %s as char", v.Kind, v)
+		}
+		if !validChar(v.Int) {
+			return v, fmt.Errorf("constant %s is not a valid char", v.Int)
+		}
+		return Value{Kind: IntConst, Type: "char", Int: v.Int}, nil
+	}
+
+	if IsFloatType(typeName) {
+		switch v.Kind {
+		case IntConst:
+			f, _ := new(big.Float).SetInt(v.Int).Float64()
+			return Value{Kind: FloatConst, Type: typeName, Float: f}, nil
+		case FloatConst:
+			return Value{Kind: FloatConst, Type: typeName, Float: v.Float}, nil
+		}
+		return v, fmt.Errorf("cannot use %s constant %s as %s", v.Kind, v, typeName)
+	}
+
+	if typeName == "bool" && v.Kind == BoolConst || typeName == "string" && v.Kind == StringConst {
+		return v, nil
+	}
+
+	if strings.HasPrefix(typeName, "[]") && v.Kind == ArrayConst {
+		elemType := strings.TrimPrefix(typeName, "[]")
+		elems := make([]Value, len(v.Elems))
+		for i, e := range v.Elems {
+			conv, err := Convert(e, elemType)
+			if err != nil {
+				return v, fmt.Errorf("element %d: %v", i, err)
+			}
+			elems[i] = conv
+		}
+		return Value{Kind: ArrayConst, Type: typeName, Elems: elems}, nil
+	}
+
+	return v, fmt.Errorf("cannot use %s constant %s as %s", v.Kind, v, typeName)
+}
+
+// sameType treats aliases of the same C type as identical
+func sameType(a, b string) bool {
+	alias := map[string]string{"byte": "u8", "int": "i32", "long": "i64", "float": "f32", "double": "f64"}
+	if x, ok := alias[a]; ok {
+		a = x
+	}
+	if x, ok := alias[b]; ok {
+		b = x
+	}
+	return a == b
+}
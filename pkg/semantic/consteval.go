@@ -0,0 +1,1261 @@
+package semantic
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+)
+
+// ErrNotConstant is returned when an expression cannot be evaluated at
+// compile time, for example because it reads a runtime variable
+var ErrNotConstant = errors.New("not a constant expression")
+
+// ErrStepLimit is returned when evaluation takes more steps than a
+// compile-time computation is allowed, as an endless loop does
+var ErrStepLimit = fmt.Errorf("constant evaluation exceeded %d steps", maxEvalSteps)
+
+// Limits that keep const def evaluation from hanging the compiler
+const (
+	maxEvalSteps = 1000000
+	maxEvalDepth = 256
+	maxConstBits = 4096 // largest untyped integer kept during evaluation
+)
+
+// Evaluator folds constant expressions and runs const def functions at
+// compile time
+type Evaluator struct {
+	consts    map[string]Value
+	functions map[string]*ast.FunctionStatement
+	builtins  map[string]Builtin
+	layouts   *Layouts
+	errors    []string
+	steps     int
+	depth     int
+}
+
+// NewEvaluator creates an evaluator with no constants defined
+func NewEvaluator() *Evaluator {
+	ev := &Evaluator{
+		consts:    make(map[string]Value),
+		functions: make(map[string]*ast.FunctionStatement),
+		builtins:  make(map[string]Builtin),
+		layouts:   NewLayouts(),
+		errors:    []string{},
+	}
+	ev.layouts.eval = ev.Eval
+	return ev
+}
+
+// Layouts returns the layout table for the types declared in the program
+func (ev *Evaluator) Layouts() *Layouts {
+	return ev.layouts
+}
+
+// Errors returns the errors reported by EvaluateProgram
+func (ev *Evaluator) Errors() []string {
+	return ev.errors
+}
+
+// Constant returns the value of a top-level constant
+func (ev *Evaluator) Constant(name string) (Value, bool) {
+	v, ok := ev.consts[name]
+	return v, ok
+}
+
+// Constants returns every top-level constant evaluated so far
+func (ev *Evaluator) Constants() map[string]Value {
+	result := make(map[string]Value, len(ev.consts))
+	for k, v := range ev.consts {
+		result[k] = v
+	}
+	return result
+}
+
+// DefineConstant makes a named constant visible to later evaluations
+func (ev *Evaluator) DefineConstant(name string, v Value) {
+	ev.consts[name] = v
+}
+
+func (ev *Evaluator) addError(msg string, tok lexer.Token) {
+	ev.errors = append(ev.errors, fmt.Sprintf("%s at line %d:%d", msg, tok.Line, tok.Column))
+}
+
+// EvaluateProgram evaluates typed defines and top-level val statements. A
+// val whose value is constant, including calls to const def functions, is
+// replaced with the folded literal so later stages see a constant table.
+// Declared structs are laid out so invalid layouts are reported even when no
+// sizeof refers to them.
+func (ev *Evaluator) EvaluateProgram(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionStatement); ok && fn != nil && fn.Const {
+			ev.functions[fn.Name.Value] = fn
+		}
+		ev.layouts.Declare(stmt)
+	}
+
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.DefineStatement:
+			ev.evaluateDefine(s)
+		case *ast.ValStatement:
+			ev.evaluateVal(s)
+		}
+	}
+
+	// Array lengths in structs may use constants defined further down
+	for _, stmt := range program.Statements {
+		s, ok := stmt.(*ast.StructStatement)
+		if !ok || s == nil || s.Name == nil {
+			continue
+		}
+		_, err := ev.layouts.Named(s.Name.Value)
+		var unknown *UnknownTypeError
+		if err != nil && !errors.As(err, &unknown) {
+			ev.addError(fmt.Sprintf("struct %s: %v", s.Name.Value, err), s.Token)
+		}
+	}
+}
+
+func (ev *Evaluator) evaluateDefine(def *ast.DefineStatement) {
+	if def.IsC || def.Value == nil || def.IsFunctionLike() {
+		return
+	}
+
+	v, err := ev.Eval(def.Value)
+	if err != nil {
+		if err != ErrNotConstant || def.Type != nil {
+			ev.addError(fmt.Sprintf("define %s: %v", def.Name.Value, err), def.Token)
+		}
+		return
+	}
+	if !v.foldable() {
+		return
+	}
+
+	if def.Type != nil {
+		if v, err = Convert(v, def.Type.String()); err != nil {
+			ev.addError(fmt.Sprintf("define %s: %v", def.Name.Value, err), def.Token)
+			return
+		}
+	}
+	ev.consts[def.Name.Value] = v
+}
+
+func (ev *Evaluator) evaluateVal(vs *ast.ValStatement) {
+	if vs.Value == nil {
+		return
+	}
+
+	v, err := ev.Eval(vs.Value)
+	if err == ErrNotConstant || err == nil && !v.foldable() {
+		return
+	}
+	if err != nil {
+		ev.addError(fmt.Sprintf("val %s: %v", vs.Names[0].Value, err), vs.Token)
+		return
+	}
+
+	if vs.Type != nil {
+		v, err = ev.convert(v, vs.Type)
+	} else {
+		v, err = defaultType(v)
+	}
+	if err != nil {
+		ev.addError(fmt.Sprintf("val %s: %v", vs.Names[0].Value, err), vs.Token)
+		return
+	}
+
+	if len(vs.Names) == 1 {
+		ev.consts[vs.Names[0].Value] = v
+		vs.Value = Literal(v, vs.Value)
+		return
+	}
+
+	if v.Kind != ArrayConst && v.Kind != TupleConst || len(v.Elems) != len(vs.Names) {
+		ev.addError(fmt.Sprintf("cannot destructure %s into %d names", v, len(vs.Names)), vs.Token)
+		return
+	}
+	for i, name := range vs.Names {
+		ev.consts[name.Value] = v.Elems[i]
+	}
+	vs.Value = Literal(v, vs.Value)
+}
+
+// defaultType gives untyped integers, also inside arrays and tuples, the
+// type int that a val without a type takes, checking that they fit
+func defaultType(v Value) (Value, error) {
+	switch {
+	case v.Kind == IntConst && v.Type == "":
+		return Convert(v, "int")
+	case v.Kind == ArrayConst || v.Kind == TupleConst:
+		elems := make([]Value, len(v.Elems))
+		for i, e := range v.Elems {
+			elem, err := defaultType(e)
+			if err != nil {
+				return v, err
+			}
+			elems[i] = elem
+		}
+		v.Elems = elems
+	}
+	return v, nil
+}
+
+// Eval evaluates an expression using the top-level constants and const def
+// functions known to the evaluator. Each expression has a budget of
+// evaluation steps of its own, so that many vals can call an expensive
+// const def.
+func (ev *Evaluator) Eval(e ast.Expression) (Value, error) {
+	ev.steps = 0
+	return ev.eval(e, nil)
+}
+
+// scope holds the local variables of a const def invocation
+type scope struct {
+	vars   map[string]*Value
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]*Value), parent: parent}
+}
+
+func (s *scope) lookup(name string) (*Value, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// returnSignal unwinds a const def body on return
+type returnSignal struct {
+	value Value
+}
+
+func (r *returnSignal) Error() string { return "return outside of const def" }
+
+func (ev *Evaluator) step() error {
+	ev.steps++
+	if ev.steps > maxEvalSteps {
+		return ErrStepLimit
+	}
+	return nil
+}
+
+func (ev *Evaluator) eval(e ast.Expression, env *scope) (Value, error) {
+	if err := ev.step(); err != nil {
+		return Value{}, err
+	}
+
+	switch n := e.(type) {
+	case nil:
+		return Value{}, ErrNotConstant
+	case *ast.IntegerLiteral:
+		digits, _ := lexer.SplitNumber(n.Token.Literal)
+		if i, err := lexer.ParseInteger(digits); err == nil {
+			return Value{Kind: IntConst, Type: n.Type, Int: i}, nil
+		}
+		v := IntValue(n.Value)
+		v.Type = n.Type
+		return v, nil
+	case *ast.FloatLiteral:
+		return Value{Kind: FloatConst, Type: n.Type, Float: n.Value}, nil
+	case *ast.StringLiteral:
+		return StringValue(n.Value), nil
+	case *ast.CharLiteral:
+		return Value{Kind: IntConst, Type: "char", Int: big.NewInt(int64(n.Value))}, nil
+	case *ast.BooleanLiteral:
+		return BoolValue(n.Value), nil
+	case *ast.Identifier:
+		if env != nil {
+			if v, ok := env.lookup(n.Value); ok {
+				return *v, nil
+			}
+		}
+		if v, ok := ev.consts[n.Value]; ok {
+			return v, nil
+		}
+		return Value{}, ErrNotConstant
+	case *ast.PrefixExpression:
+		return ev.evalPrefix(n, env)
+	case *ast.SizeofExpression:
+		return ev.evalSizeof(n, env)
+	case *ast.OffsetofExpression:
+		path := make([]string, len(n.Field))
+		for i, f := range n.Field {
+			path[i] = f.Value
+		}
+		offset, err := ev.layouts.Offsetof(n.Type, path)
+		if err != nil {
+			return Value{}, layoutError(err)
+		}
+		return IntValue(offset), nil
+	case *ast.InfixExpression:
+		if n.Operator == "." {
+			return ev.evalField(n, env)
+		}
+		left, err := ev.eval(n.Left, env)
+		if err != nil {
+			return Value{}, err
+		}
+		// Short-circuit logical operators
+		if left.Kind == BoolConst && (n.Operator == "&&" && !left.Bool || n.Operator == "||" && left.Bool) {
+			return left, nil
+		}
+		right, err := ev.eval(n.Right, env)
+		if err != nil {
+			return Value{}, err
+		}
+		return BinaryOp(n.Operator, left, right)
+	case *ast.ArrayLiteral:
+		return ev.evalList(n.Elements, env)
+	case *ast.TupleLiteral:
+		v, err := ev.evalList(n.Elements, env)
+		v.Kind = TupleConst
+		return v, err
+	case *ast.IndexExpression:
+		return ev.evalIndex(n, env)
+	case *ast.RangeExpression:
+		return ev.evalRange(n, env)
+	case *ast.CallExpression:
+		return ev.evalCall(n, env)
+	case *ast.IfExpression:
+		cond, err := ev.evalCondition(n.Condition, env)
+		if err != nil {
+			return Value{}, err
+		}
+		if cond {
+			return ev.evalBlock(n.Consequence, env)
+		}
+		if n.Alternative != nil {
+			return ev.evalBlock(n.Alternative, env)
+		}
+		return Value{}, ErrNotConstant
+	case *ast.BlockStatement:
+		return ev.evalBlock(n, env)
+	case *ast.MatchExpression:
+		return ev.evalMatch(n, env)
+	case *ast.StructLiteral:
+		return ev.evalStruct(n, env)
+	case *ast.FunctionLiteral:
+		return Value{Kind: FuncConst, Func: n, env: env}, nil
+	default:
+		return Value{}, ErrNotConstant
+	}
+}
+
+func (ev *Evaluator) evalPrefix(n *ast.PrefixExpression, env *scope) (Value, error) {
+	right, err := ev.eval(n.Right, env)
+	if err != nil {
+		return Value{}, err
+	}
+	return UnaryOp(n.Operator, right)
+}
+
+// evalSizeof computes sizeof and alignof from the C layout of the operand
+func (ev *Evaluator) evalSizeof(n *ast.SizeofExpression, env *scope) (Value, error) {
+	var l Layout
+	var err error
+	if n.Type != nil {
+		l, err = ev.layouts.Of(n.Type)
+	} else {
+		l, err = ev.operandLayout(n.Value, env)
+	}
+	if err != nil {
+		return Value{}, layoutError(err)
+	}
+
+	if n.Operator == "alignof" {
+		return IntValue(l.Align), nil
+	}
+	return IntValue(l.Size), nil
+}
+
+// operandLayout returns the layout of a sizeof operand written as an
+// expression. Identifiers name a type when one is declared, as in C.
+func (ev *Evaluator) operandLayout(e ast.Expression, env *scope) (Layout, error) {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		if ev.layouts.IsType(n.Value) {
+			return ev.layouts.Named(n.Value)
+		}
+		v, err := ev.eval(n, env)
+		if err != nil || v.Type == "" || v.Kind == ArrayConst || v.Kind == TupleConst {
+			return Layout{}, ErrNotConstant
+		}
+		return ev.layouts.Named(v.Type)
+	case *ast.TupleLiteral:
+		names := make([]string, len(n.Elements))
+		fields := make([]Layout, len(n.Elements))
+		for i, elem := range n.Elements {
+			fl, err := ev.operandLayout(elem, env)
+			if err != nil {
+				return Layout{}, err
+			}
+			names[i], fields[i] = tupleField(i), fl
+		}
+		return placeFields(names, fields, false), nil
+	case *ast.IntegerLiteral:
+		if n.Type != "" {
+			return ev.layouts.Named(n.Type)
+		}
+		return ev.layouts.Named("int")
+	case *ast.FloatLiteral:
+		if n.Type != "" {
+			return ev.layouts.Named(n.Type)
+		}
+		return ev.layouts.Named("double")
+	case *ast.BooleanLiteral:
+		return ev.layouts.Named("bool")
+	case *ast.StringLiteral:
+		return ev.layouts.Named("string")
+	}
+	return Layout{}, ErrNotConstant
+}
+
+// layoutError leaves types the program does not declare to the C compiler
+func layoutError(err error) error {
+	var unknown *UnknownTypeError
+	if errors.As(err, &unknown) {
+		return ErrNotConstant
+	}
+	return err
+}
+
+func (ev *Evaluator) evalList(exprs []ast.Expression, env *scope) (Value, error) {
+	elems := make([]Value, 0, len(exprs))
+	for _, e := range exprs {
+		v, err := ev.eval(e, env)
+		if err != nil {
+			return Value{}, err
+		}
+		elems = append(elems, v)
+	}
+	return ArrayValue(elems), nil
+}
+
+func (ev *Evaluator) evalIndex(n *ast.IndexExpression, env *scope) (Value, error) {
+	left, err := ev.eval(n.Left, env)
+	if err != nil {
+		return Value{}, err
+	}
+	index, err := ev.eval(n.Index, env)
+	if err != nil {
+		return Value{}, err
+	}
+	if index.Kind != IntConst {
+		return Value{}, fmt.Errorf("index must be an integer, got %s", index.Kind)
+	}
+
+	switch left.Kind {
+	case ArrayConst:
+		if !index.Int.IsInt64() || index.Int.Int64() < 0 || index.Int.Int64() >= int64(len(left.Elems)) {
+			return Value{}, fmt.Errorf("index %s out of range for array of length %d", index.Int, len(left.Elems))
+		}
+		return left.Elems[index.Int.Int64()], nil
+	case StringConst:
+		if !index.Int.IsInt64() || index.Int.Int64() < 0 || index.Int.Int64() >= int64(len(left.Str)) {
+			return Value{}, fmt.Errorf("index %s out of range for string of length %d", index.Int, len(left.Str))
+		}
+		return Value{Kind: IntConst, Type: "u8", Int: big.NewInt(int64(left.Str[index.Int.Int64()]))}, nil
+	}
+	return Value{}, ErrNotConstant
+}
+
+// evalRange expands start..end into an array of integers
+func (ev *Evaluator) evalRange(n *ast.RangeExpression, env *scope) (Value, error) {
+	if n.Start == nil || n.End == nil {
+		return Value{}, ErrNotConstant
+	}
+	start, err := ev.eval(n.Start, env)
+	if err != nil {
+		return Value{}, err
+	}
+	end, err := ev.eval(n.End, env)
+	if err != nil {
+		return Value{}, err
+	}
+	if start.Kind != IntConst || end.Kind != IntConst {
+		return Value{}, fmt.Errorf("range bounds must be integers")
+	}
+	if !start.Int.IsInt64() || !end.Int.IsInt64() {
+		return Value{}, fmt.Errorf("range %s..%s too large", start.Int, end.Int)
+	}
+
+	lo, hi := start.Int.Int64(), end.Int.Int64()
+	if n.Inclusive {
+		hi++
+	}
+	elems := []Value{}
+	for i := lo; i < hi; i++ {
+		if err := ev.step(); err != nil {
+			return Value{}, err
+		}
+		elems = append(elems, Value{Kind: IntConst, Type: start.Type, Int: big.NewInt(i)})
+	}
+	return ArrayValue(elems), nil
+}
+
+func (ev *Evaluator) evalCondition(e ast.Expression, env *scope) (bool, error) {
+	cond, err := ev.eval(e, env)
+	if err != nil {
+		return false, err
+	}
+	if cond.Kind != BoolConst {
+		return false, fmt.Errorf("condition must be bool, got %s", cond.Kind)
+	}
+	return cond.Bool, nil
+}
+
+func (ev *Evaluator) evalCall(n *ast.CallExpression, env *scope) (Value, error) {
+	callee, ok := n.Function.(*ast.Identifier)
+	if !ok {
+		return Value{}, ErrNotConstant
+	}
+	var local *Value
+	if env != nil {
+		local, _ = env.lookup(callee.Value)
+	}
+
+	args := make([]Value, 0, len(n.Arguments))
+	for _, arg := range n.Arguments {
+		v, err := ev.eval(arg, env)
+		if err != nil {
+			if err == ErrNotConstant {
+				if fn, isConst := ev.functions[callee.Value]; isConst {
+					return Value{}, fmt.Errorf("argument %s to %s is not constant", arg, describe(fn))
+				}
+			}
+			return Value{}, err
+		}
+		args = append(args, v)
+	}
+
+	if callee.Value == "len" && len(args) == 1 {
+		switch args[0].Kind {
+		case ArrayConst:
+			return IntValue(int64(len(args[0].Elems))), nil
+		case StringConst:
+			return IntValue(int64(len(args[0].Str))), nil
+		}
+	}
+
+	if local != nil {
+		return ev.apply(*local, args)
+	}
+	if builtin, ok := ev.builtins[callee.Value]; ok {
+		return builtin(n, args)
+	}
+	fn, ok := ev.functions[callee.Value]
+	if !ok {
+		return Value{}, ErrNotConstant
+	}
+	return ev.Call(fn, args)
+}
+
+// Call runs a const def function, or a def made callable with Declare, with
+// constant arguments
+func (ev *Evaluator) Call(fn *ast.FunctionStatement, args []Value) (Value, error) {
+	return ev.call(describe(fn), fn.Parameters, fn.ReturnType, fn.Body, nil, args)
+}
+
+// Apply calls a function value with constant arguments. The function sees
+// the variables of the scope it was evaluated in. Each call has a budget of
+// evaluation steps of its own, so that a builtin can call a function many
+// times.
+func (ev *Evaluator) Apply(fn Value, args []Value) (Value, error) {
+	steps := ev.steps
+	ev.steps = 0
+	defer func() { ev.steps = steps }()
+	return ev.apply(fn, args)
+}
+
+// Exec calls a function value like Apply, but its body may end in a
+// statement, such as an assert, rather than an expression. It reports
+// whether the function yielded a value.
+func (ev *Evaluator) Exec(fn Value, args []Value) (Value, bool, error) {
+	steps := ev.steps
+	ev.steps = 0
+	defer func() { ev.steps = steps }()
+	return ev.applyFunc(fn, args, true)
+}
+
+func (ev *Evaluator) apply(fn Value, args []Value) (Value, error) {
+	v, _, err := ev.applyFunc(fn, args, false)
+	return v, err
+}
+
+func (ev *Evaluator) applyFunc(fn Value, args []Value, statements bool) (Value, bool, error) {
+	if fn.Kind != FuncConst {
+		return Value{}, false, fmt.Errorf("cannot call %s", fn.Kind)
+	}
+	name := "function literal"
+	if fn.Func.Name != nil {
+		name = "def " + fn.Func.Name.Value
+	}
+	return ev.invoke(name, fn.Func.Parameters, fn.Func.ReturnType, fn.Func.Body, fn.env, args, statements)
+}
+
+func (ev *Evaluator) call(name string, params []*ast.Parameter, returnType *ast.TypeExpression, body ast.Expression, closure *scope, args []Value) (Value, error) {
+	v, _, err := ev.invoke(name, params, returnType, body, closure, args, false)
+	return v, err
+}
+
+// invoke calls a function. With statements set, a block body may end in a
+// statement, and invoke reports whether it yielded a value.
+func (ev *Evaluator) invoke(name string, params []*ast.Parameter, returnType *ast.TypeExpression, body ast.Expression, closure *scope, args []Value, statements bool) (Value, bool, error) {
+	if len(args) != len(params) {
+		return Value{}, false, fmt.Errorf("%s expects %d arguments, got %d", name, len(params), len(args))
+	}
+
+	ev.depth++
+	defer func() { ev.depth-- }()
+	if ev.depth > maxEvalDepth {
+		return Value{}, false, fmt.Errorf("%s: recursion deeper than %d calls", name, maxEvalDepth)
+	}
+
+	env := newScope(closure)
+	for i, param := range params {
+		arg := args[i]
+		if param.Type != nil {
+			var err error
+			if arg, err = ev.convert(arg, param.Type); err != nil {
+				return Value{}, false, fmt.Errorf("%s, parameter %s: %v", name, param.Name.Value, err)
+			}
+		}
+		env.vars[param.Name.Value] = &arg
+	}
+
+	var result Value
+	var err error
+	yielded := true
+	if block, ok := body.(*ast.BlockStatement); ok && statements {
+		result, yielded, err = ev.runBlock(block, env)
+	} else {
+		result, err = ev.eval(body, env)
+	}
+	if ret, ok := err.(*returnSignal); ok {
+		result, yielded, err = ret.value, true, nil
+	}
+	if err == ErrNotConstant {
+		return Value{}, false, fmt.Errorf("%s cannot be evaluated at compile time", name)
+	}
+	if err != nil {
+		return Value{}, false, err
+	}
+
+	if returnType != nil && yielded {
+		if result, err = ev.convert(result, returnType); err != nil {
+			return Value{}, false, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return result, yielded, nil
+}
+
+// describe names a function in errors
+func describe(fn *ast.FunctionStatement) string {
+	if fn.Const {
+		return "const def " + fn.Name.Value
+	}
+	return "def " + fn.Name.Value
+}
+
+// evalBlock executes the statements of a block; its value is the value of
+// the last expression statement
+func (ev *Evaluator) evalBlock(block *ast.BlockStatement, env *scope) (Value, error) {
+	if block == nil {
+		return Value{}, ErrNotConstant
+	}
+	if env == nil {
+		// Blocks with local state are only evaluated inside const defs
+		if len(block.Statements) == 1 {
+			if es, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+				return ev.eval(es.Expression, nil)
+			}
+		}
+		return Value{}, ErrNotConstant
+	}
+
+	last, hasValue, err := ev.runBlock(block, env)
+	if err != nil {
+		return Value{}, err
+	}
+	if !hasValue {
+		return Value{}, ErrNotConstant
+	}
+	return last, nil
+}
+
+// runBlock executes the statements of a block in a scope of its own and
+// reports whether the last one was an expression, whose value it returns
+func (ev *Evaluator) runBlock(block *ast.BlockStatement, env *scope) (Value, bool, error) {
+	local := newScope(env)
+	var last Value
+	hasValue := false
+	for _, stmt := range block.Statements {
+		v, isExpr, err := ev.exec(stmt, local)
+		if err != nil {
+			return Value{}, false, err
+		}
+		last, hasValue = v, isExpr
+	}
+	return last, hasValue, nil
+}
+
+// exec runs a statement inside a const def. It reports the value of
+// expression statements so blocks can yield them.
+func (ev *Evaluator) exec(stmt ast.Statement, env *scope) (Value, bool, error) {
+	if err := ev.step(); err != nil {
+		return Value{}, false, err
+	}
+
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		if ifx, ok := s.Expression.(*ast.IfExpression); ok && ifx.Alternative == nil {
+			// An if without else is a statement and yields no value
+			cond, err := ev.evalCondition(ifx.Condition, env)
+			if err != nil || !cond {
+				return Value{}, false, err
+			}
+			if _, err := ev.evalStatements(ifx.Consequence, env); err != nil {
+				return Value{}, false, err
+			}
+			return Value{}, false, nil
+		}
+		v, err := ev.eval(s.Expression, env)
+		return v, true, err
+	case *ast.ValStatement:
+		return Value{}, false, ev.bind(s.Names, s.Type, s.Value, env)
+	case *ast.VarStatement:
+		return Value{}, false, ev.bind(s.Names, s.Type, s.Value, env)
+	case *ast.AssignmentStatement:
+		return Value{}, false, ev.assign(s, env)
+	case *ast.ReturnStatement:
+		if s.ReturnValue == nil {
+			return Value{}, false, ErrNotConstant
+		}
+		v, err := ev.eval(s.ReturnValue, env)
+		if err != nil {
+			return Value{}, false, err
+		}
+		return Value{}, false, &returnSignal{value: v}
+	case *ast.WhileStatement:
+		for {
+			cond, err := ev.evalCondition(s.Condition, env)
+			if err != nil {
+				return Value{}, false, err
+			}
+			if !cond {
+				return Value{}, false, nil
+			}
+			if _, err := ev.evalStatements(s.Body, env); err != nil {
+				return Value{}, false, err
+			}
+		}
+	case *ast.ForStatement:
+		iterable, err := ev.eval(s.Iterable, env)
+		if err != nil {
+			return Value{}, false, err
+		}
+		if iterable.Kind != ArrayConst {
+			return Value{}, false, fmt.Errorf("cannot iterate over %s", iterable.Kind)
+		}
+		for _, elem := range iterable.Elems {
+			local := newScope(env)
+			v := elem
+			local.vars[s.Variable.Value] = &v
+			if _, err := ev.evalStatements(s.Body, local); err != nil {
+				return Value{}, false, err
+			}
+		}
+		return Value{}, false, nil
+	case *ast.AssertStatement:
+		cond, err := ev.evalCondition(s.Expression, env)
+		if err != nil {
+			return Value{}, false, err
+		}
+		if !cond {
+			return Value{}, false, ev.assertionError(s, env)
+		}
+		return Value{}, false, nil
+	case *ast.BlockStatement:
+		v, err := ev.evalBlock(s, env)
+		if err == ErrNotConstant {
+			return Value{}, false, nil
+		}
+		return v, true, err
+	default:
+		return Value{}, false, fmt.Errorf("%s statement is not allowed in const def", stmt.TokenLiteral())
+	}
+}
+
+// evalStatements runs a loop body, ignoring its value
+func (ev *Evaluator) evalStatements(block *ast.BlockStatement, env *scope) (Value, error) {
+	local := newScope(env)
+	for _, stmt := range block.Statements {
+		if _, _, err := ev.exec(stmt, local); err != nil {
+			return Value{}, err
+		}
+	}
+	return Value{}, nil
+}
+
+func (ev *Evaluator) bind(names []*ast.Identifier, typ *ast.TypeExpression, value ast.Expression, env *scope) error {
+	v, err := ev.eval(value, env)
+	if err != nil {
+		return err
+	}
+	if typ != nil {
+		if v, err = Convert(v, typ.String()); err != nil {
+			return err
+		}
+	}
+
+	if len(names) == 1 {
+		env.vars[names[0].Value] = &v
+		return nil
+	}
+	if v.Kind != ArrayConst && v.Kind != TupleConst || len(v.Elems) != len(names) {
+		return fmt.Errorf("cannot destructure %s into %d names", v, len(names))
+	}
+	for i, name := range names {
+		elem := v.Elems[i]
+		env.vars[name.Value] = &elem
+	}
+	return nil
+}
+
+func (ev *Evaluator) assign(s *ast.AssignmentStatement, env *scope) error {
+	target, ok := env.lookup(s.Name.Value)
+	if !ok {
+		return fmt.Errorf("cannot assign to %s in const def", s.Name.Value)
+	}
+
+	v, err := ev.eval(s.Value, env)
+	if err != nil {
+		return err
+	}
+
+	if s.Operator != "=" {
+		op := s.Operator[:len(s.Operator)-1]
+		if v, err = BinaryOp(op, *target, v); err != nil {
+			return err
+		}
+	}
+	if target.Type != "" {
+		if v, err = Convert(v, target.Type); err != nil {
+			return err
+		}
+	}
+	*target = v
+	return nil
+}
+
+func (ev *Evaluator) evalMatch(n *ast.MatchExpression, env *scope) (Value, error) {
+	subject, err := ev.eval(n.Value, env)
+	if err != nil {
+		return Value{}, err
+	}
+
+	for _, mc := range n.Cases {
+		local := newScope(env)
+		matched := false
+		switch pat := mc.Pattern.(type) {
+		case *ast.WildcardExpression:
+			matched = true
+		case *ast.Identifier:
+			if v, err := ev.eval(pat, env); err == nil {
+				eq, err := BinaryOp("==", subject, v)
+				if err != nil {
+					return Value{}, err
+				}
+				matched = eq.Bool
+			} else {
+				s := subject
+				local.vars[pat.Value] = &s
+				matched = true
+			}
+		default:
+			v, err := ev.eval(pat, env)
+			if err != nil {
+				return Value{}, err
+			}
+			eq, err := BinaryOp("==", subject, v)
+			if err != nil {
+				return Value{}, err
+			}
+			matched = eq.Bool
+		}
+
+		if matched && mc.Guard != nil {
+			if env == nil {
+				return Value{}, ErrNotConstant
+			}
+			if matched, err = ev.evalCondition(mc.Guard, local); err != nil {
+				return Value{}, err
+			}
+		}
+		if matched {
+			if env == nil {
+				return ev.eval(mc.Value, nil)
+			}
+			return ev.eval(mc.Value, local)
+		}
+	}
+	return Value{}, fmt.Errorf("no match case for %s", subject)
+}
+
+// UnaryOp applies a prefix operator to a constant
+func UnaryOp(op string, v Value) (Value, error) {
+	switch op {
+	case "-":
+		switch v.Kind {
+		case IntConst:
+			return checkInt(Value{Kind: IntConst, Type: v.Type, Int: new(big.Int).Neg(v.Int)})
+		case FloatConst:
+			return Value{Kind: FloatConst, Type: v.Type, Float: -v.Float}, nil
+		}
+	case "!":
+		if v.Kind == BoolConst {
+			return BoolValue(!v.Bool), nil
+		}
+	case "~":
+		if v.Kind == IntConst {
+			if it, ok := LookupIntType(v.Type); ok && !it.Signed {
+				return Value{Kind: IntConst, Type: v.Type, Int: new(big.Int).Sub(it.Max(), v.Int)}, nil
+			}
+			return Value{Kind: IntConst, Type: v.Type, Int: new(big.Int).Not(v.Int)}, nil
+		}
+	}
+	return Value{}, fmt.Errorf("invalid operation: %s%s (%s)", op, v, v.Kind)
+}
+
+// BinaryOp applies an infix operator to two constants. Integer results are
+// checked against the width of their type.
+func BinaryOp(op string, l, r Value) (Value, error) {
+	switch op {
+	case "&&", "||":
+		if l.Kind != BoolConst || r.Kind != BoolConst {
+			return Value{}, fmt.Errorf("invalid operation: %s %s %s (operands must be bool)", l, op, r)
+		}
+		if op == "&&" {
+			return BoolValue(l.Bool && r.Bool), nil
+		}
+		return BoolValue(l.Bool || r.Bool), nil
+	case "<<", ">>":
+		return shiftOp(op, l, r)
+	}
+
+	typ, err := unifyTypes(l, r)
+	if err != nil {
+		return Value{}, fmt.Errorf("invalid operation: %s %s %s (%v)", l, op, r, err)
+	}
+
+	switch {
+	case l.Kind == StringConst && r.Kind == StringConst:
+		return stringOp(op, l.Str, r.Str)
+	case l.Kind == BoolConst && r.Kind == BoolConst:
+		switch op {
+		case "==":
+			return BoolValue(l.Bool == r.Bool), nil
+		case "!=":
+			return BoolValue(l.Bool != r.Bool), nil
+		}
+	case l.Kind == IntConst && r.Kind == IntConst:
+		return intOp(op, typ, l.Int, r.Int)
+	case isNumeric(l) && isNumeric(r):
+		return floatOp(op, typ, toFloat(l), toFloat(r))
+	case l.Kind == r.Kind && (l.Kind == ArrayConst || l.Kind == TupleConst || l.Kind == StructConst) && (op == "==" || op == "!="):
+		equal := len(l.Elems) == len(r.Elems)
+		for i := 0; equal && i < len(l.Elems); i++ {
+			eq, err := BinaryOp("==", l.Elems[i], r.Elems[i])
+			if err != nil {
+				return Value{}, err
+			}
+			equal = eq.Bool
+		}
+		return BoolValue(equal == (op == "==")), nil
+	}
+	return Value{}, fmt.Errorf("invalid operation: %s %s %s (mismatched %s and %s)", l, op, r, l.Kind, r.Kind)
+}
+
+func isNumeric(v Value) bool {
+	return v.Kind == IntConst || v.Kind == FloatConst
+}
+
+func toFloat(v Value) float64 {
+	if v.Kind == FloatConst {
+		return v.Float
+	}
+	f, _ := new(big.Float).SetInt(v.Int).Float64()
+	return f
+}
+
+// unifyTypes returns the type of a binary operation's result. Untyped
+// operands adopt the type of the other side; two typed operands must agree.
+func unifyTypes(l, r Value) (string, error) {
+	switch {
+	case l.Type == "" && r.Type == "":
+		return "", nil
+	case l.Type == "":
+		return r.Type, nil
+	case r.Type == "":
+		return l.Type, nil
+	case sameType(l.Type, r.Type):
+		return l.Type, nil
+	}
+	return "", fmt.Errorf("mismatched types %s and %s", l.Type, r.Type)
+}
+
+// checkInt reports overflow of an integer result against its type
+func checkInt(v Value) (Value, error) {
+	if it, ok := LookupIntType(v.Type); ok {
+		if !it.Fits(v.Int) {
+			return Value{}, fmt.Errorf("constant %s overflows %s", v.Int, v.Type)
+		}
+	} else if v.Type == "char" {
+		if !validChar(v.Int) {
+			return Value{}, fmt.Errorf("constant %s is not a valid char", v.Int)
+		}
+	} else if v.Int.BitLen() > maxConstBits {
+		return Value{}, fmt.Errorf("constant overflow: result exceeds %d bits", maxConstBits)
+	}
+	return v, nil
+}
+
+func intOp(op, typ string, a, b *big.Int) (Value, error) {
+	result := new(big.Int)
+	switch op {
+	case "+":
+		result.Add(a, b)
+	case "-":
+		result.Sub(a, b)
+	case "*":
+		result.Mul(a, b)
+	case "/":
+		if b.Sign() == 0 {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		result.Quo(a, b) // truncates toward zero like C
+	case "%":
+		if b.Sign() == 0 {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		result.Rem(a, b)
+	case "**":
+		if b.Sign() < 0 {
+			return Value{}, fmt.Errorf("negative exponent %s in integer power", b)
+		}
+		if a.CmpAbs(big.NewInt(1)) > 0 && (!b.IsInt64() || b.Int64()*int64(a.BitLen()-1) > maxConstBits) {
+			return Value{}, fmt.Errorf("constant overflow: %s ** %s", a, b)
+		}
+		result.Exp(a, b, nil)
+	case "&":
+		result.And(a, b)
+	case "|":
+		result.Or(a, b)
+	case "^":
+		result.Xor(a, b)
+	case "==":
+		return BoolValue(a.Cmp(b) == 0), nil
+	case "!=":
+		return BoolValue(a.Cmp(b) != 0), nil
+	case "<":
+		return BoolValue(a.Cmp(b) < 0), nil
+	case ">":
+		return BoolValue(a.Cmp(b) > 0), nil
+	case "<=":
+		return BoolValue(a.Cmp(b) <= 0), nil
+	case ">=":
+		return BoolValue(a.Cmp(b) >= 0), nil
+	default:
+		return Value{}, fmt.Errorf("invalid integer operation %s", op)
+	}
+	return checkInt(Value{Kind: IntConst, Type: typ, Int: result})
+}
+
+func floatOp(op, typ string, a, b float64) (Value, error) {
+	var result float64
+	switch op {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		result = a * b
+	case "/":
+		if b == 0 {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		result = a / b
+	case "%":
+		if b == 0 {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		// As C's fmod, the result has the sign of a
+		result = math.Mod(a, b)
+	case "**":
+		result = math.Pow(a, b)
+	case "==":
+		return BoolValue(a == b), nil
+	case "!=":
+		return BoolValue(a != b), nil
+	case "<":
+		return BoolValue(a < b), nil
+	case ">":
+		return BoolValue(a > b), nil
+	case "<=":
+		return BoolValue(a <= b), nil
+	case ">=":
+		return BoolValue(a >= b), nil
+	default:
+		return Value{}, fmt.Errorf("invalid float operation %s", op)
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return Value{}, fmt.Errorf("constant overflow: %g %s %g", a, op, b)
+	}
+	if typ == "f32" || typ == "float" {
+		if math.Abs(result) > math.MaxFloat32 {
+			return Value{}, fmt.Errorf("constant %g overflows %s", result, typ)
+		}
+	}
+	return Value{Kind: FloatConst, Type: typ, Float: result}, nil
+}
+
+func stringOp(op, a, b string) (Value, error) {
+	switch op {
+	case "+":
+		return StringValue(a + b), nil
+	case "==":
+		return BoolValue(a == b), nil
+	case "!=":
+		return BoolValue(a != b), nil
+	case "<":
+		return BoolValue(a < b), nil
+	case ">":
+		return BoolValue(a > b), nil
+	case "<=":
+		return BoolValue(a <= b), nil
+	case ">=":
+		return BoolValue(a >= b), nil
+	}
+	return Value{}, fmt.Errorf("invalid string operation %s", op)
+}
+
+// shiftOp shifts the left operand; the result has the left operand's type
+func shiftOp(op string, l, r Value) (Value, error) {
+	if l.Kind != IntConst || r.Kind != IntConst {
+		return Value{}, fmt.Errorf("invalid operation: %s %s %s (shift of non-integer)", l, op, r)
+	}
+	if r.Int.Sign() < 0 {
+		return Value{}, fmt.Errorf("negative shift count %s", r.Int)
+	}
+	limit := int64(maxConstBits)
+	if it, ok := LookupIntType(l.Type); ok {
+		limit = int64(it.Bits) - 1
+	}
+	if !r.Int.IsInt64() || r.Int.Int64() > limit {
+		return Value{}, fmt.Errorf("shift count %s too large", r.Int)
+	}
+
+	n := uint(r.Int.Int64())
+	if op == "<<" {
+		return checkInt(Value{Kind: IntConst, Type: l.Type, Int: new(big.Int).Lsh(l.Int, n)})
+	}
+	return Value{Kind: IntConst, Type: l.Type, Int: new(big.Int).Rsh(l.Int, n)}, nil
+}
+
+// Literal converts a constant back into an AST literal, reusing the position
+// of the expression it replaces
+func Literal(v Value, at ast.Expression) ast.Expression {
+	tok := lexer.Token{}
+	if at != nil {
+		tok = tokenOf(at)
+	}
+
+	switch v.Kind {
+	case IntConst:
+		if v.Type == "char" {
+			r := rune(v.Int.Int64())
+			tok.Type, tok.Literal = lexer.CHAR, string(r)
+			return &ast.CharLiteral{Token: tok, Value: r}
+		}
+		tok.Type, tok.Literal = lexer.INT, v.Int.String()
+		lit := &ast.IntegerLiteral{Token: tok, Type: typeSuffix(v.Type)}
+		if v.Int.IsInt64() {
+			lit.Value = v.Int.Int64()
+		} else {
+			lit.Value = int64(v.Int.Uint64())
+		}
+		return lit
+	case FloatConst:
+		literal := strconv.FormatFloat(v.Float, 'g', -1, 64)
+		if _, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			literal += ".0"
+		}
+		tok.Type, tok.Literal = lexer.FLOAT, literal
+		return &ast.FloatLiteral{Token: tok, Value: v.Float, Type: typeSuffix(v.Type)}
+	case BoolConst:
+		tok.Type, tok.Literal = lexer.FALSE, "false"
+		if v.Bool {
+			tok.Type, tok.Literal = lexer.TRUE, "true"
+		}
+		return &ast.BooleanLiteral{Token: tok, Value: v.Bool}
+	case StringConst:
+		tok.Type, tok.Literal = lexer.STRING, v.Str
+		return &ast.StringLiteral{Token: tok, Value: v.Str}
+	case TupleConst:
+		tok.Type, tok.Literal = lexer.LPAREN, "("
+		tuple := &ast.TupleLiteral{Token: tok, Elements: []ast.Expression{}}
+		for _, elem := range v.Elems {
+			tuple.Elements = append(tuple.Elements, Literal(elem, at))
+		}
+		return tuple
+	default:
+		tok.Type, tok.Literal = lexer.LBRACKET, "["
+		arr := &ast.ArrayLiteral{Token: tok, Elements: []ast.Expression{}}
+		for _, elem := range v.Elems {
+			arr.Elements = append(arr.Elements, Literal(elem, at))
+		}
+		return arr
+	}
+}
+
+// typeSuffix returns the literal type for a constant's type, which is empty
+// for untyped constants and for types like int that have no suffix
+func typeSuffix(typ string) string {
+	if t := lexer.LookupIdent(typ); t >= lexer.I8_TYPE && t <= lexer.F64_TYPE {
+		return typ
+	}
+	return ""
+}
+
+// tokenOf returns the token an expression starts with, for positions
+func tokenOf(e ast.Expression) lexer.Token {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		return n.Token
+	case *ast.IntegerLiteral:
+		return n.Token
+	case *ast.FloatLiteral:
+		return n.Token
+	case *ast.InfixExpression:
+		return tokenOf(n.Left)
+	case *ast.PrefixExpression:
+		return n.Token
+	case *ast.CallExpression:
+		return tokenOf(n.Function)
+	case *ast.ArrayLiteral:
+		return n.Token
+	case *ast.IndexExpression:
+		return tokenOf(n.Left)
+	}
+	return lexer.Token{Literal: e.TokenLiteral()}
+}
@@ -0,0 +1,547 @@
+package semantic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// stringConverters maps the primitive types to the runtime function that
+// converts them to a string
+var stringConverters = map[string]string{
+	"int": "sango_string_from_int", "i32": "sango_string_from_int",
+	"i8": "sango_string_from_int", "i16": "sango_string_from_int",
+	"u8": "sango_string_from_int", "byte": "sango_string_from_int", "u16": "sango_string_from_int",
+	"long": "sango_string_from_long", "i64": "sango_string_from_long", "u32": "sango_string_from_long",
+	"u64":   "sango_string_from_ulong",
+	"float": "sango_string_from_float", "f32": "sango_string_from_float",
+	"double": "sango_string_from_double", "f64": "sango_string_from_double",
+	"bool":   "sango_string_from_bool",
+	"char":   "sango_string_from_char",
+	"string": ast.ConvertNone,
+}
+
+// CheckInterpolations resolves how each value embedded in a string is
+// converted. Primitive values use the matching sango_string_from_*
+// function, values of a type with a show method use that method, and values
+// with a format spec are formatted with the printf conversion it maps to.
+func CheckInterpolations(program *ast.Program) []string {
+	c := &interpChecker{
+		types:     newTypeScope(nil),
+		functions: make(map[string]*ast.TypeExpression),
+		structs:   make(map[string]*ast.StructStatement),
+		methods:   make(map[string]map[string]*ast.FunctionStatement),
+		errors:    []string{},
+	}
+	c.declare(program)
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	return c.errors
+}
+
+type interpChecker struct {
+	types     *typeScope
+	functions map[string]*ast.TypeExpression // return types
+	structs   map[string]*ast.StructStatement
+	methods   map[string]map[string]*ast.FunctionStatement // by type, then name
+	errors    []string
+}
+
+// typeScope maps the names visible in a block to their types. A nil type
+// means the name is bound but its type could not be inferred.
+type typeScope struct {
+	names  map[string]*ast.TypeExpression
+	parent *typeScope
+}
+
+func newTypeScope(parent *typeScope) *typeScope {
+	return &typeScope{names: make(map[string]*ast.TypeExpression), parent: parent}
+}
+
+func (s *typeScope) lookup(name string) (*ast.TypeExpression, bool) {
+	for ; s != nil; s = s.parent {
+		if t, ok := s.names[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// declare records the functions, structs and methods of the program, which
+// may be used before they are declared
+func (c *interpChecker) declare(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionStatement:
+			if s.Name != nil {
+				c.functions[s.Name.Value] = s.ReturnType
+			}
+		case *ast.ExternStatement:
+			for _, fn := range s.Functions {
+				c.functions[fn.Name.Value] = fn.ReturnType
+			}
+		case *ast.StructStatement:
+			if s.Name != nil {
+				c.structs[s.Name.Value] = s
+			}
+		case *ast.ImplStatement:
+			if s.ReceiverInfo == nil {
+				continue
+			}
+			methods := c.methods[s.ReceiverInfo.TypeName]
+			if methods == nil {
+				methods = make(map[string]*ast.FunctionStatement)
+				c.methods[s.ReceiverInfo.TypeName] = methods
+			}
+			for _, m := range s.Methods {
+				methods[m.Name.Value] = m
+			}
+		}
+	}
+}
+
+func (c *interpChecker) push() { c.types = newTypeScope(c.types) }
+func (c *interpChecker) pop()  { c.types = c.types.parent }
+
+func (c *interpChecker) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.ValStatement:
+		c.binding(s.Names, s.Type, s.Value)
+	case *ast.VarStatement:
+		c.binding(s.Names, s.Type, s.Value)
+	case *ast.ExpressionStatement:
+		c.expression(s.Expression)
+	case *ast.ReturnStatement:
+		c.expression(s.ReturnValue)
+	case *ast.AssignmentStatement:
+		c.expression(s.Value)
+	case *ast.DeferStatement:
+		c.expression(s.Expression)
+	case *ast.AssertStatement:
+		c.expression(s.Expression)
+	case *ast.FunctionStatement:
+		c.function(s.Parameters, s.Body, nil)
+	case *ast.ImplStatement:
+		var self *ast.TypeExpression
+		if s.ReceiverInfo != nil {
+			self = &ast.TypeExpression{Name: s.ReceiverInfo.TypeName}
+		}
+		for _, m := range s.Methods {
+			c.function(m.Parameters, m.Body, self)
+		}
+	case *ast.StructStatement:
+		for _, f := range s.Fields {
+			c.expression(f.Default)
+		}
+	case *ast.BlockStatement:
+		c.block(s)
+	case *ast.TestStatement:
+		c.block(s.Body)
+	case *ast.BenchStatement:
+		c.block(s.Body)
+	case *ast.WhileStatement:
+		c.expression(s.Condition)
+		c.block(s.Body)
+	case *ast.ForStatement:
+		c.expression(s.Iterable)
+		c.push()
+		if s.Variable != nil {
+			c.types.names[s.Variable.Value] = c.elementType(s.Iterable)
+		}
+		c.block(s.Body)
+		c.pop()
+	}
+}
+
+func (c *interpChecker) binding(names []*ast.Identifier, typ *ast.TypeExpression, value ast.Expression) {
+	c.expression(value)
+	if typ == nil && len(names) == 1 {
+		typ = c.typeOf(value)
+	}
+	for i, name := range names {
+		switch {
+		case len(names) == 1:
+			c.types.names[name.Value] = typ
+		case typ != nil && i < len(typ.Tuple):
+			c.types.names[name.Value] = &typ.Tuple[i]
+		default:
+			c.types.names[name.Value] = nil
+		}
+	}
+}
+
+func (c *interpChecker) function(params []*ast.Parameter, body ast.Expression, self *ast.TypeExpression) {
+	c.push()
+	if self != nil {
+		c.types.names["self"] = self
+	}
+	for _, param := range params {
+		if param.Name != nil && !(param.Name.Value == "self" && param.Type == nil) {
+			c.types.names[param.Name.Value] = param.Type
+		}
+	}
+	c.expression(body)
+	c.pop()
+}
+
+func (c *interpChecker) block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	c.push()
+	for _, stmt := range b.Statements {
+		c.statement(stmt)
+	}
+	c.pop()
+}
+
+// expression resolves the interpolations anywhere inside e
+func (c *interpChecker) expression(e ast.Expression) {
+	switch n := e.(type) {
+	case *ast.InterpolatedString:
+		for _, part := range n.Parts {
+			if in, ok := part.(*ast.Interpolation); ok {
+				c.expression(in.Value)
+				c.resolve(in)
+			}
+		}
+	case *ast.PrefixExpression:
+		c.expression(n.Right)
+	case *ast.InfixExpression:
+		c.expression(n.Left)
+		c.expression(n.Right)
+	case *ast.CallExpression:
+		c.expression(n.Function)
+		c.expressions(n.Arguments)
+	case *ast.BuiltinFunctionCall:
+		c.expressions(n.Arguments)
+	case *ast.ArrayLiteral:
+		c.expressions(n.Elements)
+	case *ast.TupleLiteral:
+		c.expressions(n.Elements)
+	case *ast.IndexExpression:
+		c.expression(n.Left)
+		c.expression(n.Index)
+	case *ast.RangeExpression:
+		c.expression(n.Start)
+		c.expression(n.End)
+	case *ast.StructLiteral:
+		for _, f := range n.Fields {
+			c.expression(f.Value)
+		}
+	case *ast.IfExpression:
+		c.expression(n.Condition)
+		c.block(n.Consequence)
+		c.block(n.Alternative)
+	case *ast.BlockStatement:
+		c.block(n)
+	case *ast.FunctionLiteral:
+		c.function(n.Parameters, n.Body, nil)
+	case *ast.MatchExpression:
+		c.expression(n.Value)
+		for _, mc := range n.Cases {
+			c.expression(mc.Guard)
+			c.expression(mc.Value)
+		}
+	}
+}
+
+func (c *interpChecker) expressions(es []ast.Expression) {
+	for _, e := range es {
+		c.expression(e)
+	}
+}
+
+// resolve picks the conversion of one interpolated value
+func (c *interpChecker) resolve(in *ast.Interpolation) {
+	typ := c.typeOf(in.Value)
+	if typ == nil {
+		c.addError(in, fmt.Sprintf("cannot infer the type of %s in string interpolation", in.Value))
+		return
+	}
+	in.Type = typ
+
+	name := ""
+	if !typ.Array && !typ.Pointer && typ.Function == nil && len(typ.Tuple) == 0 && typ.Record == nil {
+		name = typ.Name
+	}
+	converter, primitive := stringConverters[name]
+	if !primitive {
+		if !c.hasShow(name) {
+			c.addError(in, fmt.Sprintf("cannot interpolate value of type %s, which has no show method", typ))
+			return
+		}
+		converter = ast.ConvertShow
+	}
+
+	if in.Format == "" {
+		in.Converter = converter
+		return
+	}
+	format, err := printfFormat(in.Format, name, primitive)
+	if err != nil {
+		c.addError(in, err.Error())
+		return
+	}
+	in.Converter, in.CFormat = ast.ConvertFormat, format
+}
+
+// hasShow reports whether the named type has a show method taking no
+// arguments other than its receiver and returning a string
+func (c *interpChecker) hasShow(name string) bool {
+	m, ok := c.methods[name]["show"]
+	if !ok {
+		return false
+	}
+	for _, param := range m.Parameters {
+		if param.Name == nil || param.Name.Value != "self" {
+			return false
+		}
+	}
+	if m.ReturnType != nil {
+		return m.ReturnType.String() == "string"
+	}
+	t := c.typeOf(m.Body)
+	return t != nil && t.String() == "string"
+}
+
+func (c *interpChecker) addError(in *ast.Interpolation, msg string) {
+	c.errors = append(c.errors, fmt.Sprintf("%s at line %d:%d", msg, in.Token.Line, in.Token.Column))
+}
+
+// formatSpec is [flags][width][.precision][verb], as in printf
+var formatSpec = regexp.MustCompile(`^([-+ 0#]*)([0-9]*)(\.[0-9]+)?([dxXoeEfgGsc]?)$`)
+
+// printfFormat translates a format spec for a value of the named type into
+// a printf conversion. Values of types with a show method are formatted as
+// the string it returns.
+func printfFormat(spec, name string, primitive bool) (string, error) {
+	m := formatSpec.FindStringSubmatch(spec)
+	if m == nil {
+		return "", fmt.Errorf("invalid format spec %q", spec)
+	}
+	flags, width, precision, verb := m[1], m[2], m[3], m[4]
+
+	kind := "string"
+	if primitive {
+		kind = typeKind(name)
+	}
+	allowed := map[string]string{
+		"int":    "dxXoc",
+		"float":  "eEfgG",
+		"char":   "cdxXo",
+		"string": "s",
+		"bool":   "s",
+	}[kind]
+	if verb == "" {
+		verb = allowed[:1]
+	}
+	if !strings.Contains(allowed, verb) {
+		return "", fmt.Errorf("format %q does not apply to %s values", spec, name)
+	}
+
+	length := ""
+	if kind == "int" && verb != "c" {
+		it, _ := LookupIntType(name)
+		if it.Bits == 64 {
+			length = "ll"
+		}
+		if verb == "d" && !it.Signed {
+			verb = "u"
+		}
+	}
+	return "%" + flags + width + precision + length + verb, nil
+}
+
+// typeKind groups the primitive types by the format verbs they accept
+func typeKind(name string) string {
+	switch name {
+	case "float", "f32", "double", "f64":
+		return "float"
+	case "char", "bool", "string":
+		return name
+	}
+	return "int"
+}
+
+// numericRank orders the numeric types so that mixed arithmetic takes the
+// type of its wider operand
+var numericRank = map[string]int{
+	"i8": 1, "u8": 2, "byte": 2, "i16": 3, "u16": 4,
+	"int": 5, "i32": 5, "u32": 6, "long": 7, "i64": 7, "u64": 8,
+	"float": 9, "f32": 9, "double": 10, "f64": 10,
+}
+
+// NumericRank returns the rank of a numeric type: of two operands of mixed
+// arithmetic, the result has the type of higher rank
+func NumericRank(name string) (int, bool) {
+	rank, ok := numericRank[name]
+	return rank, ok
+}
+
+// typeOf infers the type of an expression from literals, declarations and
+// function signatures. It returns nil when the type cannot be inferred.
+func (c *interpChecker) typeOf(e ast.Expression) *ast.TypeExpression {
+	named := func(name string) *ast.TypeExpression { return &ast.TypeExpression{Name: name} }
+
+	switch n := e.(type) {
+	case *ast.IntegerLiteral:
+		if n.Type != "" {
+			return named(n.Type)
+		}
+		return named("int")
+	case *ast.FloatLiteral:
+		if n.Type != "" {
+			return named(n.Type)
+		}
+		return named("double")
+	case *ast.StringLiteral, *ast.InterpolatedString:
+		return named("string")
+	case *ast.CharLiteral:
+		return named("char")
+	case *ast.BooleanLiteral:
+		return named("bool")
+	case *ast.SizeofExpression, *ast.OffsetofExpression:
+		return named("u64")
+	case *ast.StructLiteral:
+		if n.Name != nil {
+			return named(n.Name.Value)
+		}
+	case *ast.ArrayLiteral:
+		if len(n.Elements) > 0 {
+			if t := c.typeOf(n.Elements[0]); t != nil {
+				return &ast.TypeExpression{Array: true, ElementType: t}
+			}
+		}
+	case *ast.Identifier:
+		if t, ok := c.types.lookup(n.Value); ok {
+			return t
+		}
+	case *ast.PrefixExpression:
+		switch n.Operator {
+		case "!":
+			return named("bool")
+		case "&":
+			if t := c.typeOf(n.Right); t != nil {
+				return &ast.TypeExpression{Pointer: true, ElementType: t}
+			}
+		case "*":
+			if t := c.typeOf(n.Right); t != nil && t.Pointer {
+				return t.ElementType
+			}
+		default:
+			return c.typeOf(n.Right)
+		}
+	case *ast.InfixExpression:
+		return c.infixType(n)
+	case *ast.IndexExpression:
+		t := c.typeOf(n.Left)
+		switch {
+		case t == nil:
+		case t.Array && isRange(n.Index):
+			return t
+		case t.Array:
+			return t.ElementType
+		case t.Name == "string" && isRange(n.Index):
+			return t
+		case t.Name == "string":
+			return named("u8")
+		}
+	case *ast.CallExpression:
+		switch fn := n.Function.(type) {
+		case *ast.Identifier:
+			if _, local := c.types.lookup(fn.Value); !local {
+				return c.functions[fn.Value]
+			}
+		case *ast.InfixExpression:
+			if fn.Operator != "." {
+				break
+			}
+			recv := c.typeOf(fn.Left)
+			method, ok := fn.Right.(*ast.Identifier)
+			if recv != nil && ok {
+				if m, ok := c.methods[recv.Name][method.Value]; ok {
+					return m.ReturnType
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *interpChecker) infixType(n *ast.InfixExpression) *ast.TypeExpression {
+	switch n.Operator {
+	case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+		return &ast.TypeExpression{Name: "bool"}
+	case ".":
+		return c.fieldType(c.typeOf(n.Left), n.Right)
+	}
+
+	left, right := c.typeOf(n.Left), c.typeOf(n.Right)
+	if left == nil || right == nil {
+		return nil
+	}
+	if n.Operator == "+" && left.Name == "string" && right.Name == "string" {
+		return left
+	}
+	lr, lok := numericRank[left.Name]
+	rr, rok := numericRank[right.Name]
+	if !lok || !rok {
+		return nil
+	}
+	switch n.Operator {
+	case "<<", ">>":
+		return left
+	}
+	if rr > lr {
+		return right
+	}
+	return left
+}
+
+// fieldType returns the type of a field of a struct or record value
+func (c *interpChecker) fieldType(t *ast.TypeExpression, field ast.Expression) *ast.TypeExpression {
+	name, ok := field.(*ast.Identifier)
+	if t == nil || !ok {
+		return nil
+	}
+	if t.Pointer {
+		t = t.ElementType
+	}
+	if t.Record != nil {
+		for _, f := range t.Record.Fields {
+			if f.Name.Value == name.Value {
+				return f.Type
+			}
+		}
+		return nil
+	}
+	if s, ok := c.structs[t.Name]; ok {
+		if f := s.Field(name.Value); f != nil {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// elementType returns the type of the values a for loop iterates over
+func (c *interpChecker) elementType(iterable ast.Expression) *ast.TypeExpression {
+	if r, ok := iterable.(*ast.RangeExpression); ok {
+		if t := c.typeOf(r.Start); t != nil {
+			return t
+		}
+		return c.typeOf(r.End)
+	}
+	if t := c.typeOf(iterable); t != nil && t.Array {
+		return t.ElementType
+	}
+	return nil
+}
+
+func isRange(e ast.Expression) bool {
+	_, ok := e.(*ast.RangeExpression)
+	return ok
+}
@@ -0,0 +1,115 @@
+package semantic
+
+import (
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// interpolations returns the interpolations of the last statement's string
+func interpolations(program *ast.Program) []*ast.Interpolation {
+	stmt := program.Statements[len(program.Statements)-1].(*ast.ValStatement)
+	parts := []*ast.Interpolation{}
+	for _, part := range stmt.Value.(*ast.InterpolatedString).Parts {
+		if in, ok := part.(*ast.Interpolation); ok {
+			parts = append(parts, in)
+		}
+	}
+	return parts
+}
+
+func TestInterpolationConverters(t *testing.T) {
+	input := `
+struct Point { x: int, y: int }
+impl Point {
+    def show(): string = "(${self.x}, ${self.y})"
+}
+def area(w: double, h: double): double = w * h
+val name = "world"
+val big: u64 = 3
+val p = Point { x: 1, y: 2 }
+val s = "${name} ${big} ${area(2.0, 3.0)} ${p} ${p.y} ${'c'} ${big > 2} ${1.5} ${[1, 2][0] + big}"`
+
+	expected := []string{
+		ast.ConvertNone,
+		"sango_string_from_ulong",
+		"sango_string_from_double",
+		ast.ConvertShow,
+		"sango_string_from_int",
+		"sango_string_from_char",
+		"sango_string_from_bool",
+		"sango_string_from_double",
+		"sango_string_from_ulong",
+	}
+
+	program := parse(t, input)
+	if errs := CheckInterpolations(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	parts := interpolations(program)
+	if len(parts) != len(expected) {
+		t.Fatalf("expected %d interpolations, got %d", len(expected), len(parts))
+	}
+	for i, conv := range expected {
+		if parts[i].Converter != conv {
+			t.Errorf("${%s}: expected converter %q, got %q", parts[i].Value, conv, parts[i].Converter)
+		}
+	}
+}
+
+func TestInterpolationFormats(t *testing.T) {
+	tests := []struct {
+		decl     string
+		spec     string
+		expected string
+	}{
+		{"val x = 2.5", ".2f", "%.2f"},
+		{"val x = 2.5", "10", "%10e"},
+		{"val x = 42", "05d", "%05d"},
+		{"val x = 42", "x", "%x"},
+		{"val x: u32 = 42", "d", "%u"},
+		{"val x: i64 = 42", "+d", "%+lld"},
+		{"val x: u64 = 42", "#X", "%#llX"},
+		{`val x = "s"`, "-8", "%-8s"},
+		{`val x = "s"`, ".3s", "%.3s"},
+		{"val x = 'c'", "3", "%3c"},
+		{"val x = 'c'", "d", "%d"},
+		{"val x = true", "5", "%5s"},
+	}
+
+	for _, tt := range tests {
+		input := tt.decl + "\nval s = \"${x:" + tt.spec + "}\""
+		program := parse(t, input)
+		if errs := CheckInterpolations(program); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", input, errs)
+			continue
+		}
+		in := interpolations(program)[0]
+		if in.Converter != ast.ConvertFormat || in.CFormat != tt.expected {
+			t.Errorf("%s: expected %q, got %s %q", input, tt.expected, in.Converter, in.CFormat)
+		}
+	}
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val s = "${x}"`, "cannot infer the type of x in string interpolation at line 1:9"},
+		{"struct P { x: int }\nval p = P { x: 1 }\nval s = \"${p}\"",
+			"cannot interpolate value of type P, which has no show method at line 3:9"},
+		{"val a = [1, 2]\nval s = \"${a}\"", "cannot interpolate value of type []int, which has no show method at line 2:9"},
+		{"val x = 1\nval s = \"${x:.2f}\"", `format ".2f" does not apply to int values at line 2:9`},
+		{"val x = 1.0\nval s = \"${x:d}\"", `format "d" does not apply to double values at line 2:9`},
+		{"val x = 1\nval s = \"${x:%d}\"", `invalid format spec "%d" at line 2:9`},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		errs := CheckInterpolations(program)
+		if len(errs) != 1 || errs[0] != tt.expected {
+			t.Errorf("%s: expected %q, got %v", tt.input, tt.expected, errs)
+		}
+	}
+}
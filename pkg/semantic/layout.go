@@ -0,0 +1,336 @@
+package semantic
+
+import (
+	"fmt"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// Layout is the size and alignment of a type in bytes. Layouts follow the C
+// ABI of LP64 targets, which is what the generated C is compiled for.
+type Layout struct {
+	Size   int64
+	Align  int64
+	Fields []FieldLayout // struct and tuple fields in declaration order
+}
+
+// FieldLayout is the placement of a field inside a struct or tuple
+type FieldLayout struct {
+	Name   string
+	Offset int64
+	Layout Layout
+}
+
+// Field returns the placement of the named field
+func (l Layout) Field(name string) (FieldLayout, bool) {
+	for _, f := range l.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldLayout{}, false
+}
+
+// pointerLayout is used for pointers, strings, function values and dynamic
+// arrays, which are sango_array pointers at runtime
+var pointerLayout = Layout{Size: 8, Align: 8}
+
+// primitiveLayouts maps the primitive types to their C layouts
+var primitiveLayouts = map[string]Layout{
+	"i8": {Size: 1, Align: 1}, "u8": {Size: 1, Align: 1}, "byte": {Size: 1, Align: 1}, "bool": {Size: 1, Align: 1},
+	"i16": {Size: 2, Align: 2}, "u16": {Size: 2, Align: 2},
+	"i32": {Size: 4, Align: 4}, "u32": {Size: 4, Align: 4}, "int": {Size: 4, Align: 4}, "char": {Size: 4, Align: 4},
+	"f32": {Size: 4, Align: 4}, "float": {Size: 4, Align: 4},
+	"i64": {Size: 8, Align: 8}, "u64": {Size: 8, Align: 8}, "long": {Size: 8, Align: 8},
+	"f64": {Size: 8, Align: 8}, "double": {Size: 8, Align: 8},
+	"string": pointerLayout,
+}
+
+// UnknownTypeError is returned for type names that are not declared in the
+// program. They may still be valid C types from an included header.
+type UnknownTypeError struct {
+	Name string
+}
+
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("unknown type %s", e.Name)
+}
+
+// Layouts computes the layout of the types declared in a program
+type Layouts struct {
+	structs map[string]*ast.StructStatement
+	aliases map[string]*ast.TypeExpression
+	cache   map[string]Layout
+	active  map[string]bool // named types being laid out, to detect cycles
+
+	// eval evaluates array lengths and attribute arguments
+	eval func(ast.Expression) (Value, error)
+}
+
+// NewLayouts creates a layout table that knows only the primitive types
+func NewLayouts() *Layouts {
+	return &Layouts{
+		structs: make(map[string]*ast.StructStatement),
+		aliases: make(map[string]*ast.TypeExpression),
+		cache:   make(map[string]Layout),
+		active:  make(map[string]bool),
+	}
+}
+
+// Declare registers struct and type alias declarations
+func (ls *Layouts) Declare(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.StructStatement:
+		if s != nil && s.Name != nil {
+			ls.structs[s.Name.Value] = s
+		}
+	case *ast.TypeStatement:
+		if s != nil && s.Name != nil && s.Type != nil {
+			ls.aliases[s.Name.Value] = s.Type
+		}
+	}
+}
+
+// Alias returns the type that a type alias stands for
+func (ls *Layouts) Alias(name string) (*ast.TypeExpression, bool) {
+	te, ok := ls.aliases[name]
+	return te, ok
+}
+
+// IsType reports whether name is a primitive or declared type
+func (ls *Layouts) IsType(name string) bool {
+	if _, ok := primitiveLayouts[name]; ok {
+		return true
+	}
+	if _, ok := ls.structs[name]; ok {
+		return true
+	}
+	_, ok := ls.aliases[name]
+	return ok
+}
+
+// Of returns the layout of a type expression
+func (ls *Layouts) Of(te *ast.TypeExpression) (Layout, error) {
+	switch {
+	case te == nil:
+		return Layout{}, fmt.Errorf("missing type")
+	case te.Pointer, te.Function != nil:
+		return pointerLayout, nil
+	case te.Array:
+		if te.Length == nil {
+			return pointerLayout, nil
+		}
+		return ls.fixedArray(te)
+	case len(te.Tuple) > 0:
+		fields := make([]namedType, len(te.Tuple))
+		for i := range te.Tuple {
+			fields[i] = namedType{tupleField(i), &te.Tuple[i]}
+		}
+		return ls.structLayout(fields, false)
+	case te.Record != nil:
+		fields := make([]namedType, len(te.Record.Fields))
+		for i, f := range te.Record.Fields {
+			fields[i] = namedType{f.Name.Value, f.Type}
+		}
+		return ls.structLayout(fields, false)
+	}
+	return ls.Named(te.Name)
+}
+
+// Named returns the layout of a primitive or declared type
+func (ls *Layouts) Named(name string) (Layout, error) {
+	if l, ok := primitiveLayouts[name]; ok {
+		return l, nil
+	}
+	if name == "void" {
+		return Layout{}, fmt.Errorf("void has no size")
+	}
+	if l, ok := ls.cache[name]; ok {
+		return l, nil
+	}
+
+	if ls.active[name] {
+		return Layout{}, fmt.Errorf("type %s contains itself", name)
+	}
+	ls.active[name] = true
+	defer delete(ls.active, name)
+
+	var l Layout
+	var err error
+	if s, ok := ls.structs[name]; ok {
+		l, err = ls.declaredStruct(s)
+	} else if alias, ok := ls.aliases[name]; ok {
+		l, err = ls.Of(alias)
+	} else {
+		return Layout{}, &UnknownTypeError{Name: name}
+	}
+	if err != nil {
+		return Layout{}, err
+	}
+
+	ls.cache[name] = l
+	return l, nil
+}
+
+// Offsetof returns the byte offset of a field, following a path of field
+// names through nested structs
+func (ls *Layouts) Offsetof(te *ast.TypeExpression, path []string) (int64, error) {
+	l, err := ls.Of(te)
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	typeName := te.String()
+	for _, name := range path {
+		f, ok := l.Field(name)
+		if !ok {
+			return 0, fmt.Errorf("type %s has no field %s", typeName, name)
+		}
+		offset += f.Offset
+		l = f.Layout
+		typeName = name
+	}
+	return offset, nil
+}
+
+// declaredStruct lays out a struct declaration, applying @packed and
+// @align(n) the way the GCC attributes of the same names do
+func (ls *Layouts) declaredStruct(s *ast.StructStatement) (Layout, error) {
+	packed := false
+	var align int64
+	for _, attr := range s.Attributes {
+		switch attr.Name {
+		case "packed":
+			if len(attr.Arguments) != 0 {
+				return Layout{}, fmt.Errorf("@packed takes no arguments")
+			}
+			packed = true
+		case "align":
+			if len(attr.Arguments) != 1 {
+				return Layout{}, fmt.Errorf("@align expects 1 argument, got %d", len(attr.Arguments))
+			}
+			n, err := ls.constInt(attr.Arguments[0], "alignment")
+			if err != nil {
+				return Layout{}, err
+			}
+			if n <= 0 || n&(n-1) != 0 {
+				return Layout{}, fmt.Errorf("alignment %d is not a power of two", n)
+			}
+			align = n
+		default:
+			return Layout{}, fmt.Errorf("unknown struct attribute @%s", attr.Name)
+		}
+	}
+
+	fields := make([]namedType, len(s.Fields))
+	for i, f := range s.Fields {
+		fields[i] = namedType{f.Name.Value, f.Type}
+	}
+	l, err := ls.structLayout(fields, packed)
+	if err != nil {
+		return Layout{}, err
+	}
+
+	// Like aligned(n), @align only ever raises the alignment
+	if align > l.Align {
+		l.Align = align
+		l.Size = alignUp(l.Size, align)
+	}
+	return l, nil
+}
+
+// ArrayLength returns the constant length of a fixed array type
+func (ls *Layouts) ArrayLength(te *ast.TypeExpression) (int64, error) {
+	n, err := ls.constInt(te.Length, "array length")
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("invalid array length %d", n)
+	}
+	return n, nil
+}
+
+func (ls *Layouts) fixedArray(te *ast.TypeExpression) (Layout, error) {
+	n, err := ls.ArrayLength(te)
+	if err != nil {
+		return Layout{}, err
+	}
+
+	elem, err := ls.Of(te.ElementType)
+	if err != nil {
+		return Layout{}, err
+	}
+	return Layout{Size: n * elem.Size, Align: elem.Align}, nil
+}
+
+// constInt evaluates an integer constant used in a type
+func (ls *Layouts) constInt(e ast.Expression, what string) (int64, error) {
+	if ls.eval == nil {
+		return 0, fmt.Errorf("%s %s is not constant", what, e)
+	}
+	v, err := ls.eval(e)
+	if err == ErrNotConstant {
+		return 0, fmt.Errorf("%s %s is not constant", what, e)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if v.Kind != IntConst || !v.Int.IsInt64() {
+		return 0, fmt.Errorf("invalid %s %s", what, v)
+	}
+	return v.Int.Int64(), nil
+}
+
+type namedType struct {
+	name string
+	typ  *ast.TypeExpression
+}
+
+// tupleField names the i-th member of a tuple's C struct
+func tupleField(i int) string {
+	return fmt.Sprintf("_%d", i)
+}
+
+func (ls *Layouts) structLayout(fields []namedType, packed bool) (Layout, error) {
+	names := make([]string, len(fields))
+	layouts := make([]Layout, len(fields))
+	for i, f := range fields {
+		fl, err := ls.Of(f.typ)
+		if err != nil {
+			return Layout{}, err
+		}
+		names[i], layouts[i] = f.name, fl
+	}
+	return placeFields(names, layouts, packed), nil
+}
+
+// placeFields lays fields out in order, aligning each to its own alignment,
+// and pads the total size to the largest alignment as C does. Packed fields
+// are placed back to back with no padding.
+func placeFields(names []string, fields []Layout, packed bool) Layout {
+	l := Layout{Align: 1, Fields: make([]FieldLayout, len(fields))}
+	for i, fl := range fields {
+		if packed {
+			l.Fields[i] = FieldLayout{Name: names[i], Offset: l.Size, Layout: fl}
+			l.Size += fl.Size
+			continue
+		}
+		l.Size = alignUp(l.Size, fl.Align)
+		l.Fields[i] = FieldLayout{Name: names[i], Offset: l.Size, Layout: fl}
+		l.Size += fl.Size
+		if fl.Align > l.Align {
+			l.Align = fl.Align
+		}
+	}
+	l.Size = alignUp(l.Size, l.Align)
+	return l
+}
+
+func alignUp(n, align int64) int64 {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
@@ -0,0 +1,155 @@
+package semantic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLayoutOfTypes(t *testing.T) {
+	input := `struct Header {
+  tag: u8
+  length: u32
+  flags: u16
+}
+struct Packet {
+  id: u64
+  header: Header
+  payload: [PAYLOAD]u8
+  next: *Packet
+}
+type Pair (u8, double)
+define PAYLOAD = 3
+val header_size = sizeof(Header);
+val header_align = alignof(Header);
+val packet_size = sizeof(Packet);
+val flags_at = offsetof(Packet, header.flags);
+val next_at = offsetof(Packet, next);
+val pair_size = sizeof(Pair);
+val tuple_size = sizeof((i16, i64, u8));
+val grid_size = sizeof([2][3]i16);
+val slice_size = sizeof([]int);
+val lit_size = sizeof(1);
+val char_size = sizeof(char);
+val char_align = alignof(char);`
+
+	_, ev := evaluate(t, input)
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	expected := map[string]string{
+		"header_size":  "12",
+		"header_align": "4",
+		"packet_size":  "32", // 8 + 12 + 3, padded to 24, then the pointer
+		"flags_at":     "16",
+		"next_at":      "24",
+		"pair_size":    "16",
+		"tuple_size":   "24",
+		"grid_size":    "12",
+		"slice_size":   "8",
+		"lit_size":     "4",
+		"char_size":    "4",
+		"char_align":   "4",
+	}
+	for name, want := range expected {
+		v, ok := ev.Constant(name)
+		if !ok {
+			t.Errorf("%s is not constant", name)
+			continue
+		}
+		if v.String() != want {
+			t.Errorf("%s: expected=%s, got=%s", name, want, v)
+		}
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"struct Node { value: int\n next: Node }", "type Node contains itself"},
+		{"struct Point { x: int }\nval x = offsetof(Point, y);", "type Point has no field y"},
+		{"val x = sizeof(void);", "void has no size"},
+		{"val x = sizeof([n]int);", "array length n is not constant"},
+	}
+
+	for _, tt := range tests {
+		_, ev := evaluate(t, tt.input)
+		errs := ev.Errors()
+		if len(errs) == 0 {
+			t.Errorf("%s: expected error %q", tt.input, tt.err)
+			continue
+		}
+		if !strings.Contains(errs[0], tt.err) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.err, errs[0])
+		}
+	}
+}
+
+func TestSizeofLeavesCTypesToCompiler(t *testing.T) {
+	_, ev := evaluate(t, "val x = sizeof(FILE);")
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if _, ok := ev.Constant("x"); ok {
+		t.Errorf("sizeof(FILE) should be left to the C compiler")
+	}
+}
+
+func TestLayoutAttributes(t *testing.T) {
+	input := `@packed struct Wire { tag: u8, length: u32, flags: u16 }
+@align(16) struct Vec { x: f32, y: f32, z: f32 }
+@packed @align(4) struct Both { a: u8, b: u16 }
+val wire_size = sizeof(Wire);
+val flags_at = offsetof(Wire, flags);
+val wire_align = alignof(Wire);
+val vec_size = sizeof(Vec);
+val vec_align = alignof(Vec);
+val both_size = sizeof(Both);
+val record_at = offsetof({ a: u8, b: u64 }, b);`
+
+	_, ev := evaluate(t, input)
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	expected := map[string]string{
+		"wire_size":  "7",
+		"flags_at":   "5",
+		"wire_align": "1",
+		"vec_size":   "16",
+		"vec_align":  "16",
+		"both_size":  "4",
+		"record_at":  "8",
+	}
+	for name, want := range expected {
+		v, ok := ev.Constant(name)
+		if !ok {
+			t.Errorf("%s is not constant", name)
+			continue
+		}
+		if v.String() != want {
+			t.Errorf("%s: expected=%s, got=%s", name, want, v)
+		}
+	}
+}
+
+func TestLayoutAttributeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"@align(12) struct A { x: int }", "alignment 12 is not a power of two"},
+		{"@packed(1) struct A { x: int }", "@packed takes no arguments"},
+		{"@pack struct A { x: int }", "unknown struct attribute @pack"},
+	}
+
+	for _, tt := range tests {
+		_, ev := evaluate(t, tt.input)
+		errs := ev.Errors()
+		if len(errs) == 0 || !strings.Contains(errs[0], tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.err, errs)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package semantic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// PositionError is an error that knows where in the source it happened
+type PositionError interface {
+	error
+	Position() (line, column int)
+}
+
+// AssertionError is a failed assert. For a comparison it holds the values
+// of the operands that are not literals, so assert(a == b) shows a and b.
+type AssertionError struct {
+	Expression string
+	Operands   []Operand
+	Line       int
+	Column     int
+}
+
+// Operand is the value of an operand of a failed assert
+type Operand struct {
+	Expression string
+	Value      Value
+}
+
+// Position returns the position of the assert
+func (e *AssertionError) Position() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *AssertionError) Error() string {
+	if len(e.Operands) == 0 {
+		return "assertion failed: " + e.Expression
+	}
+	values := make([]string, len(e.Operands))
+	for i, op := range e.Operands {
+		values[i] = fmt.Sprintf("%s = %s", op.Expression, op.Value)
+	}
+	return fmt.Sprintf("assertion failed: %s (%s)", e.Expression, strings.Join(values, ", "))
+}
+
+// comparisons are the operators whose operands a failed assert shows
+var comparisons = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// NewAssertionError returns the failure of an assert, without operands
+func NewAssertionError(s *ast.AssertStatement) *AssertionError {
+	return &AssertionError{Expression: Source(s.Expression), Line: s.Token.Line, Column: s.Token.Column}
+}
+
+// AssertOperands returns the operands whose values a failed assert of e
+// shows: those of a comparison that are not literals
+func AssertOperands(e ast.Expression) []ast.Expression {
+	infix, ok := e.(*ast.InfixExpression)
+	if !ok || !comparisons[infix.Operator] {
+		return nil
+	}
+	operands := []ast.Expression{}
+	for _, operand := range []ast.Expression{infix.Left, infix.Right} {
+		if !isLiteral(operand) {
+			operands = append(operands, operand)
+		}
+	}
+	return operands
+}
+
+func (ev *Evaluator) assertionError(s *ast.AssertStatement, env *scope) error {
+	e := NewAssertionError(s)
+	for _, operand := range AssertOperands(s.Expression) {
+		if v, err := ev.eval(operand, env); err == nil {
+			e.Operands = append(e.Operands, Operand{Source(operand), v})
+		}
+	}
+	return e
+}
+
+// Source prints an expression without the parentheses that infix
+// expressions print in
+func Source(e ast.Expression) string {
+	s := e.String()
+	if _, ok := e.(*ast.InfixExpression); ok {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	}
+	return s
+}
+
+func isLiteral(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.CharLiteral, *ast.BooleanLiteral:
+		return true
+	}
+	return false
+}
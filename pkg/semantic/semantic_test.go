@@ -0,0 +1,378 @@
+package semantic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/lexer"
+	"github.com/rxxuzi/sango/pkg/macro"
+	"github.com/rxxuzi/sango/pkg/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	if errs := macro.Expand(program); len(errs) > 0 {
+		t.Fatalf("macro errors: %v", errs)
+	}
+	return program
+}
+
+func evaluate(t *testing.T, input string) (*ast.Program, *Evaluator) {
+	t.Helper()
+	program := parse(t, input)
+	ev := NewEvaluator()
+	ev.EvaluateProgram(program)
+	return program, ev
+}
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"val x = 1 + 2 * 3;", "7"},
+		{"val x = (1 << 62) * 4 / (1 << 60);", "16"},
+		{"val x = -7 / 2;", "-3"},
+		{"val x = -7 % 2;", "-1"},
+		{"val x = 2 ** 10;", "1024"},
+		{"val x = 255 & ~15;", "240"},
+		{"val x = 1.5 * 2;", "3"},
+		{"val x = 5.5 % 2.0;", "1.5"},
+		{"val x = -5.5 % 2.0;", "-1.5"},
+		{"val x = 3 > 2 && !false;", "true"},
+		{`val x = "ab" + "cd";`, `"abcd"`},
+		{"val x = [1, 2, 3][1];", "2"},
+		{"val x = sizeof(u32) * 2;", "8"},
+		{"val x: u8 = 255;", "255"},
+	}
+
+	for _, tt := range tests {
+		_, ev := evaluate(t, tt.input)
+		if errs := ev.Errors(); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", tt.input, errs)
+			continue
+		}
+		v, ok := ev.Constant("x")
+		if !ok {
+			t.Errorf("%s: x is not constant", tt.input)
+			continue
+		}
+		if v.String() != tt.expected {
+			t.Errorf("%s: expected=%s, got=%s", tt.input, tt.expected, v)
+		}
+	}
+}
+
+func TestOverflowIsPerWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"val x: u8 = 256;", "constant 256 overflows u8"},
+		{"val x = 2147483647 + 1;", "constant 2147483648 overflows int"},
+		{"val x = 1 << 100;", "overflows int"},
+		{"val x = [1, 1 << 40];", "constant 1099511627776 overflows int"},
+		{"val x: i8 = -129;", "constant -129 overflows i8"},
+		{"val a: u32 = 4000000000; val x = a * 2;", "constant 8000000000 overflows u32"},
+		{"val a: i64 = 1; val x = a << 63;", "overflows i64"},
+		{"val a: u8 = 1; val x = a << 8;", "shift count 8 too large"},
+		{"val a: u8 = 0; val x = -a - 1;", "constant -1 overflows u8"},
+		{"val x = 1 / 0;", "division by zero"},
+		{"val x = 5 % (2 - 2);", "division by zero"},
+		{"val x = 5.5 % 0.0;", "division by zero"},
+		{"val a: i32 = 1; val b: i64 = 2; val x = a + b;", "mismatched types i32 and i64"},
+		{"define LIMIT: u16 = 70000", "define LIMIT: constant 70000 overflows u16"},
+		{"val x = [1, 2][2];", "index 2 out of range"},
+		{"val x = 200u8 + 100u8;", "constant 300 overflows u8"},
+		{"val x = 1i32 + 1i64;", "mismatched types i32 and i64"},
+		{"val x = 'a' - 'b';", "constant -1 is not a valid char"},
+		{"val x: char = 0xD800;", "constant 55296 is not a valid char"},
+	}
+
+	for _, tt := range tests {
+		_, ev := evaluate(t, tt.input)
+		errs := ev.Errors()
+		if len(errs) == 0 {
+			t.Errorf("%s: expected error %q", tt.input, tt.err)
+			continue
+		}
+		if !strings.Contains(errs[0], tt.err) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.err, errs[0])
+		}
+	}
+}
+
+func TestTypedUnsignedComplement(t *testing.T) {
+	_, ev := evaluate(t, "val a: u8 = 15; val x = ~a;")
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	v, _ := ev.Constant("x")
+	if v.String() != "240" || v.Type != "u8" {
+		t.Errorf("expected u8 240, got %s %s", v.Type, v)
+	}
+}
+
+func TestCharsKeepTheirType(t *testing.T) {
+	program, ev := evaluate(t, "val c = 'a'; val d = c + 1; val e: char = 0x3042;")
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	for i, expected := range []string{"'a'", "'b'", "'あ'"} {
+		val := program.Statements[i].(*ast.ValStatement)
+		v, _ := ev.Constant(val.Names[0].Value)
+		if v.Type != "char" || v.String() != expected {
+			t.Errorf("%s: expected char %s, got %s %s", val.Names[0].Value, expected, v.Type, v)
+		}
+		if _, ok := val.Value.(*ast.CharLiteral); !ok || val.Value.String() != expected {
+			t.Errorf("%s: expected the char literal %s, got %T %s", val.Names[0].Value, expected, val.Value, val.Value)
+		}
+	}
+}
+
+func TestTypedLiterals(t *testing.T) {
+	_, ev := evaluate(t, "val mask = 0xF0u8 | 0b1111; val big = 0xFFFF_FFFF_FFFF_FFFFu64; val f = 1.5f32 * 2;")
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		typ      string
+	}{
+		{"mask", "255", "u8"},
+		{"big", "18446744073709551615", "u64"},
+		{"f", "3", "f32"},
+	}
+	for _, tt := range tests {
+		v, _ := ev.Constant(tt.name)
+		if v.String() != tt.expected || v.Type != tt.typ {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.name, tt.typ, tt.expected, v.Type, v)
+		}
+	}
+}
+
+func TestRuntimeValuesAreNotFolded(t *testing.T) {
+	program, ev := evaluate(t, "val x = read(); val y = x + 1;")
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if _, ok := ev.Constant("y"); ok {
+		t.Errorf("y should not be constant")
+	}
+	val := program.Statements[1].(*ast.ValStatement)
+	if val.Value.String() != "(x + 1)" {
+		t.Errorf("runtime expression was rewritten: %s", val.Value)
+	}
+}
+
+func TestConstDefBuildsTable(t *testing.T) {
+	program, ev := evaluate(t, `const def fact(n: u64): u64 = {
+  var r: u64 = 1;
+  for i in 1..=n { r *= i; };
+  return r;
+};
+const def fib(n: int): int = {
+  if (n < 2) { return n; };
+  return fib(n - 1) + fib(n - 2);
+};
+val table = [fact(0), fact(5), fact(20)];
+val f = fib(15);`)
+
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	fn := program.Statements[0].(*ast.FunctionStatement)
+	if !fn.Const {
+		t.Errorf("fact is not marked const")
+	}
+
+	table := program.Statements[2].(*ast.ValStatement)
+	expected := "[1, 120, 2432902008176640000]"
+	if table.Value.String() != expected {
+		t.Errorf("table not folded. expected=%s, got=%s", expected, table.Value)
+	}
+
+	f, _ := ev.Constant("f")
+	if f.String() != "610" || f.Type != "int" {
+		t.Errorf("expected int 610, got %s %s", f.Type, f)
+	}
+}
+
+func TestConstDefErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`const def fact(n: u64): u64 = {
+  var r: u64 = 1;
+  for i in 1..=n { r *= i; };
+  return r;
+};
+val x = fact(21);`, "overflows u64"},
+		{`const def loop(n: int): int = loop(n)
+val x = loop(1);`, "recursion deeper than"},
+		{`const def spin(n: int): int = {
+  var i = 0;
+  while (true) { i += 1; };
+  return i;
+};
+val x = spin(1);`, "exceeded"},
+		{`const def half(n: int): int = {
+  assert(n % 2 == 0);
+  return n / 2;
+};
+val x = half(3);`, "assertion failed"},
+		{`const def twice(n: int): int = n * 2
+val x = twice(read());`, "is not constant"},
+	}
+
+	for _, tt := range tests {
+		_, ev := evaluate(t, tt.input)
+		errs := ev.Errors()
+		if len(errs) == 0 {
+			t.Errorf("%s: expected error %q", tt.input, tt.err)
+			continue
+		}
+		if !strings.Contains(errs[0], tt.err) {
+			t.Errorf("expected error containing %q, got %q", tt.err, errs[0])
+		}
+	}
+}
+
+func TestTuplesStayTuples(t *testing.T) {
+	program, ev := evaluate(t, `val t = (1, "a");
+val u: (i64, string) = (2, "b");
+val a, b = (3, "c");
+val same = (1, "a") == t;`)
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for i, expected := range []string{`(1, "a")`, `(2, "b")`, `(3, "c")`} {
+		val := program.Statements[i].(*ast.ValStatement)
+		if _, ok := val.Value.(*ast.TupleLiteral); !ok || val.Value.String() != expected {
+			t.Errorf("expected the tuple literal %s, got %T %s", expected, val.Value, val.Value)
+		}
+	}
+	for name, expected := range map[string]string{"u": `(2, "b")`, "b": `"c"`, "same": "true"} {
+		if v, ok := ev.Constant(name); !ok || v.String() != expected {
+			t.Errorf("%s: expected=%s, got=%s", name, expected, v)
+		}
+	}
+}
+
+func TestConstDefStepsPerVal(t *testing.T) {
+	// Each fib(20) takes a fifth of the step budget or more
+	input := `const def fib(n: int): int = {
+  if (n < 2) { return n; };
+  return fib(n - 1) + fib(n - 2);
+};
+`
+	for i := 0; i < 7; i++ {
+		input += fmt.Sprintf("val f%d = fib(20)\n", i)
+	}
+	_, ev := evaluate(t, input)
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if f, _ := ev.Constant("f6"); f.String() != "6765" {
+		t.Errorf("expected f6 = 6765, got %s", f)
+	}
+}
+
+func TestFillStructDefaults(t *testing.T) {
+	program := parse(t, `struct Config {
+  port: u16 = 8080
+  host: string
+  retries: int = MAX_RETRIES * 2
+}
+define MAX_RETRIES = 3
+val a = Config { host: "localhost" };
+val b = Config { retries: 1, port: 80 };`)
+
+	if errs := FillStructDefaults(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	tests := []struct {
+		index    int
+		expected string
+	}{
+		{2, `Config { port: 8080, host: "localhost", retries: (MAX_RETRIES * 2) }`},
+		{3, `Config { port: 80, retries: 1 }`},
+	}
+	for _, tt := range tests {
+		val := program.Statements[tt.index].(*ast.ValStatement)
+		if val.Value.String() != tt.expected {
+			t.Errorf("expected=%s, got=%s", tt.expected, val.Value)
+		}
+	}
+}
+
+func TestFillStructDefaultsErrors(t *testing.T) {
+	program := parse(t, `struct Point { x: int, y: int }
+val p = Point { x: 1, z: 2 };
+val q = Point { x: 1, x: 2 };`)
+
+	errs := FillStructDefaults(program)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	if !strings.Contains(errs[0], "struct Point has no field z") {
+		t.Errorf("wrong error: %s", errs[0])
+	}
+	if !strings.Contains(errs[1], "field x given twice in Point literal") {
+		t.Errorf("wrong error: %s", errs[1])
+	}
+}
+
+func TestStructAndFunctionValues(t *testing.T) {
+	program, ev := evaluate(t, `struct Point { x: int, y: int = 5 }
+const def shift(p: Point, d: int): Point = Point { x: p.x + d, y: p.y }
+const def scale(k: int): int = {
+  val f = def(n: int) = n * k;
+  f(4)
+}
+val a = shift(Point { x: 1 }, 2).x;
+val b = shift(Point { x: 1 }, 2).y;
+val c = scale(10);
+val d = Point { x: 1 } == Point { x: 1, y: 5 };
+val e = (1, "two").1;
+val p = Point { x: 1 };`)
+	if errs := ev.Errors(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	for name, expected := range map[string]string{"a": "3", "b": "5", "c": "40", "d": "true", "e": `"two"`} {
+		v, ok := ev.Constant(name)
+		if !ok || v.String() != expected {
+			t.Errorf("%s: expected=%s, got=%s", name, expected, v)
+		}
+	}
+
+	// Structs are evaluated but not folded into the program
+	if _, ok := ev.Constant("p"); ok {
+		t.Errorf("expected p not to be folded")
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.ValStatement).Value.(*ast.StructLiteral); !ok {
+		t.Errorf("expected the struct literal of p to be kept")
+	}
+
+	fn, err := ev.Eval(parse(t, "def(n: int) = n * 3").Statements[0].(*ast.ExpressionStatement).Expression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ev.Apply(fn, []Value{IntValue(7)}); err != nil || v.String() != "21" {
+		t.Errorf("expected 21, got %s %v", v, err)
+	}
+}
@@ -0,0 +1,64 @@
+package semantic
+
+import (
+	"fmt"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+	"github.com/rxxuzi/sango/pkg/macro"
+)
+
+// FillStructDefaults completes the literals of declared structs. Fields
+// left out of a literal take their declared default, and the fields are put
+// in declaration order. Fields without a default that are left out are zero
+// initialized by C. Unknown and repeated fields are reported.
+func FillStructDefaults(program *ast.Program) []string {
+	structs := map[string]*ast.StructStatement{}
+	for _, stmt := range program.Statements {
+		if s, ok := stmt.(*ast.StructStatement); ok && s != nil && s.Name != nil {
+			structs[s.Name.Value] = s
+		}
+	}
+
+	errors := []string{}
+	macro.Rewrite(program, func(e ast.Expression) ast.Expression {
+		lit, ok := e.(*ast.StructLiteral)
+		if !ok || lit.Name == nil {
+			return e
+		}
+		decl, ok := structs[lit.Name.Value]
+		if !ok {
+			return e
+		}
+
+		given := map[string]*ast.StructField{}
+		for _, f := range lit.Fields {
+			pos := f.Name.Token
+			if decl.Field(f.Name.Value) == nil {
+				errors = append(errors, fmt.Sprintf("struct %s has no field %s at line %d:%d",
+					decl.Name.Value, f.Name.Value, pos.Line, pos.Column))
+				continue
+			}
+			if _, dup := given[f.Name.Value]; dup {
+				errors = append(errors, fmt.Sprintf("field %s given twice in %s literal at line %d:%d",
+					f.Name.Value, decl.Name.Value, pos.Line, pos.Column))
+				continue
+			}
+			given[f.Name.Value] = f
+		}
+
+		fields := make([]*ast.StructField, 0, len(decl.Fields))
+		for _, fd := range decl.Fields {
+			if f, ok := given[fd.Name.Value]; ok {
+				fields = append(fields, f)
+			} else if fd.Default != nil {
+				fields = append(fields, &ast.StructField{
+					Name:  &ast.Identifier{Token: lit.Name.Token, Value: fd.Name.Value},
+					Value: macro.Clone(fd.Default),
+				})
+			}
+		}
+		lit.Fields = fields
+		return lit
+	})
+	return errors
+}
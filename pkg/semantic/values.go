@@ -0,0 +1,222 @@
+package semantic
+
+import (
+	"fmt"
+
+	"github.com/rxxuzi/sango/pkg/ast"
+)
+
+// Builtin is a function written in Go that evaluated code can call. It is
+// given the call and its evaluated arguments.
+type Builtin func(call *ast.CallExpression, args []Value) (Value, error)
+
+// Define makes a builtin callable by name. Builtins are looked up before the
+// functions of the program.
+func (ev *Evaluator) Define(name string, fn Builtin) {
+	ev.builtins[name] = fn
+}
+
+// Struct returns the declaration of a struct type, following type aliases
+func (ev *Evaluator) Struct(name string) (*ast.StructStatement, bool) {
+	for i := 0; i < maxEvalDepth; i++ {
+		if s, ok := ev.layouts.structs[name]; ok {
+			return s, true
+		}
+		alias, ok := ev.layouts.aliases[name]
+		if !ok || alias.Array || alias.Pointer || alias.Name == "" {
+			return nil, false
+		}
+		name = alias.Name
+	}
+	return nil, false
+}
+
+// Alias returns the type a type alias stands for
+func (ev *Evaluator) Alias(name string) (*ast.TypeExpression, bool) {
+	te, ok := ev.layouts.aliases[name]
+	return te, ok
+}
+
+// evalStruct evaluates a struct literal. Fields left out take their default,
+// or the zero value of their type.
+func (ev *Evaluator) evalStruct(n *ast.StructLiteral, env *scope) (Value, error) {
+	if n.Name == nil {
+		return Value{}, ErrNotConstant
+	}
+	decl, ok := ev.Struct(n.Name.Value)
+	if !ok {
+		return Value{}, ErrNotConstant
+	}
+
+	given := map[string]ast.Expression{}
+	for _, f := range n.Fields {
+		given[f.Name.Value] = f.Value
+	}
+	v := Value{Kind: StructConst, Type: decl.Name.Value}
+	for _, f := range decl.Fields {
+		var field Value
+		var err error
+		e, ok := given[f.Name.Value]
+		if !ok {
+			e = f.Default
+		}
+		if e != nil {
+			if field, err = ev.eval(e, env); err == nil {
+				field, err = ev.convert(field, f.Type)
+			}
+		} else {
+			field, err = ev.zero(f.Type)
+		}
+		if err != nil {
+			return Value{}, err
+		}
+		v.Fields = append(v.Fields, f.Name.Value)
+		v.Elems = append(v.Elems, field)
+	}
+	return v, nil
+}
+
+// evalField evaluates s.field on a struct and t.0 on a tuple
+func (ev *Evaluator) evalField(n *ast.InfixExpression, env *scope) (Value, error) {
+	left, err := ev.eval(n.Left, env)
+	if err != nil {
+		return Value{}, err
+	}
+	switch right := n.Right.(type) {
+	case *ast.Identifier:
+		if left.Kind == StructConst {
+			for i, name := range left.Fields {
+				if name == right.Value {
+					return left.Elems[i], nil
+				}
+			}
+			return Value{}, fmt.Errorf("%s has no field %s", left.Type, right.Value)
+		}
+	case *ast.IntegerLiteral:
+		if left.Kind == TupleConst {
+			if right.Value < 0 || right.Value >= int64(len(left.Elems)) {
+				return Value{}, fmt.Errorf("tuple has no field %d", right.Value)
+			}
+			return left.Elems[right.Value], nil
+		}
+	}
+	return Value{}, ErrNotConstant
+}
+
+// convert gives a value the type te like Convert, and also checks structs,
+// tuples, fixed-size arrays and functions against their types
+func (ev *Evaluator) convert(v Value, te *ast.TypeExpression) (Value, error) {
+	mismatch := func() (Value, error) {
+		return v, fmt.Errorf("cannot use %s constant %s as %s", v.Kind, v, te)
+	}
+	switch {
+	case te.Pointer:
+		return mismatch()
+	case te.Function != nil:
+		if v.Kind != FuncConst {
+			return mismatch()
+		}
+		return v, nil
+	case te.Record != nil:
+		return v, nil
+	case len(te.Tuple) > 0:
+		if v.Kind != TupleConst || len(v.Elems) != len(te.Tuple) {
+			return mismatch()
+		}
+		elems := make([]Value, len(v.Elems))
+		for i := range v.Elems {
+			elem, err := ev.convert(v.Elems[i], &te.Tuple[i])
+			if err != nil {
+				return v, fmt.Errorf("field %d: %v", i, err)
+			}
+			elems[i] = elem
+		}
+		return TupleValue(elems), nil
+	case te.Array && te.ElementType != nil:
+		if v.Kind != ArrayConst {
+			return mismatch()
+		}
+		if te.Length != nil {
+			n, err := ev.eval(te.Length, nil)
+			if err != nil || n.Kind != IntConst || n.Int.Cmp(IntValue(int64(len(v.Elems))).Int) != 0 {
+				return mismatch()
+			}
+		}
+		elems := make([]Value, len(v.Elems))
+		for i := range v.Elems {
+			elem, err := ev.convert(v.Elems[i], te.ElementType)
+			if err != nil {
+				return v, fmt.Errorf("element %d: %v", i, err)
+			}
+			elems[i] = elem
+		}
+		return Value{Kind: ArrayConst, Type: te.String(), Elems: elems}, nil
+	}
+
+	if decl, ok := ev.Struct(te.Name); ok {
+		if v.Kind != StructConst || v.Type != decl.Name.Value {
+			return mismatch()
+		}
+		return v, nil
+	}
+	if alias, ok := ev.layouts.aliases[te.Name]; ok {
+		return ev.convert(v, alias)
+	}
+	return Convert(v, te.Name)
+}
+
+// zero returns the zero value of a type, which C gives to the fields a
+// struct literal leaves out
+func (ev *Evaluator) zero(te *ast.TypeExpression) (Value, error) {
+	switch {
+	case te.Pointer, te.Function != nil, te.Record != nil:
+		return Value{}, ErrNotConstant
+	case len(te.Tuple) > 0:
+		elems := make([]Value, len(te.Tuple))
+		for i := range te.Tuple {
+			elem, err := ev.zero(&te.Tuple[i])
+			if err != nil {
+				return Value{}, err
+			}
+			elems[i] = elem
+		}
+		return TupleValue(elems), nil
+	case te.Array:
+		if te.Length == nil {
+			return Value{}, ErrNotConstant
+		}
+		n, err := ev.eval(te.Length, nil)
+		if err != nil || n.Kind != IntConst || !n.Int.IsInt64() {
+			return Value{}, ErrNotConstant
+		}
+		elem, err := ev.zero(te.ElementType)
+		if err != nil {
+			return Value{}, err
+		}
+		elems := make([]Value, n.Int.Int64())
+		for i := range elems {
+			elems[i] = elem
+		}
+		return Value{Kind: ArrayConst, Type: te.String(), Elems: elems}, nil
+	}
+
+	if _, ok := LookupIntType(te.Name); ok {
+		return Convert(IntValue(0), te.Name)
+	}
+	if IsFloatType(te.Name) {
+		return Convert(FloatValue(0), te.Name)
+	}
+	switch te.Name {
+	case "char":
+		return Convert(IntValue(0), "char")
+	case "bool":
+		return BoolValue(false), nil
+	}
+	if decl, ok := ev.Struct(te.Name); ok {
+		return ev.evalStruct(&ast.StructLiteral{Name: decl.Name}, nil)
+	}
+	if alias, ok := ev.layouts.aliases[te.Name]; ok {
+		return ev.zero(alias)
+	}
+	return Value{}, ErrNotConstant
+}
@@ -7,10 +7,8 @@
 // String duplication helper for portability
 static char* sango_strdup(const char* s) {
     size_t len = strlen(s) + 1;
-    char* dup = (char*)malloc(len);
-    if (dup) {
-        memcpy(dup, s, len);
-    }
+    char* dup = (char*)sango_alloc(len);
+    memcpy(dup, s, len);
     return dup;
 }
 
@@ -18,7 +16,7 @@ static char* sango_strdup(const char* s) {
 sango_string sango_string_concat(sango_string s1, sango_string s2) {
     size_t len1 = strlen(s1);
     size_t len2 = strlen(s2);
-    sango_string result = (sango_string)malloc(len1 + len2 + 1);
+    sango_string result = (sango_string)sango_alloc(len1 + len2 + 1);
     strcpy(result, s1);
     strcat(result, s2);
     return result;
@@ -27,7 +25,7 @@ sango_string sango_string_concat(sango_string s1, sango_string s2) {
 sango_string sango_string_repeat(sango_string s, sango_int count) {
     size_t len = strlen(s);
     size_t total_len = len * count;
-    sango_string result = (sango_string)malloc(total_len + 1);
+    sango_string result = (sango_string)sango_alloc(total_len + 1);
     result[0] = '\0';
     for (int i = 0; i < count; i++) {
         strcat(result, s);
@@ -59,6 +57,55 @@ sango_string sango_string_from_double(sango_double d) {
     return sango_strdup(buffer);
 }
 
+sango_string sango_string_from_ulong(uint64_t n) {
+    char buffer[32];
+    snprintf(buffer, sizeof(buffer), "%llu", (unsigned long long)n);
+    return sango_strdup(buffer);
+}
+
+sango_string sango_string_from_bool(sango_bool b) {
+    return sango_strdup(b ? "true" : "false");
+}
+
+// Encodes a character as UTF-8, writing U+FFFD for values that are not
+// Unicode scalar values
+sango_string sango_string_from_char(sango_char c) {
+    if (c > 0x10FFFF || (c >= 0xD800 && c <= 0xDFFF)) {
+        c = 0xFFFD;
+    }
+    char buffer[5] = {0};
+    if (c < 0x80) {
+        buffer[0] = (char)c;
+    } else if (c < 0x800) {
+        buffer[0] = (char)(0xC0 | (c >> 6));
+        buffer[1] = (char)(0x80 | (c & 0x3F));
+    } else if (c < 0x10000) {
+        buffer[0] = (char)(0xE0 | (c >> 12));
+        buffer[1] = (char)(0x80 | ((c >> 6) & 0x3F));
+        buffer[2] = (char)(0x80 | (c & 0x3F));
+    } else {
+        buffer[0] = (char)(0xF0 | (c >> 18));
+        buffer[1] = (char)(0x80 | ((c >> 12) & 0x3F));
+        buffer[2] = (char)(0x80 | ((c >> 6) & 0x3F));
+        buffer[3] = (char)(0x80 | (c & 0x3F));
+    }
+    return sango_strdup(buffer);
+}
+
+// Formats values of interpolated strings with a format spec, as in "${x:.2f}"
+sango_string sango_string_format(const char* format, ...) {
+    va_list args;
+    va_start(args, format);
+    int len = vsnprintf(NULL, 0, format, args);
+    va_end(args);
+
+    sango_string result = (sango_string)sango_alloc(len + 1);
+    va_start(args, format);
+    vsnprintf(result, len + 1, format, args);
+    va_end(args);
+    return result;
+}
+
 sango_int sango_string_to_int(sango_string s) {
     return (sango_int)atoi(s);
 }
@@ -75,6 +122,24 @@ sango_double sango_string_to_double(sango_string s) {
     return (sango_double)atof(s);
 }
 
+// Returns the byte of a string at an index, panicking when it is out of
+// range
+uint8_t sango_string_at(sango_string s, int64_t index) {
+    return (uint8_t)s[sango_index(index, strlen(s))];
+}
+
+// Returns a copy of the bytes of a string from start up to end
+sango_string sango_string_slice(sango_string s, int64_t start, int64_t end) {
+    int64_t len = (int64_t)strlen(s);
+    if (start < 0 || start > end || end > len) {
+        sango_panic("Invalid slice range");
+    }
+    sango_string result = (sango_string)sango_alloc((size_t)(end - start) + 1);
+    memcpy(result, s + start, (size_t)(end - start));
+    result[end - start] = '\0';
+    return result;
+}
+
 // Built-in functions
 void sango_print(const char* format, ...) {
     va_list args;
@@ -113,16 +178,50 @@ void sango_panic(const char* message) {
 }
 
 // Memory management
+uint64_t sango_allocs = 0;
+
+// The arena holds the blocks allocated while it is open, so that a benchmark
+// can free what each iteration allocated. sango_free leaves them to it.
+static void** sango_arena = NULL;
+static size_t sango_arena_length = 0;
+static size_t sango_arena_capacity = 0;
+static int sango_arena_open = 0;
+
 void* sango_alloc(size_t size) {
+    sango_allocs++;
     void* ptr = malloc(size);
     if (!ptr) {
         sango_panic("Out of memory");
     }
+    if (sango_arena_open) {
+        if (sango_arena_length == sango_arena_capacity) {
+            sango_arena_capacity = sango_arena_capacity > 0 ? sango_arena_capacity * 2 : 64;
+            sango_arena = (void**)realloc(sango_arena, sango_arena_capacity * sizeof(void*));
+            if (!sango_arena) {
+                sango_panic("Out of memory");
+            }
+        }
+        sango_arena[sango_arena_length++] = ptr;
+    }
     return ptr;
 }
 
 void sango_free(void* ptr) {
-    free(ptr);
+    if (!sango_arena_open) {
+        free(ptr);
+    }
+}
+
+void sango_arena_begin(void) {
+    sango_arena_open = 1;
+}
+
+void sango_arena_end(void) {
+    for (size_t i = 0; i < sango_arena_length; i++) {
+        free(sango_arena[i]);
+    }
+    sango_arena_length = 0;
+    sango_arena_open = 0;
 }
 
 // Array implementation
@@ -144,11 +243,12 @@ void sango_array_free(sango_array* arr) {
 
 void sango_array_push(sango_array* arr, void* element) {
     if (arr->length >= arr->capacity) {
+        // Not realloc, which would move a block the arena holds
+        void* data = sango_alloc(arr->capacity * 2 * arr->element_size);
+        memcpy(data, arr->data, arr->length * arr->element_size);
+        sango_free(arr->data);
+        arr->data = data;
         arr->capacity *= 2;
-        arr->data = realloc(arr->data, arr->capacity * arr->element_size);
-        if (!arr->data) {
-            sango_panic("Out of memory");
-        }
     }
     memcpy((char*)arr->data + arr->length * arr->element_size, element, arr->element_size);
     arr->length++;
@@ -184,4 +284,23 @@ sango_array* sango_array_concat(sango_array* arr1, sango_array* arr2) {
     memcpy((char*)new_arr->data + arr1->length * arr1->element_size, 
            arr2->data, arr2->length * arr2->element_size);
     return new_arr;
-}
\ No newline at end of file
+}
+
+// Creates an array holding a copy of length elements
+sango_array* sango_array_of(size_t element_size, size_t length, const void* elements) {
+    sango_array* arr = sango_array_new(element_size, length);
+    if (length > 0) {
+        memcpy(arr->data, elements, length * element_size);
+    }
+    arr->length = length;
+    return arr;
+}
+
+// Checks an index of a fixed-size array or string, panicking when it is
+// out of range
+size_t sango_index(int64_t index, size_t length) {
+    if (index < 0 || (uint64_t)index >= length) {
+        sango_panic("Index out of range");
+    }
+    return (size_t)index;
+}
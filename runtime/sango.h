@@ -15,6 +15,7 @@ typedef float sango_float;
 typedef double sango_double;
 typedef bool sango_bool;
 typedef char* sango_string;
+typedef uint32_t sango_char; // a Unicode scalar value
 
 // Array structure definition (moved before function declarations)
 typedef struct {
@@ -31,10 +32,16 @@ sango_string sango_string_from_int(sango_int n);
 sango_string sango_string_from_long(sango_long n);
 sango_string sango_string_from_float(sango_float f);
 sango_string sango_string_from_double(sango_double d);
+sango_string sango_string_from_ulong(uint64_t n);
+sango_string sango_string_from_bool(sango_bool b);
+sango_string sango_string_from_char(sango_char c);
+sango_string sango_string_format(const char* format, ...);
 sango_int sango_string_to_int(sango_string s);
 sango_long sango_string_to_long(sango_string s);
 sango_float sango_string_to_float(sango_string s);
 sango_double sango_string_to_double(sango_string s);
+uint8_t sango_string_at(sango_string s, int64_t index);
+sango_string sango_string_slice(sango_string s, int64_t start, int64_t end);
 
 // Built-in functions
 void sango_print(const char* format, ...);
@@ -45,8 +52,11 @@ void sango_assert(sango_bool condition, const char* message);
 void sango_panic(const char* message) __attribute__((noreturn));
 
 // Memory management helpers
+extern uint64_t sango_allocs;  // blocks sango_alloc has allocated, for benchmarks
 void* sango_alloc(size_t size);
 void sango_free(void* ptr);
+void sango_arena_begin(void);  // record the blocks sango_alloc returns from now on
+void sango_arena_end(void);    // free the blocks recorded since sango_arena_begin
 
 // Array helpers
 sango_array* sango_array_new(size_t element_size, size_t initial_capacity);
@@ -55,5 +65,7 @@ void sango_array_push(sango_array* arr, void* element);
 void* sango_array_get(sango_array* arr, size_t index);
 sango_array* sango_array_slice(sango_array* arr, size_t start, size_t end);
 sango_array* sango_array_concat(sango_array* arr1, sango_array* arr2);
+sango_array* sango_array_of(size_t element_size, size_t length, const void* elements);
+size_t sango_index(int64_t index, size_t length);
 
 #endif // SANGO_H
\ No newline at end of file